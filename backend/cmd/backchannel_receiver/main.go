@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 后端通道注销的本地测试接收端（模拟客户端的 backchannel_logout_uri）
+// 验证授权服务器发来的注销 Token 并打印，用于手动测试 OIDC Back-Channel Logout
+// 用法：go run cmd/backchannel_receiver/main.go -addr :9090 -issuer http://localhost:8080 -client_id test_client_123 [-fail 2]
+// 然后：go run cmd/register_client_logout/main.go -client_id test_client_123 -backchannel_logout_uri http://localhost:9090/backchannel_logout
+
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+func main() {
+	addr := flag.String("addr", ":9090", "监听地址")
+	issuer := flag.String("issuer", "http://localhost:8080", "授权服务器签发者标识")
+	clientID := flag.String("client_id", "test_client_123", "本客户端的ID（注销 Token 的 aud）")
+	fail := flag.Int("fail", 0, "前 N 次请求返回 500（用于测试授权服务器的重试）")
+	flag.Parse()
+
+	receiver := &receiver{issuer: *issuer, clientID: *clientID, fail: *fail, seen: map[string]bool{}}
+	http.HandleFunc("/backchannel_logout", receiver.handle)
+	log.Printf("后端通道注销接收端启动在 %s/backchannel_logout", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+type receiver struct {
+	issuer   string
+	clientID string
+
+	mu   sync.Mutex
+	fail int             // 剩余需要模拟失败的次数
+	seen map[string]bool // 已处理的 jti（防重放）
+}
+
+func (r *receiver) handle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 1. 模拟客户端暂时不可用
+	r.mu.Lock()
+	if r.fail > 0 {
+		r.fail--
+		r.mu.Unlock()
+		log.Printf("模拟失败，返回 500")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.mu.Unlock()
+
+	// 2. 验证注销 Token
+	claims, err := r.verify(req.PostFormValue("logout_token"))
+	if err != nil {
+		log.Printf("❌ 无效的注销 Token: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	// 3. 真实的客户端在这里结束 sid 对应的本地会话
+	log.Printf("✅ 收到注销通知: sub=%v sid=%v jti=%v", claims["sub"], claims["sid"], claims["jti"])
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// verify 按照 Back-Channel Logout 2.6 验证注销 Token
+func (r *receiver) verify(logoutToken string) (jwt.MapClaims, error) {
+	if logoutToken == "" {
+		return nil, errors.New("缺少 logout_token")
+	}
+	token, err := jwt.Parse(logoutToken, r.publicKey,
+		jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(r.issuer), jwt.WithAudience(r.clientID), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	if token.Header["typ"] != "logout+jwt" {
+		return nil, errors.New("typ 必须是 logout+jwt")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[backchannelLogoutEvent]; !ok {
+		return nil, errors.New("缺少 backchannel-logout 事件")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, errors.New("注销 Token 不能包含 nonce")
+	}
+	if claims["sid"] == nil && claims["sub"] == nil {
+		return nil, errors.New("缺少 sid 或 sub")
+	}
+	jti, _ := claims["jti"].(string)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if jti == "" || r.seen[jti] {
+		return nil, errors.New("jti 缺失或重复")
+	}
+	r.seen[jti] = true
+	return claims, nil
+}
+
+// publicKey 从授权服务器的 JWKS 端点获取 kid 对应的公钥
+func (r *receiver) publicKey(token *jwt.Token) (interface{}, error) {
+	resp, err := http.Get(r.issuer + "/.well-known/jwks.json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+	for _, key := range jwks.Keys {
+		if key.Kid != token.Header["kid"] {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("JWKS 中没有 kid=%v 的公钥", token.Header["kid"])
+}
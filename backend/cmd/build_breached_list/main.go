@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 生成按 SHA-1 前 5 位拆分的已泄露密码目录（PASSWORD_BREACHED_LIST 使用）
+// 输入每行一个 "SHA1[:次数]"（Have I Been Pwned 格式）或明文密码（-plain）
+// 用法：go run cmd/build_breached_list/main.go -in pwned-passwords-sha1.txt -out ./data/breached
+//
+//	go run cmd/build_breached_list/main.go -plain -in common-passwords.txt -out ./data/breached
+func main() {
+	in := flag.String("in", "", "输入文件")
+	out := flag.String("out", "", "输出目录")
+	plain := flag.Bool("plain", false, "输入为明文密码（每行一个）")
+	flag.Parse()
+
+	// 1. 校验参数
+	if *in == "" || *out == "" {
+		log.Fatal("必须指定 -in 和 -out")
+	}
+	input, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("打开输入文件失败: %v", err)
+	}
+	defer input.Close()
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("创建输出目录失败: %v", err)
+	}
+
+	// 2. 逐行写入对应前缀的范围文件
+	// HIBP 的文件按哈希排序，同一前缀的行连续出现，只需保持一个文件打开
+	w := &rangeWriter{dir: *out, seen: map[string]bool{}}
+	defer w.close()
+	var total, skipped int
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, count := line, ""
+		if *plain {
+			sum := sha1.Sum([]byte(strings.TrimSuffix(scanner.Text(), "\r")))
+			hash = hex.EncodeToString(sum[:])
+		} else {
+			hash, count, _ = strings.Cut(line, ":")
+		}
+		hash = strings.ToUpper(strings.TrimSpace(hash))
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			skipped++
+			continue
+		}
+		entry := hash[5:]
+		if count != "" {
+			entry += ":" + strings.TrimSpace(count)
+		}
+		if err := w.write(hash[:5], entry); err != nil {
+			log.Fatalf("写入失败: %v", err)
+		}
+		total++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("读取输入文件失败: %v", err)
+	}
+
+	fmt.Printf("✅ 已写入 %d 条记录，%d 个前缀文件（跳过 %d 行无效数据）: %s\n", total, len(w.seen), skipped, *out)
+}
+
+// rangeWriter 按前缀写入范围文件
+type rangeWriter struct {
+	dir    string
+	seen   map[string]bool // 本次已写入的前缀（首次写入时清空旧文件）
+	prefix string
+	file   *os.File
+	buf    *bufio.Writer
+}
+
+func (w *rangeWriter) write(prefix, entry string) error {
+	if prefix != w.prefix {
+		if err := w.close(); err != nil {
+			return err
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if !w.seen[prefix] {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		}
+		file, err := os.OpenFile(filepath.Join(w.dir, prefix), flags, 0o644)
+		if err != nil {
+			return err
+		}
+		w.prefix, w.file, w.buf = prefix, file, bufio.NewWriter(file)
+		w.seen[prefix] = true
+	}
+	_, err := w.buf.WriteString(entry + "\n")
+	return err
+}
+
+func (w *rangeWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.prefix, w.file, w.buf = "", nil, nil
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+)
+
+// 创建第一个管理员（或为已有用户授予角色），之后可以由管理员通过管理接口分配角色
+// 用法：go run cmd/create_admin/main.go -email admin@example.com -password '...' -name Admin
+//
+//	go run cmd/create_admin/main.go -email ops@example.com -role support
+//	go run cmd/create_admin/main.go -email ops@example.com -role support -revoke
+func main() {
+	email := flag.String("email", "", "用户邮箱（不存在时创建用户）")
+	password := flag.String("password", "", "创建用户时的密码")
+	name := flag.String("name", "", "创建用户时的用户名")
+	role := flag.String("role", service.RoleAdmin, "授予的角色")
+	revoke := flag.Bool("revoke", false, "撤销角色")
+	flag.Parse()
+
+	// 1. 校验参数
+	if *email == "" {
+		log.Fatal("必须指定 -email")
+	}
+
+	// 2. 加载配置
+	cfg := config.Load()
+
+	// 3. 初始化数据库
+	if err := database.Initialize(cfg.Database.Path); err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer database.Close()
+
+	// 4. 自动迁移数据库表结构，创建内置角色
+	if err := database.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.AuditEvent{}); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+	if err := service.EnsureBuiltinRoles(); err != nil {
+		log.Fatalf("初始化内置角色失败: %v", err)
+	}
+
+	// 5. 查询用户，不存在时使用指定的密码创建（邮箱视为已验证）
+	authService := service.NewAuthService(cfg.JWT.Secret, cfg.JWT.ExpireHours, cfg.OAuth.Issuer)
+	var user models.User
+	if err := database.DB.Where("LOWER(email) = ?", strings.ToLower(*email)).First(&user).Error; err != nil {
+		if *revoke || *password == "" {
+			log.Fatalf("用户不存在: %s（创建用户需要指定 -password）", *email)
+		}
+		created, err := authService.Register(service.RegisterRequest{Email: *email, Password: *password, Name: *name})
+		if err != nil {
+			log.Fatalf("创建用户失败: %v", err)
+		}
+		if err := database.DB.Model(created).Updates(map[string]interface{}{"email_verified": true, "email_verified_at": time.Now()}).Error; err != nil {
+			log.Fatalf("保存用户失败: %v", err)
+		}
+		user = *created
+		log.Printf("已创建用户 %s", user.Email)
+	}
+
+	// 6. 授予或撤销角色
+	if *revoke {
+		if err := authService.RevokeRole(user.ID, *role, service.AuditContext{}); err != nil {
+			log.Fatalf("撤销角色失败: %v", err)
+		}
+	} else if err := authService.AssignRole(user.ID, *role, service.AuditContext{}); err != nil {
+		log.Fatalf("授予角色失败: %v", err)
+	}
+
+	roles, err := authService.UserRoleNames(user.ID)
+	if err != nil {
+		log.Fatalf("查询角色失败: %v", err)
+	}
+	log.Println("✅ 用户角色已更新！")
+	log.Printf("Email: %s", user.Email)
+	log.Printf("Roles: %s", strings.Join(roles, " "))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// 登记授权详情类型及其 JSON Schema（RFC 9396）
+// 用法：go run cmd/register_authorization_detail_type/main.go -type payment_approval -schema payment_approval.json -description "付款审批"
+func main() {
+	detailType := flag.String("type", "", "授权详情类型（authorization_details 中的 type 字段）")
+	schemaFile := flag.String("schema", "", "JSON Schema 文件路径")
+	description := flag.String("description", "", "类型说明（展示在授权确认页面）")
+	flag.Parse()
+
+	// 1. 校验参数
+	if *detailType == "" || *schemaFile == "" {
+		log.Fatal("必须指定 -type 和 -schema")
+	}
+	schema, err := os.ReadFile(*schemaFile)
+	if err != nil {
+		log.Fatalf("读取 Schema 文件失败: %v", err)
+	}
+	if !json.Valid(schema) {
+		log.Fatalf("Schema 文件不是有效的 JSON: %s", *schemaFile)
+	}
+
+	// 2. 加载配置
+	cfg := config.Load()
+
+	// 3. 初始化数据库
+	if err := database.Initialize(cfg.Database.Path); err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer database.Close()
+
+	// 4. 自动迁移数据库表结构
+	if err := database.AutoMigrate(&models.AuthorizationDetailType{}); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+
+	// 5. 创建或更新类型
+	var registered models.AuthorizationDetailType
+	database.DB.Where("type = ?", *detailType).First(&registered)
+	registered.Type = *detailType
+	registered.Description = *description
+	registered.Schema = string(schema)
+	if err := database.DB.Save(&registered).Error; err != nil {
+		log.Fatalf("保存授权详情类型失败: %v", err)
+	}
+
+	log.Println("✅ 授权详情类型登记成功！")
+	log.Printf("Type: %s", registered.Type)
+	log.Printf("Description: %s", registered.Description)
+}
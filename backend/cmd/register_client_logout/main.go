@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+)
+
+// 配置客户端的退出登录地址（OIDC RP-Initiated / Front-Channel / Back-Channel Logout）
+// 用法：go run cmd/register_client_logout/main.go -client_id test_client_123 \
+//
+//	-post_logout_redirect_uris "http://localhost:3000/" -backchannel_logout_uri http://localhost:9090/backchannel_logout
+func main() {
+	clientID := flag.String("client_id", "", "客户端ID")
+	postLogoutRedirectURIs := flag.String("post_logout_redirect_uris", "", "退出后允许重定向的地址（空格分隔）")
+	frontchannelURI := flag.String("frontchannel_logout_uri", "", "前端通道注销地址（在退出页面通过 iframe 加载）")
+	backchannelURI := flag.String("backchannel_logout_uri", "", "后端通道注销地址（接收 POST 的 logout_token）")
+	flag.Parse()
+
+	// 1. 校验参数
+	if *clientID == "" {
+		log.Fatal("必须指定 -client_id")
+	}
+	uris := strings.Fields(*postLogoutRedirectURIs)
+	for _, uri := range append(uris, *frontchannelURI) {
+		if uri == "" {
+			continue
+		}
+		if err := service.ValidateClientURI(uri); err != nil {
+			log.Fatalf("地址无效: %v", err)
+		}
+	}
+	if *backchannelURI != "" {
+		if parsed, err := url.Parse(*backchannelURI); err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			log.Fatalf("地址必须是不含片段的绝对 URI: %q", *backchannelURI)
+		}
+		// 本地开发可以登记内网地址，但服务器只有在 BACKCHANNEL_LOGOUT_ALLOW_PRIVATE=true 时才会发送
+		if err := service.ValidateBackchannelLogoutURI(*backchannelURI); err != nil {
+			log.Printf("⚠️  %v，需要设置 BACKCHANNEL_LOGOUT_ALLOW_PRIVATE=true 才会发送通知", err)
+		}
+	}
+
+	// 2. 加载配置
+	cfg := config.Load()
+
+	// 3. 初始化数据库
+	if err := database.Initialize(cfg.Database.Path); err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer database.Close()
+
+	// 4. 自动迁移数据库表结构
+	if err := database.AutoMigrate(&models.OAuthClient{}); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+
+	// 5. 更新客户端
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", *clientID).First(&client).Error; err != nil {
+		log.Fatalf("客户端不存在: %s", *clientID)
+	}
+	client.PostLogoutRedirectURIs = strings.Join(uris, " ")
+	client.FrontchannelLogoutURI = *frontchannelURI
+	client.BackchannelLogoutURI = *backchannelURI
+	if err := database.DB.Save(&client).Error; err != nil {
+		log.Fatalf("保存客户端失败: %v", err)
+	}
+
+	log.Println("✅ 客户端退出登录地址配置成功！")
+	log.Printf("Client ID: %s", client.ClientID)
+	log.Printf("Post Logout Redirect URIs: %s", client.PostLogoutRedirectURIs)
+	log.Printf("Front-Channel Logout URI: %s", client.FrontchannelLogoutURI)
+	log.Printf("Back-Channel Logout URI: %s", client.BackchannelLogoutURI)
+}
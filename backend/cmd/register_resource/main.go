@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// 登记受保护资源（RFC 8707）
+// 用法：go run cmd/register_resource/main.go -identifier https://api.example.com -name "示例 API" -scopes "read write"
+func main() {
+	identifier := flag.String("identifier", "", "资源标识（绝对 URI，即 Token 的 aud）")
+	name := flag.String("name", "", "资源名称")
+	scopes := flag.String("scopes", "", "资源允许的权限范围（空格分隔）")
+	flag.Parse()
+
+	// 1. 校验参数
+	parsed, err := url.Parse(*identifier)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+		log.Fatalf("资源标识必须是不含片段的绝对 URI: %q", *identifier)
+	}
+	if *name == "" {
+		*name = *identifier
+	}
+
+	// 2. 加载配置
+	cfg := config.Load()
+
+	// 3. 初始化数据库
+	if err := database.Initialize(cfg.Database.Path); err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer database.Close()
+
+	// 4. 自动迁移数据库表结构
+	if err := database.AutoMigrate(&models.ProtectedResource{}); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+
+	// 5. 创建或更新资源
+	var resource models.ProtectedResource
+	database.DB.Where("identifier = ?", *identifier).First(&resource)
+	resource.Identifier = *identifier
+	resource.Name = *name
+	resource.Scopes = strings.Join(strings.Fields(*scopes), " ")
+	if err := database.DB.Save(&resource).Error; err != nil {
+		log.Fatalf("保存资源失败: %v", err)
+	}
+
+	log.Println("✅ 受保护资源登记成功！")
+	log.Printf("Identifier: %s", resource.Identifier)
+	log.Printf("Name: %s", resource.Name)
+	log.Printf("Scopes: %s", resource.Scopes)
+}
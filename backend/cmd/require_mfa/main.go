@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// 要求账户必须启用两步验证（如员工账户），未启用的账户下次登录时需要先设置验证器
+// 用法：go run cmd/require_mfa/main.go -email admin@example.com
+//
+//	go run cmd/require_mfa/main.go -email admin@example.com -off
+func main() {
+	email := flag.String("email", "", "用户邮箱")
+	off := flag.Bool("off", false, "取消强制两步验证")
+	flag.Parse()
+
+	// 1. 校验参数
+	if *email == "" {
+		log.Fatal("必须指定 -email")
+	}
+
+	// 2. 加载配置
+	cfg := config.Load()
+
+	// 3. 初始化数据库
+	if err := database.Initialize(cfg.Database.Path); err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer database.Close()
+
+	// 4. 自动迁移数据库表结构
+	if err := database.AutoMigrate(&models.User{}); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+
+	// 5. 更新用户
+	var user models.User
+	if err := database.DB.Where("LOWER(email) = ?", strings.ToLower(*email)).First(&user).Error; err != nil {
+		log.Fatalf("用户不存在: %s", *email)
+	}
+	if err := database.DB.Model(&user).Update("mfa_required", !*off).Error; err != nil {
+		log.Fatalf("保存用户失败: %v", err)
+	}
+
+	log.Println("✅ 用户两步验证要求已更新！")
+	log.Printf("Email: %s", user.Email)
+	log.Printf("MFA Required: %t", !*off)
+	log.Printf("MFA Enabled: %t", user.MFAEnabled())
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"time"
 
 	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/handlers"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/middleware"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/web"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -30,15 +38,53 @@ func main() {
 		&models.User{},
 		&models.OAuthClient{},
 		&models.AuthorizationCode{},
+		&models.DeviceCode{},
 		&models.AccessToken{},
+		&models.ProtectedResource{},
+		&models.AuthorizationDetailType{},
+		&models.Consent{},
+		&models.Session{},
+		&models.VerificationToken{},
+		&models.AuditEvent{},
+		&models.LoginThrottle{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.EmailLogin{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.ClientCollaborator{},
+		&models.ClientInvitation{},
 	); err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
+	if err := service.EnsureBuiltinRoles(); err != nil {
+		log.Fatalf("初始化内置角色失败: %v", err)
+	}
 
 	// 4. 初始化 Gin 路由
 	router := setupRouter(cfg)
 
-	// 5. 启动服务器
+	// 5. 启动 HTTPS 服务器（可选，请求客户端证书以支持双向 TLS 客户端认证）
+	if cfg.TLS.Enabled() {
+		tlsServer := &http.Server{
+			Addr:    ":" + cfg.TLS.Port,
+			Handler: router,
+			TLSConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				// 只请求不强制校验：tls_client_auth 和 self_signed_tls_client_auth 在服务层校验证书
+				ClientAuth: tls.RequestClientCert,
+			},
+		}
+		go func() {
+			log.Printf("🔒 HTTPS 服务器启动在 https://localhost%s", tlsServer.Addr)
+			if err := tlsServer.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTPS 服务器启动失败: %v", err)
+			}
+		}()
+	}
+
+	// 6. 启动服务器
 	addr := ":" + cfg.Server.Port
 	log.Printf("🚀 服务器启动在 http://localhost%s", addr)
 	if err := router.Run(addr); err != nil {
@@ -53,12 +99,22 @@ func setupRouter(cfg *config.Config) *gin.Engine {
 
 	router := gin.Default()
 
+	// 只信任配置的反向代理转发的 X-Forwarded-For（默认不信任，使用连接的对端地址）
+	// 否则客户端可以伪造 IP，绕过按 IP 的失败锁定和发送频率限制
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("可信代理配置无效: %v", err)
+	}
+	// X-Forwarded-Proto 同样只信任这些代理（决定 DPoP 的 htu 和 Cookie 的 Secure 属性）
+	if err := service.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("可信代理配置无效: %v", err)
+	}
+
 	// 配置 CORS（允许前端跨域访问）
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"}, // 允许的前端地址
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "DPoP", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Content-Length", "WWW-Authenticate"},
 		AllowCredentials: true,
 	}))
 
@@ -70,24 +126,122 @@ func setupRouter(cfg *config.Config) *gin.Engine {
 	})
 
 	// 初始化服务层
-	authService := service.NewAuthService(cfg.JWT.Secret, cfg.JWT.ExpireHours)
-	oauthService := service.NewOAuthService(cfg.JWT.Secret, cfg.JWT.ExpireHours)
+	authService := service.NewAuthService(cfg.JWT.Secret, cfg.JWT.ExpireHours, cfg.OAuth.Issuer)
+	oauthService := service.NewOAuthService(cfg.JWT.Secret, cfg.JWT.ExpireHours, cfg.OAuth.Issuer)
+	if cfg.TLS.ClientCAFile != "" {
+		clientCAs, err := loadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			log.Fatalf("加载客户端 CA 证书失败: %v", err)
+		}
+		oauthService.EnableMutualTLS(clientCAs)
+	}
+	signingKey, err := loadSigningKey(cfg.OAuth.SigningKeyFile)
+	if err != nil {
+		log.Fatalf("加载签名密钥失败: %v", err)
+	}
+	oauthService.SetSigningKey(signingKey)
+	authService.SetLogoutNotifier(oauthService) // 会话结束时通知客户端（后端通道注销）
+	oauthService.SetBackchannelAllowPrivate(cfg.OAuth.BackchannelAllowPrivate)
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("初始化邮件发送失败: %v", err)
+	}
+	authService.SetMailer(mailer)
+	oauthService.SetMailer(mailer)
+	oauthService.SetDeveloperPolicy(service.DeveloperPolicy{
+		RequireApproval: cfg.Developer.ClientApproval,
+		MaxClients:      cfg.Developer.MaxClients,
+	})
+	if err := authService.SetEmailVerification(cfg.Auth.EmailVerification); err != nil {
+		log.Fatalf("邮箱验证配置无效: %v", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(cfg.Password)
+	if err != nil {
+		log.Fatalf("加载密码策略失败: %v", err)
+	}
+	authService.SetPasswordPolicy(passwordPolicy)
+	passwordHasher, err := newPasswordHasher(cfg.Password)
+	if err != nil {
+		log.Fatalf("密码哈希配置无效: %v", err)
+	}
+	if err := authService.SetPasswordHasher(passwordHasher); err != nil {
+		log.Fatalf("密码哈希配置无效: %v", err)
+	}
+	throttle := newThrottle(cfg.Throttle)
+	authService.SetThrottle(throttle)
+	oauthService.SetThrottle(throttle)
+	authService.SetWebAuthn(newWebAuthnConfig(cfg))
 
 	// 初始化处理器
 	authHandler := handlers.NewAuthHandler(authService)
-	oauthHandler := handlers.NewOAuthHandler(oauthService, authService)
+	oauthHandler := handlers.NewOAuthHandler(oauthService, authService, cfg.OAuth.LoginURL, cfg.OAuth.ConsentURL)
+	renderer, err := web.NewRenderer(cfg.Web.TemplateDirs)
+	if err != nil {
+		log.Fatalf("加载页面模板失败: %v", err)
+	}
+	pageHandler := handlers.NewPageHandler(oauthHandler, renderer)
+	adminHandler := handlers.NewAdminHandler(authService, oauthService)
+	developerHandler := handlers.NewDeveloperHandler(oauthService)
+
+	// 授权服务器元数据（RFC 8414 / OIDC Discovery）和签名公钥
+	router.GET("/.well-known/oauth-authorization-server", oauthHandler.Metadata)
+	router.GET("/.well-known/openid-configuration", oauthHandler.Metadata)
+	router.GET("/.well-known/jwks.json", oauthHandler.JWKS)
 
 	// OAuth 路由组（OAuth 2.0 授权服务器）
 	oauth := router.Group("/oauth")
 	{
-		// 授权端点（需要用户登录）
-		oauth.GET("/authorize", middleware.JWTAuth(authService), oauthHandler.Authorize)
+		// 授权确认信息（供授权确认页面展示客户端和请求的权限）
+		oauth.GET("/consent", oauthHandler.Consent)
+
+		// 授权确认（用户在授权确认页面同意或拒绝）
+		oauth.POST("/consent", middleware.OptionalJWTAuth(authService), oauthHandler.ConsentDecision)
+
+		// 授权端点（登录状态由处理器根据 prompt / max_age 判断，支持浏览器会话 Cookie）
+		oauth.GET("/authorize", middleware.OptionalJWTAuth(authService), oauthHandler.Authorize)
 
 		// Token 端点（公开，但需要客户端密钥）
 		oauth.POST("/token", oauthHandler.Token)
 
-		// 用户信息端点（需要 Access Token）
-		oauth.GET("/userinfo", oauthHandler.UserInfo)
+		// 设备授权端点（RFC 8628，需要客户端认证）
+		oauth.POST("/device_authorization", oauthHandler.DeviceAuthorization)
+
+		// Token 内省端点（RFC 7662，需要客户端认证）
+		oauth.POST("/introspect", oauthHandler.Introspect)
+
+		// 用户信息端点（需要 Access Token，支持 DPoP 绑定的 Token）
+		oauth.GET("/userinfo", middleware.OAuthTokenAuth(oauthService, ""), oauthHandler.UserInfo)
+
+		// 退出登录端点（OIDC RP-Initiated Logout，POST 转为 GET 处理）
+		oauth.GET("/end_session", middleware.OptionalJWTAuth(authService), pageHandler.EndSession)
+		oauth.POST("/end_session", pageHandler.EndSession)
+	}
+
+	// 托管页面（不依赖前端应用的登录、注册、授权确认等页面，通过会话 Cookie 识别用户，表单提交校验 CSRF Token）
+	pages := router.Group("", middleware.OptionalJWTAuth(authService))
+	{
+		pages.GET("/login", pageHandler.LoginPage)
+		pages.POST("/login", pageHandler.Login)
+		pages.POST("/login/mfa", pageHandler.LoginMFA)
+		pages.GET("/login/email", pageHandler.EmailLoginPage)
+		pages.POST("/login/email", pageHandler.EmailLogin)
+		pages.POST("/login/email/send", pageHandler.EmailLoginSend)
+		pages.GET("/register", pageHandler.RegisterPage)
+		pages.POST("/register", pageHandler.Register)
+		pages.GET("/consent", pageHandler.ConsentPage)
+		pages.POST("/consent", pageHandler.ConsentSubmit)
+		pages.GET("/device", pageHandler.DevicePage)
+		pages.POST("/device", pageHandler.DeviceSubmit)
+		pages.GET("/verify-email", pageHandler.VerifyEmailPage)
+		pages.POST("/verify-email", pageHandler.VerifyEmail)
+		pages.POST("/verify-email/resend", pageHandler.ResendVerification)
+		pages.GET("/forgot-password", pageHandler.ForgotPasswordPage)
+		pages.POST("/forgot-password", pageHandler.ForgotPassword)
+		pages.GET("/reset-password", pageHandler.ResetPasswordPage)
+		pages.POST("/reset-password", pageHandler.ResetPassword)
+		pages.GET("/logout", pageHandler.LogoutPage)
+		pages.POST("/logout", pageHandler.Logout)
+		pages.GET("/error", pageHandler.ErrorPage)
 	}
 
 	// API 路由组
@@ -99,11 +253,212 @@ func setupRouter(cfg *config.Config) *gin.Engine {
 			// 公开接口（无需认证）
 			auth.POST("/register", authHandler.Register) // 用户注册
 			auth.POST("/login", authHandler.Login)       // 用户登录
+			auth.GET("/csrf", authHandler.CSRFToken)     // 获取 CSRF Token（cookie 模式使用）
+
+			// 邮箱验证（重新发送时，已登录发送给当前用户，未登录按邮箱发送）
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", middleware.OptionalJWTAuth(authService), authHandler.ResendVerification)
+
+			// 两步验证：登录第二步，以及设置验证器（已登录，或登录时要求先启用两步验证的 MFA 令牌）
+			auth.POST("/mfa/verify", authHandler.VerifyMFA)
+			auth.POST("/mfa/totp/setup", middleware.OptionalJWTAuth(authService), authHandler.SetupTOTP)
+			auth.POST("/mfa/webauthn/options", authHandler.PasskeyMFAOptions)
+			auth.POST("/mfa/webauthn", authHandler.PasskeyMFA)
+
+			// 通行密钥无密码登录
+			auth.POST("/webauthn/login/options", authHandler.PasskeyLoginOptions)
+			auth.POST("/webauthn/login", authHandler.PasskeyLogin)
+
+			// 邮件登录（登录链接或六位验证码，需要在同一浏览器中完成）
+			auth.POST("/email-login", authHandler.StartEmailLogin)
+			auth.POST("/email-login/verify", authHandler.VerifyEmailLogin)
+
+			// 忘记密码（无论邮箱是否注册都返回相同结果）和重置密码
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
 
 			// 受保护接口（需要认证）
-			auth.GET("/me", middleware.JWTAuth(authService), authHandler.GetCurrentUser) // 获取当前用户信息
+			auth.GET("/me", middleware.JWTAuth(authService), authHandler.GetCurrentUser)             // 获取当前用户信息
+			auth.POST("/logout", middleware.JWTAuth(authService), authHandler.Logout)                // 退出当前会话
+			auth.POST("/logout/all", middleware.JWTAuth(authService), authHandler.LogoutAll)         // 在所有设备上退出登录
+			auth.GET("/sessions", middleware.JWTAuth(authService), authHandler.ListSessions)         // 列出登录会话
+			auth.DELETE("/sessions/:id", middleware.JWTAuth(authService), authHandler.RevokeSession) // 撤销指定会话
+			auth.PUT("/password", middleware.JWTAuth(authService), authHandler.ChangePassword)       // 修改密码
+			auth.PATCH("/profile", middleware.JWTAuth(authService), authHandler.UpdateProfile)       // 修改用户名、邮箱
+
+			// 两步验证管理（需要认证）
+			auth.POST("/mfa/totp/confirm", middleware.JWTAuth(authService), authHandler.ConfirmTOTP)               // 确认验证码，启用两步验证
+			auth.DELETE("/mfa/totp", middleware.JWTAuth(authService), authHandler.DisableTOTP)                     // 关闭两步验证
+			auth.POST("/mfa/recovery-codes", middleware.JWTAuth(authService), authHandler.RegenerateRecoveryCodes) // 重新生成恢复码
+			auth.POST("/step-up", middleware.JWTAuth(authService), authHandler.StepUp)                             // 提升当前会话的认证级别（acr_values）
+
+			// 通行密钥管理（需要认证）
+			auth.POST("/webauthn/register/options", middleware.JWTAuth(authService), authHandler.PasskeyRegistrationOptions) // 获取注册选项
+			auth.POST("/webauthn/register", middleware.JWTAuth(authService), authHandler.RegisterPasskey)                    // 注册通行密钥
+			auth.GET("/webauthn/credentials", middleware.JWTAuth(authService), authHandler.ListPasskeys)                     // 列出通行密钥
+			auth.DELETE("/webauthn/credentials/:id", middleware.JWTAuth(authService), authHandler.DeletePasskey)             // 删除通行密钥
+		}
+
+		// 管理接口（需要 ADMIN_API_TOKEN，或拥有相应权限的用户）
+		admin := api.Group("/admin", middleware.AdminAuth(cfg.Admin.APIToken, authService))
+		{
+			manageLockouts := middleware.RequirePermission(authService, service.PermissionLockoutsManage)
+			admin.GET("/lockouts", manageLockouts, adminHandler.ListLockouts)        // 列出认证失败计数和锁定状态
+			admin.DELETE("/lockouts/:id", manageLockouts, adminHandler.Unlock)       // 解除锁定
+			admin.POST("/users/:id/unlock", manageLockouts, adminHandler.UnlockUser) // 解除用户账户的锁定
+
+			// 用户管理
+			readUsers := middleware.RequirePermission(authService, service.PermissionUsersRead)
+			writeUsers := middleware.RequirePermission(authService, service.PermissionUsersWrite)
+			admin.GET("/roles", readUsers, adminHandler.ListRoles)                                // 列出角色和权限
+			admin.GET("/users", readUsers, adminHandler.ListUsers)                                // 分页列出、搜索用户
+			admin.GET("/users/:id", readUsers, adminHandler.GetUser)                              // 用户详情
+			admin.POST("/users/:id/disable", writeUsers, adminHandler.DisableUser)                // 停用账户
+			admin.POST("/users/:id/enable", writeUsers, adminHandler.EnableUser)                  // 重新启用账户
+			admin.POST("/users/:id/reset-password", writeUsers, adminHandler.ForcePasswordReset)  // 要求重置密码
+			admin.POST("/users/:id/revoke-sessions", writeUsers, adminHandler.RevokeUserSessions) // 撤销所有会话和 Token
+			admin.PUT("/users/:id/roles", writeUsers, adminHandler.SetUserRoles)                  // 设置角色
+			admin.DELETE("/users/:id", writeUsers, adminHandler.DeleteUser)                       // 删除用户（?hard=true 永久删除）
+			admin.POST("/users/:id/restore", writeUsers, adminHandler.RestoreUser)                // 恢复已删除的用户
+
+			// OAuth 客户端管理
+			readClients := middleware.RequirePermission(authService, service.PermissionClientsRead)
+			writeClients := middleware.RequirePermission(authService, service.PermissionClientsWrite)
+			admin.GET("/clients", readClients, adminHandler.ListClients)                                // 分页列出、搜索客户端
+			admin.POST("/clients", writeClients, adminHandler.CreateClient)                             // 创建客户端
+			admin.GET("/clients/:client_id", readClients, adminHandler.GetClient)                       // 客户端配置
+			admin.PUT("/clients/:client_id", writeClients, adminHandler.UpdateClient)                   // 修改客户端配置
+			admin.DELETE("/clients/:client_id", writeClients, adminHandler.DeleteClient)                // 删除客户端
+			admin.POST("/clients/:client_id/secret", writeClients, adminHandler.RegenerateClientSecret) // 重新生成密钥
+			admin.POST("/clients/:client_id/disable", writeClients, adminHandler.DisableClient)         // 停用客户端
+			admin.POST("/clients/:client_id/enable", writeClients, adminHandler.EnableClient)           // 重新启用客户端
+			admin.GET("/clients/:client_id/tokens", readClients, adminHandler.ListClientTokens)         // 有效的 Access Token
+			admin.GET("/clients/:client_id/consents", readClients, adminHandler.ListClientConsents)     // 授权过的用户
+			admin.POST("/clients/:client_id/approve", writeClients, adminHandler.ApproveClient)         // 审核通过
+			admin.POST("/clients/:client_id/reject", writeClients, adminHandler.RejectClient)           // 审核不通过
+		}
+
+		// 开发者接口（登录用户自助注册和管理自己的 OAuth 客户端）
+		developer := api.Group("/developer", middleware.JWTAuth(authService))
+		{
+			developer.GET("/clients", developerHandler.ListClients)                                             // 拥有或参与协作的客户端
+			developer.POST("/clients", developerHandler.CreateClient)                                           // 创建客户端（需要验证邮箱）
+			developer.GET("/clients/:client_id", developerHandler.GetClient)                                    // 客户端配置
+			developer.PUT("/clients/:client_id", developerHandler.UpdateClient)                                 // 修改客户端配置
+			developer.DELETE("/clients/:client_id", developerHandler.DeleteClient)                              // 删除客户端（所有者）
+			developer.POST("/clients/:client_id/secret", developerHandler.RegenerateClientSecret)               // 重新生成密钥
+			developer.GET("/clients/:client_id/members", developerHandler.ListMembers)                          // 所有者、协作者和待接受的邀请
+			developer.POST("/clients/:client_id/invitations", developerHandler.InviteCollaborator)              // 邀请协作者
+			developer.DELETE("/clients/:client_id/invitations/:id", developerHandler.CancelInvitation)          // 撤回邀请
+			developer.DELETE("/clients/:client_id/collaborators/:user_id", developerHandler.RemoveCollaborator) // 移除协作者或退出协作
+			developer.POST("/clients/:client_id/owner", developerHandler.TransferOwnership)                     // 转让所有权（所有者）
+			developer.GET("/invitations", developerHandler.ListInvitations)                                     // 收到的协作邀请
+			developer.POST("/invitations/:id/accept", developerHandler.AcceptInvitation)                        // 接受邀请
+			developer.DELETE("/invitations/:id", developerHandler.DeclineInvitation)                            // 拒绝邀请
 		}
 	}
 
 	return router
 }
+
+// loadSigningKey 加载 ID Token 签名密钥，未配置时生成临时密钥
+func loadSigningKey(path string) (*service.SigningKey, error) {
+	if path != "" {
+		return service.LoadSigningKey(path)
+	}
+	log.Printf("⚠️  未配置 OIDC_SIGNING_KEY_FILE，使用临时签名密钥（重启后之前签发的 ID Token 将无法验证）")
+	return service.GenerateSigningKey()
+}
+
+// newMailer 根据配置创建邮件发送器
+func newMailer(cfg config.MailConfig) (mail.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case "file":
+		return mail.NewFileMailer(cfg.OutboxDir, cfg.From), nil
+	case "log":
+		return mail.NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件发送方式: %s", cfg.Driver)
+	}
+}
+
+// newPasswordPolicy 根据配置创建密码策略
+func newPasswordPolicy(cfg config.PasswordConfig) (*service.PasswordPolicy, error) {
+	policy := &service.PasswordPolicy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireUppercase: cfg.RequireUppercase,
+		RequireLowercase: cfg.RequireLowercase,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+		DisallowPersonal: cfg.DisallowPersonal,
+	}
+	if cfg.BreachedList != "" {
+		breached, err := service.LoadBreachedPasswords(cfg.BreachedList)
+		if err != nil {
+			return nil, fmt.Errorf("加载已泄露密码列表失败: %w", err)
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// newPasswordHasher 根据配置创建密码哈希器
+func newPasswordHasher(cfg config.PasswordConfig) (*service.PasswordHasher, error) {
+	if cfg.Argon2Memory <= 0 || cfg.Argon2Iterations <= 0 || cfg.Argon2Parallelism <= 0 || cfg.Argon2Parallelism > 255 {
+		return nil, fmt.Errorf("argon2id 参数无效: m=%d, t=%d, p=%d", cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	}
+	hasher := service.DefaultPasswordHasher()
+	hasher.Algorithm = cfg.HashAlgorithm
+	hasher.BcryptCost = cfg.BcryptCost
+	hasher.Argon2.Memory = uint32(cfg.Argon2Memory)
+	hasher.Argon2.Iterations = uint32(cfg.Argon2Iterations)
+	hasher.Argon2.Parallelism = uint8(cfg.Argon2Parallelism)
+	return hasher, nil
+}
+
+// newThrottle 根据配置创建认证失败计数器
+func newThrottle(cfg config.ThrottleConfig) *service.Throttle {
+	rule := func(maxFailures int) service.ThrottleRule {
+		return service.ThrottleRule{
+			MaxFailures: maxFailures,
+			BaseDelay:   time.Duration(cfg.LockoutSeconds) * time.Second,
+			MaxDelay:    time.Duration(cfg.MaxLockoutSeconds) * time.Second,
+			Window:      time.Duration(cfg.MaxLockoutSeconds) * time.Second,
+		}
+	}
+	return service.NewThrottle(map[string]service.ThrottleRule{
+		models.ThrottleKindAccount: rule(cfg.MaxAccountFailures),
+		models.ThrottleKindIP:      rule(cfg.MaxIPFailures),
+		models.ThrottleKindClient:  rule(cfg.MaxClientFailures),
+	})
+}
+
+// newWebAuthnConfig 根据配置创建通行密钥的依赖方配置
+// 托管页面（授权服务器）和前端登录页所在的来源总是允许使用通行密钥
+func newWebAuthnConfig(cfg *config.Config) service.WebAuthnConfig {
+	origins := []string{cfg.OAuth.Issuer}
+	if loginURL, err := url.Parse(cfg.OAuth.LoginURL); err == nil && loginURL.IsAbs() {
+		origins = append(origins, loginURL.Scheme+"://"+loginURL.Host)
+	}
+	return service.WebAuthnConfig{
+		RPID:    cfg.WebAuthn.RPID,
+		RPName:  cfg.WebAuthn.RPName,
+		Origins: append(origins, cfg.WebAuthn.Origins...),
+	}
+}
+
+// loadCertPool 从 PEM 文件加载证书池
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("%s 中没有有效的证书", path)
+	}
+	return pool, nil
+}
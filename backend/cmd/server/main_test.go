@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/config"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetupRouterTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { service.SetTrustedProxies(nil) })
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		wantIP         string
+	}{
+		{name: "默认不信任 X-Forwarded-For", remoteAddr: "198.51.100.7:5000", wantIP: "198.51.100.7"},
+		{name: "对端不是可信代理", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "198.51.100.7:5000", wantIP: "198.51.100.7"},
+		{name: "可信代理转发的请求", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:5000", wantIP: "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Load()
+			cfg.Server.TrustedProxies = tt.trustedProxies
+			router := setupRouter(cfg)
+			router.GET("/test/client-ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+			req := httptest.NewRequest(http.MethodGet, "/test/client-ip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.wantIP {
+				t.Fatalf("客户端 IP = %s，期望 %s", got, tt.wantIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+// 软件认证器：在命令行模拟通行密钥（ES256），用于手动测试 WebAuthn 注册和登录
+// 凭证（私钥、凭证ID、用户句柄、签名计数）保存在 -key 指定的文件中
+// 用法：
+//
+//	go run cmd/soft_authenticator/main.go -register -email user@example.com -password 'xxx'   # 登录后注册通行密钥
+//	go run cmd/soft_authenticator/main.go -login                                               # 无密码登录
+//	go run cmd/soft_authenticator/main.go -mfa -email user@example.com -password 'xxx'        # 密码 + 通行密钥两步验证
+func main() {
+	server := flag.String("server", "http://localhost:8080", "授权服务器地址")
+	origin := flag.String("origin", "", "页面来源（默认与 -server 相同）")
+	rpID := flag.String("rp_id", "localhost", "依赖方标识（WEBAUTHN_RP_ID）")
+	keyFile := flag.String("key", "./data/soft_authenticator.json", "凭证文件")
+	email := flag.String("email", "", "用户邮箱（-register、-mfa 使用）")
+	password := flag.String("password", "", "用户密码（-register、-mfa 使用）")
+	code := flag.String("code", "", "注册时账户已启用两步验证所需的验证码")
+	register := flag.Bool("register", false, "注册通行密钥")
+	login := flag.Bool("login", false, "使用通行密钥无密码登录")
+	mfa := flag.Bool("mfa", false, "使用密码登录，通行密钥完成两步验证")
+	noUV := flag.Bool("no_uv", false, "不设置用户验证（UV）标志")
+	flag.Parse()
+
+	if *origin == "" {
+		*origin = *server
+	}
+	a := &authenticator{server: *server, origin: *origin, rpID: *rpID, keyFile: *keyFile, userVerified: !*noUV}
+
+	switch {
+	case *register:
+		token := a.passwordLogin(*email, *password, *code)
+		a.register(token)
+	case *login:
+		a.load()
+		a.assert("/api/auth/webauthn/login/options", "/api/auth/webauthn/login", map[string]interface{}{})
+	case *mfa:
+		a.load()
+		mfaToken := a.passwordMFAToken(*email, *password)
+		a.assert("/api/auth/mfa/webauthn/options", "/api/auth/mfa/webauthn", map[string]interface{}{"mfa_token": mfaToken})
+	default:
+		log.Fatal("必须指定 -register、-login 或 -mfa")
+	}
+}
+
+// credentialFile 凭证文件内容
+type credentialFile struct {
+	CredentialID string `json:"credential_id"` // Base64URL
+	PrivateKey   string `json:"private_key"`   // PKCS#8 DER，Base64
+	UserHandle   string `json:"user_handle"`   // Base64URL
+	SignCount    uint32 `json:"sign_count"`
+}
+
+type authenticator struct {
+	server       string
+	origin       string
+	rpID         string
+	keyFile      string
+	userVerified bool
+
+	credential credentialFile
+	key        *ecdsa.PrivateKey
+}
+
+// passwordLogin 使用密码登录，返回 JWT（账户启用了两步验证时使用 -code 完成第二步）
+func (a *authenticator) passwordLogin(email, password, code string) string {
+	resp := a.post("/api/auth/login", "", map[string]interface{}{"email": email, "password": password})
+	if mfaRequired, _ := resp["mfa_required"].(bool); mfaRequired {
+		if code == "" {
+			log.Fatal("账户已启用两步验证，请使用 -code 提供验证码")
+		}
+		resp = a.post("/api/auth/mfa/verify", "", map[string]interface{}{"mfa_token": resp["mfa_token"], "code": code})
+	}
+	token, _ := resp["token"].(string)
+	return token
+}
+
+// passwordMFAToken 使用密码登录，返回第二步验证的 MFA 令牌
+func (a *authenticator) passwordMFAToken(email, password string) string {
+	resp := a.post("/api/auth/login", "", map[string]interface{}{"email": email, "password": password})
+	mfaToken, _ := resp["mfa_token"].(string)
+	if mfaToken == "" {
+		log.Fatal("登录不需要两步验证")
+	}
+	log.Printf("可用的两步验证方式: %v", resp["mfa_methods"])
+	return mfaToken
+}
+
+// register 生成密钥对并完成注册仪式（attestation 格式为 none）
+func (a *authenticator) register(token string) {
+	// 1. 获取注册选项
+	options := a.post("/api/auth/webauthn/register/options", token, map[string]interface{}{})
+	challenge, _ := options["challenge"].(string)
+	user, _ := options["user"].(map[string]interface{})
+	userHandle, _ := user["id"].(string)
+
+	// 2. 生成密钥对和凭证ID
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("生成密钥失败: %v", err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		log.Fatalf("生成凭证ID失败: %v", err)
+	}
+
+	// 3. 认证器数据：rpIdHash | flags | signCount | aaguid | credIdLen | credId | COSE 公钥
+	coseKey := cborMap(
+		[]interface{}{int64(1), int64(2)},  // kty: EC2
+		[]interface{}{int64(3), int64(-7)}, // alg: ES256
+		[]interface{}{int64(-1), int64(1)}, // crv: P-256
+		[]interface{}{int64(-2), pad32(key.X.Bytes())},
+		[]interface{}{int64(-3), pad32(key.Y.Bytes())},
+	)
+	attested := make([]byte, 16) // aaguid 全为 0（软件认证器）
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(credentialID)))
+	attested = append(append(attested, credentialID...), coseKey...)
+	authData := a.authenticatorData(0x40|0x04, 0, attested) // AT、UV
+
+	attestationObject := cborMap(
+		[]interface{}{"fmt", "none"},
+		[]interface{}{"attStmt", cborMap()},
+		[]interface{}{"authData", authData},
+	)
+	clientData := a.clientData("webauthn.create", challenge)
+
+	// 4. 提交注册结果
+	resp := a.post("/api/auth/webauthn/register", token, map[string]interface{}{
+		"name": "软件认证器",
+		"credential": map[string]interface{}{
+			"id":   b64(credentialID),
+			"type": "public-key",
+			"response": map[string]interface{}{
+				"clientDataJSON":    b64(clientData),
+				"attestationObject": b64(attestationObject),
+				"transports":        []string{"internal"},
+			},
+		},
+	})
+	log.Printf("通行密钥已注册: %v", resp)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		log.Fatalf("保存私钥失败: %v", err)
+	}
+	a.credential = credentialFile{
+		CredentialID: b64(credentialID),
+		PrivateKey:   base64.StdEncoding.EncodeToString(der),
+		UserHandle:   userHandle,
+	}
+	a.save()
+}
+
+// assert 获取选项并对挑战签名，提交到 finishPath（body 为额外的请求字段）
+func (a *authenticator) assert(optionsPath, finishPath string, body map[string]interface{}) {
+	// 1. 获取选项
+	options := a.post(optionsPath, "", body)
+	challenge, _ := options["challenge"].(string)
+
+	// 2. 签名计数加一，对 authenticatorData || SHA-256(clientDataJSON) 签名
+	a.credential.SignCount++
+	flags := byte(0x01) // UP
+	if a.userVerified {
+		flags |= 0x04 // UV
+	}
+	authData := a.authenticatorData(flags, a.credential.SignCount, nil)
+	clientData := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		log.Fatalf("签名失败: %v", err)
+	}
+	a.save()
+
+	// 3. 提交签名结果
+	body["credential"] = map[string]interface{}{
+		"id":   a.credential.CredentialID,
+		"type": "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        a.credential.UserHandle,
+		},
+	}
+	resp := a.post(finishPath, "", body)
+	log.Printf("✅ 登录成功: %v", resp)
+}
+
+// authenticatorData 生成认证器数据
+func (a *authenticator) authenticatorData(flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags|0x01) // 总是设置 UP
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+// clientData 生成浏览器的 clientDataJSON
+func (a *authenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// post 发送 JSON 请求并返回响应的 data 字段，失败时退出
+func (a *authenticator) post(path, token string, body interface{}) map[string]interface{} {
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, a.server+path, bytes.NewReader(payload))
+	if err != nil {
+		log.Fatalf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("请求 %s 失败: %v", path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var result struct {
+		Success bool                   `json:"success"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil || !result.Success {
+		log.Fatalf("请求 %s 失败（%d）: %s", path, resp.StatusCode, raw)
+	}
+	return result.Data
+}
+
+// load 读取凭证文件
+func (a *authenticator) load() {
+	raw, err := os.ReadFile(a.keyFile)
+	if err != nil {
+		log.Fatalf("读取凭证文件失败（请先 -register）: %v", err)
+	}
+	if err := json.Unmarshal(raw, &a.credential); err != nil {
+		log.Fatalf("解析凭证文件失败: %v", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(a.credential.PrivateKey)
+	if err != nil {
+		log.Fatalf("解析私钥失败: %v", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		log.Fatalf("解析私钥失败: %v", err)
+	}
+	var ok bool
+	if a.key, ok = key.(*ecdsa.PrivateKey); !ok {
+		log.Fatal("私钥不是 ECDSA 密钥")
+	}
+}
+
+// save 保存凭证文件（每次签名后更新签名计数）
+func (a *authenticator) save() {
+	raw, _ := json.MarshalIndent(a.credential, "", "  ")
+	if err := os.WriteFile(a.keyFile, raw, 0o600); err != nil {
+		log.Fatalf("保存凭证文件失败: %v", err)
+	}
+}
+
+// cborRaw 已编码的 CBOR 数据（作为映射的值时原样写入）
+type cborRaw []byte
+
+// cborMap 按给定顺序编码 CBOR 映射（每项为 [键, 值]）
+func cborMap(entries ...[]interface{}) cborRaw {
+	out := cborRaw(cborHead(5, uint64(len(entries))))
+	for _, entry := range entries {
+		out = append(out, cborValue(entry[0])...)
+		out = append(out, cborValue(entry[1])...)
+	}
+	return out
+}
+
+// cborValue 编码整数、字节串、文本和已编码的数据
+func cborValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborRaw:
+		return v
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	}
+	panic(fmt.Sprintf("不支持的 CBOR 类型 %T", value))
+}
+
+// cborHead 编码类型和长度
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+// pad32 左侧补零到 32 字节（P-256 坐标）
+func pad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -3,18 +3,43 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
+	Server    ServerConfig
+	TLS       TLSConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	OAuth     OAuthConfig
+	Web       WebConfig
+	Auth      AuthConfig
+	Mail      MailConfig
+	Password  PasswordConfig
+	Throttle  ThrottleConfig
+	Admin     AdminConfig
+	WebAuthn  WebAuthnConfig
+	Developer DeveloperConfig
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port string // 服务器端口
+	Port           string   // 服务器端口
+	TrustedProxies []string // 可信的反向代理（IP 或 CIDR），只信任它们转发的 X-Forwarded-For / X-Forwarded-Proto
+}
+
+// TLSConfig HTTPS 监听配置（可选，用于双向 TLS 客户端认证）
+type TLSConfig struct {
+	Port         string // HTTPS 端口
+	CertFile     string // 服务器证书文件
+	KeyFile      string // 服务器私钥文件
+	ClientCAFile string // 签发客户端证书的 CA 文件（tls_client_auth 使用）
+}
+
+// Enabled 是否启用 HTTPS 监听
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
 }
 
 // DatabaseConfig 数据库配置
@@ -28,11 +53,94 @@ type JWTConfig struct {
 	ExpireHours int    // Token 过期时间（小时）
 }
 
+// OAuthConfig OAuth 授权服务器配置
+type OAuthConfig struct {
+	Issuer         string // 授权服务器的签发者标识（对外访问的基础 URL，不以 / 结尾）
+	LoginURL       string // 登录页地址（授权端点需要用户登录时跳转到这里）
+	ConsentURL     string // 授权确认页地址（需要用户确认授权时跳转到这里）
+	SigningKeyFile string // ID Token 签名私钥文件（RSA PEM，未配置时每次启动生成临时密钥）
+
+	BackchannelAllowPrivate bool // 允许向回环、私有地址发送后端通道注销通知（只用于本地开发）
+}
+
+// WebConfig 托管页面配置
+type WebConfig struct {
+	TemplateDirs []string // 覆盖内置页面模板的目录（按顺序查找同名模板文件）
+}
+
+// AuthConfig 用户认证配置
+type AuthConfig struct {
+	EmailVerification string // 邮箱验证要求：optional（不要求）、authorize（验证前不能授权第三方应用）、login（验证前不能登录）
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver       string // 发送方式：smtp、file（写入 OutboxDir）、log（打印到日志）
+	From         string // 发件人
+	SMTPHost     string // SMTP 服务器
+	SMTPPort     int    // SMTP 端口
+	SMTPUsername string // SMTP 用户名（为空时不认证）
+	SMTPPassword string // SMTP 密码
+	OutboxDir    string // file 方式的邮件输出目录
+}
+
+// PasswordConfig 密码策略配置
+type PasswordConfig struct {
+	MinLength        int    // 最少字符数
+	MaxLength        int    // 最多字节数（bcrypt 只使用前 72 字节，超过 72 按 72 处理）
+	RequireUppercase bool   // 必须包含大写字母
+	RequireLowercase bool   // 必须包含小写字母
+	RequireDigit     bool   // 必须包含数字
+	RequireSymbol    bool   // 必须包含特殊字符
+	DisallowPersonal bool   // 不能包含邮箱或用户名
+	BreachedList     string // 已泄露密码列表（SHA-1 文件或按前缀拆分的目录，为空时不检查）
+
+	HashAlgorithm     string // 新密码使用的哈希算法：argon2id 或 bcrypt（登录时旧哈希自动升级）
+	BcryptCost        int    // bcrypt 的 cost
+	Argon2Memory      int    // argon2id 内存（KiB）
+	Argon2Iterations  int    // argon2id 迭代次数
+	Argon2Parallelism int    // argon2id 并行度
+}
+
+// ThrottleConfig 认证失败锁定配置（连续失败达到次数后锁定，之后每次失败锁定时间翻倍）
+type ThrottleConfig struct {
+	MaxAccountFailures int // 同一账户（邮箱）连续失败次数（0 表示不限制）
+	MaxIPFailures      int // 同一 IP 连续失败次数（登录和客户端认证合计）
+	MaxClientFailures  int // 同一 OAuth 客户端连续认证失败次数
+	LockoutSeconds     int // 第一次锁定的秒数
+	MaxLockoutSeconds  int // 锁定时长上限（秒），也是失败计数清零的时间
+}
+
+// AdminConfig 管理接口配置
+type AdminConfig struct {
+	APIToken string // 管理接口的 Bearer 令牌（为空时不启用管理接口）
+}
+
+// WebAuthnConfig 通行密钥（WebAuthn）配置
+type WebAuthnConfig struct {
+	RPID    string   // 依赖方标识（网站的域名，通行密钥绑定到该域名及其子域名）
+	RPName  string   // 依赖方名称（认证器中显示）
+	Origins []string // 额外允许使用通行密钥的页面来源（授权服务器和登录页的来源总是允许）
+}
+
+// DeveloperConfig 开发者自助注册客户端配置
+type DeveloperConfig struct {
+	ClientApproval bool // 开发者创建的客户端需要管理员审核通过后才能使用
+	MaxClients     int  // 每个用户最多拥有的客户端数量（0 表示不限制）
+}
+
 // Load 加载配置，支持环境变量覆盖
 func Load() *Config {
 	config := &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"), // 默认端口 8080
+			Port:           getEnv("PORT", "8080"),          // 默认端口 8080
+			TrustedProxies: getEnvAsList("TRUSTED_PROXIES"), // 默认不信任任何代理
+		},
+		TLS: TLSConfig{
+			Port:         getEnv("TLS_PORT", "8443"),  // 默认 HTTPS 端口 8443
+			CertFile:     getEnv("TLS_CERT_FILE", ""), // 未配置证书时不启用 HTTPS
+			KeyFile:      getEnv("TLS_KEY_FILE", ""),
+			ClientCAFile: getEnv("TLS_CLIENT_CA_FILE", ""),
 		},
 		Database: DatabaseConfig{
 			Path: getEnv("DATABASE_PATH", "./data/shadow.db"), // 默认数据库路径
@@ -41,6 +149,64 @@ func Load() *Config {
 			Secret:      getEnv("JWT_SECRET", "your-secret-key-change-in-production"), // 默认密钥（生产环境必须修改）
 			ExpireHours: getEnvAsInt("JWT_EXPIRE_HOURS", 24),                          // 默认 24 小时
 		},
+		OAuth: OAuthConfig{
+			Issuer:         strings.TrimSuffix(getEnv("OAUTH_ISSUER", "http://localhost:8080"), "/"), // 默认本地地址（生产环境必须修改）
+			LoginURL:       getEnv("OAUTH_LOGIN_URL", "http://localhost:3000/login"),                 // 默认前端登录页
+			ConsentURL:     getEnv("OAUTH_CONSENT_URL", "http://localhost:3000/oauth/authorize"),     // 默认前端授权确认页
+			SigningKeyFile: getEnv("OIDC_SIGNING_KEY_FILE", ""),
+
+			BackchannelAllowPrivate: getEnvAsBool("BACKCHANNEL_LOGOUT_ALLOW_PRIVATE", false),
+		},
+		Web: WebConfig{
+			TemplateDirs: getEnvAsList("WEB_TEMPLATE_DIRS"), // 默认只使用内置模板
+		},
+		Auth: AuthConfig{
+			EmailVerification: getEnv("EMAIL_VERIFICATION", "optional"), // 默认不要求验证邮箱
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"), // 默认打印到日志
+			From:         getEnv("MAIL_FROM", "Shadow OAuth <no-reply@localhost>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			OutboxDir:    getEnv("MAIL_OUTBOX_DIR", "./data/outbox"),
+		},
+		Password: PasswordConfig{
+			MinLength:        getEnvAsInt("PASSWORD_MIN_LENGTH", 8), // 默认至少 8 个字符
+			MaxLength:        getEnvAsInt("PASSWORD_MAX_LENGTH", 72),
+			RequireUppercase: getEnvAsBool("PASSWORD_REQUIRE_UPPERCASE", false),
+			RequireLowercase: getEnvAsBool("PASSWORD_REQUIRE_LOWERCASE", false),
+			RequireDigit:     getEnvAsBool("PASSWORD_REQUIRE_DIGIT", false),
+			RequireSymbol:    getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+			DisallowPersonal: getEnvAsBool("PASSWORD_DISALLOW_PERSONAL", true),
+			BreachedList:     getEnv("PASSWORD_BREACHED_LIST", ""),
+
+			HashAlgorithm:     getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 10),
+			Argon2Memory:      getEnvAsInt("ARGON2_MEMORY_KIB", 19456), // 默认 19 MiB
+			Argon2Iterations:  getEnvAsInt("ARGON2_ITERATIONS", 2),
+			Argon2Parallelism: getEnvAsInt("ARGON2_PARALLELISM", 1),
+		},
+		Throttle: ThrottleConfig{
+			MaxAccountFailures: getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+			MaxIPFailures:      getEnvAsInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+			MaxClientFailures:  getEnvAsInt("CLIENT_AUTH_MAX_FAILURES", 10),
+			LockoutSeconds:     getEnvAsInt("LOCKOUT_SECONDS", 60),       // 默认 1 分钟
+			MaxLockoutSeconds:  getEnvAsInt("MAX_LOCKOUT_SECONDS", 3600), // 默认 1 小时
+		},
+		Admin: AdminConfig{
+			APIToken: getEnv("ADMIN_API_TOKEN", ""), // 默认不启用管理接口
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:    getEnv("WEBAUTHN_RP_ID", "localhost"), // 默认本地地址（生产环境必须修改）
+			RPName:  getEnv("WEBAUTHN_RP_NAME", "Shadow OAuth"),
+			Origins: getEnvAsList("WEBAUTHN_ORIGINS"),
+		},
+		Developer: DeveloperConfig{
+			ClientApproval: getEnvAsBool("DEVELOPER_CLIENT_APPROVAL", false), // 默认创建后立即可用
+			MaxClients:     getEnvAsInt("DEVELOPER_MAX_CLIENTS", 10),
+		},
 	}
 
 	return config
@@ -63,3 +229,21 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool 获取环境变量并转换为布尔值，如果不存在或转换失败则返回默认值
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsList 获取以逗号分隔的环境变量列表，忽略空项
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
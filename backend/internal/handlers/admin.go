@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler 管理接口处理器
+type AdminHandler struct {
+	authService  *service.AuthService
+	oauthService *service.OAuthService
+}
+
+// NewAdminHandler 创建管理接口处理器实例
+func NewAdminHandler(authService *service.AuthService, oauthService *service.OAuthService) *AdminHandler {
+	return &AdminHandler{authService: authService, oauthService: oauthService}
+}
+
+// ListLockouts 列出认证失败计数和锁定状态
+// GET /api/admin/lockouts
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	records, err := h.authService.Lockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", records))
+}
+
+// Unlock 解除锁定并清零失败计数（账户、IP 或客户端）
+// DELETE /api/admin/lockouts/:id
+func (h *AdminHandler) Unlock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("解除锁定失败", service.ErrLockoutNotFound))
+		return
+	}
+	record, err := h.authService.Unlock(uint(id), adminAuditContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrLockoutNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse("解除锁定失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("解除锁定失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已解除锁定", record))
+}
+
+// UnlockUser 解除用户账户的锁定
+// POST /api/admin/users/:id/unlock
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("解除锁定失败", service.ErrUserNotFound))
+		return
+	}
+	if err := h.authService.UnlockUser(uint(id), adminAuditContext(c)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse("解除锁定失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("解除锁定失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已解除锁定", nil))
+}
+
+// ListRoles 列出角色和权限
+// GET /api/admin/roles
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.authService.Roles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", roles))
+}
+
+// adminAuditContext 管理操作的审计信息（使用管理令牌时操作者为 0）
+func adminAuditContext(c *gin.Context) service.AuditContext {
+	return service.AuditContext{ActorID: c.GetUint("userID"), SessionInfo: sessionInfo(c)}
+}
+
+// ListUsers 分页列出用户
+// GET /api/admin/users?q=&status=&role=&page=&page_size=
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var req service.UserListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	list, err := h.authService.ListUsers(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", list))
+}
+
+// GetUser 获取用户详情（角色、会话、通行密钥、已授权的客户端）
+// GET /api/admin/users/:id
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	id, ok := adminUserID(c, "获取失败")
+	if !ok {
+		return
+	}
+	detail, err := h.authService.GetUserDetail(id)
+	if err != nil {
+		abortAdminUserError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", detail))
+}
+
+// DisableUser 停用账户（撤销所有会话和 Token）
+// POST /api/admin/users/:id/disable
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	id, ok := adminUserID(c, "停用失败")
+	if !ok {
+		return
+	}
+	user, err := h.authService.DisableUser(id, adminAuditContext(c))
+	if err != nil {
+		abortAdminUserError(c, "停用失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("账户已停用", user.ToAdminResponse()))
+}
+
+// EnableUser 重新启用账户
+// POST /api/admin/users/:id/enable
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	id, ok := adminUserID(c, "启用失败")
+	if !ok {
+		return
+	}
+	user, err := h.authService.EnableUser(id, adminAuditContext(c))
+	if err != nil {
+		abortAdminUserError(c, "启用失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("账户已启用", user.ToAdminResponse()))
+}
+
+// ForcePasswordReset 要求用户重置密码（发送重置邮件，撤销所有会话和 Token）
+// POST /api/admin/users/:id/reset-password
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	id, ok := adminUserID(c, "操作失败")
+	if !ok {
+		return
+	}
+	if err := h.authService.ForcePasswordReset(id, adminAuditContext(c)); err != nil {
+		abortAdminUserError(c, "操作失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已要求用户重置密码", nil))
+}
+
+// RevokeUserSessions 撤销用户的所有会话和 Token
+// POST /api/admin/users/:id/revoke-sessions
+func (h *AdminHandler) RevokeUserSessions(c *gin.Context) {
+	id, ok := adminUserID(c, "撤销失败")
+	if !ok {
+		return
+	}
+	if err := h.authService.RevokeUserCredentials(id, adminAuditContext(c)); err != nil {
+		abortAdminUserError(c, "撤销失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已撤销所有会话和 Token", nil))
+}
+
+// SetUserRoles 设置用户的角色
+// PUT /api/admin/users/:id/roles
+func (h *AdminHandler) SetUserRoles(c *gin.Context) {
+	id, ok := adminUserID(c, "修改角色失败")
+	if !ok {
+		return
+	}
+	var req service.SetUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	roles, err := h.authService.SetUserRoles(id, req, adminAuditContext(c))
+	if err != nil {
+		abortAdminUserError(c, "修改角色失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("角色已更新", gin.H{"roles": roles}))
+}
+
+// DeleteUser 删除用户（默认软删除，?hard=true 时永久删除用户及关联数据）
+// DELETE /api/admin/users/:id
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	id, ok := adminUserID(c, "删除失败")
+	if !ok {
+		return
+	}
+	hard := c.Query("hard") == "true"
+	if err := h.authService.DeleteUser(id, hard, adminAuditContext(c)); err != nil {
+		abortAdminUserError(c, "删除失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("用户已删除", nil))
+}
+
+// RestoreUser 恢复软删除的用户
+// POST /api/admin/users/:id/restore
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	id, ok := adminUserID(c, "恢复失败")
+	if !ok {
+		return
+	}
+	user, err := h.authService.RestoreUser(id, adminAuditContext(c))
+	if err != nil {
+		abortAdminUserError(c, "恢复失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("用户已恢复", user.ToAdminResponse()))
+}
+
+// adminUserID 解析路径中的用户ID，无效时返回 404
+func adminUserID(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(message, service.ErrUserNotFound))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// abortAdminUserError 根据用户管理操作的错误类型返回对应的状态码
+func abortAdminUserError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrRoleNotFound), errors.Is(err, service.ErrCannotModifySelf):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse(message, err))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(message, err))
+	}
+}
+
+// ListClients 分页列出 OAuth 客户端
+// GET /api/admin/clients?q=&status=&page=&page_size=
+func (h *AdminHandler) ListClients(c *gin.Context) {
+	var req service.ClientListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	list, err := h.oauthService.ListClients(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", list))
+}
+
+// CreateClient 创建 OAuth 客户端（密钥只在响应中返回这一次）
+// POST /api/admin/clients
+func (h *AdminHandler) CreateClient(c *gin.Context) {
+	var req service.ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	result, err := h.oauthService.CreateClient(req)
+	if err != nil {
+		abortAdminClientError(c, "创建失败", err)
+		return
+	}
+	c.JSON(http.StatusCreated, models.SuccessResponse("客户端已创建", result))
+}
+
+// GetClient 获取客户端配置
+// GET /api/admin/clients/:client_id
+func (h *AdminHandler) GetClient(c *gin.Context) {
+	client, err := h.oauthService.GetClient(c.Param("client_id"))
+	if err != nil {
+		abortAdminClientError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", client))
+}
+
+// UpdateClient 修改客户端配置（整体替换）
+// PUT /api/admin/clients/:client_id
+func (h *AdminHandler) UpdateClient(c *gin.Context) {
+	var req service.ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	client, err := h.oauthService.UpdateClient(c.Param("client_id"), req)
+	if err != nil {
+		abortAdminClientError(c, "修改失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已更新", client))
+}
+
+// DeleteClient 删除客户端（撤销 Token 和用户的授权记录）
+// DELETE /api/admin/clients/:client_id
+func (h *AdminHandler) DeleteClient(c *gin.Context) {
+	if err := h.oauthService.DeleteClient(c.Param("client_id")); err != nil {
+		abortAdminClientError(c, "删除失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已删除", nil))
+}
+
+// RegenerateClientSecret 重新生成客户端密钥
+// POST /api/admin/clients/:client_id/secret
+func (h *AdminHandler) RegenerateClientSecret(c *gin.Context) {
+	result, err := h.oauthService.RegenerateClientSecret(c.Param("client_id"))
+	if err != nil {
+		abortAdminClientError(c, "生成密钥失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("密钥已重新生成", result))
+}
+
+// DisableClient 停用客户端（撤销 Token 和未使用的授权码）
+// POST /api/admin/clients/:client_id/disable
+func (h *AdminHandler) DisableClient(c *gin.Context) {
+	client, err := h.oauthService.SetClientDisabled(c.Param("client_id"), true)
+	if err != nil {
+		abortAdminClientError(c, "停用失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已停用", client))
+}
+
+// EnableClient 重新启用客户端
+// POST /api/admin/clients/:client_id/enable
+func (h *AdminHandler) EnableClient(c *gin.Context) {
+	client, err := h.oauthService.SetClientDisabled(c.Param("client_id"), false)
+	if err != nil {
+		abortAdminClientError(c, "启用失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已启用", client))
+}
+
+// ListClientTokens 列出客户端持有的有效 Access Token
+// GET /api/admin/clients/:client_id/tokens
+func (h *AdminHandler) ListClientTokens(c *gin.Context) {
+	tokens, err := h.oauthService.ClientTokens(c.Param("client_id"))
+	if err != nil {
+		abortAdminClientError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", tokens))
+}
+
+// ListClientConsents 列出对客户端授权过的用户
+// GET /api/admin/clients/:client_id/consents
+func (h *AdminHandler) ListClientConsents(c *gin.Context) {
+	consents, err := h.oauthService.ClientConsents(c.Param("client_id"))
+	if err != nil {
+		abortAdminClientError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", consents))
+}
+
+// ApproveClient 审核通过开发者创建的客户端
+// POST /api/admin/clients/:client_id/approve
+func (h *AdminHandler) ApproveClient(c *gin.Context) {
+	client, err := h.oauthService.ReviewClient(c.Param("client_id"), true)
+	if err != nil {
+		abortAdminClientError(c, "审核失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已通过审核", client))
+}
+
+// RejectClient 审核不通过开发者创建的客户端（撤销 Token 和未使用的授权码）
+// POST /api/admin/clients/:client_id/reject
+func (h *AdminHandler) RejectClient(c *gin.Context) {
+	client, err := h.oauthService.ReviewClient(c.Param("client_id"), false)
+	if err != nil {
+		abortAdminClientError(c, "审核失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端未通过审核", client))
+}
+
+// abortAdminClientError 根据客户端管理操作的错误类型返回对应的状态码
+func abortAdminClientError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrClientNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrInvalidClientMetadata):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(message, err))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(message, err))
+	}
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/middleware"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
 	"github.com/gin-gonic/gin"
@@ -43,10 +48,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	user, err := h.authService.Register(req)
 	if err != nil {
 		// 根据不同错误类型返回不同的 HTTP 状态码
-		switch err {
-		case service.ErrInvalidEmail, service.ErrWeakPassword:
+		switch {
+		case errors.Is(err, service.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, passwordErrorResponse("注册失败", err))
+		case errors.Is(err, service.ErrInvalidEmail):
 			c.JSON(http.StatusBadRequest, models.ErrorResponse("注册失败", err))
-		case service.ErrEmailExists:
+		case errors.Is(err, service.ErrEmailExists):
 			c.JSON(http.StatusConflict, models.ErrorResponse("注册失败", err))
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse("注册失败", err))
@@ -78,20 +85,46 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 2. 调用服务层处理登录逻辑
+	// 2. 调用服务层处理登录逻辑（记录登录设备信息）
+	req.SessionInfo = sessionInfo(c)
 	loginResp, err := h.authService.Login(req)
 	if err != nil {
 		// 根据不同错误类型返回不同的 HTTP 状态码
-		switch err {
-		case service.ErrInvalidCredentials:
+		switch {
+		case err == service.ErrInvalidCredentials:
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse("登录失败", err))
+		case err == service.ErrEmailNotVerified, err == service.ErrAccountDisabled, err == service.ErrPasswordResetRequired:
+			c.JSON(http.StatusForbidden, models.ErrorResponse("登录失败", err))
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		case errors.Is(err, service.ErrInvalidContinuation):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("登录失败", err))
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse("登录失败", err))
 		}
 		return
 	}
 
-	// 3. 返回成功响应（包含 Token 和用户信息）
+	// 3. 启用了两步验证时返回 MFA 令牌，由 /api/auth/mfa/verify 完成登录
+	if loginResp.MFARequired {
+		c.JSON(http.StatusOK, models.SuccessResponse("需要两步验证", loginResp))
+		return
+	}
+
+	// 4. 写入会话 Cookie 并返回 Token 和用户信息
+	h.respondLogin(c, loginResp)
+}
+
+// respondLogin 登录完成：写入会话 Cookie（浏览器直接访问授权端点，以及 cookie 模式下访问 API 时使用）并返回登录结果
+// 提升认证级别时沿用原有会话，没有新的会话令牌
+func (h *AuthHandler) respondLogin(c *gin.Context, loginResp *service.LoginResponse) {
+	if loginResp.SessionToken != "" {
+		setSessionCookie(c, loginResp.SessionToken, h.authService.SessionExpire())
+	}
+	if loginResp.Token == "" {
+		// cookie 模式不返回 JWT，写操作需要携带 CSRF Token
+		loginResp.CSRFToken = middleware.CSRFToken(c)
+	}
 	c.JSON(http.StatusOK, models.SuccessResponse("登录成功", loginResp))
 }
 
@@ -119,6 +152,461 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 		return
 	}
 
+	// 查询用户角色（前端据此显示管理入口）
+	resp := user.ToResponse()
+	if resp.Roles, err = h.authService.UserRoleNames(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取用户信息失败", err))
+		return
+	}
+
 	// 返回用户信息
-	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", user.ToResponse()))
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", resp))
+}
+
+// Logout 退出当前会话
+// POST /api/auth/logout
+// 撤销当前会话，关联的 JWT 和会话 Cookie 立即失效
+func (h *AuthHandler) Logout(c *gin.Context) {
+	session := c.MustGet("session").(*service.SessionClaims)
+	if err := h.authService.RevokeSession(session.UserID, session.SessionID); err != nil && err != service.ErrSessionNotFound {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("退出登录失败", err))
+		return
+	}
+	clearSessionCookie(c)
+	c.JSON(http.StatusOK, models.SuccessResponse("已退出登录", nil))
+}
+
+// LogoutAll 在所有设备上退出登录
+// POST /api/auth/logout/all
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("退出登录失败", err))
+		return
+	}
+	clearSessionCookie(c)
+	c.JSON(http.StatusOK, models.SuccessResponse("已在所有设备上退出登录", nil))
+}
+
+// ListSessions 列出当前用户的登录会话（设备、IP、最近使用时间）
+// GET /api/auth/sessions
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	session := c.MustGet("session").(*service.SessionClaims)
+	sessions, err := h.authService.ListSessions(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取会话列表失败", err))
+		return
+	}
+
+	resp := make([]models.SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		resp = append(resp, sessions[i].ToResponse(session.SessionID))
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", resp))
+}
+
+// RevokeSession 撤销指定的登录会话（退出该设备的登录）
+// DELETE /api/auth/sessions/:id
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	session := c.MustGet("session").(*service.SessionClaims)
+	sessionID := c.Param("id")
+	if err := h.authService.RevokeSession(session.UserID, sessionID); err != nil {
+		if err == service.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, models.ErrorResponse("撤销会话失败", err))
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("撤销会话失败", err))
+		}
+		return
+	}
+	if sessionID == session.SessionID {
+		clearSessionCookie(c)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("会话已撤销", nil))
+}
+
+// ChangePassword 修改密码（需要当前密码）
+// PUT /api/auth/password
+// 修改后其他设备上的登录会话和已签发的 Token 失效，当前会话保留
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req service.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	session := c.MustGet("session").(*service.SessionClaims)
+	if err := h.authService.ChangePassword(session, req, sessionInfo(c)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrIncorrectPassword):
+			c.JSON(http.StatusForbidden, models.ErrorResponse("修改密码失败", err))
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		case errors.Is(err, service.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, passwordErrorResponse("修改密码失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("修改密码失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("密码已修改", nil))
+}
+
+// UpdateProfile 修改用户资料（用户名、邮箱）
+// PATCH /api/auth/profile
+// 修改邮箱需要当前密码，新邮箱验证后才生效（响应中的 pending_email 为等待验证的新邮箱）
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req service.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(c.GetUint("userID"), req, sessionInfo(c))
+	if err != nil {
+		switch {
+		case err == service.ErrInvalidEmail, errors.Is(err, service.ErrInvalidProfile):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("修改资料失败", err))
+		case err == service.ErrIncorrectPassword:
+			c.JSON(http.StatusForbidden, models.ErrorResponse("修改资料失败", err))
+		case err == service.ErrEmailExists:
+			c.JSON(http.StatusConflict, models.ErrorResponse("修改资料失败", err))
+		case err == service.ErrTooManyEmails:
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse("修改资料失败", err))
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("修改资料失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("资料已更新", user.ToResponse()))
+}
+
+// VerifyEmailRequest 邮箱验证请求
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"` // 验证邮件中的令牌
+}
+
+// VerifyEmail 验证邮箱
+// POST /api/auth/verify-email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	user, err := h.authService.VerifyEmail(req.Token, sessionInfo(c))
+	if err != nil {
+		if err == service.ErrInvalidVerificationToken || err == service.ErrEmailExists {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("邮箱验证失败", err))
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("邮箱验证失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("邮箱验证成功", user.ToResponse()))
+}
+
+// ResendVerificationRequest 重新发送验证邮件请求（未登录时填写邮箱）
+type ResendVerificationRequest struct {
+	Email string `json:"email"` // 注册邮箱
+}
+
+// ResendVerification 重新发送验证邮件
+// POST /api/auth/verify-email/resend
+// 已登录时发送给当前用户；未登录时按请求中的邮箱发送，且无论邮箱是否注册都返回相同结果
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	// 1. 已登录：发送给当前用户
+	if userID, exists := c.Get("userID"); exists {
+		if err := h.authService.ResendVerificationEmail(userID.(uint)); err != nil {
+			switch err {
+			case service.ErrEmailAlreadyVerified:
+				c.JSON(http.StatusBadRequest, models.ErrorResponse("发送失败", err))
+			case service.ErrTooManyEmails:
+				c.JSON(http.StatusTooManyRequests, models.ErrorResponse("发送失败", err))
+			default:
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送失败", err))
+			}
+			return
+		}
+		c.JSON(http.StatusOK, models.SuccessResponse("验证邮件已发送", nil))
+		return
+	}
+
+	// 2. 未登录：按邮箱发送
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	if err := h.authService.ResendVerificationEmailTo(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("如果该邮箱已注册且尚未验证，验证邮件已发送", nil))
+}
+
+// ForgotPasswordRequest 忘记密码请求
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"` // 注册邮箱
+}
+
+// ForgotPassword 发送重置密码邮件
+// POST /api/auth/forgot-password
+// 无论邮箱是否注册都返回相同结果，避免泄露注册信息
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	if err := h.authService.ForgotPassword(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("如果该邮箱已注册，重置密码邮件已发送", nil))
+}
+
+// ResetPassword 使用重置邮件中的令牌设置新密码
+// POST /api/auth/reset-password
+// 重置成功后所有设备上的登录和已签发的 Token 都会失效
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req service.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.SessionInfo = sessionInfo(c)
+	if err := h.authService.ResetPassword(req); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, passwordErrorResponse("重置密码失败", err))
+		case errors.Is(err, service.ErrInvalidVerificationToken):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("重置密码失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("重置密码失败", err))
+		}
+		return
+	}
+	clearSessionCookie(c)
+	c.JSON(http.StatusOK, models.SuccessResponse("密码已重置，请使用新密码登录", nil))
+}
+
+// CSRFToken 获取 CSRF Token
+// GET /api/auth/csrf
+// cookie 模式下，前端在 POST/PUT/DELETE 请求的 X-CSRF-Token 头中携带该值
+func (h *AuthHandler) CSRFToken(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", gin.H{"csrf_token": middleware.CSRFToken(c)}))
+}
+
+// setSessionCookie 写入登录会话 Cookie
+// HttpOnly 防止脚本读取，SameSite=Lax 使第三方网站跳转过来的顶层导航能带上 Cookie，HTTPS 访问时设置 Secure
+func setSessionCookie(c *gin.Context, token string, maxAge time.Duration) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.SessionCookieName, token, int(maxAge.Seconds()), "/", "", service.IsHTTPS(c.Request), true)
+}
+
+// clearSessionCookie 清除登录会话 Cookie
+func clearSessionCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.SessionCookieName, "", -1, "/", "", service.IsHTTPS(c.Request), true)
+}
+
+// sessionInfo 获取请求的设备信息，记录在登录会话上
+func sessionInfo(c *gin.Context) service.SessionInfo {
+	return service.SessionInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// passwordErrorResponse 密码不符合策略时的错误响应，data.violations 列出所有违反的规则
+func passwordErrorResponse(message string, err error) models.Response {
+	response := models.ErrorResponse(message, err)
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		response.Data = gin.H{"violations": policyErr.Violations}
+	}
+	return response
+}
+
+// abortThrottled 认证因多次失败被暂时锁定时返回 429
+func abortThrottled(c *gin.Context, err error) {
+	setRetryAfter(c, err)
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse("尝试次数过多", err))
+}
+
+// setRetryAfter 设置 Retry-After 响应头（距离解锁的秒数）
+func setRetryAfter(c *gin.Context, err error) {
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(throttled.RetryAfterSeconds()))
+	}
+}
+
+// VerifyMFA 登录第二步：提交 TOTP 验证码或恢复码
+// POST /api/auth/mfa/verify
+// 账户要求两步验证但尚未启用时，先通过 /api/auth/mfa/totp/setup 设置验证器，此处的验证码同时用于确认，响应中返回恢复码
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req service.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.VerifyMFA(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAToken):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("两步验证失败", err))
+		case errors.Is(err, service.ErrMFASetupRequired):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("两步验证失败", err))
+		case errors.Is(err, service.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, models.ErrorResponse("两步验证失败", err))
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("两步验证失败", err))
+		}
+		return
+	}
+	h.respondLogin(c, loginResp)
+}
+
+// StepUp 提升当前会话的认证级别
+// POST /api/auth/step-up
+// 授权请求的 acr_values 要求两步验证而当前会话没有完成时，授权端点跳转到登录页并带上 step_up=1，登录页调用此接口，
+// 响应与登录第一步相同（mfa_token），完成第二步验证后更新当前会话（不签发新的 Token），再跳转到 redirect_url
+func (h *AuthHandler) StepUp(c *gin.Context) {
+	var req service.StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	loginResp, err := h.authService.BeginStepUp(session, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidContinuation) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("请求失败", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("请求失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("需要两步验证", loginResp))
+}
+
+// SetupTOTPRequest 设置验证器请求
+type SetupTOTPRequest struct {
+	MFAToken string `json:"mfa_token"` // 未登录时使用登录第一步返回的 MFA 令牌（账户要求先启用两步验证）
+}
+
+// SetupTOTP 生成 TOTP 密钥和 otpauth URI（确认验证码之前不生效）
+// POST /api/auth/mfa/totp/setup
+// 已登录用户直接调用；登录时要求启用两步验证的用户携带 mfa_token 调用
+func (h *AuthHandler) SetupTOTP(c *gin.Context) {
+	var req SetupTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	// 1. 确定用户：已登录的会话，或要求先设置验证器的 MFA 令牌
+	var userID uint
+	if session, ok := c.Get("session"); ok {
+		userID = session.(*service.SessionClaims).UserID
+	} else if req.MFAToken != "" {
+		id, err := h.authService.EnrollmentUserID(req.MFAToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("设置失败", err))
+			return
+		}
+		userID = id
+	} else {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("缺少认证令牌", nil))
+		return
+	}
+
+	// 2. 生成密钥
+	setup, err := h.authService.SetupTOTP(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusConflict, models.ErrorResponse("设置失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("设置失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("请使用验证器应用扫描二维码，然后提交验证码确认", setup))
+}
+
+// ConfirmTOTP 提交验证器生成的验证码，启用两步验证
+// POST /api/auth/mfa/totp/confirm
+// 响应中的恢复码只显示这一次
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	codes, err := h.authService.ConfirmTOTP(session.UserID, req.Code, service.AuditContext{ActorID: session.UserID, SessionInfo: sessionInfo(c)})
+	if err != nil {
+		h.abortMFAError(c, "启用两步验证失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已启用两步验证，请妥善保存恢复码", gin.H{"recovery_codes": codes}))
+}
+
+// DisableTOTP 关闭两步验证（需要当前验证码或恢复码）
+// DELETE /api/auth/mfa/totp
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	if err := h.authService.DisableTOTP(session.UserID, req.Code, service.AuditContext{ActorID: session.UserID, SessionInfo: sessionInfo(c)}); err != nil {
+		h.abortMFAError(c, "关闭两步验证失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已关闭两步验证", nil))
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（需要当前验证码或恢复码），之前的恢复码全部作废
+// POST /api/auth/mfa/recovery-codes
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	codes, err := h.authService.RegenerateRecoveryCodes(session.UserID, req.Code, service.AuditContext{ActorID: session.UserID, SessionInfo: sessionInfo(c)})
+	if err != nil {
+		h.abortMFAError(c, "生成恢复码失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已生成新的恢复码，请妥善保存", gin.H{"recovery_codes": codes}))
+}
+
+// abortMFAError 两步验证管理操作的错误响应
+func (h *AuthHandler) abortMFAError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusForbidden, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrMFANotEnabled), errors.Is(err, service.ErrMFASetupRequired):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrMFARequired):
+		c.JSON(http.StatusForbidden, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrTooManyAttempts):
+		abortThrottled(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(message, err))
+	}
 }
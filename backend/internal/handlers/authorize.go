@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// prompt 参数的取值（OIDC Core 3.1.2.1）
+const (
+	promptNone          = "none"           // 不展示任何页面，无法静默完成时返回错误
+	promptLogin         = "login"          // 强制用户重新登录
+	promptConsent       = "consent"        // 强制展示授权确认页面
+	promptSelectAccount = "select_account" // 让用户选择账号
+)
+
+// insufficientAuthentication 会话的认证级别低于 acr_values 的要求，需要提升认证级别（RFC 9470 的错误码）
+const insufficientAuthentication = "insufficient_user_authentication"
+
+// reauthWindow prompt=login 时，用户在授权确认页面操作前必须在此时间内重新登录过
+const reauthWindow = 5 * time.Minute
+
+// AuthorizeRequest 授权请求参数
+type AuthorizeRequest struct {
+	ClientID             string   `form:"client_id" binding:"required"`     // 客户端ID
+	RedirectURI          string   `form:"redirect_uri" binding:"required"`  // 重定向URI
+	ResponseType         string   `form:"response_type" binding:"required"` // 响应类型（固定为 "code"）
+	State                string   `form:"state"`                            // 状态参数（用于防止CSRF攻击）
+	Scope                string   `form:"scope"`                            // 权限范围（空格分隔）
+	Resource             []string `form:"resource"`                         // 目标资源（RFC 8707，可出现多次）
+	AuthorizationDetails string   `form:"authorization_details"`            // 授权详情（RFC 9396，JSON 数组）
+	Prompt               string   `form:"prompt"`                           // 交互要求（none/login/consent/select_account，空格分隔）
+	MaxAge               string   `form:"max_age"`                          // 允许的最长登录时间（秒）
+	ACRValues            string   `form:"acr_values"`                       // 要求的认证级别（空格分隔，按偏好排列，满足任意一个即可）
+	LoginHint            string   `form:"login_hint"`                       // 建议登录的账号（邮箱）
+	Nonce                string   `form:"nonce"`                            // OIDC nonce，原样写入 ID Token
+
+	maxAge      *time.Duration // 解析后的 max_age
+	requiredACR string         // acr_values 中最低要求的认证级别（为空表示不要求）
+	loginAfter  time.Time      // 从登录页恢复的请求：跳转到登录页的时间（零值表示不是恢复的请求）
+}
+
+// freshLogin 检查用户是否在跳转到登录页之后重新登录过（即刚在登录页完成了认证和账号选择）
+func (r *AuthorizeRequest) freshLogin(session *service.SessionClaims) bool {
+	return !r.loginAfter.IsZero() && session.AuthTime.Unix() >= r.loginAfter.Unix()
+}
+
+// hasPrompt 检查请求是否包含指定的 prompt 取值
+func (r *AuthorizeRequest) hasPrompt(value string) bool {
+	for _, item := range strings.Fields(r.Prompt) {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeError 授权请求错误
+type authorizeError struct {
+	Code     string // OAuth 错误码（如 invalid_scope）
+	Message  string // 错误提示
+	Err      error  // 具体错误
+	Status   int    // 不重定向时返回的 HTTP 状态码（默认 400）
+	Redirect bool   // 是否重定向回客户端（只有 client_id 和 redirect_uri 验证通过后才能重定向）
+}
+
+// parseAuthorizeRequest 解析并验证授权请求
+func (h *OAuthHandler) parseAuthorizeRequest(c *gin.Context) (*AuthorizeRequest, *models.OAuthClient, *authorizeError) {
+	var req AuthorizeRequest
+
+	// 1. 解析查询参数
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, nil, &authorizeError{Code: "invalid_request", Message: "请求参数无效", Err: err}
+	}
+
+	// 2. 验证客户端
+	client, err := h.oauthService.ValidateClientID(req.ClientID)
+	if err != nil {
+		return nil, nil, &authorizeError{Code: "invalid_client", Message: "无效的客户端", Err: err}
+	}
+
+	// 3. 验证重定向URI（验证通过后，后续错误都重定向回客户端）
+	if err := h.oauthService.ValidateRedirectURI(client, req.RedirectURI); err != nil {
+		return nil, nil, &authorizeError{Code: "invalid_request", Message: "重定向URI不匹配", Err: err}
+	}
+
+	// 4. 验证响应类型（简化版只支持授权码模式），客户端必须允许授权码模式
+	if req.ResponseType != "code" {
+		return &req, client, &authorizeError{Code: "unsupported_response_type", Message: "不支持的响应类型", Redirect: true}
+	}
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return &req, client, &authorizeError{Code: "unauthorized_client", Message: "客户端不允许使用授权码模式", Redirect: true}
+	}
+
+	// 5. 验证 prompt、max_age 和 acr_values（OIDC）
+	if err := validatePrompt(req.Prompt); err != nil {
+		return &req, client, &authorizeError{Code: "invalid_request", Message: "无效的 prompt 参数", Err: err, Redirect: true}
+	}
+	if req.MaxAge != "" {
+		seconds, err := strconv.Atoi(req.MaxAge)
+		if err != nil || seconds < 0 {
+			return &req, client, &authorizeError{Code: "invalid_request", Message: "max_age 必须是非负整数", Redirect: true}
+		}
+		maxAge := time.Duration(seconds) * time.Second
+		req.maxAge = &maxAge
+	}
+	if values := strings.Fields(req.ACRValues); len(values) > 0 {
+		required, ok := service.RequiredACR(values)
+		if !ok {
+			return &req, client, &authorizeError{Code: "invalid_request", Message: "不支持的 acr_values", Redirect: true}
+		}
+		req.requiredACR = required
+	}
+
+	// 6. 验证目标资源和权限范围（RFC 8707），权限范围必须在客户端允许的范围内
+	if err := h.oauthService.ValidateClientScope(client, req.Scope); err != nil {
+		return &req, client, &authorizeError{Code: "invalid_scope", Message: "客户端不允许请求该权限范围", Err: err, Redirect: true}
+	}
+	if err := h.oauthService.ValidateResources(req.Resource, req.Scope); err != nil {
+		code := "invalid_target"
+		if errors.Is(err, service.ErrInvalidScope) {
+			code = "invalid_scope"
+		}
+		return &req, client, &authorizeError{Code: code, Message: "无效的资源或权限范围", Err: err, Redirect: true}
+	}
+
+	// 7. 验证授权详情（RFC 9396）
+	details, err := h.oauthService.ValidateAuthorizationDetails(req.AuthorizationDetails)
+	if err != nil {
+		return &req, client, &authorizeError{Code: "invalid_authorization_details", Message: "无效的授权详情", Err: err, Redirect: true}
+	}
+	req.AuthorizationDetails = details
+	req.Scope = service.JoinScope(service.ParseScope(req.Scope))
+
+	return &req, client, nil
+}
+
+// validatePrompt 验证 prompt 参数：只能使用已知取值，none 不能与其他取值同时出现
+func validatePrompt(prompt string) error {
+	values := strings.Fields(prompt)
+	for _, value := range values {
+		switch value {
+		case promptNone:
+			if len(values) > 1 {
+				return errors.New("prompt=none 不能与其他取值同时使用")
+			}
+		case promptLogin, promptConsent, promptSelectAccount:
+		default:
+			return fmt.Errorf("不支持的 prompt 取值: %s", value)
+		}
+	}
+	return nil
+}
+
+// checkSession 检查当前登录会话是否满足授权请求的认证要求（prompt、max_age、acr_values、login_hint）
+// interactive 为 true 表示请求来自授权确认页面（用户已经看到了页面）
+func (h *OAuthHandler) checkSession(req *AuthorizeRequest, session *service.SessionClaims, interactive bool) *authorizeError {
+	silent := req.hasPrompt(promptNone)
+	loginRequired := func(message string) *authorizeError {
+		return &authorizeError{Code: "login_required", Message: message, Status: http.StatusUnauthorized, Redirect: silent}
+	}
+
+	// 1. 未登录
+	if session == nil {
+		return loginRequired("请先登录")
+	}
+
+	// 2. prompt=login：授权端点要求在登录页重新登录过；授权确认页面要求最近刚登录过
+	if req.hasPrompt(promptLogin) && !req.freshLogin(session) && (!interactive || time.Since(session.AuthTime) > reauthWindow) {
+		return loginRequired("请重新登录")
+	}
+
+	// 3. max_age：登录时间超过限制时需要重新登录（刚在登录页重新登录过的除外，否则 max_age=0 会反复跳转登录页）
+	if req.maxAge != nil && time.Since(session.AuthTime) > *req.maxAge && !req.freshLogin(session) {
+		return loginRequired("登录已超过 max_age 限制，请重新登录")
+	}
+
+	// 4. acr_values：认证级别不够时需要完成两步验证（提升当前会话的认证级别）
+	if req.requiredACR != "" && !service.SatisfiesACR(session.AMR, req.requiredACR) {
+		if silent {
+			return &authorizeError{Code: "interaction_required", Message: "需要完成两步验证", Status: http.StatusUnauthorized, Redirect: true}
+		}
+		return &authorizeError{Code: insufficientAuthentication, Message: "需要完成两步验证", Status: http.StatusUnauthorized}
+	}
+
+	// 5. login_hint：当前登录的不是建议的账号时需要切换账号（用户已在页面上自行选择账号时除外）
+	if req.LoginHint != "" && !interactive && !req.freshLogin(session) {
+		user, err := h.authService.GetUserByID(session.UserID)
+		if err != nil {
+			return &authorizeError{Code: "server_error", Message: "获取用户信息失败", Err: err, Status: http.StatusInternalServerError}
+		}
+		if !strings.EqualFold(user.Email, req.LoginHint) {
+			return &authorizeError{
+				Code:     "interaction_required",
+				Message:  fmt.Sprintf("请使用 %s 登录", req.LoginHint),
+				Status:   http.StatusUnauthorized,
+				Redirect: silent,
+			}
+		}
+	}
+
+	// 6. prompt=select_account：需要在页面上确认使用的账号
+	if req.hasPrompt(promptSelectAccount) && !interactive && !req.freshLogin(session) {
+		return &authorizeError{Code: "account_selection_required", Message: "请选择要使用的账号", Status: http.StatusUnauthorized}
+	}
+
+	// 7. 要求验证邮箱后才能授权第三方应用
+	if err := h.authService.CheckAuthorizeAllowed(session.UserID); err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return &authorizeError{Code: "access_denied", Message: err.Error(), Status: http.StatusForbidden, Redirect: silent}
+		}
+		return &authorizeError{Code: "server_error", Message: "获取用户信息失败", Err: err, Status: http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
+// checkConsent 检查用户是否已同意本次授权；prompt=consent 时总是要求确认
+func (h *OAuthHandler) checkConsent(req *AuthorizeRequest, userID uint) *authorizeError {
+	consented, err := h.oauthService.HasConsent(userID, req.ClientID, req.Scope, req.Resource, req.AuthorizationDetails)
+	if err != nil {
+		return &authorizeError{Code: "server_error", Message: "查询授权记录失败", Err: err, Status: http.StatusInternalServerError}
+	}
+	if !consented || req.hasPrompt(promptConsent) {
+		return &authorizeError{
+			Code:     "consent_required",
+			Message:  "需要用户确认授权",
+			Status:   http.StatusForbidden,
+			Redirect: req.hasPrompt(promptNone),
+		}
+	}
+	return nil
+}
+
+// clientRedirectURL 构造重定向回客户端的地址，带上 state 和 iss 参数（RFC 9207）
+func (h *OAuthHandler) clientRedirectURL(req *AuthorizeRequest, params url.Values) string {
+	redirectURL, _ := url.Parse(req.RedirectURI)
+	query := redirectURL.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State) // 原样返回 state 参数
+	}
+	query.Set("iss", h.oauthService.Issuer()) // 标识授权服务器，防止混淆攻击
+	redirectURL.RawQuery = query.Encode()
+	return redirectURL.String()
+}
+
+// errorParams 构造 OAuth 2.0 错误重定向参数
+func errorParams(aerr *authorizeError) url.Values {
+	params := url.Values{}
+	params.Set("error", aerr.Code)
+	description := aerr.Message
+	if aerr.Err != nil {
+		description = aerr.Err.Error()
+	}
+	params.Set("error_description", description)
+	return params
+}
+
+// writeAuthorizeError 输出授权错误：可重定向时按 OAuth 2.0 格式重定向回客户端，否则返回 JSON
+func (h *OAuthHandler) writeAuthorizeError(c *gin.Context, req *AuthorizeRequest, aerr *authorizeError) {
+	if aerr.Redirect {
+		c.Redirect(http.StatusFound, h.clientRedirectURL(req, errorParams(aerr)))
+		return
+	}
+	writeAuthorizeErrorJSON(c, aerr)
+}
+
+// writeAuthorizeErrorJSON 以 JSON 输出授权错误，error 字段为 OAuth 错误码，便于页面判断下一步操作
+func writeAuthorizeErrorJSON(c *gin.Context, aerr *authorizeError) {
+	status := aerr.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	err := aerr.Err
+	if err == nil {
+		err = errors.New(aerr.Code)
+	}
+	c.JSON(status, models.ErrorResponse(aerr.Message, err))
+}
+
+// currentSession 获取当前登录会话（未登录时返回 nil）
+func currentSession(c *gin.Context) *service.SessionClaims {
+	if session, exists := c.Get("session"); exists {
+		return session.(*service.SessionClaims)
+	}
+	return nil
+}
+
+// ConsentResponse 授权确认页面需要展示的内容
+type ConsentResponse struct {
+	Client               models.OAuthClientResponse `json:"client"`                          // 请求授权的客户端
+	Scopes               []string                   `json:"scopes"`                          // 请求的权限范围
+	Resources            []string                   `json:"resources"`                       // 请求访问的资源
+	AuthorizationDetails json.RawMessage            `json:"authorization_details,omitempty"` // 请求的授权详情（RFC 9396）
+	LoginHint            string                     `json:"login_hint,omitempty"`            // 建议登录的账号（用于预填登录表单）
+	Prompt               []string                   `json:"prompt,omitempty"`                // 交互要求
+}
+
+// Consent 授权确认信息端点
+// GET /oauth/consent?client_id=xxx&redirect_uri=xxx&response_type=code&...
+// 授权确认页面用它获取客户端信息和请求的权限，参数与授权端点相同
+func (h *OAuthHandler) Consent(c *gin.Context) {
+	req, client, aerr := h.parseAuthorizeRequest(c)
+	if aerr != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(aerr.Message, aerr.Err))
+		return
+	}
+
+	resp := ConsentResponse{
+		Client:    client.ToResponse(),
+		Scopes:    service.ParseScope(req.Scope),
+		Resources: req.Resource,
+		LoginHint: req.LoginHint,
+		Prompt:    strings.Fields(req.Prompt),
+	}
+	if req.AuthorizationDetails != "" {
+		resp.AuthorizationDetails = json.RawMessage(req.AuthorizationDetails)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", resp))
+}
+
+// ConsentDecisionRequest 用户在授权确认页面的决定
+type ConsentDecisionRequest struct {
+	Approve bool `json:"approve" form:"approve"` // 是否同意授权
+}
+
+// ConsentDecisionResponse 授权确认结果
+type ConsentDecisionResponse struct {
+	RedirectURL string `json:"redirect_url"` // 页面需要跳转到的客户端地址（带授权码或错误信息）
+}
+
+// ConsentDecision 授权确认端点
+// POST /oauth/consent?client_id=xxx&redirect_uri=xxx&response_type=code&...
+// 授权确认页面提交用户的决定，查询参数与授权端点相同；同意时记录授权并生成授权码
+func (h *OAuthHandler) ConsentDecision(c *gin.Context) {
+	var decision ConsentDecisionRequest
+
+	// 1. 解析并验证授权请求和用户决定
+	req, _, aerr := h.parseAuthorizeRequest(c)
+	if aerr != nil {
+		writeAuthorizeErrorJSON(c, aerr)
+		return
+	}
+	if err := c.ShouldBind(&decision); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	if req.hasPrompt(promptNone) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("prompt=none 的请求不能进行交互", nil))
+		return
+	}
+
+	// 2. 检查登录会话
+	session := currentSession(c)
+	if aerr := h.checkSession(req, session, true); aerr != nil {
+		writeAuthorizeErrorJSON(c, aerr)
+		return
+	}
+
+	// 3. 用户拒绝授权
+	if !decision.Approve {
+		c.JSON(http.StatusOK, models.SuccessResponse("已拒绝授权", ConsentDecisionResponse{RedirectURL: h.deniedURL(req)}))
+		return
+	}
+
+	// 4. 记录授权并生成授权码
+	redirectURL, err := h.approveConsent(req, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("授权失败", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("授权成功", ConsentDecisionResponse{RedirectURL: redirectURL}))
+}
+
+// deniedURL 用户拒绝授权时重定向回客户端的地址
+func (h *OAuthHandler) deniedURL(req *AuthorizeRequest) string {
+	return h.clientRedirectURL(req, errorParams(&authorizeError{Code: "access_denied", Message: "用户拒绝授权"}))
+}
+
+// approveConsent 记录用户同意的授权并生成授权码，返回带授权码的客户端重定向地址
+func (h *OAuthHandler) approveConsent(req *AuthorizeRequest, session *service.SessionClaims) (string, error) {
+	if err := h.oauthService.SaveConsent(session.UserID, req.ClientID, req.Scope, req.Resource); err != nil {
+		return "", fmt.Errorf("保存授权记录失败: %w", err)
+	}
+	redirectURL, err := h.issueCode(req, session)
+	if err != nil {
+		return "", fmt.Errorf("生成授权码失败: %w", err)
+	}
+	return redirectURL, nil
+}
+
+// Authorize 授权端点
+// GET /oauth/authorize?client_id=xxx&redirect_uri=xxx&response_type=code&state=xxx
+// 这是 OAuth 2.0 的第一步：第三方应用引导用户到这里进行授权
+// 已登录且已同意过授权时直接签发授权码；否则跳转到登录页或授权确认页面，由用户操作后继续
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	// 1. 从登录页返回时，用签名的 continuation 恢复原始授权请求
+	var loginAfter time.Time
+	if token := c.Query("continue"); token != "" {
+		continuation, err := h.authService.ParseContinuation(token)
+		if err == nil && continuation.Device {
+			err = service.ErrInvalidContinuation // 设备授权页面的 continuation 不能用来恢复授权请求
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的授权请求", err))
+			return
+		}
+		c.Request.URL.RawQuery = continuation.Query
+		loginAfter = continuation.IssuedAt
+	}
+
+	// 2. 解析并验证授权请求
+	req, _, aerr := h.parseAuthorizeRequest(c)
+	if aerr != nil {
+		h.writeAuthorizeError(c, req, aerr)
+		return
+	}
+	req.loginAfter = loginAfter
+
+	// 3. 检查登录会话（prompt、max_age、acr_values、login_hint），需要登录或提升认证级别时跳转到登录页
+	session := currentSession(c)
+	if aerr := h.checkSession(req, session, false); aerr != nil {
+		if aerr.Redirect || aerr.Status != http.StatusUnauthorized {
+			h.writeAuthorizeError(c, req, aerr)
+			return
+		}
+		h.redirectToLogin(c, req, aerr.Code == insufficientAuthentication)
+		return
+	}
+
+	// 4. 检查用户是否已同意授权，需要确认时跳转到授权确认页面（由页面调用 POST /oauth/consent）
+	if aerr := h.checkConsent(req, session.UserID); aerr != nil {
+		if aerr.Redirect || aerr.Code != "consent_required" {
+			h.writeAuthorizeError(c, req, aerr)
+			return
+		}
+		c.Redirect(http.StatusFound, appendQuery(h.consentURL, c.Request.URL.Query()))
+		return
+	}
+
+	// 5. 生成授权码并重定向到客户端
+	// 格式：redirect_uri?code=xxx&state=xxx&iss=xxx
+	redirectURL, err := h.issueCode(req, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成授权码失败", err))
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// redirectToLogin 跳转到登录页，带上签名的 continuation，登录成功后由登录页跳回授权端点继续处理
+// stepUp 为 true 时用户已登录但认证级别不够，登录页对当前会话发起两步验证（POST /api/auth/step-up）
+func (h *OAuthHandler) redirectToLogin(c *gin.Context, req *AuthorizeRequest, stepUp bool) {
+	continuation, err := h.authService.SignContinuation(c.Request.URL.RawQuery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("跳转登录页失败", err))
+		return
+	}
+	params := url.Values{"continue": {continuation}}
+	if req.LoginHint != "" {
+		params.Set("login_hint", req.LoginHint) // 用于预填登录表单
+	}
+	if stepUp {
+		params.Set("step_up", "1")
+	}
+	c.Redirect(http.StatusFound, appendQuery(h.loginURL, params))
+}
+
+// appendQuery 在页面地址后追加查询参数
+func appendQuery(pageURL string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(pageURL, "?") {
+		separator = "&"
+	}
+	return pageURL + separator + params.Encode()
+}
+
+// issueCode 生成授权码，返回带授权码的客户端重定向地址
+// 授权码记录登录会话、认证时间和认证方式，用于 ID Token 的 sid/auth_time/acr/amr、Token 内省和退出登录通知
+func (h *OAuthHandler) issueCode(req *AuthorizeRequest, session *service.SessionClaims) (string, error) {
+	code, err := h.oauthService.GenerateAuthorizationCode(service.AuthorizationGrant{
+		ClientID:             req.ClientID,
+		UserID:               session.UserID,
+		RedirectURI:          req.RedirectURI,
+		Scope:                req.Scope,
+		Resources:            req.Resource,
+		AuthorizationDetails: req.AuthorizationDetails,
+		Nonce:                req.Nonce,
+		SessionID:            session.SessionID,
+		AuthTime:             session.AuthTime,
+		ACR:                  service.ACRForAMR(session.AMR),
+		AMR:                  session.AMR,
+	})
+	if err != nil {
+		return "", err
+	}
+	return h.clientRedirectURL(req, url.Values{"code": {code}}), nil
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+)
+
+func TestCheckSessionMaxAge(t *testing.T) {
+	h := &OAuthHandler{authService: service.NewAuthService(testSecret, 1, testIssuer)}
+	zero := time.Duration(0)
+	hour := time.Hour
+	authTime := time.Now().Add(-2 * time.Second)
+
+	tests := []struct {
+		name       string
+		maxAge     *time.Duration
+		loginAfter time.Time // 跳转到登录页的时间（零值表示不是从登录页恢复的请求）
+		wantLogin  bool
+	}{
+		{name: "未指定 max_age", wantLogin: false},
+		{name: "max_age 内的会话", maxAge: &hour, wantLogin: false},
+		{name: "max_age=0 且没有重新登录", maxAge: &zero, wantLogin: true},
+		{name: "max_age=0 且刚在登录页登录", maxAge: &zero, loginAfter: authTime.Add(-time.Second), wantLogin: false},
+		{name: "max_age=0 且登录早于跳转登录页", maxAge: &zero, loginAfter: authTime.Add(time.Minute), wantLogin: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &AuthorizeRequest{maxAge: tt.maxAge, loginAfter: tt.loginAfter}
+			session := &service.SessionClaims{UserID: 1, SessionID: "sid", AuthTime: authTime, AMR: []string{service.AMRPassword}}
+			aerr := h.checkSession(req, session, false)
+			if tt.wantLogin {
+				if aerr == nil || aerr.Code != "login_required" {
+					t.Fatalf("期望 login_required，实际 %+v", aerr)
+				}
+				return
+			}
+			if aerr != nil {
+				t.Fatalf("期望通过，实际 %+v", aerr)
+			}
+		})
+	}
+}
+
+func TestCheckSessionACR(t *testing.T) {
+	h := &OAuthHandler{authService: service.NewAuthService(testSecret, 1, testIssuer)}
+	password := []string{service.AMRPassword}
+	mfa := []string{service.AMRPassword, service.AMROTP, service.AMRMFA}
+
+	tests := []struct {
+		name      string
+		required  string
+		prompt    string
+		amr       []string
+		wantCode  string // 为空表示通过
+		wantRedir bool
+	}{
+		{name: "未要求认证级别", amr: password},
+		{name: "单因素满足单因素要求", required: service.ACRSingleFactor, amr: password},
+		{name: "多因素满足多因素要求", required: service.ACRMultiFactor, amr: mfa},
+		{name: "单因素需要提升认证级别", required: service.ACRMultiFactor, amr: password, wantCode: insufficientAuthentication},
+		{name: "prompt=none 时返回 interaction_required", required: service.ACRMultiFactor, prompt: promptNone, amr: password, wantCode: "interaction_required", wantRedir: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &AuthorizeRequest{Prompt: tt.prompt, requiredACR: tt.required}
+			session := &service.SessionClaims{UserID: 1, SessionID: "sid", AuthTime: time.Now(), AMR: tt.amr}
+			aerr := h.checkSession(req, session, false)
+			if tt.wantCode == "" {
+				if aerr != nil {
+					t.Fatalf("期望通过，实际 %+v", aerr)
+				}
+				return
+			}
+			if aerr == nil || aerr.Code != tt.wantCode || aerr.Redirect != tt.wantRedir {
+				t.Fatalf("期望 %s（重定向: %v），实际 %+v", tt.wantCode, tt.wantRedir, aerr)
+			}
+		})
+	}
+}
+
+func TestAuthorizeResponseIssuer(t *testing.T) {
+	f := newAuthorizeFixture(t)
+	session := f.session(time.Now())
+
+	tests := []struct {
+		name      string
+		query     url.Values
+		wantCode  bool   // 重定向中带授权码
+		wantError string // 重定向中的 error 参数
+	}{
+		{
+			name:     "成功时带上 iss",
+			query:    url.Values{"response_type": {"code"}, "scope": {"profile"}},
+			wantCode: true,
+		},
+		{
+			name:      "不支持的响应类型时带上 iss",
+			query:     url.Values{"response_type": {"token"}},
+			wantError: "unsupported_response_type",
+		},
+		{
+			name:      "需要确认授权时带上 iss",
+			query:     url.Values{"response_type": {"code"}, "scope": {"email"}, "prompt": {"none"}},
+			wantError: "consent_required",
+		},
+		{
+			name:      "无效的 max_age 时带上 iss",
+			query:     url.Values{"response_type": {"code"}, "max_age": {"-1"}},
+			wantError: "invalid_request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := redirectLocation(t, f.authorize(session, authorizeQuery(tt.query)))
+			params := location.Query()
+			if location.Scheme+"://"+location.Host+location.Path != testRedirectURI {
+				t.Fatalf("重定向到 %s，期望 %s", location, testRedirectURI)
+			}
+			if params.Get("iss") != testIssuer || params.Get("state") != "xyz" {
+				t.Fatalf("iss = %q, state = %q，期望 %q, %q", params.Get("iss"), params.Get("state"), testIssuer, "xyz")
+			}
+			if (params.Get("code") != "") != tt.wantCode || params.Get("error") != tt.wantError {
+				t.Fatalf("重定向参数不正确: %s", location.RawQuery)
+			}
+		})
+	}
+
+	// 用户拒绝授权的重定向同样带上 iss
+	denied, _ := url.Parse(f.handler.deniedURL(&AuthorizeRequest{RedirectURI: testRedirectURI + "?tenant=a"}))
+	if params := denied.Query(); params.Get("iss") != testIssuer || params.Get("error") != "access_denied" || params.Get("tenant") != "a" {
+		t.Fatalf("拒绝授权的重定向参数不正确: %s", denied.RawQuery)
+	}
+
+	// 重定向地址无效时不重定向，也就不会泄露 iss
+	rec := f.authorize(session, authorizeQuery(url.Values{"redirect_uri": {"https://evil.example.com/"}}))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+		t.Fatalf("无效的重定向地址: 状态码 = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAuthorizeRedirectsToLogin(t *testing.T) {
+	f := newAuthorizeFixture(t)
+
+	tests := []struct {
+		name       string
+		session    *service.SessionClaims
+		query      url.Values
+		wantHint   string
+		wantStepUp bool
+	}{
+		{name: "未登录", query: url.Values{}},
+		{name: "预填建议的账号", query: url.Values{"login_hint": {"bob@example.com"}}, wantHint: "bob@example.com"},
+		{name: "需要提升认证级别", session: f.session(time.Now()), query: url.Values{"acr_values": {service.ACRMultiFactor}}, wantStepUp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := authorizeQuery(tt.query)
+			location := redirectLocation(t, f.authorize(tt.session, query))
+			if location.Path != "/login" {
+				t.Fatalf("重定向到 %s，期望登录页", location)
+			}
+			params := location.Query()
+			if params.Get("login_hint") != tt.wantHint || (params.Get("step_up") == "1") != tt.wantStepUp {
+				t.Fatalf("登录页参数不正确: %s", location.RawQuery)
+			}
+
+			// continuation 签名保存原始的授权请求
+			continuation, err := f.authService.ParseContinuation(params.Get("continue"))
+			if err != nil {
+				t.Fatalf("解析 continuation 失败: %v", err)
+			}
+			if continuation.Query != query.Encode() {
+				t.Fatalf("continuation 中的请求 = %q，期望 %q", continuation.Query, query.Encode())
+			}
+		})
+	}
+}
+
+func TestAuthorizeResumesAfterLogin(t *testing.T) {
+	f := newAuthorizeFixture(t)
+
+	// 1. 未登录时跳转到登录页，登录页完成登录后带着 continuation 回到授权端点
+	location := redirectLocation(t, f.authorize(nil, authorizeQuery(url.Values{"state": {"resume-state"}, "nonce": {"n-1"}})))
+	continuation := location.Query().Get("continue")
+	resume, err := url.Parse(f.authService.ResumeURL(continuation))
+	if err != nil {
+		t.Fatalf("解析恢复地址失败: %v", err)
+	}
+
+	// 2. 恢复时重放原始请求：授权码签发给原始的重定向地址，并带回原始的 state
+	location = redirectLocation(t, f.authorize(f.session(time.Now()), resume.Query()))
+	params := location.Query()
+	if location.Scheme+"://"+location.Host+location.Path != testRedirectURI || params.Get("state") != "resume-state" || params.Get("code") == "" {
+		t.Fatalf("恢复后的重定向不正确: %s", location)
+	}
+	var code models.AuthorizationCode
+	if err := database.DB.Where("code = ?", params.Get("code")).First(&code).Error; err != nil {
+		t.Fatalf("查询授权码失败: %v", err)
+	}
+	if code.Nonce != "n-1" || code.Scope != "profile" || code.UserID != f.user.ID {
+		t.Fatalf("授权码与原始请求不一致: %+v", code)
+	}
+
+	// 3. 无效的 continuation 不能恢复授权请求
+	other := service.NewAuthService("other-secret", 1, testIssuer)
+	foreign, _ := other.SignContinuation(authorizeQuery(url.Values{"redirect_uri": {"https://evil.example.com/"}}).Encode())
+	device, _ := f.authService.SignDeviceContinuation(authorizeQuery(nil).Encode())
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "篡改的 continuation", token: continuation[:len(continuation)/2] + "x" + continuation[len(continuation)/2+1:]},
+		{name: "其他密钥签名的 continuation", token: foreign},
+		{name: "不是 JWT", token: "not-a-token"},
+		{name: "设备授权页面的 continuation", token: device},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.authorize(f.session(time.Now()), url.Values{"continue": {tt.token}})
+			if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+				t.Fatalf("状态码 = %d, Location = %q，期望 400 且不重定向", rec.Code, rec.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestValidatePrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		wantErr bool
+	}{
+		{name: "未指定", prompt: ""},
+		{name: "none", prompt: "none"},
+		{name: "多个交互取值", prompt: "login consent select_account"},
+		{name: "none 与 login 同时出现", prompt: "none login", wantErr: true},
+		{name: "none 与 consent 同时出现", prompt: "consent none", wantErr: true},
+		{name: "未知取值", prompt: "login create", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePrompt(tt.prompt); (err != nil) != tt.wantErr {
+				t.Fatalf("validatePrompt(%q) = %v，期望出错: %v", tt.prompt, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizePrompt(t *testing.T) {
+	f := newAuthorizeFixture(t)
+	session := f.session(time.Now())
+
+	tests := []struct {
+		name      string
+		session   *service.SessionClaims
+		query     url.Values
+		resumed   bool   // 通过 continuation 从登录页恢复（用户刚在登录页重新登录过）
+		wantPath  string // 跳转到的页面（/login 或 /consent）
+		wantError string // 重定向回客户端时的 error 参数
+	}{
+		{name: "prompt=none 且未登录", query: url.Values{"prompt": {"none"}}, wantError: "login_required"},
+		{name: "prompt=none 且未同意授权", session: session, query: url.Values{"prompt": {"none"}, "scope": {"profile email"}}, wantError: "consent_required"},
+		{name: "prompt=none 且需要两步验证", session: session, query: url.Values{"prompt": {"none"}, "acr_values": {service.ACRMultiFactor}}, wantError: "interaction_required"},
+		{name: "prompt=none 且已同意授权", session: session, query: url.Values{"prompt": {"none"}}},
+		{name: "prompt=none 与其他取值同时出现", session: session, query: url.Values{"prompt": {"none login"}}, wantError: "invalid_request"},
+		{name: "prompt=login 要求重新登录", session: session, query: url.Values{"prompt": {"login"}}, wantPath: "/login"},
+		{name: "prompt=login 重新登录后签发授权码", session: session, query: url.Values{"prompt": {"login"}}, resumed: true},
+		{name: "prompt=consent 已同意过也要确认", session: session, query: url.Values{"prompt": {"consent"}}, wantPath: "/consent"},
+		{name: "prompt=select_account 要求选择账号", session: session, query: url.Values{"prompt": {"select_account"}}, wantPath: "/login"},
+		{name: "prompt=select_account 选择账号后签发授权码", session: session, query: url.Values{"prompt": {"select_account"}}, resumed: true},
+		{name: "login_hint 与当前账号一致", session: session, query: url.Values{"login_hint": {"Alice@Example.com"}}},
+		{name: "login_hint 与当前账号不一致", session: session, query: url.Values{"login_hint": {"bob@example.com"}}, wantPath: "/login"},
+		{name: "prompt=none 且 login_hint 不一致", session: session, query: url.Values{"prompt": {"none"}, "login_hint": {"bob@example.com"}}, wantError: "interaction_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, session := authorizeQuery(tt.query), tt.session
+			if tt.resumed {
+				continuation, err := f.authService.SignContinuation(query.Encode())
+				if err != nil {
+					t.Fatalf("签名 continuation 失败: %v", err)
+				}
+				query = url.Values{"continue": {continuation}}
+				session = f.session(time.Now()) // 在跳转登录页之后重新登录
+			}
+			location := redirectLocation(t, f.authorize(session, query))
+			params := location.Query()
+			if tt.wantPath != "" {
+				if location.Path != tt.wantPath {
+					t.Fatalf("重定向到 %s，期望 %s", location, tt.wantPath)
+				}
+				return
+			}
+			if location.Scheme+"://"+location.Host+location.Path != testRedirectURI {
+				t.Fatalf("重定向到 %s，期望 %s", location, testRedirectURI)
+			}
+			if params.Get("error") != tt.wantError || (params.Get("code") != "") != (tt.wantError == "") {
+				t.Fatalf("重定向参数不正确: %s，期望 error = %q", location.RawQuery, tt.wantError)
+			}
+		})
+	}
+}
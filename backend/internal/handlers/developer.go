@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// DeveloperHandler 开发者接口处理器（用户自助管理自己的 OAuth 客户端）
+type DeveloperHandler struct {
+	oauthService *service.OAuthService
+}
+
+// NewDeveloperHandler 创建开发者接口处理器实例
+func NewDeveloperHandler(oauthService *service.OAuthService) *DeveloperHandler {
+	return &DeveloperHandler{oauthService: oauthService}
+}
+
+// ListClients 列出当前用户拥有或参与协作的客户端
+// GET /api/developer/clients
+func (h *DeveloperHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthService.DeveloperClients(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", clients))
+}
+
+// CreateClient 创建客户端（当前用户成为所有者，密钥只在响应中返回这一次）
+// POST /api/developer/clients
+func (h *DeveloperHandler) CreateClient(c *gin.Context) {
+	var req service.ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	result, err := h.oauthService.CreateDeveloperClient(c.GetUint("userID"), req)
+	if err != nil {
+		abortDeveloperError(c, "创建失败", err)
+		return
+	}
+	message := "客户端已创建"
+	if !result.Client.Approved() {
+		message = "客户端已创建，管理员审核通过后才能使用"
+	}
+	c.JSON(http.StatusCreated, models.SuccessResponse(message, result))
+}
+
+// GetClient 获取客户端配置
+// GET /api/developer/clients/:client_id
+func (h *DeveloperHandler) GetClient(c *gin.Context) {
+	client, err := h.oauthService.GetDeveloperClient(c.GetUint("userID"), c.Param("client_id"))
+	if err != nil {
+		abortDeveloperError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", client))
+}
+
+// UpdateClient 修改客户端配置（整体替换）
+// PUT /api/developer/clients/:client_id
+func (h *DeveloperHandler) UpdateClient(c *gin.Context) {
+	var req service.ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	client, err := h.oauthService.UpdateDeveloperClient(c.GetUint("userID"), c.Param("client_id"), req)
+	if err != nil {
+		abortDeveloperError(c, "修改失败", err)
+		return
+	}
+	message := "客户端已更新"
+	if !client.Approved() {
+		message = "客户端已更新，管理员审核通过后才能使用"
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(message, client))
+}
+
+// DeleteClient 删除客户端（只有所有者可以删除）
+// DELETE /api/developer/clients/:client_id
+func (h *DeveloperHandler) DeleteClient(c *gin.Context) {
+	if err := h.oauthService.DeleteDeveloperClient(c.GetUint("userID"), c.Param("client_id")); err != nil {
+		abortDeveloperError(c, "删除失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("客户端已删除", nil))
+}
+
+// RegenerateClientSecret 重新生成客户端密钥
+// POST /api/developer/clients/:client_id/secret
+func (h *DeveloperHandler) RegenerateClientSecret(c *gin.Context) {
+	result, err := h.oauthService.RegenerateDeveloperClientSecret(c.GetUint("userID"), c.Param("client_id"))
+	if err != nil {
+		abortDeveloperError(c, "生成密钥失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("密钥已重新生成", result))
+}
+
+// ListMembers 列出客户端的所有者、协作者和待接受的邀请
+// GET /api/developer/clients/:client_id/members
+func (h *DeveloperHandler) ListMembers(c *gin.Context) {
+	members, err := h.oauthService.ClientMembers(c.GetUint("userID"), c.Param("client_id"))
+	if err != nil {
+		abortDeveloperError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", members))
+}
+
+// InviteCollaborator 邀请协作者（向被邀请的邮箱发送通知）
+// POST /api/developer/clients/:client_id/invitations
+func (h *DeveloperHandler) InviteCollaborator(c *gin.Context) {
+	var req service.InviteCollaboratorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	invitation, err := h.oauthService.InviteCollaborator(c.GetUint("userID"), c.Param("client_id"), req)
+	if err != nil {
+		abortDeveloperError(c, "邀请失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("邀请已发送", invitation))
+}
+
+// CancelInvitation 撤回尚未接受的邀请
+// DELETE /api/developer/clients/:client_id/invitations/:id
+func (h *DeveloperHandler) CancelInvitation(c *gin.Context) {
+	id, ok := invitationID(c, "撤回失败")
+	if !ok {
+		return
+	}
+	if err := h.oauthService.CancelInvitation(c.GetUint("userID"), c.Param("client_id"), id); err != nil {
+		abortDeveloperError(c, "撤回失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("邀请已撤回", nil))
+}
+
+// RemoveCollaborator 移除协作者（所有者），或协作者退出协作
+// DELETE /api/developer/clients/:client_id/collaborators/:user_id
+func (h *DeveloperHandler) RemoveCollaborator(c *gin.Context) {
+	collaboratorID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("移除失败", service.ErrCollaboratorNotFound))
+		return
+	}
+	if err := h.oauthService.RemoveCollaborator(c.GetUint("userID"), c.Param("client_id"), uint(collaboratorID)); err != nil {
+		abortDeveloperError(c, "移除失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("协作者已移除", nil))
+}
+
+// TransferOwnership 把客户端转让给一位协作者（只有所有者可以转让）
+// POST /api/developer/clients/:client_id/owner
+func (h *DeveloperHandler) TransferOwnership(c *gin.Context) {
+	var req service.TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	client, err := h.oauthService.TransferClientOwnership(c.GetUint("userID"), c.Param("client_id"), req)
+	if err != nil {
+		abortDeveloperError(c, "转让失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("所有权已转让", client))
+}
+
+// ListInvitations 列出当前用户收到的协作邀请
+// GET /api/developer/invitations
+func (h *DeveloperHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.oauthService.ReceivedInvitations(c.GetUint("userID"))
+	if err != nil {
+		abortDeveloperError(c, "获取失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", invitations))
+}
+
+// AcceptInvitation 接受协作邀请
+// POST /api/developer/invitations/:id/accept
+func (h *DeveloperHandler) AcceptInvitation(c *gin.Context) {
+	id, ok := invitationID(c, "接受失败")
+	if !ok {
+		return
+	}
+	client, err := h.oauthService.AcceptInvitation(c.GetUint("userID"), id)
+	if err != nil {
+		abortDeveloperError(c, "接受失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已加入客户端", client))
+}
+
+// DeclineInvitation 拒绝协作邀请
+// DELETE /api/developer/invitations/:id
+func (h *DeveloperHandler) DeclineInvitation(c *gin.Context) {
+	id, ok := invitationID(c, "拒绝失败")
+	if !ok {
+		return
+	}
+	if err := h.oauthService.DeclineInvitation(c.GetUint("userID"), id); err != nil {
+		abortDeveloperError(c, "拒绝失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("已拒绝邀请", nil))
+}
+
+// invitationID 解析路径中的邀请ID，无效时返回 404
+func invitationID(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(message, service.ErrInvitationNotFound))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// abortDeveloperError 根据开发者接口的错误类型返回对应的状态码
+func abortDeveloperError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrClientNotFound), errors.Is(err, service.ErrInvitationNotFound),
+		errors.Is(err, service.ErrCollaboratorNotFound), errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrInvalidClientMetadata), errors.Is(err, service.ErrAlreadyCollaborator):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrNotClientOwner), errors.Is(err, service.ErrEmailNotVerified),
+		errors.Is(err, service.ErrTooManyClients):
+		c.JSON(http.StatusForbidden, models.ErrorResponse(message, err))
+	case errors.Is(err, service.ErrTooManyEmails):
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(message, err))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(message, err))
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// StartEmailLogin 发送登录链接和验证码
+// POST /api/auth/email-login
+// 无论邮箱是否注册都返回相同结果；浏览器绑定密钥写入 HttpOnly Cookie，验证码和登录链接只能在同一浏览器中使用
+func (h *AuthHandler) StartEmailLogin(c *gin.Context) {
+	var req service.EmailLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.SessionInfo = sessionInfo(c)
+	binding, err := h.authService.StartEmailLogin(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		case errors.Is(err, service.ErrTooManyEmails):
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse("发送失败", err))
+		case errors.Is(err, service.ErrInvalidContinuation):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("发送失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送失败", err))
+		}
+		return
+	}
+	setEmailLoginCookie(c, binding)
+	c.JSON(http.StatusOK, models.SuccessResponse("如果该邮箱已注册，登录邮件已发送", gin.H{
+		"expires_in": int(service.EmailLoginTTL.Seconds()),
+	}))
+}
+
+// VerifyEmailLogin 使用邮件中的验证码（或登录链接中的令牌）登录，响应与 /api/auth/login 相同
+// POST /api/auth/email-login/verify
+func (h *AuthHandler) VerifyEmailLogin(c *gin.Context) {
+	var req service.EmailLoginVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.Binding, _ = c.Cookie(service.EmailLoginCookieName)
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.FinishEmailLogin(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmailLogin), errors.Is(err, service.ErrEmailLoginBrowserMismatch):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("登录失败", err))
+		case errors.Is(err, service.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, models.ErrorResponse("登录失败", err))
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("登录失败", err))
+		}
+		return
+	}
+	clearEmailLoginCookie(c)
+
+	// 启用了两步验证时返回 MFA 令牌，由 /api/auth/mfa/verify 完成登录
+	if loginResp.MFARequired {
+		c.JSON(http.StatusOK, models.SuccessResponse("需要两步验证", loginResp))
+		return
+	}
+	h.respondLogin(c, loginResp)
+}
+
+// setEmailLoginCookie 写入邮件登录的浏览器绑定 Cookie（有效期与登录邮件相同）
+func setEmailLoginCookie(c *gin.Context, binding string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.EmailLoginCookieName, binding, int(service.EmailLoginTTL.Seconds()), "/", "", service.IsHTTPS(c.Request), true)
+}
+
+// clearEmailLoginCookie 登录完成后清除浏览器绑定 Cookie
+func clearEmailLoginCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.EmailLoginCookieName, "", -1, "/", "", service.IsHTTPS(c.Request), true)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// EndSessionRequest RP 发起的退出登录请求参数（OIDC RP-Initiated Logout 1.0）
+type EndSessionRequest struct {
+	IDTokenHint           string `form:"id_token_hint"`            // 之前签发给客户端的 ID Token
+	ClientID              string `form:"client_id"`                // 客户端ID
+	PostLogoutRedirectURI string `form:"post_logout_redirect_uri"` // 退出后重定向地址（必须预先注册）
+	State                 string `form:"state"`                    // 原样返回给客户端的状态
+}
+
+// validateEndSession 解析并验证退出登录请求，验证失败时渲染错误页面并返回 false
+func (h *PageHandler) validateEndSession(c *gin.Context) (*EndSessionRequest, *service.ValidatedLogout, bool) {
+	var req EndSessionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.renderError(c, http.StatusBadRequest, "invalid_request", "请求参数无效")
+		return nil, nil, false
+	}
+	logout, err := h.oauthService.ValidateLogoutRequest(service.LogoutRequest{
+		IDTokenHint:           req.IDTokenHint,
+		ClientID:              req.ClientID,
+		PostLogoutRedirectURI: req.PostLogoutRedirectURI,
+		State:                 req.State,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidIDTokenHint),
+			errors.Is(err, service.ErrInvalidPostLogoutRedirectURI),
+			errors.Is(err, service.ErrInvalidClient):
+			h.renderError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		default:
+			log.Printf("验证退出登录请求失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "退出登录失败，请稍后重试")
+		}
+		return nil, nil, false
+	}
+	return &req, logout, true
+}
+
+// EndSession 退出登录端点（end_session_endpoint）
+// GET /oauth/end_session?id_token_hint=xxx&post_logout_redirect_uri=xxx&state=xxx
+// id_token_hint 对应当前会话时直接退出；否则显示退出确认页面，防止第三方网站强制用户退出
+func (h *PageHandler) EndSession(c *gin.Context) {
+	// 1. POST 请求转为 GET，跨站 POST 不会携带 SameSite=Lax 的会话 Cookie
+	if c.Request.Method == http.MethodPost {
+		if err := c.Request.ParseForm(); err != nil {
+			h.renderError(c, http.StatusBadRequest, "invalid_request", "请求参数无效")
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/oauth/end_session?"+c.Request.PostForm.Encode())
+		return
+	}
+
+	// 2. 验证请求
+	req, logout, ok := h.validateEndSession(c)
+	if !ok {
+		return
+	}
+
+	// 3. 未登录或 id_token_hint 对应当前会话时，直接完成退出
+	session := currentSession(c)
+	if session == nil || (logout.Hint != nil && logout.Hint.SessionID == session.SessionID && logout.Hint.UserID == session.UserID) {
+		h.finishLogout(c, session, logout)
+		return
+	}
+
+	// 4. 显示退出确认页面
+	h.render(c, http.StatusOK, "logout", gin.H{
+		"User":    h.currentUser(c),
+		"Client":  logout.Client,
+		"Request": req,
+	})
+}
+
+// finishLogout 结束会话，通知客户端，然后重定向到 post_logout_redirect_uri 或显示已退出页面
+// 有前端通道注销地址时，在已退出页面中通过隐藏的 iframe 加载，加载完成后再重定向
+func (h *PageHandler) finishLogout(c *gin.Context, session *service.SessionClaims, logout *service.ValidatedLogout) {
+	// 1. 结束会话（同时发送后端通道注销通知）
+	var frontchannelURLs []string
+	if session != nil {
+		ended, err := h.authService.EndSession(session.SessionID)
+		if err != nil {
+			log.Printf("退出登录失败: %v", err)
+		}
+		if ended != nil {
+			frontchannelURLs = h.oauthService.FrontchannelLogoutURLs([]models.Session{*ended})
+		}
+	}
+	clearSessionCookie(c)
+
+	// 2. 不需要前端通道通知时直接重定向
+	if logout.RedirectURL != "" && len(frontchannelURLs) == 0 {
+		c.Redirect(http.StatusSeeOther, logout.RedirectURL)
+		return
+	}
+	h.render(c, http.StatusOK, "logout", gin.H{
+		"LoggedOut":        true,
+		"Client":           logout.Client,
+		"RedirectURL":      logout.RedirectURL,
+		"FrontchannelURLs": frontchannelURLs,
+	})
+}
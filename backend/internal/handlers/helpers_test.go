@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testIssuer      = "https://auth.example.com"         // 测试使用的签发者标识
+	testSecret      = "test-secret"                      // 测试使用的 JWT 签名密钥
+	testRedirectURI = "https://app.example.com/callback" // 测试客户端的重定向地址
+)
+
+// newTestDB 为当前测试创建独立的 SQLite 数据库（替换全局连接），测试结束后关闭
+func newTestDB(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() { database.Close() })
+	if err := database.AutoMigrate(
+		&models.User{},
+		&models.OAuthClient{},
+		&models.AuthorizationCode{},
+		&models.DeviceCode{},
+		&models.AccessToken{},
+		&models.ProtectedResource{},
+		&models.AuthorizationDetailType{},
+		&models.Consent{},
+		&models.Session{},
+		&models.VerificationToken{},
+		&models.AuditEvent{},
+		&models.LoginThrottle{},
+		&models.RecoveryCode{},
+		&models.Role{},
+		&models.UserRole{},
+	); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+}
+
+// authorizeFixture 授权端点测试使用的服务、用户和客户端（用户已同意授予 profile）
+type authorizeFixture struct {
+	oauthService *service.OAuthService
+	authService  *service.AuthService
+	handler      *OAuthHandler
+	user         *models.User
+	client       *models.OAuthClient
+}
+
+// newAuthorizeFixture 创建已验证邮箱的用户 alice@example.com 和客户端 test_client
+func newAuthorizeFixture(t *testing.T) *authorizeFixture {
+	t.Helper()
+	newTestDB(t)
+	now := time.Now()
+	user := &models.User{Email: "alice@example.com", Password: "x", Name: "alice", EmailVerified: true, EmailVerifiedAt: &now}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	client := &models.OAuthClient{ClientID: "test_client", ClientSecret: "secret", Name: "Test App", RedirectURI: testRedirectURI}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	oauthService := service.NewOAuthService(testSecret, 1, testIssuer)
+	if err := oauthService.SaveConsent(user.ID, client.ClientID, "profile", nil); err != nil {
+		t.Fatalf("保存授权记录失败: %v", err)
+	}
+	authService := service.NewAuthService(testSecret, 1, testIssuer)
+	return &authorizeFixture{
+		oauthService: oauthService,
+		authService:  authService,
+		handler:      NewOAuthHandler(oauthService, authService, "/login", "/consent"),
+		user:         user,
+		client:       client,
+	}
+}
+
+// session 返回用户在 authTime 登录的会话
+func (f *authorizeFixture) session(authTime time.Time, amr ...string) *service.SessionClaims {
+	if len(amr) == 0 {
+		amr = []string{service.AMRPassword}
+	}
+	return &service.SessionClaims{UserID: f.user.ID, SessionID: "sid", AuthTime: authTime, AMR: amr}
+}
+
+// authorize 以指定的会话（nil 表示未登录）请求授权端点
+func (f *authorizeFixture) authorize(session *service.SessionClaims, query url.Values) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/oauth/authorize", func(c *gin.Context) {
+		if session != nil {
+			c.Set("session", session)
+		}
+		f.handler.Authorize(c)
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil))
+	return rec
+}
+
+// authorizeQuery 测试客户端的授权请求参数，extra 中的参数覆盖默认值
+func authorizeQuery(extra url.Values) url.Values {
+	query := url.Values{
+		"client_id":     {"test_client"},
+		"redirect_uri":  {testRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"profile"},
+		"state":         {"xyz"},
+	}
+	for key, values := range extra {
+		query[key] = values
+	}
+	return query
+}
+
+// redirectLocation 检查响应是 302 重定向并返回解析后的地址
+func redirectLocation(t *testing.T, rec *httptest.ResponseRecorder) *url.URL {
+	t.Helper()
+	if rec.Code != http.StatusFound {
+		t.Fatalf("状态码 = %d，期望 302: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("解析重定向地址失败: %v", err)
+	}
+	return location
+}
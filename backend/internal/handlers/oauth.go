@@ -1,8 +1,9 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
-	"net/url"
 
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
@@ -13,108 +14,53 @@ import (
 type OAuthHandler struct {
 	oauthService *service.OAuthService
 	authService  *service.AuthService
+	loginURL     string // 登录页地址
+	consentURL   string // 授权确认页地址
 }
 
 // NewOAuthHandler 创建 OAuth 处理器实例
-func NewOAuthHandler(oauthService *service.OAuthService, authService *service.AuthService) *OAuthHandler {
+// loginURL 和 consentURL 为浏览器访问授权端点时，需要用户登录或确认授权时跳转的页面
+func NewOAuthHandler(oauthService *service.OAuthService, authService *service.AuthService, loginURL, consentURL string) *OAuthHandler {
 	return &OAuthHandler{
 		oauthService: oauthService,
 		authService:  authService,
+		loginURL:     loginURL,
+		consentURL:   consentURL,
 	}
 }
 
-// AuthorizeRequest 授权请求参数
-type AuthorizeRequest struct {
-	ClientID     string `form:"client_id" binding:"required"`     // 客户端ID
-	RedirectURI  string `form:"redirect_uri" binding:"required"`  // 重定向URI
-	ResponseType string `form:"response_type" binding:"required"` // 响应类型（固定为 "code"）
-	State        string `form:"state"`                            // 状态参数（用于防止CSRF攻击）
-}
-
-// Authorize 授权端点
-// GET /oauth/authorize?client_id=xxx&redirect_uri=xxx&response_type=code&state=xxx
-// 这是 OAuth 2.0 的第一步：第三方应用引导用户到这里进行授权
-func (h *OAuthHandler) Authorize(c *gin.Context) {
-	var req AuthorizeRequest
-
-	// 1. 解析查询参数
-	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
-		return
-	}
-
-	// 2. 验证响应类型（简化版只支持授权码模式）
-	if req.ResponseType != "code" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("不支持的响应类型", nil))
-		return
-	}
-
-	// 3. 验证客户端
-	client, err := h.oauthService.ValidateClientID(req.ClientID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的客户端", err))
-		return
-	}
-
-	// 4. 验证重定向URI
-	if err := h.oauthService.ValidateRedirectURI(client, req.RedirectURI); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("重定向URI不匹配", err))
-		return
-	}
-
-	// 5. 检查用户是否已登录（通过 JWT Token）
-	// 如果未登录，需要先登录
-	userID, exists := c.Get("userID")
-	if !exists {
-		// 未登录，重定向到登录页（登录后返回这里）
-		// 简化版：直接返回需要登录的提示
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse("请先登录", nil))
-		return
-	}
-
-	// 6. 生成授权码
-	code, err := h.oauthService.GenerateAuthorizationCode(
-		req.ClientID,
-		userID.(uint),
-		req.RedirectURI,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成授权码失败", err))
-		return
-	}
-
-	// 7. 重定向到客户端，带上授权码
-	// 格式：redirect_uri?code=xxx&state=xxx
-	redirectURL, _ := url.Parse(req.RedirectURI)
-	query := redirectURL.Query()
-	query.Set("code", code)
-	if req.State != "" {
-		query.Set("state", req.State) // 原样返回 state 参数
-	}
-	redirectURL.RawQuery = query.Encode()
-
-	c.Redirect(http.StatusFound, redirectURL.String())
-}
-
 // TokenRequest Token 请求参数
 type TokenRequest struct {
-	GrantType    string `form:"grant_type" binding:"required"`    // 授权类型（固定为 "authorization_code"）
-	Code         string `form:"code" binding:"required"`          // 授权码
-	RedirectURI  string `form:"redirect_uri" binding:"required"`  // 重定向URI（必须与授权时一致）
-	ClientID     string `form:"client_id" binding:"required"`     // 客户端ID
-	ClientSecret string `form:"client_secret" binding:"required"` // 客户端密钥
+	GrantType    string   `form:"grant_type" binding:"required"` // 授权类型（authorization_code 或 urn:ietf:params:oauth:grant-type:device_code）
+	Code         string   `form:"code"`                          // 授权码（授权码模式必填）
+	RedirectURI  string   `form:"redirect_uri"`                  // 重定向URI（授权码模式必填，必须与授权时一致）
+	DeviceCode   string   `form:"device_code"`                   // 设备代码（设备授权必填，RFC 8628）
+	ClientID     string   `form:"client_id" binding:"required"`  // 客户端ID
+	ClientSecret string   `form:"client_secret"`                 // 客户端密钥（双向 TLS 认证的客户端无需提供）
+	Resource     []string `form:"resource"`                      // 目标资源（RFC 8707，必须是授权时资源的子集）
 }
 
 // TokenResponse Token 响应
 type TokenResponse struct {
-	AccessToken string `json:"access_token"` // Access Token
-	TokenType   string `json:"token_type"`   // Token 类型（固定为 "Bearer"）
-	ExpiresIn   int64  `json:"expires_in"`   // 过期时间（秒）
+	AccessToken          string          `json:"access_token"`                    // Access Token
+	TokenType            string          `json:"token_type"`                      // Token 类型（"Bearer" 或 "DPoP"）
+	ExpiresIn            int64           `json:"expires_in"`                      // 过期时间（秒）
+	Scope                string          `json:"scope,omitempty"`                 // 权限范围
+	AuthorizationDetails json.RawMessage `json:"authorization_details,omitempty"` // 授予的授权详情（RFC 9396）
+	IDToken              string          `json:"id_token,omitempty"`              // ID Token（请求了 openid 权限时返回）
+}
+
+// deviceGrantErrors 设备轮询 Token 端点时，用户尚未完成授权等情况对应的错误码（RFC 8628 3.5）
+var deviceGrantErrors = map[error]string{
+	service.ErrAuthorizationPending: "authorization_pending",
+	service.ErrSlowDown:             "slow_down",
+	service.ErrExpiredDeviceCode:    "expired_token",
+	service.ErrDeviceAccessDenied:   "access_denied",
 }
 
 // Token Token 端点
 // POST /oauth/token
-// 这是 OAuth 2.0 的第二步：第三方应用用授权码交换 Access Token
+// 这是 OAuth 2.0 的第二步：第三方应用用授权码交换 Access Token；设备用设备代码轮询 Access Token（RFC 8628）
 func (h *OAuthHandler) Token(c *gin.Context) {
 	var req TokenRequest
 
@@ -124,73 +70,322 @@ func (h *OAuthHandler) Token(c *gin.Context) {
 		return
 	}
 
-	// 2. 验证授权类型（简化版只支持授权码模式）
-	if req.GrantType != "authorization_code" {
+	// 2. 验证授权类型和对应的必填参数
+	switch req.GrantType {
+	case models.GrantTypeAuthorizationCode:
+		if req.Code == "" || req.RedirectURI == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", errors.New("缺少 code 或 redirect_uri")))
+			return
+		}
+	case models.GrantTypeDeviceCode:
+		if req.DeviceCode == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", errors.New("缺少 device_code")))
+			return
+		}
+	default:
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("不支持的授权类型", nil))
 		return
 	}
 
-	// 3. 用授权码交换 Access Token
-	accessToken, err := h.oauthService.ExchangeAuthorizationCode(
-		req.Code,
-		req.ClientID,
-		req.ClientSecret,
-		req.RedirectURI,
-	)
+	// 3. 如果携带了 DPoP 证明，签发的 Token 将绑定到证明公钥（RFC 9449）
+	var binding service.TokenBinding
+	if proof := c.GetHeader("DPoP"); proof != "" {
+		dpopProof, err := h.oauthService.ValidateDPoPProof(proof, c.Request.Method, service.RequestURL(c.Request), "")
+		if err != nil {
+			// RFC 9449 5.：证明无效时返回 invalid_dpop_proof 错误码
+			c.JSON(http.StatusBadRequest, models.Response{Message: "无效的 DPoP 证明: " + err.Error(), Error: "invalid_dpop_proof"})
+			return
+		}
+		binding.JKT = dpopProof.JKT
+	}
+
+	// 4. 通过双向 TLS 出示了客户端证书时，Token 同时绑定到该证书（RFC 8705）
+	cert := service.ClientCertificate(c.Request)
+	if cert != nil {
+		binding.X5tS256 = service.CertificateThumbprint(cert)
+	}
+
+	// 5. 用授权码或设备代码交换 Access Token
+	client := service.ClientCredentials{
+		ClientID:     req.ClientID,
+		ClientSecret: req.ClientSecret,
+		Certificate:  cert,
+		Chain:        service.ClientCertificateChain(c.Request),
+		IPAddress:    c.ClientIP(),
+	}
+	var accessToken *models.AccessToken
+	var err error
+	if req.GrantType == models.GrantTypeDeviceCode {
+		accessToken, err = h.oauthService.ExchangeDeviceCode(service.DeviceCodeExchangeRequest{
+			DeviceCode: req.DeviceCode,
+			Client:     client,
+			Resources:  req.Resource,
+			Binding:    binding,
+		})
+	} else {
+		accessToken, err = h.oauthService.ExchangeAuthorizationCode(service.CodeExchangeRequest{
+			Code:        req.Code,
+			RedirectURI: req.RedirectURI,
+			Client:      client,
+			Resources:   req.Resource,
+			Binding:     binding,
+		})
+	}
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidTarget) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的资源", err))
+			return
+		}
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			abortThrottled(c, err)
+			return
+		}
+		if code, ok := deviceGrantErrors[err]; ok {
+			// 设备根据错误码决定继续轮询、降低频率还是停止
+			c.JSON(http.StatusBadRequest, models.Response{Message: err.Error(), Error: code})
+			return
+		}
 		switch err {
 		case service.ErrInvalidClient:
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的客户端", err))
 		case service.ErrInvalidRedirectURI:
 			c.JSON(http.StatusBadRequest, models.ErrorResponse("重定向URI不匹配", err))
+		case service.ErrUnauthorizedClient:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("客户端未获授权", err))
 		case service.ErrInvalidAuthorizationCode, service.ErrAuthorizationCodeUsed:
 			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的授权码", err))
+		case service.ErrInvalidDeviceCode:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的设备代码", err))
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse("交换Token失败", err))
 		}
 		return
 	}
 
-	// 4. 返回 Access Token（按照 OAuth 2.0 标准格式）
+	// 6. 返回 Access Token（按照 OAuth 2.0 标准格式）
+	tokenType := "Bearer"
+	if accessToken.IsDPoPBound() {
+		tokenType = "DPoP"
+	}
 	expiresIn := int64(accessToken.ExpiresAt.Sub(accessToken.CreatedAt).Seconds())
 	c.JSON(http.StatusOK, TokenResponse{
-		AccessToken: accessToken.Token,
-		TokenType:   "Bearer",
-		ExpiresIn:   expiresIn,
+		AccessToken:          accessToken.Token,
+		TokenType:            tokenType,
+		ExpiresIn:            expiresIn,
+		Scope:                accessToken.Scope,
+		AuthorizationDetails: rawJSON(accessToken.AuthorizationDetails),
+		IDToken:              accessToken.IDToken,
 	})
 }
 
-// UserInfoRequest 用户信息请求
-type UserInfoRequest struct {
-	AccessToken string `form:"access_token" binding:"required"` // Access Token
+// DeviceAuthorizationRequest 设备授权请求参数（RFC 8628 3.1）
+type DeviceAuthorizationRequest struct {
+	ClientID     string   `form:"client_id" binding:"required"` // 客户端ID
+	ClientSecret string   `form:"client_secret"`                // 客户端密钥（双向 TLS 认证的客户端无需提供）
+	Scope        string   `form:"scope"`                        // 权限范围（空格分隔）
+	Resource     []string `form:"resource"`                     // 目标资源（RFC 8707，可出现多次）
 }
 
-// UserInfo 用户信息端点
-// GET /oauth/userinfo?access_token=xxx
-// 第三方应用使用 Access Token 获取用户信息
-func (h *OAuthHandler) UserInfo(c *gin.Context) {
-	// 1. 从查询参数或 Header 获取 Token
-	token := c.Query("access_token")
-	if token == "" {
-		// 尝试从 Authorization Header 获取
-		authHeader := c.GetHeader("Authorization")
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			token = authHeader[7:]
+// DeviceAuthorization 设备授权端点（RFC 8628）
+// POST /oauth/device_authorization
+// 没有浏览器或输入不便的设备用它获取设备代码和用户代码，用户在其他设备上打开 /device 输入用户代码完成授权
+func (h *OAuthHandler) DeviceAuthorization(c *gin.Context) {
+	var req DeviceAuthorizationRequest
+
+	// 1. 解析请求参数
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	// 2. 发起设备授权
+	resp, err := h.oauthService.StartDeviceAuthorization(service.DeviceAuthorizationRequest{
+		Client: service.ClientCredentials{
+			ClientID:     req.ClientID,
+			ClientSecret: req.ClientSecret,
+			Certificate:  service.ClientCertificate(c.Request),
+			Chain:        service.ClientCertificateChain(c.Request),
+			IPAddress:    c.ClientIP(),
+		},
+		Scope:     req.Scope,
+		Resources: req.Resource,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTooManyAttempts):
+			abortThrottled(c, err)
+		case errors.Is(err, service.ErrInvalidClient):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的客户端", err))
+		case errors.Is(err, service.ErrUnauthorizedClient):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("客户端未获授权", err))
+		case errors.Is(err, service.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的权限范围", err))
+		case errors.Is(err, service.ErrInvalidTarget):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的资源", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("发起设备授权失败", err))
 		}
+		return
 	}
 
-	if token == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("缺少 access_token", nil))
+	// 3. 返回设备代码和用户代码（按照 RFC 8628 标准格式）
+	c.JSON(http.StatusOK, resp)
+}
+
+// UserInfo 用户信息端点
+// GET /oauth/userinfo
+// 第三方应用使用 Access Token 获取用户信息（Token 由 OAuthTokenAuth 中间件验证）
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	// 1. 从上下文中获取 Token 信息
+	claims, exists := c.Get("accessToken")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("缺少 access_token", nil))
 		return
 	}
 
-	// 2. 使用 Token 获取用户信息
-	user, err := h.oauthService.GetUserInfo(token)
+	// 2. 获取用户信息
+	user, err := h.oauthService.GetUserInfo(claims.(*service.AccessTokenClaims))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的 Token", err))
 		return
 	}
 
-	// 3. 返回用户信息（不包含敏感信息）
-	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", user.ToResponse()))
+	// 3. 授权包含 roles 权限范围时返回用户角色
+	resp := user.ToResponse()
+	if resp.Roles, err = h.oauthService.RoleClaims(user.ID, claims.(*service.AccessTokenClaims).Scope); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取用户信息失败", err))
+		return
+	}
+
+	// 4. 返回用户信息（不包含敏感信息）
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", resp))
+}
+
+// IntrospectRequest Token 内省请求参数
+type IntrospectRequest struct {
+	Token        string `form:"token" binding:"required"`     // 待检查的 Token
+	ClientID     string `form:"client_id" binding:"required"` // 调用方客户端ID
+	ClientSecret string `form:"client_secret"`                // 调用方客户端密钥
+}
+
+// Introspect Token 内省端点（RFC 7662）
+// POST /oauth/introspect
+// 资源服务器用来检查 Token 是否有效，并通过 aud 确认 Token 是签发给自己的
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	var req IntrospectRequest
+
+	// 1. 解析请求参数
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+
+	// 2. 内省 Token
+	resp, err := h.oauthService.IntrospectToken(service.ClientCredentials{
+		ClientID:     req.ClientID,
+		ClientSecret: req.ClientSecret,
+		Certificate:  service.ClientCertificate(c.Request),
+		Chain:        service.ClientCertificateChain(c.Request),
+		IPAddress:    c.ClientIP(),
+	}, req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			abortThrottled(c, err)
+			return
+		}
+		switch err {
+		case service.ErrInvalidClient:
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的客户端", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("Token 内省失败", err))
+		}
+		return
+	}
+
+	// 3. 返回内省结果（按照 RFC 7662 标准格式）
+	c.JSON(http.StatusOK, resp)
+}
+
+// AuthorizationServerMetadata 授权服务器元数据（RFC 8414）
+type AuthorizationServerMetadata struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint        string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                   string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint              string   `json:"introspection_endpoint"`
+	ResponseTypesSupported             []string `json:"response_types_supported"`
+	GrantTypesSupported                []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+	DPoPSigningAlgValuesSupported      []string `json:"dpop_signing_alg_values_supported"`
+	TLSClientCertificateBoundTokens    bool     `json:"tls_client_certificate_bound_access_tokens"`
+	AuthorizationDetailsTypes          []string `json:"authorization_details_types_supported"`
+	AuthorizationResponseIssSupported  bool     `json:"authorization_response_iss_parameter_supported"`
+	PromptValuesSupported              []string `json:"prompt_values_supported"`
+	JWKSURI                            string   `json:"jwks_uri"`
+	EndSessionEndpoint                 string   `json:"end_session_endpoint"`
+	ScopesSupported                    []string `json:"scopes_supported"`
+	SubjectTypesSupported              []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	ACRValuesSupported                 []string `json:"acr_values_supported"`
+	FrontchannelLogoutSupported        bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported bool     `json:"frontchannel_logout_session_supported"`
+	BackchannelLogoutSupported         bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported  bool     `json:"backchannel_logout_session_supported"`
+}
+
+// Metadata 授权服务器元数据端点
+// GET /.well-known/oauth-authorization-server
+// GET /.well-known/openid-configuration（OIDC Discovery，内容相同）
+func (h *OAuthHandler) Metadata(c *gin.Context) {
+	issuer := h.oauthService.Issuer()
+	detailTypes, err := h.oauthService.AuthorizationDetailTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取元数据失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, AuthorizationServerMetadata{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       issuer + "/oauth/authorize",
+		TokenEndpoint:               issuer + "/oauth/token",
+		DeviceAuthorizationEndpoint: issuer + "/oauth/device_authorization",
+		UserInfoEndpoint:            issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:       issuer + "/oauth/introspect",
+		ResponseTypesSupported:      []string{"code"},
+		GrantTypesSupported:         []string{models.GrantTypeAuthorizationCode, models.GrantTypeDeviceCode},
+		TokenEndpointAuthMethodsSupported: []string{
+			models.AuthMethodClientSecretPost,
+			models.AuthMethodTLSClientAuth,
+			models.AuthMethodSelfSignedTLSClientAuth,
+		},
+		DPoPSigningAlgValuesSupported:      service.DPoPSigningAlgs,
+		TLSClientCertificateBoundTokens:    true,
+		AuthorizationDetailsTypes:          detailTypes,
+		AuthorizationResponseIssSupported:  true,
+		PromptValuesSupported:              []string{promptNone, promptLogin, promptConsent, promptSelectAccount},
+		JWKSURI:                            issuer + "/.well-known/jwks.json",
+		EndSessionEndpoint:                 issuer + "/oauth/end_session",
+		ScopesSupported:                    []string{service.ScopeOpenID, service.ScopeRoles},
+		SubjectTypesSupported:              []string{"public"},
+		IDTokenSigningAlgValuesSupported:   []string{"RS256"},
+		ACRValuesSupported:                 []string{service.ACRSingleFactor, service.ACRMultiFactor},
+		FrontchannelLogoutSupported:        true,
+		FrontchannelLogoutSessionSupported: true,
+		BackchannelLogoutSupported:         true,
+		BackchannelLogoutSessionSupported:  true,
+	})
+}
+
+// JWKS 公钥集合端点，客户端用来验证 ID Token 和注销 Token 的签名
+// GET /.well-known/jwks.json
+func (h *OAuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.oauthService.JWKS()})
+}
+
+// rawJSON 将已规范化的 JSON 字符串原样输出，为空时省略
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
 }
@@ -0,0 +1,719 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/middleware"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/web"
+	"github.com/gin-gonic/gin"
+)
+
+// PageHandler 授权服务器托管页面处理器（登录、注册、授权确认、设备授权、退出和错误页面）
+// 不依赖前端应用即可完成浏览器授权流程
+type PageHandler struct {
+	*OAuthHandler
+	renderer *web.Renderer
+}
+
+// NewPageHandler 创建托管页面处理器实例
+func NewPageHandler(oauthHandler *OAuthHandler, renderer *web.Renderer) *PageHandler {
+	return &PageHandler{
+		OAuthHandler: oauthHandler,
+		renderer:     renderer,
+	}
+}
+
+// render 渲染页面，自动带上 CSRF Token，并禁止页面被嵌入其他网站（防止点击劫持）
+// 页面地址中可能带有一次性令牌（如重置密码链接），不通过 Referer 发送给其他网站
+func (h *PageHandler) render(c *gin.Context, status int, page string, data gin.H) {
+	data["CSRFToken"] = middleware.CSRFToken(c)
+	body, err := h.renderer.Render(page, data)
+	if err != nil {
+		log.Printf("渲染页面失败: %v", err)
+		c.String(http.StatusInternalServerError, "页面渲染失败")
+		return
+	}
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Data(status, "text/html; charset=utf-8", body)
+}
+
+// renderError 渲染错误页面
+func (h *PageHandler) renderError(c *gin.Context, status int, code, message string) {
+	h.render(c, status, "error", gin.H{"Code": code, "Message": message})
+}
+
+// rejectInvalidCSRF 校验表单的 CSRF Token，无效时渲染错误页面并返回 true
+func (h *PageHandler) rejectInvalidCSRF(c *gin.Context) bool {
+	if middleware.ValidCSRF(c) {
+		return false
+	}
+	h.renderError(c, http.StatusForbidden, "invalid_csrf_token", "页面已过期，请返回重试")
+	return true
+}
+
+// currentUser 获取当前登录的用户（未登录时返回 nil）
+func (h *PageHandler) currentUser(c *gin.Context) *models.User {
+	session := currentSession(c)
+	if session == nil {
+		return nil
+	}
+	user, err := h.authService.GetUserByID(session.UserID)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// continuationClient 获取 continuation 对应的客户端，用于在登录页展示客户端品牌
+func (h *PageHandler) continuationClient(continuation string) *models.OAuthClient {
+	if continuation == "" {
+		return nil
+	}
+	cont, err := h.authService.ParseContinuation(continuation)
+	if err != nil {
+		return nil
+	}
+	query, err := url.ParseQuery(cont.Query)
+	if err != nil {
+		return nil
+	}
+	client, err := h.oauthService.ValidateClientID(query.Get("client_id"))
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// LoginPage 登录页面
+// GET /login?continue=xxx&login_hint=xxx
+// 授权请求要求更高的认证级别时（step_up=1），已登录用户直接进入两步验证
+func (h *PageHandler) LoginPage(c *gin.Context) {
+	continuation := c.Query("continue")
+	if session := currentSession(c); session != nil && c.Query("step_up") != "" {
+		loginResp, err := h.authService.BeginStepUp(session, service.StepUpRequest{Continue: continuation})
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidContinuation) {
+				h.renderError(c, http.StatusBadRequest, "invalid_request", err.Error())
+				return
+			}
+			log.Printf("提升认证级别失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "登录失败，请稍后重试")
+			return
+		}
+		h.renderMFA(c, http.StatusOK, loginResp.MFAToken, "")
+		return
+	}
+	h.render(c, http.StatusOK, "login", gin.H{
+		"Continue":   continuation,
+		"Email":      c.Query("login_hint"),
+		"Registered": c.Query("registered") != "",
+		"User":       h.currentUser(c),
+		"Client":     h.continuationClient(continuation),
+	})
+}
+
+// Login 提交登录表单
+// POST /login
+func (h *PageHandler) Login(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 登录（continue 由服务层校验）
+	req := service.LoginRequest{
+		Email:    c.PostForm("email"),
+		Password: c.PostForm("password"),
+		Continue: c.PostForm("continue"),
+		Mode:     service.SessionModeCookie,
+	}
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.Login(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidContinuation):
+			h.renderError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrTooManyAttempts),
+			errors.Is(err, service.ErrAccountDisabled), errors.Is(err, service.ErrPasswordResetRequired):
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, service.ErrTooManyAttempts):
+				status = http.StatusTooManyRequests
+				setRetryAfter(c, err)
+			case errors.Is(err, service.ErrAccountDisabled), errors.Is(err, service.ErrPasswordResetRequired):
+				status = http.StatusForbidden
+			}
+			h.render(c, status, "login", gin.H{
+				"Continue": req.Continue,
+				"Email":    req.Email,
+				"Error":    err.Error(),
+				"Client":   h.continuationClient(req.Continue),
+			})
+		default:
+			log.Printf("登录失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "登录失败，请稍后重试")
+		}
+		return
+	}
+
+	// 3. 启用了两步验证时先输入验证码
+	if loginResp.MFARequired {
+		h.renderMFA(c, http.StatusOK, loginResp.MFAToken, "")
+		return
+	}
+
+	// 4. 写入会话 Cookie，回到授权端点继续授权（没有 continue 时回到登录页显示登录状态）
+	setSessionCookie(c, loginResp.SessionToken, h.authService.SessionExpire())
+	c.Redirect(http.StatusSeeOther, loginRedirectURL(loginResp))
+}
+
+// loginRedirectURL 登录完成后的跳转地址（没有 continue 时回到登录页显示登录状态）
+func loginRedirectURL(loginResp *service.LoginResponse) string {
+	if loginResp.RedirectURL == "" {
+		return "/login"
+	}
+	return loginResp.RedirectURL
+}
+
+// renderMFA 渲染两步验证页面，需要强制启用两步验证的账户同时展示验证器密钥
+func (h *PageHandler) renderMFA(c *gin.Context, status int, mfaToken, message string) {
+	data := gin.H{"MFAToken": mfaToken, "Error": message}
+	for _, method := range h.authService.PendingMFAMethods(mfaToken) {
+		switch method {
+		case service.MFAMethodTOTP:
+			data["TOTP"] = true
+		case service.MFAMethodWebAuthn:
+			data["Passkey"] = true
+		}
+	}
+	if userID, err := h.authService.EnrollmentUserID(mfaToken); err == nil {
+		setup, err := h.authService.PendingTOTPSetup(userID)
+		if err != nil {
+			log.Printf("生成 TOTP 密钥失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "登录失败，请稍后重试")
+			return
+		}
+		data["Setup"] = setup
+	}
+	h.render(c, status, "mfa", data)
+}
+
+// LoginMFA 提交两步验证码
+// POST /login/mfa
+func (h *PageHandler) LoginMFA(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 验证验证码
+	req := service.MFAVerifyRequest{
+		MFAToken: c.PostForm("mfa_token"),
+		Code:     c.PostForm("code"),
+	}
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.VerifyMFA(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFAToken):
+			h.render(c, http.StatusUnauthorized, "login", gin.H{"Error": "两步验证已过期，请重新登录"})
+		case errors.Is(err, service.ErrInvalidMFACode):
+			h.renderMFA(c, http.StatusUnauthorized, req.MFAToken, err.Error())
+		case errors.Is(err, service.ErrAccountDisabled):
+			h.render(c, http.StatusForbidden, "login", gin.H{"Error": err.Error()})
+		case errors.Is(err, service.ErrTooManyAttempts):
+			setRetryAfter(c, err)
+			h.renderMFA(c, http.StatusTooManyRequests, req.MFAToken, err.Error())
+		default:
+			log.Printf("两步验证失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "登录失败，请稍后重试")
+		}
+		return
+	}
+
+	// 3. 写入会话 Cookie（提升认证级别时沿用原有会话）；首次启用时先展示恢复码，再继续授权
+	if loginResp.SessionToken != "" {
+		setSessionCookie(c, loginResp.SessionToken, h.authService.SessionExpire())
+	}
+	if len(loginResp.RecoveryCodes) > 0 {
+		h.render(c, http.StatusOK, "mfa", gin.H{
+			"RecoveryCodes": loginResp.RecoveryCodes,
+			"Next":          loginRedirectURL(loginResp),
+		})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, loginRedirectURL(loginResp))
+}
+
+// EmailLoginPage 邮件登录页面
+// GET /login/email?continue=xxx&email=xxx，以及登录邮件中的链接 GET /login/email?token=xxx
+// 打开链接只显示确认按钮，提交后才登录，避免邮件安全网关预先访问链接时产生副作用
+func (h *PageHandler) EmailLoginPage(c *gin.Context) {
+	continuation := c.Query("continue")
+	h.render(c, http.StatusOK, "email_login", gin.H{
+		"Token":    c.Query("token"),
+		"Continue": continuation,
+		"Email":    c.Query("email"),
+		"Client":   h.continuationClient(continuation),
+	})
+}
+
+// EmailLoginSend 提交邮箱，发送登录链接和验证码（无论邮箱是否注册都显示验证码输入框）
+// POST /login/email/send
+func (h *PageHandler) EmailLoginSend(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	req := service.EmailLoginRequest{
+		Email:    c.PostForm("email"),
+		Continue: c.PostForm("continue"),
+	}
+	req.SessionInfo = sessionInfo(c)
+	binding, err := h.authService.StartEmailLogin(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidContinuation):
+			h.renderError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		case errors.Is(err, service.ErrTooManyAttempts), errors.Is(err, service.ErrTooManyEmails):
+			setRetryAfter(c, err)
+			h.render(c, http.StatusTooManyRequests, "email_login", gin.H{
+				"Continue": req.Continue,
+				"Email":    req.Email,
+				"Error":    err.Error(),
+				"Client":   h.continuationClient(req.Continue),
+			})
+		default:
+			log.Printf("发送登录邮件失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "发送失败，请稍后重试")
+		}
+		return
+	}
+	setEmailLoginCookie(c, binding)
+	h.render(c, http.StatusOK, "email_login", gin.H{"Sent": true, "Email": req.Email})
+}
+
+// EmailLogin 提交邮件中的验证码或确认登录链接
+// POST /login/email
+func (h *PageHandler) EmailLogin(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 验证验证码或登录链接（必须携带发起登录时写入的绑定 Cookie）
+	req := service.EmailLoginVerifyRequest{
+		Code:  c.PostForm("code"),
+		Token: c.PostForm("token"),
+		Mode:  service.SessionModeCookie,
+	}
+	req.Binding, _ = c.Cookie(service.EmailLoginCookieName)
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.FinishEmailLogin(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmailLogin) && req.Token == "":
+			h.render(c, http.StatusUnauthorized, "email_login", gin.H{"Sent": true, "Email": c.PostForm("email"), "Error": err.Error()})
+		case errors.Is(err, service.ErrInvalidEmailLogin), errors.Is(err, service.ErrEmailLoginBrowserMismatch):
+			h.render(c, http.StatusUnauthorized, "email_login", gin.H{"Error": err.Error()})
+		case errors.Is(err, service.ErrAccountDisabled):
+			h.render(c, http.StatusForbidden, "email_login", gin.H{"Error": err.Error()})
+		case errors.Is(err, service.ErrTooManyAttempts):
+			setRetryAfter(c, err)
+			h.render(c, http.StatusTooManyRequests, "email_login", gin.H{"Error": err.Error()})
+		default:
+			log.Printf("邮件登录失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "登录失败，请稍后重试")
+		}
+		return
+	}
+	clearEmailLoginCookie(c)
+
+	// 3. 启用了两步验证时先完成第二步验证
+	if loginResp.MFARequired {
+		h.renderMFA(c, http.StatusOK, loginResp.MFAToken, "")
+		return
+	}
+
+	// 4. 写入会话 Cookie，回到授权端点继续授权
+	setSessionCookie(c, loginResp.SessionToken, h.authService.SessionExpire())
+	c.Redirect(http.StatusSeeOther, loginRedirectURL(loginResp))
+}
+
+// RegisterPage 注册页面
+// GET /register?continue=xxx
+func (h *PageHandler) RegisterPage(c *gin.Context) {
+	continuation := c.Query("continue")
+	h.render(c, http.StatusOK, "register", gin.H{
+		"Continue": continuation,
+		"Client":   h.continuationClient(continuation),
+	})
+}
+
+// Register 提交注册表单，注册成功后跳转到登录页
+// POST /register
+func (h *PageHandler) Register(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 注册
+	req := service.RegisterRequest{
+		Email:    c.PostForm("email"),
+		Password: c.PostForm("password"),
+		Name:     c.PostForm("name"),
+	}
+	continuation := c.PostForm("continue")
+	if _, err := h.authService.Register(req); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrWeakPassword):
+		case errors.Is(err, service.ErrEmailExists):
+			status = http.StatusConflict
+		default:
+			log.Printf("注册失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "注册失败，请稍后重试")
+			return
+		}
+		h.render(c, status, "register", gin.H{
+			"Continue": continuation,
+			"Email":    req.Email,
+			"Name":     req.Name,
+			"Error":    err.Error(),
+			"Client":   h.continuationClient(continuation),
+		})
+		return
+	}
+
+	// 3. 跳转到登录页（保留 continue，登录后继续授权）
+	params := url.Values{"registered": {"true"}, "login_hint": {req.Email}}
+	if continuation != "" {
+		params.Set("continue", continuation)
+	}
+	c.Redirect(http.StatusSeeOther, "/login?"+params.Encode())
+}
+
+// consentPageRequest 解析授权确认页面的授权请求并检查登录状态
+// 返回 false 时已输出响应（错误页面、重定向回客户端或跳转登录页）
+func (h *PageHandler) consentPageRequest(c *gin.Context) (*AuthorizeRequest, *models.OAuthClient, *service.SessionClaims, bool) {
+	// 1. 解析并验证授权请求
+	req, client, aerr := h.parseAuthorizeRequest(c)
+	if aerr != nil {
+		if aerr.Redirect {
+			h.writeAuthorizeError(c, req, aerr)
+		} else {
+			h.renderError(c, http.StatusBadRequest, aerr.Code, aerr.Message)
+		}
+		return nil, nil, nil, false
+	}
+
+	// 2. 检查登录会话，需要登录时跳转到登录页
+	session := currentSession(c)
+	if aerr := h.checkSession(req, session, true); aerr != nil {
+		switch {
+		case aerr.Redirect:
+			h.writeAuthorizeError(c, req, aerr)
+		case aerr.Status == http.StatusUnauthorized:
+			h.redirectToLogin(c, req, aerr.Code == insufficientAuthentication)
+		default:
+			h.renderError(c, aerr.Status, aerr.Code, aerr.Message)
+		}
+		return nil, nil, nil, false
+	}
+	return req, client, session, true
+}
+
+// ConsentPage 授权确认页面
+// GET /consent?client_id=xxx&redirect_uri=xxx&response_type=code&...（参数与授权端点相同）
+func (h *PageHandler) ConsentPage(c *gin.Context) {
+	req, client, session, ok := h.consentPageRequest(c)
+	if !ok {
+		return
+	}
+	user, err := h.authService.GetUserByID(session.UserID)
+	if err != nil {
+		h.renderError(c, http.StatusInternalServerError, "server_error", "获取用户信息失败")
+		return
+	}
+
+	data := gin.H{
+		"Client":      client,
+		"User":        user,
+		"Scopes":      service.ParseScope(req.Scope),
+		"Resources":   req.Resource,
+		"RedirectURI": req.RedirectURI,
+		"Query":       template.URL(c.Request.URL.RawQuery),
+	}
+	if req.AuthorizationDetails != "" {
+		var pretty interface{}
+		if err := json.Unmarshal([]byte(req.AuthorizationDetails), &pretty); err == nil {
+			formatted, _ := json.MarshalIndent(pretty, "", "  ")
+			data["AuthorizationDetails"] = string(formatted)
+		}
+	}
+	h.render(c, http.StatusOK, "consent", data)
+}
+
+// ConsentSubmit 提交授权确认表单，同意时签发授权码，然后重定向回客户端
+// POST /consent?client_id=xxx&redirect_uri=xxx&response_type=code&...
+func (h *PageHandler) ConsentSubmit(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 解析授权请求并检查登录状态
+	req, _, session, ok := h.consentPageRequest(c)
+	if !ok {
+		return
+	}
+
+	// 3. 用户拒绝授权
+	if c.PostForm("decision") != "approve" {
+		c.Redirect(http.StatusSeeOther, h.deniedURL(req))
+		return
+	}
+
+	// 4. 记录授权并签发授权码
+	redirectURL, err := h.approveConsent(req, session)
+	if err != nil {
+		log.Printf("授权失败: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "server_error", "授权失败，请稍后重试")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, redirectURL)
+}
+
+// VerifyEmailPage 邮箱验证页面
+// GET /verify-email?token=xxx（验证邮件中的链接，显示确认按钮，提交后才使用令牌）
+// GET /verify-email?email=xxx（重新发送验证邮件的表单）
+// GET 请求不使用令牌：邮件安全网关和链接预览会自动访问邮件中的链接
+func (h *PageHandler) VerifyEmailPage(c *gin.Context) {
+	if token := c.Query("token"); token != "" {
+		h.render(c, http.StatusOK, "verify_email", gin.H{"Token": token})
+		return
+	}
+	h.render(c, http.StatusOK, "verify_email", gin.H{"Email": c.Query("email")})
+}
+
+// VerifyEmail 确认验证邮箱
+// POST /verify-email
+func (h *PageHandler) VerifyEmail(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	user, err := h.authService.VerifyEmail(c.PostForm("token"), sessionInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidVerificationToken):
+			h.render(c, http.StatusBadRequest, "verify_email", gin.H{"Error": "验证链接无效或已过期，请重新发送验证邮件"})
+		case errors.Is(err, service.ErrEmailExists):
+			h.render(c, http.StatusConflict, "verify_email", gin.H{"Error": "该邮箱已被其他账户使用"})
+		default:
+			log.Printf("邮箱验证失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "邮箱验证失败，请稍后重试")
+		}
+		return
+	}
+	h.render(c, http.StatusOK, "verify_email", gin.H{"Verified": true, "Email": user.Email})
+}
+
+// ResendVerification 提交重新发送验证邮件表单
+// POST /verify-email/resend
+func (h *PageHandler) ResendVerification(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	email := c.PostForm("email")
+	if err := h.authService.ResendVerificationEmailTo(email); err != nil {
+		log.Printf("发送验证邮件失败: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "server_error", "发送失败，请稍后重试")
+		return
+	}
+	h.render(c, http.StatusOK, "verify_email", gin.H{"Email": email, "Sent": true})
+}
+
+// ForgotPasswordPage 忘记密码页面
+// GET /forgot-password?email=xxx
+func (h *PageHandler) ForgotPasswordPage(c *gin.Context) {
+	h.render(c, http.StatusOK, "forgot_password", gin.H{"Email": c.Query("email")})
+}
+
+// ForgotPassword 提交忘记密码表单（无论邮箱是否注册都显示相同结果）
+// POST /forgot-password
+func (h *PageHandler) ForgotPassword(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	email := c.PostForm("email")
+	if err := h.authService.ForgotPassword(email); err != nil {
+		log.Printf("发送重置密码邮件失败: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "server_error", "发送失败，请稍后重试")
+		return
+	}
+	h.render(c, http.StatusOK, "forgot_password", gin.H{"Email": email, "Sent": true})
+}
+
+// ResetPasswordPage 重置密码页面（重置邮件中的链接）
+// GET /reset-password?token=xxx
+func (h *PageHandler) ResetPasswordPage(c *gin.Context) {
+	h.render(c, http.StatusOK, "reset_password", gin.H{"Token": c.Query("token")})
+}
+
+// ResetPassword 提交新密码
+// POST /reset-password
+func (h *PageHandler) ResetPassword(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	req := service.ResetPasswordRequest{
+		Token:    c.PostForm("token"),
+		Password: c.PostForm("password"),
+	}
+	req.SessionInfo = sessionInfo(c)
+	if err := h.authService.ResetPassword(req); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWeakPassword):
+			h.render(c, http.StatusBadRequest, "reset_password", gin.H{"Token": req.Token, "Error": err.Error()})
+		case errors.Is(err, service.ErrInvalidVerificationToken):
+			h.render(c, http.StatusBadRequest, "reset_password", gin.H{"Error": "重置链接无效或已过期，请重新申请"})
+		default:
+			log.Printf("重置密码失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "重置密码失败，请稍后重试")
+		}
+		return
+	}
+	clearSessionCookie(c)
+	h.render(c, http.StatusOK, "reset_password", gin.H{"Reset": true})
+}
+
+// DevicePage 设备授权页面（RFC 8628 的 verification_uri）
+// GET /device（输入设备上显示的代码），GET /device?user_code=xxx（确认授权，需要登录）
+func (h *PageHandler) DevicePage(c *gin.Context) {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		h.render(c, http.StatusOK, "device", gin.H{})
+		return
+	}
+	record, client, session, ok := h.deviceRequest(c, userCode)
+	if !ok {
+		return
+	}
+	user, err := h.authService.GetUserByID(session.UserID)
+	if err != nil {
+		h.renderError(c, http.StatusInternalServerError, "server_error", "获取用户信息失败")
+		return
+	}
+	h.render(c, http.StatusOK, "device", gin.H{
+		"Client":    client,
+		"User":      user,
+		"UserCode":  userCode,
+		"Scopes":    service.ParseScope(record.Scope),
+		"Resources": service.ParseScope(record.Resource),
+	})
+}
+
+// DeviceSubmit 提交设备授权的决定
+// POST /device
+func (h *PageHandler) DeviceSubmit(c *gin.Context) {
+	// 1. 校验 CSRF Token
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+
+	// 2. 查找待授权的设备请求并检查登录状态
+	record, client, session, ok := h.deviceRequest(c, c.PostForm("user_code"))
+	if !ok {
+		return
+	}
+
+	// 3. 记录用户的决定，设备下次轮询时得到结果
+	approve := c.PostForm("decision") == "approve"
+	if err := h.oauthService.DecideDeviceCode(record, session, approve); err != nil {
+		if errors.Is(err, service.ErrInvalidUserCode) {
+			h.render(c, http.StatusBadRequest, "device", gin.H{"Error": err.Error()})
+			return
+		}
+		log.Printf("设备授权失败: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "server_error", "授权失败，请稍后重试")
+		return
+	}
+	done := models.DeviceCodeDenied
+	if approve {
+		done = models.DeviceCodeApproved
+	}
+	h.render(c, http.StatusOK, "device", gin.H{"Client": client, "Done": done})
+}
+
+// deviceRequest 检查登录状态并查找用户代码对应的设备授权
+// 未登录时跳转到登录页，登录后带着用户代码回到设备授权页面；代码无效时重新显示输入框
+func (h *PageHandler) deviceRequest(c *gin.Context, userCode string) (*models.DeviceCode, *models.OAuthClient, *service.SessionClaims, bool) {
+	// 1. 需要登录
+	session := currentSession(c)
+	if session == nil {
+		continuation, err := h.authService.SignDeviceContinuation(url.Values{"user_code": {userCode}}.Encode())
+		if err != nil {
+			h.renderError(c, http.StatusInternalServerError, "server_error", "跳转登录页失败")
+			return nil, nil, nil, false
+		}
+		c.Redirect(http.StatusSeeOther, appendQuery(h.loginURL, url.Values{"continue": {continuation}}))
+		return nil, nil, nil, false
+	}
+
+	// 2. 查找未过期、未处理的设备授权（输错过多时暂时锁定）
+	record, client, err := h.oauthService.FindDeviceCode(userCode, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUserCode):
+			h.render(c, http.StatusBadRequest, "device", gin.H{"UserCode": userCode, "Error": err.Error()})
+		case errors.Is(err, service.ErrTooManyAttempts):
+			setRetryAfter(c, err)
+			h.render(c, http.StatusTooManyRequests, "device", gin.H{"UserCode": userCode, "Error": err.Error()})
+		default:
+			log.Printf("查询设备授权失败: %v", err)
+			h.renderError(c, http.StatusInternalServerError, "server_error", "查询设备授权失败，请稍后重试")
+		}
+		return nil, nil, nil, false
+	}
+	return record, client, session, true
+}
+
+// LogoutPage 退出登录确认页面
+// GET /logout
+func (h *PageHandler) LogoutPage(c *gin.Context) {
+	h.render(c, http.StatusOK, "logout", gin.H{"User": h.currentUser(c)})
+}
+
+// Logout 提交退出登录，结束会话并清除会话 Cookie
+// POST /logout
+// 从退出登录端点的确认页面提交时，带有原始请求参数，退出后重定向回客户端
+func (h *PageHandler) Logout(c *gin.Context) {
+	if h.rejectInvalidCSRF(c) {
+		return
+	}
+	_, logout, ok := h.validateEndSession(c)
+	if !ok {
+		return
+	}
+	h.finishLogout(c, currentSession(c), logout)
+}
+
+// ErrorPage 错误页面
+// GET /error?error=xxx&error_description=xxx
+func (h *PageHandler) ErrorPage(c *gin.Context) {
+	message := c.Query("error_description")
+	if message == "" {
+		message = "请求无法完成"
+	}
+	h.renderError(c, http.StatusBadRequest, c.Query("error"), message)
+}
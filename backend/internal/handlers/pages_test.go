@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/middleware"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/web"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConsentSubmit(t *testing.T) {
+	f := newAuthorizeFixture(t)
+	renderer, err := web.NewRenderer(nil)
+	if err != nil {
+		t.Fatalf("加载页面模板失败: %v", err)
+	}
+	h := NewPageHandler(f.handler, renderer)
+	session := f.session(time.Now())
+
+	// submit 以已登录的会话提交授权确认表单（请求授权 email，用户尚未同意过）
+	const csrfToken = "csrf-token-value"
+	submit := func(csrfCookie string, form url.Values) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/consent", func(c *gin.Context) {
+			c.Set("session", session)
+			h.ConsentSubmit(c)
+		})
+		query := authorizeQuery(url.Values{"scope": {"profile email"}})
+		req := httptest.NewRequest(http.MethodPost, "/consent?"+query.Encode(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if csrfCookie != "" {
+			req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: csrfCookie})
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	codes := func() int64 {
+		var count int64
+		database.DB.Model(&models.AuthorizationCode{}).Count(&count)
+		return count
+	}
+
+	// 1. 缺少或错误的 CSRF Token 时拒绝提交，不签发授权码
+	rejected := []struct {
+		name   string
+		cookie string
+		form   url.Values
+	}{
+		{name: "没有 CSRF Token", cookie: csrfToken, form: url.Values{"decision": {"approve"}}},
+		{name: "没有 CSRF Cookie", form: url.Values{"decision": {"approve"}, middleware.CSRFFieldName: {csrfToken}}},
+		{name: "CSRF Token 与 Cookie 不一致", cookie: csrfToken, form: url.Values{"decision": {"approve"}, middleware.CSRFFieldName: {"other-token"}}},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := submit(tt.cookie, tt.form)
+			if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+				t.Fatalf("状态码 = %d, Location = %q，期望 403 且不重定向", rec.Code, rec.Header().Get("Location"))
+			}
+			if !strings.Contains(rec.Body.String(), "invalid_csrf_token") {
+				t.Fatalf("错误页面不正确: %s", rec.Body.String())
+			}
+			if n := codes(); n != 0 {
+				t.Fatalf("签发了 %d 个授权码，期望 0", n)
+			}
+		})
+	}
+
+	// 2. 拒绝授权时带着 access_denied 回到客户端
+	rec := submit(csrfToken, url.Values{"decision": {"deny"}, middleware.CSRFFieldName: {csrfToken}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("状态码 = %d，期望 303: %s", rec.Code, rec.Body.String())
+	}
+	if location, _ := url.Parse(rec.Header().Get("Location")); location.Query().Get("error") != "access_denied" || codes() != 0 {
+		t.Fatalf("拒绝授权的重定向不正确: %s", rec.Header().Get("Location"))
+	}
+
+	// 3. 同意授权时记录授权并签发授权码
+	rec = submit(csrfToken, url.Values{"decision": {"approve"}, middleware.CSRFFieldName: {csrfToken}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("状态码 = %d，期望 303: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("解析重定向地址失败: %v", err)
+	}
+	params := location.Query()
+	if location.Scheme+"://"+location.Host+location.Path != testRedirectURI || params.Get("state") != "xyz" || params.Get("iss") != testIssuer {
+		t.Fatalf("同意授权的重定向不正确: %s", location)
+	}
+	var code models.AuthorizationCode
+	if err := database.DB.Where("code = ?", params.Get("code")).First(&code).Error; err != nil {
+		t.Fatalf("查询授权码失败: %v", err)
+	}
+	if code.UserID != f.user.ID || code.ClientID != f.client.ClientID || code.Scope != "profile email" {
+		t.Fatalf("授权码不正确: %+v", code)
+	}
+	if ok, err := f.oauthService.HasConsent(f.user.ID, f.client.ClientID, "profile email", nil, ""); err != nil || !ok {
+		t.Fatalf("同意授权后没有记录授权: %v", err)
+	}
+}
+
+func TestDevicePage(t *testing.T) {
+	f := newAuthorizeFixture(t)
+	database.DB.Model(f.client).Update("grant_types", models.GrantTypeDeviceCode)
+	renderer, err := web.NewRenderer(nil)
+	if err != nil {
+		t.Fatalf("加载页面模板失败: %v", err)
+	}
+	h := NewPageHandler(f.handler, renderer)
+	session := f.session(time.Now())
+
+	// serve 以指定的会话（nil 表示未登录）访问设备授权端点、页面和 Token 端点
+	const csrfToken = "csrf-token-value"
+	serve := func(session *service.SessionClaims, method, target string, form url.Values) *httptest.ResponseRecorder {
+		router := gin.New()
+		withSession := func(c *gin.Context) {
+			if session != nil {
+				c.Set("session", session)
+			}
+		}
+		router.POST("/oauth/device_authorization", f.handler.DeviceAuthorization)
+		router.POST("/oauth/token", f.handler.Token)
+		router.GET("/device", withSession, h.DevicePage)
+		router.POST("/device", withSession, h.DeviceSubmit)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: csrfToken})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	poll := func(deviceCode string) *httptest.ResponseRecorder {
+		return serve(nil, http.MethodPost, "/oauth/token", url.Values{
+			"grant_type":    {models.GrantTypeDeviceCode},
+			"device_code":   {deviceCode},
+			"client_id":     {"test_client"},
+			"client_secret": {"secret"},
+		})
+	}
+
+	// 1. 设备发起授权
+	rec := serve(nil, http.MethodPost, "/oauth/device_authorization", url.Values{"client_id": {"test_client"}, "client_secret": {"secret"}, "scope": {"profile email"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("发起设备授权: 状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	var start service.DeviceAuthorization
+	if err := json.Unmarshal(rec.Body.Bytes(), &start); err != nil || start.DeviceCode == "" || start.UserCode == "" {
+		t.Fatalf("设备授权响应不正确: %s", rec.Body.String())
+	}
+
+	// 2. 用户完成授权前，Token 端点返回 authorization_pending
+	rec = poll(start.DeviceCode)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"error":"authorization_pending"`) {
+		t.Fatalf("用户授权前轮询: 状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 3. 未登录时跳转到登录页，登录后带着用户代码回到设备授权页面
+	rec = serve(nil, http.MethodGet, "/device?"+url.Values{"user_code": {start.UserCode}}.Encode(), nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("未登录: 状态码 = %d，期望 303", rec.Code)
+	}
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	if location.Path != "/login" {
+		t.Fatalf("重定向到 %s，期望登录页", location)
+	}
+	devicePage := testIssuer + "/device?" + url.Values{"user_code": {start.UserCode}}.Encode()
+	if resume := f.authService.ResumeURL(location.Query().Get("continue")); resume != devicePage {
+		t.Fatalf("登录后的恢复地址 = %s，期望 %s", resume, devicePage)
+	}
+
+	// 4. 页面展示客户端和请求的权限；输入错误的代码时重新显示输入框
+	tests := []struct {
+		name     string
+		userCode string
+		status   int
+		want     string
+	}{
+		{name: "输入代码", status: http.StatusOK, want: `name="user_code"`},
+		{name: "确认授权", userCode: start.UserCode, status: http.StatusOK, want: "Test App"},
+		{name: "代码不存在", userCode: "BBBB-BBBB", status: http.StatusBadRequest, want: service.ErrInvalidUserCode.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/device"
+			if tt.userCode != "" {
+				target += "?" + url.Values{"user_code": {tt.userCode}}.Encode()
+			}
+			rec := serve(session, http.MethodGet, target, nil)
+			if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Fatalf("状态码 = %d，期望 %d，页面应包含 %q: %s", rec.Code, tt.status, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// 5. 提交决定需要 CSRF Token
+	rec = serve(session, http.MethodPost, "/device", url.Values{"user_code": {start.UserCode}, "decision": {"approve"}})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("没有 CSRF Token: 状态码 = %d，期望 403", rec.Code)
+	}
+
+	// 6. 用户同意后，设备换取 Token
+	rec = serve(session, http.MethodPost, "/device", url.Values{"user_code": {start.UserCode}, "decision": {"approve"}, middleware.CSRFFieldName: {csrfToken}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "设备已连接") {
+		t.Fatalf("同意授权: 状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	database.DB.Model(&models.DeviceCode{}).Where("1 = 1").Update("last_polled_at", time.Now().Add(-time.Minute))
+	rec = poll(start.DeviceCode)
+	var token TokenResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &token) != nil || token.AccessToken == "" || token.Scope != "profile email" {
+		t.Fatalf("换取 Token: 状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PasskeyMFAOptionsRequest 获取两步验证通行密钥选项请求
+type PasskeyMFAOptionsRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"` // 登录第一步返回的 MFA 令牌
+}
+
+// PasskeyRegistrationOptions 生成注册通行密钥的选项
+// POST /api/auth/webauthn/register/options
+// 响应交给 navigator.credentials.create({publicKey})，结果提交到 /api/auth/webauthn/register
+func (h *AuthHandler) PasskeyRegistrationOptions(c *gin.Context) {
+	session := c.MustGet("session").(*service.SessionClaims)
+	options, err := h.authService.BeginPasskeyRegistration(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成通行密钥选项失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", options))
+}
+
+// RegisterPasskey 保存认证器创建的通行密钥
+// POST /api/auth/webauthn/register
+func (h *AuthHandler) RegisterPasskey(c *gin.Context) {
+	var req service.PasskeyRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	credential, err := h.authService.FinishPasskeyRegistration(session.UserID, req, service.AuditContext{ActorID: session.UserID, SessionInfo: sessionInfo(c)})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPasskey), errors.Is(err, service.ErrInvalidWebAuthnChallenge):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("注册通行密钥失败", err))
+		case errors.Is(err, service.ErrPasskeyExists):
+			c.JSON(http.StatusConflict, models.ErrorResponse("注册通行密钥失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("注册通行密钥失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, models.SuccessResponse("通行密钥已注册", credential.ToResponse()))
+}
+
+// ListPasskeys 列出当前用户的通行密钥
+// GET /api/auth/webauthn/credentials
+func (h *AuthHandler) ListPasskeys(c *gin.Context) {
+	session := c.MustGet("session").(*service.SessionClaims)
+	credentials, err := h.authService.ListPasskeys(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("获取通行密钥失败", err))
+		return
+	}
+	responses := make([]models.WebAuthnCredentialResponse, 0, len(credentials))
+	for i := range credentials {
+		responses = append(responses, credentials[i].ToResponse())
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", responses))
+}
+
+// DeletePasskey 删除当前用户的通行密钥
+// DELETE /api/auth/webauthn/credentials/:id
+func (h *AuthHandler) DeletePasskey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("删除通行密钥失败", service.ErrPasskeyNotFound))
+		return
+	}
+	session := c.MustGet("session").(*service.SessionClaims)
+	if err := h.authService.DeletePasskey(session.UserID, uint(id), service.AuditContext{ActorID: session.UserID, SessionInfo: sessionInfo(c)}); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasskeyNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse("删除通行密钥失败", err))
+		case errors.Is(err, service.ErrMFARequired):
+			c.JSON(http.StatusForbidden, models.ErrorResponse("删除通行密钥失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除通行密钥失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("通行密钥已删除", nil))
+}
+
+// PasskeyLoginOptions 生成无密码登录的选项
+// POST /api/auth/webauthn/login/options
+// 响应交给 navigator.credentials.get({publicKey})，结果提交到 /api/auth/webauthn/login
+func (h *AuthHandler) PasskeyLoginOptions(c *gin.Context) {
+	options, err := h.authService.BeginPasskeyLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成通行密钥选项失败", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", options))
+}
+
+// PasskeyLogin 使用通行密钥登录（无密码），响应与 /api/auth/login 相同
+// POST /api/auth/webauthn/login
+func (h *AuthHandler) PasskeyLogin(c *gin.Context) {
+	var req service.PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.FinishPasskeyLogin(req)
+	if err != nil {
+		h.abortPasskeyLoginError(c, err)
+		return
+	}
+	h.respondLogin(c, loginResp)
+}
+
+// PasskeyMFAOptions 生成使用通行密钥完成两步验证的选项
+// POST /api/auth/mfa/webauthn/options
+func (h *AuthHandler) PasskeyMFAOptions(c *gin.Context) {
+	var req PasskeyMFAOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	options, err := h.authService.BeginPasskeyMFA(req.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFAToken):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("两步验证失败", err))
+		case errors.Is(err, service.ErrPasskeyNotFound):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("两步验证失败", err))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("两步验证失败", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("获取成功", options))
+}
+
+// PasskeyMFA 登录第二步：使用通行密钥代替验证码，响应与 /api/auth/login 相同
+// POST /api/auth/mfa/webauthn
+func (h *AuthHandler) PasskeyMFA(c *gin.Context) {
+	var req service.PasskeyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数无效", err))
+		return
+	}
+	req.SessionInfo = sessionInfo(c)
+	loginResp, err := h.authService.FinishPasskeyMFA(req)
+	if err != nil {
+		h.abortPasskeyLoginError(c, err)
+		return
+	}
+	h.respondLogin(c, loginResp)
+}
+
+// abortPasskeyLoginError 根据通行密钥登录的错误类型返回对应的状态码
+func (h *AuthHandler) abortPasskeyLoginError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPasskey), errors.Is(err, service.ErrInvalidWebAuthnChallenge),
+		errors.Is(err, service.ErrPasskeyCloned), errors.Is(err, service.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("登录失败", err))
+	case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, models.ErrorResponse("登录失败", err))
+	case errors.Is(err, service.ErrTooManyAttempts):
+		abortThrottled(c, err)
+	case errors.Is(err, service.ErrInvalidContinuation):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("登录失败", err))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("登录失败", err))
+	}
+}
@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Message 邮件内容（纯文本）
+type Message struct {
+	To      string // 收件人邮箱
+	Subject string // 主题
+	Body    string // 正文
+}
+
+// Mailer 邮件发送接口
+// 生产环境使用 SMTP；开发和测试环境使用写入本地文件或打印日志的实现，不需要网络
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	addr     string    // 服务器地址（host:port）
+	host     string    // 服务器主机名（用于认证）
+	auth     smtp.Auth // 认证信息（未配置用户名时不认证）
+	from     string    // 发件人
+	fromAddr string    // 发件人邮箱（SMTP MAIL FROM）
+}
+
+// NewSMTPMailer 创建 SMTP 邮件发送器
+// 服务器支持 STARTTLS 时自动加密连接；username 为空时不进行认证
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("无效的发件人地址: %w", err)
+	}
+	m := &SMTPMailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		from:     from,
+		fromAddr: fromAddr.Address,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+// Send 发送邮件
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.fromAddr, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return nil
+}
+
+// FileMailer 把邮件写入本地目录（每封邮件一个 .eml 文件），用于开发和测试
+type FileMailer struct {
+	dir  string // 输出目录
+	from string // 发件人
+}
+
+// NewFileMailer 创建写入本地目录的邮件发送器
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send 把邮件写入文件
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("创建邮件目录失败: %w", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	if err := os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("写入邮件失败: %w", err)
+	}
+	return nil
+}
+
+// LogMailer 把邮件打印到日志（默认实现，只用于开发环境）
+type LogMailer struct{}
+
+// NewLogMailer 创建打印日志的邮件发送器
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send 打印邮件
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("📧 邮件发送到 %s\n主题: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// format 生成 RFC 5322 格式的邮件（UTF-8 纯文本）
+func format(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
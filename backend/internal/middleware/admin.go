@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 管理接口认证中间件
+// 携带配置的管理令牌（Authorization: Bearer）时视为拥有全部权限，用于自动化脚本；
+// 否则与 JWTAuth 相同按用户认证，由 RequirePermission 检查用户的角色
+func AdminAuth(apiToken string, authService *service.AuthService) gin.HandlerFunc {
+	userAuth := JWTAuth(authService)
+	return func(c *gin.Context) {
+		// 1. 校验管理令牌（常量时间比较，未配置令牌时跳过）
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok && apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1 {
+			c.Set("adminToken", true)
+			c.Next()
+			return
+		}
+
+		// 2. 按用户认证
+		userAuth(c)
+	}
+}
+
+// RequirePermission 权限检查中间件（放在 JWTAuth 或 AdminAuth 之后）
+// 每次请求都从数据库读取用户的角色，撤销角色后立即生效
+func RequirePermission(authService *service.AuthService, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. 管理令牌拥有全部权限
+		if c.GetBool("adminToken") {
+			c.Next()
+			return
+		}
+
+		// 2. 获取当前用户
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("未授权", nil))
+			c.Abort()
+			return
+		}
+
+		// 3. 检查用户的角色是否包含所需权限
+		ok, err := authService.HasPermission(userID.(uint), permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("检查权限失败", err))
+			c.Abort()
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("权限不足", service.ErrPermissionDenied))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
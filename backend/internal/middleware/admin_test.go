@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() { database.Close() })
+	if err := database.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.AuditEvent{}); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	if err := service.EnsureBuiltinRoles(); err != nil {
+		t.Fatalf("初始化内置角色失败: %v", err)
+	}
+
+	authService := service.NewAuthService("test-secret", 1, "https://auth.example.com")
+	users := map[string]uint{}
+	for _, role := range []string{service.RoleAdmin, service.RoleSupport, ""} {
+		user := &models.User{Email: "user-" + role + "@example.com", Password: "x", Name: role}
+		if err := database.DB.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+		if role != "" {
+			if err := authService.AssignRole(user.ID, role, service.AuditContext{}); err != nil {
+				t.Fatalf("授予角色失败: %v", err)
+			}
+		}
+		users[role] = user.ID
+	}
+
+	tests := []struct {
+		name       string
+		adminToken bool   // 使用管理令牌
+		role       string // 当前用户的角色（为空表示没有角色）
+		anonymous  bool   // 没有当前用户
+		permission string
+		wantStatus int
+	}{
+		{name: "管理令牌拥有全部权限", adminToken: true, anonymous: true, permission: service.PermissionUsersWrite, wantStatus: http.StatusOK},
+		{name: "未认证", anonymous: true, permission: service.PermissionUsersRead, wantStatus: http.StatusUnauthorized},
+		{name: "管理员写用户", role: service.RoleAdmin, permission: service.PermissionUsersWrite, wantStatus: http.StatusOK},
+		{name: "客服读用户", role: service.RoleSupport, permission: service.PermissionUsersRead, wantStatus: http.StatusOK},
+		{name: "客服解除锁定", role: service.RoleSupport, permission: service.PermissionLockoutsManage, wantStatus: http.StatusOK},
+		{name: "客服不能写用户", role: service.RoleSupport, permission: service.PermissionUsersWrite, wantStatus: http.StatusForbidden},
+		{name: "客服不能管理客户端", role: service.RoleSupport, permission: service.PermissionClientsWrite, wantStatus: http.StatusForbidden},
+		{name: "没有角色的用户", role: "", permission: service.PermissionUsersRead, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				// 模拟 AdminAuth 的认证结果
+				if tt.adminToken {
+					c.Set("adminToken", true)
+				}
+				if !tt.anonymous {
+					c.Set("userID", users[tt.role])
+				}
+			}, RequirePermission(authService, tt.permission), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d，期望 %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
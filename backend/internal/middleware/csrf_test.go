@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+func TestCookieSessionCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() { database.Close() })
+	if err := database.AutoMigrate(&models.User{}, &models.Session{}); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+
+	authService := service.NewAuthService("test-secret", 1, "https://auth.example.com")
+	user := &models.User{Email: "alice@example.com", Password: "x", Name: "alice"}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	session, sessionToken, err := authService.CreateSession(user.ID, time.Now(), []string{service.AMRPassword}, service.SessionInfo{})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	jwtToken, err := authService.GenerateToken(session)
+	if err != nil {
+		t.Fatalf("生成 Token 失败: %v", err)
+	}
+
+	router := gin.New()
+	whoami := func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	}
+	router.Any("/required", JWTAuth(authService), whoami)
+	router.Any("/optional", OptionalJWTAuth(authService), whoami)
+
+	const csrfToken = "csrf-token-value"
+	tests := []struct {
+		name       string
+		path       string
+		method     string
+		cookie     bool   // 携带会话 Cookie
+		csrfCookie string // CSRF Cookie 的值（为空表示不携带）
+		header     string // X-CSRF-Token 请求头
+		form       string // csrf_token 表单字段
+		bearer     bool   // 使用 Authorization 头而不是 Cookie
+		wantStatus int
+		wantUser   bool // 上下文中有当前用户
+	}{
+		{name: "GET 不校验 CSRF", path: "/required", method: http.MethodGet, cookie: true, wantStatus: http.StatusOK, wantUser: true},
+		{name: "HEAD 不校验 CSRF", path: "/required", method: http.MethodHead, cookie: true, wantStatus: http.StatusOK, wantUser: true},
+		{name: "缺少 CSRF Token", path: "/required", method: http.MethodPost, cookie: true, csrfCookie: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "缺少 CSRF Cookie", path: "/required", method: http.MethodPost, cookie: true, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "CSRF Token 不一致", path: "/required", method: http.MethodDelete, cookie: true, csrfCookie: csrfToken, header: "other", wantStatus: http.StatusForbidden},
+		{name: "请求头中的 CSRF Token", path: "/required", method: http.MethodPost, cookie: true, csrfCookie: csrfToken, header: csrfToken, wantStatus: http.StatusOK, wantUser: true},
+		{name: "表单中的 CSRF Token", path: "/required", method: http.MethodPost, cookie: true, csrfCookie: csrfToken, form: csrfToken, wantStatus: http.StatusOK, wantUser: true},
+		{name: "Bearer Token 不需要 CSRF Token", path: "/required", method: http.MethodPost, bearer: true, wantStatus: http.StatusOK, wantUser: true},
+		{name: "没有会话", path: "/required", method: http.MethodPost, csrfCookie: csrfToken, header: csrfToken, wantStatus: http.StatusUnauthorized},
+		{name: "可选认证：CSRF Token 无效时视为未登录", path: "/optional", method: http.MethodPost, cookie: true, csrfCookie: csrfToken, header: "other", wantStatus: http.StatusOK},
+		{name: "可选认证：CSRF Token 有效", path: "/optional", method: http.MethodPost, cookie: true, csrfCookie: csrfToken, header: csrfToken, wantStatus: http.StatusOK, wantUser: true},
+		{name: "可选认证：GET 不校验 CSRF", path: "/optional", method: http.MethodGet, cookie: true, wantStatus: http.StatusOK, wantUser: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *strings.Reader
+			if tt.form != "" {
+				body = strings.NewReader(url.Values{CSRFFieldName: {tt.form}}.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: service.SessionCookieName, Value: sessionToken})
+			}
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.csrfCookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeaderName, tt.header)
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer "+jwtToken)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d，期望 %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.method == http.MethodHead || rec.Code != http.StatusOK {
+				return
+			}
+			hasUser := !strings.Contains(rec.Body.String(), `"user_id":null`)
+			if hasUser != tt.wantUser {
+				t.Fatalf("当前用户: %v，期望 %v（%s）", hasUser, tt.wantUser, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 1. 没有 Cookie 时生成新的 Token 并写入 HttpOnly Cookie
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/csrf", nil)
+	token := CSRFToken(c)
+	if len(token) < 32 {
+		t.Fatalf("CSRF Token 过短: %q", token)
+	}
+	if again := CSRFToken(c); again != token {
+		t.Fatal("同一请求中应返回相同的 Token")
+	}
+	setCookie := rec.Header().Get("Set-Cookie")
+	if !strings.Contains(setCookie, CSRFCookieName+"="+token) || !strings.Contains(setCookie, "HttpOnly") || !strings.Contains(setCookie, "SameSite=Strict") {
+		t.Fatalf("CSRF Cookie 不正确: %s", setCookie)
+	}
+
+	// 2. 已有 Cookie 时沿用，不重新写入
+	rec = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/csrf", nil)
+	c.Request.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: token})
+	if got := CSRFToken(c); got != token {
+		t.Fatalf("CSRF Token = %q，期望沿用 Cookie 中的 %q", got, token)
+	}
+	if setCookie := rec.Header().Get("Set-Cookie"); setCookie != "" {
+		t.Fatalf("不应重新写入 Cookie: %s", setCookie)
+	}
+}
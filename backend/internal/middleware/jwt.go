@@ -10,13 +10,33 @@ import (
 )
 
 // JWTAuth JWT 认证中间件
+// 同时接受登录时写入的 HttpOnly 会话 Cookie；通过 Cookie 认证的写操作必须携带 CSRF Token
 func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 1. 从 Header 中获取 Authorization
+		// 1. 从 Header 中获取 Authorization，没有时使用会话 Cookie
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse("缺少认证令牌", nil))
-			c.Abort()
+			sessionToken, err := c.Cookie(service.SessionCookieName)
+			if err != nil || sessionToken == "" {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse("缺少认证令牌", nil))
+				c.Abort()
+				return
+			}
+
+			session, err := authService.ValidateSession(sessionToken)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的会话", err))
+				c.Abort()
+				return
+			}
+			if !isSafeMethod(c.Request.Method) && !ValidCSRF(c) {
+				c.JSON(http.StatusForbidden, models.ErrorResponse("CSRF Token 无效", nil))
+				c.Abort()
+				return
+			}
+
+			setSession(c, session)
+			c.Next()
 			return
 		}
 
@@ -31,18 +51,48 @@ func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// 3. 验证 Token
-		userID, err := authService.ValidateToken(tokenString)
+		session, err := authService.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse("无效的认证令牌", err))
 			c.Abort()
 			return
 		}
 
-		// 4. 将用户ID存入上下文，供后续处理器使用
-		c.Set("userID", userID)
+		// 4. 将用户ID和会话信息存入上下文，供后续处理器使用
+		setSession(c, session)
 
 		// 5. 继续处理请求
 		c.Next()
 	}
 }
 
+// OptionalJWTAuth 可选的认证中间件
+// 携带有效 Token 或会话 Cookie 时与 JWTAuth 一样写入上下文，未登录或认证无效时不拦截请求，由处理器自行决定
+// 通过 Cookie 认证的写操作没有携带有效 CSRF Token 时视为未登录
+func OptionalJWTAuth(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2); len(parts) == 2 && parts[0] == "Bearer" {
+			if session, err := authService.ValidateToken(parts[1]); err == nil {
+				setSession(c, session)
+			}
+		} else if sessionToken, err := c.Cookie(service.SessionCookieName); err == nil && sessionToken != "" {
+			if isSafeMethod(c.Request.Method) || ValidCSRF(c) {
+				if session, err := authService.ValidateSession(sessionToken); err == nil {
+					setSession(c, session)
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// setSession 将用户ID和会话信息存入上下文
+func setSession(c *gin.Context, session *service.SessionClaims) {
+	c.Set("userID", session.UserID)
+	c.Set("session", session)
+}
+
+// isSafeMethod 是否为不修改状态的请求方法（不需要 CSRF 校验）
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthTokenAuth OAuth Access Token 认证中间件（供受保护资源使用）
+// 同时支持 Bearer Token 和 DPoP 绑定的 Token
+// audience 为资源自身的标识，非空时只接受签发给该资源的 Token（RFC 8707）
+func OAuthTokenAuth(oauthService *service.OAuthService, audience string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. 从 Header 中获取 Token（兼容查询参数 access_token）
+		scheme, token := "Bearer", c.Query("access_token")
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || (!strings.EqualFold(parts[0], "Bearer") && !strings.EqualFold(parts[0], "DPoP")) {
+				abortInvalidToken(c, "", "认证令牌格式错误", nil)
+				return
+			}
+			scheme, token = parts[0], parts[1]
+		}
+
+		if token == "" {
+			c.Header("WWW-Authenticate", `Bearer, DPoP `+dpopAlgs())
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("缺少 access_token", nil))
+			c.Abort()
+			return
+		}
+
+		// 2. 验证 Token 及其绑定关系
+		claims, err := oauthService.AuthenticateResourceRequest(service.ResourceRequest{
+			Scheme:      scheme,
+			Token:       token,
+			DPoPProof:   c.GetHeader("DPoP"),
+			Method:      c.Request.Method,
+			URL:         service.RequestURL(c.Request),
+			Certificate: service.ClientCertificate(c.Request),
+			Audience:    audience,
+		})
+		if err != nil {
+			abortInvalidToken(c, scheme, "无效的 Token", err)
+			return
+		}
+
+		// 3. 将 Token 信息存入上下文，供后续处理器使用
+		c.Set("accessToken", claims)
+		c.Next()
+	}
+}
+
+// abortInvalidToken 返回 401 并按 RFC 6750 / RFC 9449 设置 WWW-Authenticate
+// DPoP 证明无效或以 DPoP 方案出示 Token 时返回 DPoP 质询，否则同时返回 Bearer 和 DPoP 质询
+func abortInvalidToken(c *gin.Context, scheme, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDPoPProof) || errors.Is(err, service.ErrDPoPProofReplayed):
+		c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof", `+dpopAlgs())
+	case strings.EqualFold(scheme, "DPoP"):
+		c.Header("WWW-Authenticate", `DPoP error="invalid_token", `+dpopAlgs())
+	default:
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token", DPoP `+dpopAlgs())
+	}
+	c.JSON(http.StatusUnauthorized, models.ErrorResponse(message, err))
+	c.Abort()
+}
+
+// dpopAlgs 支持的 DPoP 签名算法（WWW-Authenticate 的 algs 参数）
+func dpopAlgs() string {
+	return `algs="` + strings.Join(service.DPoPSigningAlgs, " ") + `"`
+}
@@ -13,10 +13,19 @@ type AccessToken struct {
 	Token       string         `gorm:"uniqueIndex;not null;size:500" json:"token"` // Token 字符串（JWT）
 	ClientID    string         `gorm:"not null;size:100" json:"client_id"`      // 客户端ID
 	UserID      uint           `gorm:"not null" json:"user_id"`                // 用户ID
+	Scope       string         `gorm:"type:text" json:"scope"`                  // 权限范围（空格分隔）
+	Audience    string         `gorm:"type:text" json:"audience"`               // 受众（空格分隔的资源标识，RFC 8707）
+	AuthorizationDetails string `gorm:"type:text" json:"authorization_details"` // 授予的授权详情（JSON 数组，RFC 9396）
+	JKT         string         `gorm:"size:100" json:"jkt,omitempty"`           // DPoP 公钥指纹（cnf.jkt，为空表示 Bearer Token）
+	X5tS256     string         `gorm:"size:100" json:"x5t_s256,omitempty"`      // 客户端证书指纹（cnf.x5t#S256，RFC 8705）
+	ACR         string         `gorm:"size:100" json:"acr,omitempty"`           // 用户授权时达到的认证级别
+	AMR         string         `gorm:"size:100" json:"amr,omitempty"`           // 用户授权时的认证方式（空格分隔）
+	AuthTime    *time.Time     `json:"auth_time,omitempty"`                      // 用户完成认证的时间
 	ExpiresAt   time.Time      `gorm:"not null" json:"expires_at"`               // 过期时间
 	CreatedAt   time.Time      `json:"created_at"`                               // 创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                              // 更新时间
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                          // 软删除时间
+	IDToken     string         `gorm:"-" json:"-"`                              // 同时签发的 ID Token（OIDC，不保存）
 }
 
 // TableName 指定表名
@@ -24,6 +33,11 @@ func (AccessToken) TableName() string {
 	return "access_tokens"
 }
 
+// IsDPoPBound 检查 Token 是否绑定了 DPoP 密钥
+func (at *AccessToken) IsDPoPBound() bool {
+	return at.JKT != ""
+}
+
 // IsExpired 检查 Token 是否过期
 func (at *AccessToken) IsExpired() bool {
 	return time.Now().After(at.ExpiresAt)
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEvent 账户安全审计记录（修改密码、修改资料等）
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`                 // 主键
+	UserID    uint      `gorm:"not null;index" json:"user_id"`        // 被操作的用户ID
+	ActorID   uint      `gorm:"index" json:"actor_id"`                // 操作者ID（用户本人或管理员，0 表示通过邮件链接等匿名操作）
+	Action    string    `gorm:"not null;size:64;index" json:"action"` // 操作类型
+	Detail    string    `gorm:"type:text" json:"detail,omitempty"`    // 操作详情（JSON 对象）
+	IPAddress string    `gorm:"size:64" json:"ip_address"`            // 请求 IP
+	UserAgent string    `gorm:"size:255" json:"user_agent"`           // 请求的浏览器/设备信息
+	CreatedAt time.Time `gorm:"index" json:"created_at"`              // 发生时间
+}
+
+// TableName 指定表名
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -14,6 +14,14 @@ type AuthorizationCode struct {
 	ClientID      string         `gorm:"not null;size:100" json:"client_id"`      // 客户端ID
 	UserID        uint           `gorm:"not null" json:"user_id"`                 // 用户ID
 	RedirectURI   string         `gorm:"not null" json:"redirect_uri"`            // 重定向URI
+	Scope         string         `gorm:"type:text" json:"scope"`                  // 授权的权限范围（空格分隔）
+	Resource      string         `gorm:"type:text" json:"resource"`               // 授权访问的资源（空格分隔，RFC 8707）
+	AuthorizationDetails string  `gorm:"type:text" json:"authorization_details"`  // 授权详情（JSON 数组，RFC 9396）
+	Nonce         string         `gorm:"size:255" json:"nonce"`                   // OIDC nonce（原样放入 ID Token）
+	SessionID     string         `gorm:"size:64;index" json:"session_id"`         // 授权时的登录会话（ID Token 的 sid，注销时通知客户端）
+	AuthTime      time.Time      `json:"auth_time"`                               // 用户完成认证的时间（ID Token 的 auth_time）
+	ACR           string         `gorm:"size:100" json:"acr"`                     // 授权时会话达到的认证级别（ID Token 的 acr）
+	AMR           string         `gorm:"size:100" json:"amr"`                     // 授权时会话的认证方式（空格分隔，ID Token 的 amr）
 	ExpiresAt     time.Time      `gorm:"not null" json:"expires_at"`              // 过期时间（通常10分钟）
 	Used          bool           `gorm:"default:false" json:"used"`               // 是否已使用（授权码只能使用一次）
 	CreatedAt     time.Time      `json:"created_at"`                               // 创建时间
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthorizationDetailType 授权详情类型模型（RFC 9396）
+// 每种类型登记一个 JSON Schema，授权请求中的 authorization_details 必须符合对应的 Schema
+type AuthorizationDetailType struct {
+	ID          uint           `gorm:"primarykey" json:"id"`                      // 主键
+	Type        string         `gorm:"uniqueIndex;not null;size:100" json:"type"` // 类型标识（authorization_details 中的 type 字段）
+	Description string         `gorm:"size:255" json:"description"`               // 类型说明（展示在授权确认页面）
+	Schema      string         `gorm:"type:text;not null" json:"schema"`          // JSON Schema
+	CreatedAt   time.Time      `json:"created_at"`                                // 创建时间
+	UpdatedAt   time.Time      `json:"updated_at"`                                // 更新时间
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                            // 软删除时间
+}
+
+// TableName 指定表名
+func (AuthorizationDetailType) TableName() string {
+	return "authorization_detail_types"
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// ClientCollaborator 客户端协作者（与所有者共同管理客户端）
+type ClientCollaborator struct {
+	ClientID  string    `gorm:"primaryKey;size:100" json:"client_id"`                // 客户端ID
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"` // 协作者的用户ID
+	InvitedBy uint      `gorm:"not null;default:0" json:"invited_by"`                // 邀请人（用户ID）
+	CreatedAt time.Time `json:"created_at"`                                          // 加入时间
+}
+
+// TableName 指定表名
+func (ClientCollaborator) TableName() string {
+	return "client_collaborators"
+}
+
+// ClientInvitation 邀请用户成为客户端协作者
+// 被邀请人使用邀请邮箱登录（邮箱已验证）后在开发者接口中接受或拒绝
+type ClientInvitation struct {
+	ID         uint       `gorm:"primarykey" json:"id"`                     // 主键
+	ClientID   string     `gorm:"not null;size:100;index" json:"client_id"` // 客户端ID
+	Email      string     `gorm:"not null;size:255;index" json:"email"`     // 被邀请人邮箱（小写）
+	InvitedBy  uint       `gorm:"not null" json:"invited_by"`               // 邀请人（用户ID）
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`               // 过期时间
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`                    // 接受时间（未接受为空）
+	CreatedAt  time.Time  `json:"created_at"`                               // 邀请时间
+}
+
+// TableName 指定表名
+func (ClientInvitation) TableName() string {
+	return "client_invitations"
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Consent 用户授权记录模型
+// 记录用户已同意授予某个客户端的权限范围和资源，用于决定是否需要再次展示授权确认页面
+type Consent struct {
+	ID        uint           `gorm:"primarykey" json:"id"`                                                   // 主键
+	UserID    uint           `gorm:"not null;uniqueIndex:idx_consent_user_client" json:"user_id"`            // 用户ID
+	ClientID  string         `gorm:"not null;size:100;uniqueIndex:idx_consent_user_client" json:"client_id"` // 客户端ID
+	Scope     string         `gorm:"type:text" json:"scope"`                                                 // 已同意的权限范围（空格分隔）
+	Resource  string         `gorm:"type:text" json:"resource"`                                              // 已同意访问的资源（空格分隔，RFC 8707）
+	CreatedAt time.Time      `json:"created_at"`                                                             // 首次授权时间
+	UpdatedAt time.Time      `json:"updated_at"`                                                             // 最近授权时间
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`                                                         // 软删除时间（撤销授权）
+}
+
+// TableName 指定表名
+func (Consent) TableName() string {
+	return "consents"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// 设备授权的状态
+const (
+	DeviceCodePending  = "pending"  // 等待用户在浏览器中输入用户代码
+	DeviceCodeApproved = "approved" // 用户已同意，设备可以换取 Token
+	DeviceCodeDenied   = "denied"   // 用户已拒绝
+)
+
+// DeviceCode 设备授权请求（RFC 8628）
+// 设备持有 device_code 轮询 Token 端点，用户在浏览器中输入 user_code 完成授权；数据库只保存两者的哈希
+type DeviceCode struct {
+	ID             uint       `gorm:"primarykey" json:"-"`                       // 主键
+	DeviceCodeHash string     `gorm:"uniqueIndex;not null;size:64" json:"-"`     // device_code 的 SHA-256（十六进制）
+	UserCodeHash   string     `gorm:"uniqueIndex;not null;size:64" json:"-"`     // 规范化后的 user_code 的 SHA-256（十六进制）
+	ClientID       string     `gorm:"not null;size:100;index" json:"-"`          // 客户端ID
+	Scope          string     `gorm:"type:text" json:"-"`                        // 请求的权限范围（空格分隔）
+	Resource       string     `gorm:"type:text" json:"-"`                        // 请求访问的资源（空格分隔，RFC 8707）
+	Status         string     `gorm:"not null;size:20;default:pending" json:"-"` // 状态（pending/approved/denied）
+	UserID         uint       `json:"-"`                                         // 授权的用户ID（用户操作后填写）
+	SessionID      string     `gorm:"size:64;index" json:"-"`                    // 用户授权时的登录会话
+	AuthTime       *time.Time `json:"-"`                                         // 用户完成认证的时间
+	ACR            string     `gorm:"size:100" json:"-"`                         // 用户授权时达到的认证级别
+	AMR            string     `gorm:"size:100" json:"-"`                         // 用户授权时的认证方式（空格分隔）
+	Interval       int        `gorm:"not null" json:"-"`                         // 设备轮询的最小间隔（秒，轮询过快时增加）
+	LastPolledAt   *time.Time `json:"-"`                                         // 设备最近一次轮询的时间
+	ExpiresAt      time.Time  `gorm:"not null" json:"-"`                         // 过期时间
+	UsedAt         *time.Time `json:"-"`                                         // 换取 Token 的时间（为空表示未使用，只能换取一次）
+	CreatedAt      time.Time  `json:"-"`                                         // 创建时间
+	UpdatedAt      time.Time  `json:"-"`                                         // 更新时间
+}
+
+// TableName 指定表名
+func (DeviceCode) TableName() string {
+	return "device_codes"
+}
+
+// IsExpired 检查设备授权是否过期
+func (d *DeviceCode) IsExpired() bool {
+	return time.Now().After(d.ExpiresAt)
+}
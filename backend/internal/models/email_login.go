@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailLogin 无密码登录请求（邮件中的登录链接和六位验证码）
+// 数据库只保存链接令牌、验证码和浏览器绑定密钥的哈希；登录完成、验证码错误次数过多或重新申请后不能再使用
+type EmailLogin struct {
+	ID          uint       `gorm:"primarykey" json:"-"`                   // 主键
+	UserID      uint       `gorm:"not null;index" json:"-"`               // 用户ID
+	Email       string     `gorm:"not null;size:255" json:"-"`            // 邮件发送到的邮箱（邮箱变更后失效）
+	LinkHash    string     `gorm:"uniqueIndex;not null;size:64" json:"-"` // 登录链接令牌的 SHA-256（十六进制）
+	CodeHash    string     `gorm:"not null;size:64" json:"-"`             // 浏览器绑定密钥与验证码的 SHA-256（十六进制）
+	BrowserHash string     `gorm:"not null;size:64;index" json:"-"`       // 浏览器绑定密钥（保存在发起登录的浏览器的 Cookie 中）的 SHA-256
+	Continue    string     `gorm:"type:text" json:"-"`                    // 登录后需要恢复的授权请求
+	IPAddress   string     `gorm:"size:64;index" json:"-"`                // 发起登录的 IP（用于限制发送频率）
+	Attempts    int        `gorm:"not null;default:0" json:"-"`           // 验证码错误次数
+	ExpiresAt   time.Time  `gorm:"not null" json:"-"`                     // 过期时间
+	UsedAt      *time.Time `json:"-"`                                     // 使用或作废时间（为空表示未使用）
+	CreatedAt   time.Time  `gorm:"index" json:"-"`                        // 创建时间（用于限制发送频率）
+}
+
+// TableName 指定表名
+func (EmailLogin) TableName() string {
+	return "email_logins"
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// 失败计数的类型
+const (
+	ThrottleKindAccount = "account" // 按登录邮箱统计（不区分账户是否存在）
+	ThrottleKindIP      = "ip"      // 按客户端 IP 统计
+	ThrottleKindClient  = "client"  // 按 OAuth 客户端ID统计（Token 端点的客户端密钥）
+)
+
+// LoginThrottle 认证失败计数模型（用于暴力破解防护）
+// 连续失败达到阈值后锁定一段时间，之后每次失败锁定时间翻倍；认证成功或管理员解锁时清零
+type LoginThrottle struct {
+	ID            uint       `gorm:"primarykey" json:"id"`                                      // 主键
+	Kind          string     `gorm:"not null;size:20;uniqueIndex:idx_throttle_key" json:"kind"` // 类型：account、ip、client
+	Key           string     `gorm:"not null;size:255;uniqueIndex:idx_throttle_key" json:"key"` // 邮箱（小写）、IP 或客户端ID
+	Failures      int        `gorm:"not null;default:0" json:"failures"`                        // 连续失败次数
+	LastFailureAt time.Time  `json:"last_failure_at"`                                           // 最近一次失败的时间
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`                                    // 锁定截止时间
+	CreatedAt     time.Time  `json:"created_at"`                                                // 创建时间
+	UpdatedAt     time.Time  `json:"updated_at"`                                                // 更新时间
+}
+
+// TableName 指定表名
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// IsLocked 当前是否处于锁定状态
+func (t *LoginThrottle) IsLocked() bool {
+	return t.LockedUntil != nil && time.Now().Before(*t.LockedUntil)
+}
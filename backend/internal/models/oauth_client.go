@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,23 +14,105 @@ type OAuthClient struct {
 	ClientID    string         `gorm:"uniqueIndex;not null;size:100" json:"client_id"` // 客户端标识符（公开）
 	ClientSecret string        `gorm:"not null;size:255" json:"-"`              // 客户端密钥（保密，不返回JSON）
 	Name        string         `gorm:"not null;size:100" json:"name"`            // 客户端名称
-	RedirectURI string         `gorm:"not null" json:"redirect_uri"`             // 重定向URI（授权后跳转的地址）
+	RedirectURI string         `gorm:"not null" json:"redirect_uri"`             // 重定向URI（授权后跳转的地址，多个用空格分隔）
+	GrantTypes  string         `gorm:"size:255" json:"grant_types,omitempty"`    // 允许的授权类型（空格分隔，为空表示 authorization_code）
+	Scopes      string         `gorm:"type:text" json:"scopes,omitempty"`        // 允许请求的权限范围（空格分隔，为空表示不限制）
+	AccessTokenLifetime int    `gorm:"not null;default:0" json:"access_token_lifetime,omitempty"` // Access Token 有效期（秒，0 表示使用服务器默认值）
+	IDTokenLifetime     int    `gorm:"not null;default:0" json:"id_token_lifetime,omitempty"`     // ID Token 有效期（秒，0 表示使用服务器默认值）
+	TokenEndpointAuthMethod string `gorm:"size:50;default:client_secret_post" json:"token_endpoint_auth_method"` // Token 端点认证方式
+	TLSClientAuthSubjectDN  string `gorm:"size:255" json:"tls_client_auth_subject_dn,omitempty"`               // tls_client_auth：证书主题 DN
+	TLSClientCertificates   string `gorm:"type:text" json:"-"`                                                 // self_signed_tls_client_auth：已登记的自签名证书（PEM，可包含多个）
+	LogoURI     string         `gorm:"size:500" json:"logo_uri,omitempty"`       // 客户端 Logo（在登录和授权确认页面展示）
+	ClientURI   string         `gorm:"size:500" json:"client_uri,omitempty"`     // 客户端主页
+	PolicyURI   string         `gorm:"size:500" json:"policy_uri,omitempty"`     // 隐私政策地址
+	TOSURI      string         `gorm:"size:500" json:"tos_uri,omitempty"`        // 服务条款地址
+	PostLogoutRedirectURIs string `gorm:"type:text" json:"post_logout_redirect_uris,omitempty"` // 注销后允许跳转的地址（空格分隔）
+	FrontchannelLogoutURI  string `gorm:"size:500" json:"frontchannel_logout_uri,omitempty"`   // 前端通道注销地址（注销时在 iframe 中加载）
+	BackchannelLogoutURI   string `gorm:"size:500" json:"backchannel_logout_uri,omitempty"`    // 后端通道注销地址（注销时 POST logout_token）
+	DisabledAt  *time.Time     `json:"disabled_at,omitempty"`                     // 停用时间（为空表示正常，停用的客户端不能发起授权和换取 Token）
+	OwnerID     *uint          `gorm:"index" json:"owner_id,omitempty"`          // 所有者（用户ID，为空表示由管理员创建）
+	ApprovalStatus string      `gorm:"size:20;not null;default:approved" json:"approval_status"` // 审核状态（只有审核通过的客户端可以使用）
 	CreatedAt   time.Time      `json:"created_at"`                               // 创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                               // 更新时间
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                            // 软删除时间
 }
 
+// 客户端认证方式（RFC 6749 / RFC 8705）
+const (
+	AuthMethodClientSecretPost        = "client_secret_post"          // 请求体中携带 client_secret
+	AuthMethodTLSClientAuth           = "tls_client_auth"             // CA 签发的客户端证书
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth" // 预先登记的自签名证书
+)
+
+// 支持的授权类型
+const (
+	GrantTypeAuthorizationCode = "authorization_code"                           // 授权码模式
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code" // 设备授权（RFC 8628，需要客户端显式开启）
+)
+
+// 客户端审核状态（开发者创建的客户端需要管理员审核时使用）
+const (
+	ClientApprovalPending  = "pending"  // 等待审核
+	ClientApprovalApproved = "approved" // 审核通过
+	ClientApprovalRejected = "rejected" // 审核未通过
+)
+
 // TableName 指定表名
 func (OAuthClient) TableName() string {
 	return "oauth_clients"
 }
 
+// RedirectURIs 返回登记的全部重定向URI
+func (c *OAuthClient) RedirectURIs() []string {
+	return strings.Fields(c.RedirectURI)
+}
+
+// AllowsGrant 检查客户端是否允许使用指定的授权类型
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	if c.GrantTypes == "" {
+		return grantType == GrantTypeAuthorizationCode
+	}
+	for _, allowed := range strings.Fields(c.GrantTypes) {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// Disabled 客户端是否已被停用
+func (c *OAuthClient) Disabled() bool {
+	return c.DisabledAt != nil
+}
+
+// Approved 客户端是否已通过审核（管理员创建的客户端不需要审核）
+func (c *OAuthClient) Approved() bool {
+	return c.ApprovalStatus == "" || c.ApprovalStatus == ClientApprovalApproved
+}
+
+// Live 客户端是否可以使用（未停用且已通过审核）
+func (c *OAuthClient) Live() bool {
+	return !c.Disabled() && c.Approved()
+}
+
+// AuthMethod 返回客户端的认证方式（未设置时默认为 client_secret_post）
+func (c *OAuthClient) AuthMethod() string {
+	if c.TokenEndpointAuthMethod == "" {
+		return AuthMethodClientSecretPost
+	}
+	return c.TokenEndpointAuthMethod
+}
+
 // OAuthClientResponse 客户端响应结构（不包含密钥）
 type OAuthClientResponse struct {
 	ID          uint      `json:"id"`
 	ClientID    string    `json:"client_id"`
 	Name        string    `json:"name"`
 	RedirectURI string    `json:"redirect_uri"`
+	LogoURI     string    `json:"logo_uri,omitempty"`
+	ClientURI   string    `json:"client_uri,omitempty"`
+	PolicyURI   string    `json:"policy_uri,omitempty"`
+	TOSURI      string    `json:"tos_uri,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -40,6 +123,10 @@ func (c *OAuthClient) ToResponse() OAuthClientResponse {
 		ClientID:    c.ClientID,
 		Name:        c.Name,
 		RedirectURI: c.RedirectURI,
+		LogoURI:     c.LogoURI,
+		ClientURI:   c.ClientURI,
+		PolicyURI:   c.PolicyURI,
+		TOSURI:      c.TOSURI,
 		CreatedAt:   c.CreatedAt,
 	}
 }
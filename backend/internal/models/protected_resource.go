@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProtectedResource 受保护资源模型
+// 代表一个接受 Access Token 的 API（资源服务器），Token 的受众（aud）即为其标识
+type ProtectedResource struct {
+	ID         uint           `gorm:"primarykey" json:"id"`                            // 主键
+	Identifier string         `gorm:"uniqueIndex;not null;size:255" json:"identifier"` // 资源标识（绝对 URI，RFC 8707）
+	Name       string         `gorm:"not null;size:100" json:"name"`                   // 资源名称
+	Scopes     string         `gorm:"type:text" json:"scopes"`                         // 该资源允许的权限范围（空格分隔）
+	CreatedAt  time.Time      `json:"created_at"`                                      // 创建时间
+	UpdatedAt  time.Time      `json:"updated_at"`                                      // 更新时间
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`                                  // 软删除时间
+}
+
+// TableName 指定表名
+func (ProtectedResource) TableName() string {
+	return "protected_resources"
+}
+
+// AllowsScope 检查资源是否允许指定的权限范围
+func (r *ProtectedResource) AllowsScope(scope string) bool {
+	for _, allowed := range strings.Fields(r.Scopes) {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode 两步验证恢复码模型
+// 启用两步验证时生成一组，每个只能使用一次（丢失验证器时代替 TOTP 验证码），数据库只保存哈希
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"-"`                   // 主键
+	UserID    uint       `gorm:"not null;index" json:"-"`               // 用户ID
+	CodeHash  string     `gorm:"uniqueIndex;not null;size:64" json:"-"` // 恢复码的 SHA-256（十六进制）
+	UsedAt    *time.Time `json:"used_at,omitempty"`                     // 使用时间（为空表示未使用）
+	CreatedAt time.Time  `json:"created_at"`                            // 创建时间
+}
+
+// TableName 指定表名
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
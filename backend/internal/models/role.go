@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Role 角色模型（一组权限）
+// 内置角色在服务启动时创建，权限随代码更新；权限为空格分隔的列表，"*" 表示全部权限
+type Role struct {
+	ID          uint      `gorm:"primarykey" json:"id"`                     // 主键
+	Name        string    `gorm:"uniqueIndex;not null;size:64" json:"name"` // 角色名（如 admin）
+	Description string    `gorm:"size:255" json:"description"`              // 说明
+	Permissions string    `gorm:"type:text" json:"permissions"`             // 权限（空格分隔）
+	Builtin     bool      `gorm:"not null;default:false" json:"builtin"`    // 是否为内置角色
+	CreatedAt   time.Time `json:"created_at"`                               // 创建时间
+	UpdatedAt   time.Time `json:"updated_at"`                               // 更新时间
+}
+
+// TableName 指定表名
+func (Role) TableName() string {
+	return "roles"
+}
+
+// UserRole 用户与角色的关联
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`       // 用户ID
+	RoleID    uint      `gorm:"primaryKey;autoIncrement:false;index" json:"role_id"` // 角色ID
+	GrantedBy uint      `gorm:"not null;default:0" json:"granted_by"`                // 授予者（用户ID，0 表示命令行或管理令牌）
+	CreatedAt time.Time `json:"created_at"`                                          // 授予时间
+}
+
+// TableName 指定表名
+func (UserRole) TableName() string {
+	return "user_roles"
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Session 登录会话模型
+// 每次登录创建一条记录：登录 JWT 通过 sid 关联会话，浏览器通过 HttpOnly Cookie 持有会话令牌（数据库只保存令牌的哈希）
+// 退出登录或撤销会话时删除记录，关联的 JWT 和 Cookie 随即失效
+type Session struct {
+	ID         uint      `gorm:"primarykey" json:"-"`                   // 主键
+	SessionID  string    `gorm:"uniqueIndex;size:64" json:"id"`         // 会话标识（JWT 中的 sid，对外展示）
+	TokenHash  string    `gorm:"uniqueIndex;not null;size:64" json:"-"` // 会话令牌的 SHA-256（十六进制）
+	UserID     uint      `gorm:"not null;index" json:"user_id"`         // 用户ID
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`            // 登录时的浏览器/设备信息
+	IPAddress  string    `gorm:"size:64" json:"ip_address"`             // 登录时的 IP 地址
+	AuthTime   time.Time `gorm:"not null" json:"auth_time"`             // 用户完成认证的时间
+	AMR        string    `gorm:"size:100" json:"amr"`                   // 认证方式（RFC 8176，空格分隔，如 "pwd otp mfa"）
+	LastSeenAt time.Time `json:"last_seen_at"`                          // 最近使用时间
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`      // 过期时间
+	CreatedAt  time.Time `json:"created_at"`                            // 创建时间
+	UpdatedAt  time.Time `json:"updated_at"`                            // 更新时间
+}
+
+// TableName 指定表名
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsExpired 检查会话是否过期
+func (s *Session) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// SessionResponse 会话响应结构（用于会话列表）
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	AuthTime   time.Time `json:"auth_time"`
+	AMR        []string  `json:"amr"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"` // 是否为发起请求的当前会话
+}
+
+// ToResponse 转换为响应结构
+func (s *Session) ToResponse(currentSessionID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.SessionID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		AuthTime:   s.AuthTime,
+		AMR:        strings.Fields(s.AMR),
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		CreatedAt:  s.CreatedAt,
+		Current:    s.SessionID == currentSessionID,
+	}
+}
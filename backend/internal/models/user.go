@@ -8,13 +8,23 @@ import (
 
 // User 用户模型
 type User struct {
-	ID        uint           `gorm:"primarykey" json:"id"`                    // 用户ID（主键）
-	Email     string         `gorm:"uniqueIndex;not null" json:"email"`       // 邮箱（唯一索引）
-	Password  string         `gorm:"not null" json:"-"`                       // 密码（bcrypt加密，不返回到JSON）
-	Name      string         `gorm:"size:100" json:"name"`                    // 用户名
-	CreatedAt time.Time      `json:"created_at"`                              // 创建时间
-	UpdatedAt time.Time      `json:"updated_at"`                              // 更新时间
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`                          // 软删除时间
+	ID                    uint           `gorm:"primarykey" json:"id"`                         // 用户ID（主键）
+	Email                 string         `gorm:"uniqueIndex;not null" json:"email"`            // 邮箱（唯一索引）
+	Password              string         `gorm:"not null" json:"-"`                            // 密码哈希（argon2id 或 bcrypt，不返回到JSON）
+	Name                  string         `gorm:"size:100" json:"name"`                         // 用户名
+	EmailVerified         bool           `gorm:"not null;default:false" json:"email_verified"` // 邮箱是否已验证
+	EmailVerifiedAt       *time.Time     `json:"email_verified_at,omitempty"`                  // 邮箱验证时间
+	PendingEmail          string         `gorm:"size:255" json:"pending_email,omitempty"`      // 等待验证的新邮箱（修改邮箱时）
+	MFARequired           bool           `gorm:"not null;default:false" json:"mfa_required"`   // 是否必须启用两步验证（如员工账户）
+	TOTPSecret            string         `gorm:"size:64" json:"-"`                             // TOTP 密钥（Base32，等待确认或已启用）
+	TOTPEnabledAt         *time.Time     `json:"-"`                                            // TOTP 启用时间（为空表示未启用）
+	TOTPLastCounter       int64          `gorm:"not null;default:0" json:"-"`                  // 最近一次通过验证的 TOTP 时间步（防止同一验证码重复使用）
+	WebAuthnID            string         `gorm:"size:64;index" json:"-"`                       // WebAuthn 用户句柄（随机值，Base64URL，第一次注册通行密钥时生成）
+	PasswordResetRequired bool           `gorm:"not null;default:false" json:"-"`              // 管理员要求重置密码（通过邮件重置前不能使用密码登录）
+	DisabledAt            *time.Time     `json:"-"`                                            // 停用时间（为空表示正常，停用的账户不能登录）
+	CreatedAt             time.Time      `json:"created_at"`                                   // 创建时间
+	UpdatedAt             time.Time      `json:"updated_at"`                                   // 更新时间
+	DeletedAt             gorm.DeletedAt `gorm:"index" json:"-"`                               // 软删除时间
 }
 
 // TableName 指定表名
@@ -22,23 +32,62 @@ func (User) TableName() string {
 	return "users"
 }
 
+// MFAEnabled 是否已启用两步验证
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Disabled 账户是否已被停用
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
 // UserResponse 用户响应结构（不包含敏感信息）
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uint      `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	MFARequired   bool      `json:"mfa_required"`
+	Roles         []string  `json:"roles,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // ToResponse 将 User 转换为 UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Email:     u.Email,
-		Name:      u.Name,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		EmailVerified: u.EmailVerified,
+		PendingEmail:  u.PendingEmail,
+		MFAEnabled:    u.MFAEnabled(),
+		MFARequired:   u.MFARequired,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
 	}
 }
 
+// AdminUserResponse 管理接口返回的用户信息（包含账户状态）
+type AdminUserResponse struct {
+	UserResponse
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ToAdminResponse 将 User 转换为 AdminUserResponse
+func (u *User) ToAdminResponse() AdminUserResponse {
+	resp := AdminUserResponse{
+		UserResponse:          u.ToResponse(),
+		PasswordResetRequired: u.PasswordResetRequired,
+		DisabledAt:            u.DisabledAt,
+	}
+	if u.DeletedAt.Valid {
+		resp.DeletedAt = &u.DeletedAt.Time
+	}
+	return resp
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// VerificationToken 通过邮件发送给用户的一次性令牌（邮箱验证等）
+// 数据库只保存令牌的哈希；令牌使用后记录使用时间，不能再次使用
+type VerificationToken struct {
+	ID        uint       `gorm:"primarykey" json:"-"`                   // 主键
+	UserID    uint       `gorm:"not null;index" json:"user_id"`         // 用户ID
+	Purpose   string     `gorm:"not null;size:32;index" json:"purpose"` // 用途（如 verify_email）
+	Email     string     `gorm:"not null;size:255" json:"email"`        // 令牌发送到的邮箱（邮箱变更后旧令牌失效）
+	TokenHash string     `gorm:"uniqueIndex;not null;size:64" json:"-"` // 令牌的 SHA-256（十六进制）
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`            // 过期时间
+	UsedAt    *time.Time `json:"used_at,omitempty"`                     // 使用时间（未使用为空）
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`               // 创建时间（用于限制发送频率）
+}
+
+// TableName 指定表名
+func (VerificationToken) TableName() string {
+	return "verification_tokens"
+}
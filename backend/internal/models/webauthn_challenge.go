@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// WebAuthn 挑战的用途
+const (
+	WebAuthnPurposeRegister = "register" // 注册通行密钥
+	WebAuthnPurposeLogin    = "login"    // 使用通行密钥登录（无密码）
+	WebAuthnPurposeMFA      = "mfa"      // 使用通行密钥完成两步验证
+)
+
+// WebAuthnChallenge 发给浏览器的 WebAuthn 挑战
+// 认证器签名的 clientDataJSON 中包含挑战，服务端按挑战找到记录并标记为已使用，每个挑战只能使用一次
+type WebAuthnChallenge struct {
+	ID            uint       `gorm:"primarykey" json:"-"`                   // 主键
+	ChallengeHash string     `gorm:"uniqueIndex;not null;size:64" json:"-"` // 挑战的 SHA-256（十六进制）
+	Purpose       string     `gorm:"not null;size:16" json:"-"`             // 用途
+	UserID        uint       `gorm:"not null;default:0" json:"-"`           // 用户ID（无密码登录时为 0，由凭证确定用户）
+	ExpiresAt     time.Time  `gorm:"not null" json:"-"`                     // 过期时间
+	UsedAt        *time.Time `json:"-"`                                     // 使用时间（为空表示未使用）
+	CreatedAt     time.Time  `json:"-"`                                     // 创建时间
+}
+
+// TableName 指定表名
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// WebAuthnCredential 用户注册的通行密钥（WebAuthn 凭证）
+// 只保存公钥，私钥保存在用户的设备或密码管理器中；SignCount 用于发现被复制的凭证
+type WebAuthnCredential struct {
+	ID             uint       `gorm:"primarykey" json:"id"`                    // 主键
+	UserID         uint       `gorm:"not null;index" json:"-"`                 // 用户ID
+	CredentialID   string     `gorm:"uniqueIndex;not null;size:1400" json:"-"` // 凭证ID（Base64URL）
+	PublicKey      []byte     `gorm:"not null" json:"-"`                       // COSE 格式的公钥
+	Algorithm      int        `gorm:"not null" json:"-"`                       // COSE 签名算法（-7 ES256、-8 EdDSA、-257 RS256）
+	SignCount      uint32     `gorm:"not null;default:0" json:"-"`             // 认证器的签名计数
+	Transports     string     `gorm:"size:255" json:"-"`                       // 认证器支持的传输方式（空格分隔，如 internal hybrid）
+	AAGUID         string     `gorm:"size:36" json:"-"`                        // 认证器型号标识
+	BackupEligible bool       `gorm:"not null;default:false" json:"-"`         // 是否可以同步备份（同步的通行密钥）
+	Name           string     `gorm:"size:100" json:"-"`                       // 用户起的名称
+	LastUsedAt     *time.Time `json:"-"`                                       // 最近使用时间
+	CreatedAt      time.Time  `json:"-"`                                       // 注册时间
+}
+
+// TableName 指定表名
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// TransportList 认证器支持的传输方式列表
+func (c *WebAuthnCredential) TransportList() []string {
+	return strings.Fields(c.Transports)
+}
+
+// WebAuthnCredentialResponse 通行密钥响应结构（不包含公钥）
+type WebAuthnCredentialResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Synced     bool       `json:"synced"` // 是否为可同步的通行密钥
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ToResponse 转换为响应结构
+func (c *WebAuthnCredential) ToResponse() WebAuthnCredentialResponse {
+	return WebAuthnCredentialResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		Synced:     c.BackupEligible,
+		Transports: c.TransportList(),
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIncorrectPassword 当前密码错误
+	ErrIncorrectPassword = errors.New("当前密码错误")
+	// ErrInvalidProfile 无效的用户资料
+	ErrInvalidProfile = errors.New("用户资料无效")
+)
+
+const (
+	purposeChangeEmail = "change_email" // 修改邮箱时验证新邮箱的令牌用途
+	maxNameLength      = 100            // 用户名最大长度（与数据库字段一致）
+)
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"` // 当前密码
+	NewPassword     string `json:"new_password" binding:"required"`     // 新密码
+}
+
+// UpdateProfileRequest 修改资料请求（只修改出现的字段）
+type UpdateProfileRequest struct {
+	Name            *string `json:"name"`             // 用户名
+	Email           *string `json:"email"`            // 新邮箱（验证新邮箱后才生效）
+	CurrentPassword string  `json:"current_password"` // 当前密码（修改邮箱时必填）
+}
+
+// ChangePassword 修改密码（需要当前密码）
+// 修改后撤销其他设备上的登录会话和已签发的 Token，保留当前会话
+func (s *AuthService) ChangePassword(session *SessionClaims, req ChangePasswordRequest, info SessionInfo) error {
+	// 1. 验证当前密码
+	user, err := s.GetUserByID(session.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCurrentPassword(user, req.CurrentPassword, info); err != nil {
+		return err
+	}
+
+	// 2. 验证并保存新密码
+	if err := s.validatePassword(req.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+	hashedPassword, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{"password": hashedPassword, "password_reset_required": false}).Error; err != nil {
+		return fmt.Errorf("更新密码失败: %w", err)
+	}
+
+	// 3. 撤销其他会话和 Token，记录审计并通知用户
+	if err := s.revokeCredentials(user.ID, session.SessionID); err != nil {
+		return err
+	}
+	recordAudit(user.ID, AuditPasswordChanged, AuditContext{ActorID: user.ID, SessionInfo: info}, nil)
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "您的密码已修改 - Shadow OAuth",
+		Body:    fmt.Sprintf("您好 %s：\n\n您的账户密码已于 %s 修改，其他设备上的登录已失效。\n\n如果这不是您本人的操作，请立即通过“忘记密码”重置密码。\n", user.Name, time.Now().Format("2006-01-02 15:04:05")),
+	})
+	return nil
+}
+
+// UpdateProfile 修改用户资料
+// 修改用户名立即生效；修改邮箱需要当前密码，新邮箱收到验证链接并验证后才生效，同时通知原邮箱
+// 所有校验通过并签发验证令牌后才在同一个事务中保存，任何一步失败都不会修改资料
+func (s *AuthService) UpdateProfile(userID uint, req UpdateProfileRequest, info SessionInfo) (*models.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := AuditContext{ActorID: userID, SessionInfo: info}
+
+	// 1. 验证用户名
+	updates := map[string]interface{}{}
+	oldName := user.Name
+	if req.Name != nil && *req.Name != user.Name {
+		name := strings.TrimSpace(*req.Name)
+		if len([]rune(name)) > maxNameLength {
+			return nil, fmt.Errorf("%w: 用户名不能超过 %d 个字符", ErrInvalidProfile, maxNameLength)
+		}
+		updates["name"] = name
+	}
+
+	// 2. 验证新邮箱（与当前邮箱相同时视为未修改），当前密码错误计入登录失败次数
+	var newEmail string
+	if req.Email != nil && !strings.EqualFold(*req.Email, user.Email) {
+		newEmail = *req.Email
+		if !emailRegex.MatchString(newEmail) {
+			return nil, ErrInvalidEmail
+		}
+		if err := s.checkCurrentPassword(user, req.CurrentPassword, info); err != nil {
+			return nil, err
+		}
+		if err := ensureEmailAvailable(newEmail, user.ID); err != nil {
+			return nil, err
+		}
+		updates["pending_email"] = newEmail
+	}
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	// 3. 签发新邮箱的验证令牌，并保存用户名和待验证的新邮箱
+	var token string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if newEmail != "" {
+			var err error
+			if token, err = issueVerificationToken(tx, user.ID, purposeChangeEmail, newEmail, verifyEmailTTL); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return fmt.Errorf("更新用户失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 记录审计；修改邮箱时向新邮箱发送验证链接，通知原邮箱
+	if name, ok := updates["name"]; ok {
+		recordAudit(user.ID, AuditProfileUpdated, ctx, map[string]interface{}{"name": map[string]string{"old": oldName, "new": name.(string)}})
+	}
+	if newEmail != "" {
+		recordAudit(user.ID, AuditEmailChangeRequested, ctx, map[string]interface{}{"old": user.Email, "new": newEmail})
+
+		link := s.issuer + "/verify-email?" + url.Values{"token": {token}}.Encode()
+		s.sendMailAsync(mail.Message{
+			To:      newEmail,
+			Subject: "验证您的新邮箱 - Shadow OAuth",
+			Body: fmt.Sprintf("您好 %s：\n\n请点击以下链接确认把账户邮箱修改为 %s（%d 小时内有效）：\n\n%s\n\n如果这不是您本人的操作，请忽略这封邮件。\n",
+				user.Name, newEmail, int(verifyEmailTTL.Hours()), link),
+		})
+		s.sendMailAsync(mail.Message{
+			To:      user.Email,
+			Subject: "账户邮箱修改申请 - Shadow OAuth",
+			Body: fmt.Sprintf("您好 %s：\n\n您的账户于 %s 申请把邮箱修改为 %s，新邮箱验证后生效。\n\n如果这不是您本人的操作，请立即修改密码。\n",
+				user.Name, time.Now().Format("2006-01-02 15:04:05"), newEmail),
+		})
+	}
+
+	return s.GetUserByID(user.ID)
+}
+
+// checkCurrentPassword 验证当前密码，错误次数与登录共用失败计数和锁定（防止用已登录的会话暴力猜测密码）
+func (s *AuthService) checkCurrentPassword(user *models.User, password string, info SessionInfo) error {
+	login := LoginRequest{Email: user.Email, SessionInfo: info}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return err
+	}
+	if !s.checkPassword(user, password) {
+		s.recordLoginFailure(login, user)
+		return ErrIncorrectPassword
+	}
+	s.resetLoginThrottle(login)
+	return nil
+}
+
+// confirmEmailChange 新邮箱验证通过后修改邮箱
+func (s *AuthService) confirmEmailChange(user *models.User, record *models.VerificationToken, ctx AuditContext) error {
+	// 1. 令牌必须对应用户当前申请的新邮箱（再次申请修改后旧链接失效）
+	if user.PendingEmail == "" || user.PendingEmail != record.Email {
+		return ErrInvalidVerificationToken
+	}
+
+	// 2. 新邮箱可能在等待验证期间被其他用户注册
+	if err := ensureEmailAvailable(record.Email, user.ID); err != nil {
+		return err
+	}
+
+	// 3. 修改邮箱并标记为已验证
+	oldEmail := user.Email
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"email":             record.Email,
+		"pending_email":     "",
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("更新用户失败: %w", err)
+	}
+	recordAudit(user.ID, AuditEmailChanged, ctx, map[string]interface{}{"old": oldEmail, "new": record.Email})
+	return nil
+}
+
+// ensureEmailAvailable 检查邮箱没有被其他用户使用（包括已软删除的用户）
+func ensureEmailAvailable(email string, userID uint) error {
+	var existing models.User
+	err := database.DB.Unscoped().Where("email = ? AND id <> ?", email, userID).First(&existing).Error
+	if err == nil {
+		return ErrEmailExists
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查询用户失败: %w", err)
+	}
+	return nil
+}
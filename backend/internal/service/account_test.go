@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// sessionClaims 把会话记录转换为 ChangePassword 使用的会话信息
+func sessionClaims(session *models.Session) *SessionClaims {
+	return &SessionClaims{UserID: session.UserID, SessionID: session.SessionID, AuthTime: session.AuthTime}
+}
+
+func TestChangePasswordWrongCurrentPassword(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	s.SetThrottle(NewThrottle(map[string]ThrottleRule{models.ThrottleKindAccount: testThrottleRule(3)}))
+	alice := createTestUser(t, s, "alice@example.com")
+	session, _, _ := newTestSession(t, s, alice.ID)
+
+	// 1. 当前密码错误时拒绝，且计入登录失败次数
+	for i := 0; i < 3; i++ {
+		err := s.ChangePassword(sessionClaims(session), ChangePasswordRequest{CurrentPassword: "wrong-password", NewPassword: newTestPassword}, SessionInfo{})
+		if !errors.Is(err, ErrIncorrectPassword) {
+			t.Fatalf("第 %d 次错误的当前密码: 期望 %v，实际 %v", i+1, ErrIncorrectPassword, err)
+		}
+	}
+
+	// 2. 达到阈值后账户被锁定，正确的密码也不能修改或登录
+	err := s.ChangePassword(sessionClaims(session), ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: newTestPassword}, SessionInfo{})
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("锁定后修改密码: 期望 %v，实际 %v", ErrTooManyAttempts, err)
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("锁定后登录: 期望 %v，实际 %v", ErrTooManyAttempts, err)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	current, currentToken, _ := newTestSession(t, s, alice.ID)
+	_, otherToken, _ := newTestSession(t, s, alice.ID)
+	if err := database.DB.Create(&models.AccessToken{Token: "issued", ClientID: "test_client", UserID: alice.ID, ExpiresAt: current.ExpiresAt}).Error; err != nil {
+		t.Fatalf("保存 Access Token 失败: %v", err)
+	}
+	if err := database.DB.Create(&models.AuthorizationCode{Code: "pending", ClientID: "test_client", UserID: alice.ID, ExpiresAt: current.ExpiresAt}).Error; err != nil {
+		t.Fatalf("保存授权码失败: %v", err)
+	}
+
+	if err := s.ChangePassword(sessionClaims(current), ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: newTestPassword}, SessionInfo{}); err != nil {
+		t.Fatalf("修改密码失败: %v", err)
+	}
+
+	// 1. 保留当前会话，撤销其他会话、Access Token 和未使用的授权码
+	if _, err := s.ValidateSession(currentToken); err != nil {
+		t.Fatalf("当前会话应保留: %v", err)
+	}
+	if _, err := s.ValidateSession(otherToken); err == nil {
+		t.Fatal("其他会话应失效")
+	}
+	var tokens int64
+	database.DB.Model(&models.AccessToken{}).Where("user_id = ?", alice.ID).Count(&tokens)
+	if tokens != 0 {
+		t.Fatalf("还有 %d 个 Access Token", tokens)
+	}
+	var code models.AuthorizationCode
+	database.DB.Where("code = ?", "pending").First(&code)
+	if !code.Used {
+		t.Fatal("未使用的授权码应作废")
+	}
+
+	// 2. 只能使用新密码登录
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err == nil {
+		t.Fatal("旧密码不应能登录")
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: newTestPassword}); err != nil {
+		t.Fatalf("新密码登录失败: %v", err)
+	}
+}
+
+func TestChangePasswordRejectsWeakPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{name: "过短", password: "Ab1-"},
+		{name: "包含邮箱", password: "Alice-2024-secret"},
+		{name: "超过 bcrypt 的 72 字节", password: strings.Repeat("Secret-42", 9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			alice := createTestUser(t, s, "alice@example.com")
+			session, _, _ := newTestSession(t, s, alice.ID)
+
+			err := s.ChangePassword(sessionClaims(session), ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: tt.password}, SessionInfo{})
+			if !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("期望 %v，实际 %v", ErrWeakPassword, err)
+			}
+			if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err != nil {
+				t.Fatalf("密码不应被修改: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileEmailChange(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	outbox := newTestOutbox(t, s)
+	newEmail := "alice@new.example.com"
+
+	// 1. 新邮箱验证前只记录为待验证邮箱
+	user, err := s.UpdateProfile(alice.ID, UpdateProfileRequest{Email: &newEmail, CurrentPassword: testPassword}, SessionInfo{})
+	if err != nil {
+		t.Fatalf("申请修改邮箱失败: %v", err)
+	}
+	if user.Email != alice.Email || user.PendingEmail != newEmail {
+		t.Fatalf("email = %s, pending_email = %s，期望 %s, %s", user.Email, user.PendingEmail, alice.Email, newEmail)
+	}
+
+	// 2. 新邮箱收到验证链接，原邮箱收到通知
+	var verifyMail, noticeMail string
+	for _, m := range waitForMails(t, outbox, 2) {
+		switch {
+		case strings.Contains(m, "To: "+newEmail):
+			verifyMail = m
+		case strings.Contains(m, "To: "+alice.Email):
+			noticeMail = m
+		}
+	}
+	if verifyMail == "" || noticeMail == "" {
+		t.Fatal("新邮箱和原邮箱都应收到邮件")
+	}
+
+	// 3. 验证新邮箱后修改生效
+	if _, err := s.VerifyEmail(mailLinkParam(t, verifyMail, "token"), SessionInfo{}); err != nil {
+		t.Fatalf("验证新邮箱失败: %v", err)
+	}
+	user, _ = s.GetUserByID(alice.ID)
+	if user.Email != newEmail || user.PendingEmail != "" || !user.EmailVerified {
+		t.Fatalf("验证后 email = %s, pending_email = %s, email_verified = %v", user.Email, user.PendingEmail, user.EmailVerified)
+	}
+	if _, err := s.Login(LoginRequest{Email: newEmail, Password: testPassword}); err != nil {
+		t.Fatalf("使用新邮箱登录失败: %v", err)
+	}
+}
+
+func TestUpdateProfileFailureLeavesUserUnchanged(t *testing.T) {
+	longName := strings.Repeat("长", maxNameLength+1)
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T, s *AuthService, user *models.User)
+		newName  string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{name: "用户名过长", newName: longName, wantErr: ErrInvalidProfile},
+		{name: "无效的邮箱", newName: "Alice", email: "not-an-email", password: testPassword, wantErr: ErrInvalidEmail},
+		{name: "当前密码错误", newName: "Alice", email: "alice@new.example.com", password: "wrong-password", wantErr: ErrIncorrectPassword},
+		{
+			name: "邮箱已被其他用户使用",
+			prepare: func(t *testing.T, s *AuthService, user *models.User) {
+				createTestUser(t, s, "bob@example.com")
+			},
+			newName: "Alice", email: "bob@example.com", password: testPassword, wantErr: ErrEmailExists,
+		},
+		{
+			name: "邮箱属于已软删除的用户",
+			prepare: func(t *testing.T, s *AuthService, user *models.User) {
+				bob := createTestUser(t, s, "bob@example.com")
+				if err := s.DeleteUser(bob.ID, false, AuditContext{}); err != nil {
+					t.Fatalf("删除用户失败: %v", err)
+				}
+			},
+			newName: "Alice", email: "bob@example.com", password: testPassword, wantErr: ErrEmailExists,
+		},
+		{
+			// 签发验证令牌失败时，已通过校验的用户名也不保存
+			name: "验证邮件发送过于频繁",
+			prepare: func(t *testing.T, s *AuthService, user *models.User) {
+				if _, err := issueVerificationToken(database.DB, user.ID, purposeChangeEmail, "other@example.com", verifyEmailTTL); err != nil {
+					t.Fatalf("签发令牌失败: %v", err)
+				}
+			},
+			newName: "Alice", email: "alice@new.example.com", password: testPassword, wantErr: ErrTooManyEmails,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			alice := createTestUser(t, s, "alice@example.com")
+			if tt.prepare != nil {
+				tt.prepare(t, s, alice)
+			}
+
+			req := UpdateProfileRequest{Name: &tt.newName, CurrentPassword: tt.password}
+			if tt.email != "" {
+				req.Email = &tt.email
+			}
+			if _, err := s.UpdateProfile(alice.ID, req, SessionInfo{}); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望 %v，实际 %v", tt.wantErr, err)
+			}
+
+			user, _ := s.GetUserByID(alice.ID)
+			if user.Name != alice.Name || user.Email != alice.Email || user.PendingEmail != "" {
+				t.Fatalf("失败后资料被修改: name = %s, email = %s, pending_email = %s", user.Name, user.Email, user.PendingEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrCannotModifySelf 管理员不能修改自己的账户状态或角色（避免误操作失去管理权限）
+var ErrCannotModifySelf = errors.New("不能修改自己的账户状态或角色")
+
+// 用户状态（用户列表的筛选条件）
+const (
+	UserStatusActive   = "active"   // 正常
+	UserStatusDisabled = "disabled" // 已停用
+	UserStatusDeleted  = "deleted"  // 已删除（软删除，可以恢复）
+)
+
+const defaultUserPageSize = 20 // 用户列表默认每页数量
+
+// UserListRequest 用户列表的查询参数
+type UserListRequest struct {
+	Query    string `form:"q"`                                                        // 按邮箱或用户名搜索
+	Status   string `form:"status" binding:"omitempty,oneof=active disabled deleted"` // 账户状态（默认列出所有未删除的用户）
+	Role     string `form:"role"`                                                     // 只列出拥有该角色的用户
+	Page     int    `form:"page" binding:"omitempty,min=1"`                           // 页码（从 1 开始）
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`              // 每页数量（默认 20）
+}
+
+// UserList 用户列表（分页）
+type UserList struct {
+	Users    []models.AdminUserResponse `json:"users"`
+	Total    int64                      `json:"total"`
+	Page     int                        `json:"page"`
+	PageSize int                        `json:"page_size"`
+}
+
+// UserDetail 用户详情
+type UserDetail struct {
+	User     models.AdminUserResponse    `json:"user"`
+	Sessions []models.SessionResponse    `json:"sessions"` // 未过期的登录会话
+	Passkeys []models.WebAuthnCredential `json:"passkeys"` // 通行密钥
+	Consents []models.Consent            `json:"consents"` // 已授权的客户端
+}
+
+// SetUserRolesRequest 设置用户角色请求
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required"` // 用户的全部角色（未列出的角色会被撤销）
+}
+
+// ListUsers 分页列出用户，支持按邮箱或用户名搜索、按状态和角色筛选
+func (s *AuthService) ListUsers(req UserListRequest) (*UserList, error) {
+	// 1. 分页参数
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultUserPageSize
+	}
+
+	// 2. 筛选条件
+	query := database.DB.Model(&models.User{})
+	switch req.Status {
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	case UserStatusDeleted:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if req.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(req.Query)) + "%"
+		query = query.Where(`(LOWER(email) LIKE ? ESCAPE '\' OR LOWER(name) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if req.Role != "" {
+		query = query.Where("id IN (?)", database.DB.Table("user_roles").Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").Where("roles.name = ?", req.Role))
+	}
+
+	// 3. 查询总数和当前页
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	var users []models.User
+	if err := query.Order("id").Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	// 4. 查询这些用户的角色
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	roles, err := rolesByUser(ids)
+	if err != nil {
+		return nil, err
+	}
+	list := &UserList{Users: make([]models.AdminUserResponse, 0, len(users)), Total: total, Page: req.Page, PageSize: req.PageSize}
+	for i := range users {
+		resp := users[i].ToAdminResponse()
+		resp.Roles = roles[users[i].ID]
+		list.Users = append(list.Users, resp)
+	}
+	return list, nil
+}
+
+// GetUserDetail 获取用户详情（包括已删除的用户）
+func (s *AuthService) GetUserDetail(userID uint) (*UserDetail, error) {
+	user, err := findUserUnscoped(userID)
+	if err != nil {
+		return nil, err
+	}
+	detail := &UserDetail{User: user.ToAdminResponse()}
+	if detail.User.Roles, err = userRoleNames(user.ID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.ListSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	detail.Sessions = make([]models.SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		detail.Sessions = append(detail.Sessions, sessions[i].ToResponse(""))
+	}
+	if detail.Passkeys, err = s.ListPasskeys(user.ID); err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", user.ID).Order("updated_at DESC").Find(&detail.Consents).Error; err != nil {
+		return nil, fmt.Errorf("查询授权记录失败: %w", err)
+	}
+	return detail, nil
+}
+
+// DisableUser 停用账户：撤销所有会话和 Token，之后不能再登录
+func (s *AuthService) DisableUser(userID uint, ctx AuditContext) (*models.User, error) {
+	if userID == ctx.ActorID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Disabled() {
+		now := time.Now()
+		if err := database.DB.Model(user).Update("disabled_at", now).Error; err != nil {
+			return nil, fmt.Errorf("停用账户失败: %w", err)
+		}
+		recordAudit(user.ID, AuditUserDisabled, ctx, nil)
+	}
+	if err := s.revokeCredentials(user.ID, ""); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// EnableUser 重新启用已停用的账户
+func (s *AuthService) EnableUser(userID uint, ctx AuditContext) (*models.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled() {
+		if err := database.DB.Model(user).Update("disabled_at", nil).Error; err != nil {
+			return nil, fmt.Errorf("启用账户失败: %w", err)
+		}
+		recordAudit(user.ID, AuditUserEnabled, ctx, nil)
+	}
+	return user, nil
+}
+
+// ForcePasswordReset 要求用户重置密码（如密码可能已泄露）
+// 当前密码立即不能用于登录，撤销所有会话和 Token，并向用户发送重置密码邮件
+func (s *AuthService) ForcePasswordReset(userID uint, ctx AuditContext) error {
+	// 1. 标记为需要重置密码
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Model(user).Update("password_reset_required", true).Error; err != nil {
+		return fmt.Errorf("保存用户失败: %w", err)
+	}
+
+	// 2. 撤销所有会话和 Token
+	if err := s.revokeCredentials(user.ID, ""); err != nil {
+		return err
+	}
+	recordAudit(user.ID, AuditPasswordResetForced, ctx, nil)
+
+	// 3. 发送重置密码邮件（发送过于频繁时用户仍可以通过“忘记密码”重新申请）
+	err = s.sendResetLink(user, "为了您的账户安全，管理员要求您重置密码，当前密码已不能用于登录。", "如有疑问，请联系管理员。")
+	if err != nil && !errors.Is(err, ErrTooManyEmails) {
+		return err
+	}
+	return nil
+}
+
+// RevokeUserCredentials 撤销用户的所有登录会话、Access Token 和未使用的授权码（在所有设备上退出登录）
+func (s *AuthService) RevokeUserCredentials(userID uint, ctx AuditContext) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeCredentials(user.ID, ""); err != nil {
+		return err
+	}
+	recordAudit(user.ID, AuditCredentialsRevoked, ctx, nil)
+	return nil
+}
+
+// SetUserRoles 设置用户的角色（授予列出的角色，撤销未列出的角色）
+// 操作者只能授予或撤销自己拥有全部权限的角色，不能修改自己的角色
+func (s *AuthService) SetUserRoles(userID uint, req SetUserRolesRequest, ctx AuditContext) ([]string, error) {
+	// 1. 校验用户和角色
+	if userID == ctx.ActorID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := userRoleNames(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var grant, revoke []string
+	for _, name := range req.Roles {
+		if !contains(current, name) && !contains(grant, name) {
+			grant = append(grant, name)
+		}
+	}
+	for _, name := range current {
+		if !contains(req.Roles, name) {
+			revoke = append(revoke, name)
+		}
+	}
+
+	// 2. 检查操作者是否可以授予或撤销这些角色
+	for _, name := range append(append([]string{}, grant...), revoke...) {
+		role, err := findRole(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkCanManageRole(ctx.ActorID, role); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. 授予和撤销角色
+	for _, name := range grant {
+		if err := s.AssignRole(user.ID, name, ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range revoke {
+		if err := s.RevokeRole(user.ID, name, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return userRoleNames(user.ID)
+}
+
+// DeleteUser 删除用户
+// 软删除保留用户数据（可以恢复，邮箱不能被重新注册）；硬删除同时删除会话、Token、授权记录、凭证等关联数据，不能恢复。审计记录保留
+func (s *AuthService) DeleteUser(userID uint, hard bool, ctx AuditContext) error {
+	// 1. 查询用户（硬删除也可以用于已软删除的用户）
+	if userID == ctx.ActorID {
+		return ErrCannotModifySelf
+	}
+	user, err := findUserUnscoped(userID)
+	if err != nil {
+		return err
+	}
+	if !hard && user.DeletedAt.Valid {
+		return nil
+	}
+
+	// 2. 撤销所有会话和 Token（通知客户端会话已结束）
+	if err := s.revokeCredentials(user.ID, ""); err != nil {
+		return err
+	}
+
+	// 3. 软删除
+	if !hard {
+		if err := database.DB.Delete(user).Error; err != nil {
+			return fmt.Errorf("删除用户失败: %w", err)
+		}
+		recordAudit(user.ID, AuditUserDeleted, ctx, map[string]interface{}{"hard": false})
+		return nil
+	}
+
+	// 4. 硬删除用户和关联数据
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.AccessToken{}, &models.AuthorizationCode{}, &models.Consent{}, &models.Session{},
+			&models.VerificationToken{}, &models.RecoveryCode{}, &models.WebAuthnCredential{},
+			&models.WebAuthnChallenge{}, &models.EmailLogin{}, &models.UserRole{}, &models.ClientCollaborator{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// 用户拥有的客户端保留，之后由管理员管理
+		if err := tx.Unscoped().Model(&models.OAuthClient{}).Where("owner_id = ?", user.ID).Update("owner_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(user).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除用户失败: %w", err)
+	}
+	recordAudit(user.ID, AuditUserDeleted, ctx, map[string]interface{}{"hard": true, "email": user.Email})
+	return nil
+}
+
+// RestoreUser 恢复软删除的用户（之前的会话和 Token 已撤销，需要重新登录）
+func (s *AuthService) RestoreUser(userID uint, ctx AuditContext) (*models.User, error) {
+	user, err := findUserUnscoped(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt.Valid {
+		if err := database.DB.Unscoped().Model(user).Update("deleted_at", nil).Error; err != nil {
+			return nil, fmt.Errorf("恢复用户失败: %w", err)
+		}
+		user.DeletedAt = gorm.DeletedAt{}
+		recordAudit(user.ID, AuditUserRestored, ctx, nil)
+	}
+	return user, nil
+}
+
+// checkCanManageRole 检查操作者是否拥有角色的全部权限（管理令牌和命令行的操作者为 0，不受限制）
+func (s *AuthService) checkCanManageRole(actorID uint, role *models.Role) error {
+	if actorID == 0 {
+		return nil
+	}
+	for _, permission := range ParseScope(role.Permissions) {
+		ok, err := s.HasPermission(actorID, permission)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: 没有角色 %s 的全部权限", ErrPermissionDenied, role.Name)
+		}
+	}
+	return nil
+}
+
+// findUserUnscoped 按ID查询用户（包括已软删除的用户）
+func findUserUnscoped(userID uint) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Unscoped().First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return &user, nil
+}
+
+// rolesByUser 批量查询用户的角色名
+func rolesByUser(userIDs []uint) (map[uint][]string, error) {
+	result := make(map[uint][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	var rows []struct {
+		UserID uint
+		Name   string
+	}
+	if err := database.DB.Table("user_roles").Select("user_roles.user_id, roles.name").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id IN ?", userIDs).Order("roles.name").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询用户角色失败: %w", err)
+	}
+	for _, row := range rows {
+		result[row.UserID] = append(result[row.UserID], row.Name)
+	}
+	return result, nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符（配合 ESCAPE '\' 使用）
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
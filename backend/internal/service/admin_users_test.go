@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// countRows 统计表中属于用户的记录数（包括软删除的记录）
+func countRows(t *testing.T, model interface{}, userID uint) int64 {
+	t.Helper()
+	var count int64
+	if err := database.DB.Unscoped().Model(model).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		t.Fatalf("统计记录失败: %v", err)
+	}
+	return count
+}
+
+func TestAdminCannotModifySelf(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	admin := createTestUserWithRoles(t, s, "admin@example.com", RoleAdmin)
+	self := AuditContext{ActorID: admin.ID}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{name: "停用自己", op: func() error { _, err := s.DisableUser(admin.ID, self); return err }},
+		{name: "修改自己的角色", op: func() error {
+			_, err := s.SetUserRoles(admin.ID, SetUserRolesRequest{Roles: []string{}}, self)
+			return err
+		}},
+		{name: "软删除自己", op: func() error { return s.DeleteUser(admin.ID, false, self) }},
+		{name: "硬删除自己", op: func() error { return s.DeleteUser(admin.ID, true, self) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrCannotModifySelf) {
+				t.Fatalf("期望 %v，实际 %v", ErrCannotModifySelf, err)
+			}
+		})
+	}
+
+	// 操作均未生效
+	detail, err := s.GetUserDetail(admin.ID)
+	if err != nil {
+		t.Fatalf("获取用户详情失败: %v", err)
+	}
+	if detail.User.DisabledAt != nil || detail.User.DeletedAt != nil || !contains(detail.User.Roles, RoleAdmin) {
+		t.Fatalf("管理员账户被修改: %+v", detail.User)
+	}
+}
+
+func TestDisableUser(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	admin := createTestUserWithRoles(t, s, "admin@example.com", RoleAdmin)
+	alice := createTestUser(t, s, "alice@example.com")
+	_, sessionToken, _ := newTestSession(t, s, alice.ID)
+	ctx := AuditContext{ActorID: admin.ID}
+
+	if _, err := s.DisableUser(alice.ID, ctx); err != nil {
+		t.Fatalf("停用账户失败: %v", err)
+	}
+	if _, err := s.ValidateSession(sessionToken); err == nil {
+		t.Fatal("停用后会话应失效")
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("停用后登录: 期望 %v，实际 %v", ErrAccountDisabled, err)
+	}
+
+	if _, err := s.EnableUser(alice.ID, ctx); err != nil {
+		t.Fatalf("启用账户失败: %v", err)
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err != nil {
+		t.Fatalf("启用后登录失败: %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name string
+		hard bool
+	}{
+		{name: "软删除", hard: false},
+		{name: "硬删除", hard: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			admin := createTestUserWithRoles(t, s, "admin@example.com", RoleAdmin)
+			alice := createTestUserWithRoles(t, s, "alice@example.com", RoleSupport)
+			_, sessionToken, _ := newTestSession(t, s, alice.ID)
+			client := &models.OAuthClient{ClientID: "alice_client", ClientSecret: "secret", Name: "Alice App", RedirectURI: "https://app.example.com/callback", OwnerID: &alice.ID}
+			if err := database.DB.Create(client).Error; err != nil {
+				t.Fatalf("创建客户端失败: %v", err)
+			}
+			if err := database.DB.Create(&models.Consent{UserID: alice.ID, ClientID: client.ClientID, Scope: "profile"}).Error; err != nil {
+				t.Fatalf("保存授权记录失败: %v", err)
+			}
+			ctx := AuditContext{ActorID: admin.ID}
+
+			if err := s.DeleteUser(alice.ID, tt.hard, ctx); err != nil {
+				t.Fatalf("删除用户失败: %v", err)
+			}
+
+			// 1. 无论哪种删除，会话都被撤销，不能再登录
+			if _, err := s.ValidateSession(sessionToken); err == nil {
+				t.Fatal("删除后会话应失效")
+			}
+			if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err == nil {
+				t.Fatal("删除后不应能登录")
+			}
+			var audits int64
+			database.DB.Model(&models.AuditEvent{}).Where("user_id = ? AND action = ?", alice.ID, AuditUserDeleted).Count(&audits)
+			if audits != 1 {
+				t.Fatalf("删除的审计记录有 %d 条，期望 1", audits)
+			}
+
+			if !tt.hard {
+				// 2. 软删除保留数据，邮箱不能被重新注册，可以恢复
+				if countRows(t, &models.Consent{}, alice.ID) != 1 || countRows(t, &models.UserRole{}, alice.ID) != 1 {
+					t.Fatal("软删除不应删除关联数据")
+				}
+				if _, err := s.Register(RegisterRequest{Email: alice.Email, Password: testPassword}); !errors.Is(err, ErrEmailExists) {
+					t.Fatalf("软删除后重新注册: 期望 %v，实际 %v", ErrEmailExists, err)
+				}
+				if err := s.DeleteUser(alice.ID, false, ctx); err != nil {
+					t.Fatalf("重复软删除: %v", err)
+				}
+				if _, err := s.RestoreUser(alice.ID, ctx); err != nil {
+					t.Fatalf("恢复用户失败: %v", err)
+				}
+				if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err != nil {
+					t.Fatalf("恢复后登录失败: %v", err)
+				}
+				return
+			}
+
+			// 3. 硬删除删除用户和关联数据，保留客户端和审计记录，邮箱可以重新注册
+			if _, err := s.GetUserDetail(alice.ID); !errors.Is(err, ErrUserNotFound) {
+				t.Fatalf("硬删除后查询用户: 期望 %v，实际 %v", ErrUserNotFound, err)
+			}
+			for name, model := range map[string]interface{}{
+				"会话":   &models.Session{},
+				"授权记录": &models.Consent{},
+				"角色":   &models.UserRole{},
+			} {
+				if n := countRows(t, model, alice.ID); n != 0 {
+					t.Fatalf("硬删除后还有 %d 条%s", n, name)
+				}
+			}
+			var kept models.OAuthClient
+			if err := database.DB.Where("client_id = ?", client.ClientID).First(&kept).Error; err != nil {
+				t.Fatalf("用户拥有的客户端应保留: %v", err)
+			}
+			if kept.OwnerID != nil {
+				t.Fatalf("客户端所有者应清空，实际 %d", *kept.OwnerID)
+			}
+			if _, err := s.RestoreUser(alice.ID, ctx); !errors.Is(err, ErrUserNotFound) {
+				t.Fatalf("硬删除后不能恢复，实际 %v", err)
+			}
+			createTestUser(t, s, alice.Email)
+		})
+	}
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	admin := createTestUserWithRoles(t, s, "admin@example.com", RoleAdmin)
+	alice := createTestUser(t, s, "alice@example.com")
+	_, sessionToken, _ := newTestSession(t, s, alice.ID)
+	outbox := newTestOutbox(t, s)
+
+	if err := s.ForcePasswordReset(alice.ID, AuditContext{ActorID: admin.ID}); err != nil {
+		t.Fatalf("要求重置密码失败: %v", err)
+	}
+
+	// 1. 当前密码不能再登录，会话被撤销
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); !errors.Is(err, ErrPasswordResetRequired) {
+		t.Fatalf("期望 %v，实际 %v", ErrPasswordResetRequired, err)
+	}
+	if _, err := s.ValidateSession(sessionToken); err == nil {
+		t.Fatal("要求重置密码后会话应失效")
+	}
+
+	// 2. 通过邮件中的链接设置新密码后恢复登录
+	token := mailLinkParam(t, waitForMails(t, outbox, 1)[0], "token")
+	if err := s.ResetPassword(ResetPasswordRequest{Token: token, Password: newTestPassword}); err != nil {
+		t.Fatalf("重置密码失败: %v", err)
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: newTestPassword}); err != nil {
+		t.Fatalf("重置后登录失败: %v", err)
+	}
+
+	// 3. 短时间内再次要求重置时邮件发送受限，但操作本身仍然生效
+	if err := s.ForcePasswordReset(alice.ID, AuditContext{ActorID: admin.ID}); err != nil {
+		t.Fatalf("再次要求重置密码失败: %v", err)
+	}
+	if _, err := s.Login(LoginRequest{Email: alice.Email, Password: newTestPassword}); !errors.Is(err, ErrPasswordResetRequired) {
+		t.Fatalf("期望 %v，实际 %v", ErrPasswordResetRequired, err)
+	}
+}
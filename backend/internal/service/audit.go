@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// 审计操作类型
+const (
+	AuditPasswordChanged      = "password_changed"        // 修改密码
+	AuditPasswordReset        = "password_reset"          // 通过邮件重置密码
+	AuditProfileUpdated       = "profile_updated"         // 修改资料（用户名）
+	AuditEmailChangeRequested = "email_change_requested"  // 申请修改邮箱（等待验证新邮箱）
+	AuditEmailChanged         = "email_changed"           // 新邮箱验证通过，邮箱已修改
+	AuditEmailVerified        = "email_verified"          // 邮箱验证通过
+	AuditAccountLocked        = "account_locked"          // 连续登录失败，账户被暂时锁定
+	AuditAccountUnlocked      = "account_unlocked"        // 管理员解除账户锁定
+	AuditMFAEnabled           = "mfa_enabled"             // 启用两步验证
+	AuditMFADisabled          = "mfa_disabled"            // 关闭两步验证
+	AuditRecoveryCodeUsed     = "recovery_code_used"      // 使用恢复码完成两步验证
+	AuditRecoveryCodesReset   = "recovery_codes_reset"    // 重新生成恢复码
+	AuditPasskeyAdded         = "passkey_added"           // 注册通行密钥
+	AuditPasskeyRemoved       = "passkey_removed"         // 删除通行密钥
+	AuditPasskeyCloned        = "passkey_clone_suspected" // 通行密钥签名计数没有增加，可能被复制
+	AuditRoleGranted          = "role_granted"            // 授予角色
+	AuditRoleRevoked          = "role_revoked"            // 撤销角色
+	AuditUserDisabled         = "user_disabled"           // 管理员停用账户
+	AuditUserEnabled          = "user_enabled"            // 管理员重新启用账户
+	AuditPasswordResetForced  = "password_reset_forced"   // 管理员要求重置密码
+	AuditCredentialsRevoked   = "credentials_revoked"     // 管理员撤销所有会话和 Token
+	AuditUserDeleted          = "user_deleted"            // 管理员删除用户
+	AuditUserRestored         = "user_restored"           // 管理员恢复已删除的用户
+)
+
+// AuditContext 审计记录中的操作者和请求信息
+type AuditContext struct {
+	ActorID     uint // 操作者ID（0 表示通过邮件链接等匿名操作）
+	SessionInfo      // 请求的设备信息
+}
+
+// recordAudit 写入审计记录（失败只记录日志，不影响操作本身）
+func recordAudit(userID uint, action string, ctx AuditContext, detail map[string]interface{}) {
+	event := &models.AuditEvent{
+		UserID:    userID,
+		ActorID:   ctx.ActorID,
+		Action:    action,
+		IPAddress: truncate(ctx.IPAddress, 64),
+		UserAgent: truncate(ctx.UserAgent, 255),
+	}
+	if len(detail) > 0 {
+		raw, err := json.Marshal(detail)
+		if err == nil {
+			event.Detail = string(raw)
+		}
+	}
+	if err := database.DB.Create(event).Error; err != nil {
+		log.Printf("写入审计记录失败（user=%d action=%s）: %v", userID, action, err)
+	}
+}
@@ -3,27 +3,41 @@ package service
 import (
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"time"
 
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var (
 	// ErrInvalidEmail 无效的邮箱格式
 	ErrInvalidEmail = errors.New("邮箱格式无效")
-	// ErrWeakPassword 密码强度不足
-	ErrWeakPassword = errors.New("密码必须至少包含 6 个字符")
+	// ErrWeakPassword 密码不符合密码策略（具体违反的规则见 PasswordPolicyError）
+	ErrWeakPassword = errors.New("密码不符合安全要求")
 	// ErrEmailExists 邮箱已存在
 	ErrEmailExists = errors.New("该邮箱已被注册")
 	// ErrInvalidCredentials 无效的登录凭证
 	ErrInvalidCredentials = errors.New("邮箱或密码错误")
 	// ErrUserNotFound 用户不存在
 	ErrUserNotFound = errors.New("用户不存在")
+	// ErrAccountDisabled 账户已被管理员停用
+	ErrAccountDisabled = errors.New("账户已被停用，请联系管理员")
+	// ErrPasswordResetRequired 管理员要求重置密码，当前密码不能再用于登录
+	ErrPasswordResetRequired = errors.New("需要重置密码，请使用“忘记密码”通过邮件设置新密码")
+)
+
+// SessionCookieName 登录会话 Cookie 的名称（保存服务端会话令牌，HttpOnly）
+const SessionCookieName = "shadow_session"
+
+// 登录方式
+const (
+	SessionModeToken  = "token"  // 返回 JWT，由前端保存（默认）
+	SessionModeCookie = "cookie" // 不返回 JWT，只使用 HttpOnly 会话 Cookie
 )
 
 // emailRegex 邮箱格式验证正则表达式
@@ -31,15 +45,36 @@ var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-
 
 // AuthService 认证服务
 type AuthService struct {
-	jwtSecret string        // JWT 签名密钥
-	jwtExpire time.Duration // JWT 过期时间
+	issuer         string         // 签发者标识
+	jwtSecret      string         // JWT 签名密钥
+	jwtExpire      time.Duration  // JWT 过期时间
+	logoutNotifier LogoutNotifier // 会话结束时通知客户端（可选）
+
+	mailer            mail.Mailer // 邮件发送器（验证邮件等）
+	emailVerification string      // 邮箱验证要求（optional、authorize、login）
+
+	passwordPolicy *PasswordPolicy // 密码策略（注册、重置和修改密码时检查）
+	passwordHasher *PasswordHasher // 密码哈希器（登录时将旧算法或旧参数的哈希升级为当前配置）
+	throttle       *Throttle       // 登录失败计数（按账户和 IP 锁定）
+
+	webauthn WebAuthnConfig // 通行密钥的依赖方配置
 }
 
 // NewAuthService 创建认证服务实例
-func NewAuthService(jwtSecret string, expireHours int) *AuthService {
+func NewAuthService(jwtSecret string, expireHours int, issuer string) *AuthService {
 	return &AuthService{
+		issuer:    issuer,
 		jwtSecret: jwtSecret,
 		jwtExpire: time.Duration(expireHours) * time.Hour,
+
+		mailer:            mail.NewLogMailer(),
+		emailVerification: EmailVerificationOptional,
+
+		passwordPolicy: DefaultPasswordPolicy(),
+		passwordHasher: DefaultPasswordHasher(),
+		throttle:       DefaultThrottle(),
+
+		webauthn: WebAuthnConfig{RPID: "localhost", RPName: "Shadow OAuth", Origins: []string{issuer}},
 	}
 }
 
@@ -52,14 +87,35 @@ type RegisterRequest struct {
 
 // LoginRequest 登录请求结构
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required"`    // 邮箱（必填）
-	Password string `json:"password" binding:"required"` // 密码（必填）
+	Email    string `json:"email" binding:"required"`                    // 邮箱（必填）
+	Password string `json:"password" binding:"required"`                 // 密码（必填）
+	Continue string `json:"continue"`                                    // 登录后需要恢复的授权请求（可选，由授权端点签发）
+	Mode     string `json:"mode" binding:"omitempty,oneof=token cookie"` // 登录方式：token（默认）或 cookie
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// SessionClaims 登录 Token 中携带的会话信息
+type SessionClaims struct {
+	UserID    uint      // 用户ID
+	SessionID string    // 会话标识（sid）
+	AuthTime  time.Time // 用户完成认证的时间（OIDC auth_time）
+	AMR       []string  // 认证方式（RFC 8176 amr）
 }
 
 // LoginResponse 登录响应结构
 type LoginResponse struct {
-	Token string              `json:"token"` // JWT Token
-	User  models.UserResponse `json:"user"`  // 用户信息
+	Token        string               `json:"token,omitempty"`        // JWT Token（cookie 模式下不返回）
+	User         *models.UserResponse `json:"user,omitempty"`         // 用户信息（等待两步验证时不返回）
+	RedirectURL  string               `json:"redirect_url,omitempty"` // 登录后需要跳转的地址（携带 continue 时返回）
+	CSRFToken    string               `json:"csrf_token,omitempty"`   // cookie 模式下写操作需要携带的 CSRF Token
+	SessionToken string               `json:"-"`                      // 服务端会话令牌（写入 HttpOnly Cookie，不出现在响应中）
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`            // 需要完成两步验证（此时没有创建会话）
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"` // 账户要求两步验证但尚未启用，需要先设置验证器
+	MFAToken              string   `json:"mfa_token,omitempty"`               // 提交第二步验证时携带的令牌（5 分钟内有效）
+	MFAMethods            []string `json:"mfa_methods,omitempty"`             // 可以使用的第二步验证方式（totp、webauthn）
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`          // 登录时启用两步验证后生成的恢复码（只显示这一次）
 }
 
 // Register 用户注册
@@ -69,29 +125,29 @@ func (s *AuthService) Register(req RegisterRequest) (*models.User, error) {
 		return nil, ErrInvalidEmail
 	}
 
-	// 2. 验证密码强度
-	if len(req.Password) < 6 {
-		return nil, ErrWeakPassword
+	// 2. 验证密码是否符合策略
+	if err := s.validatePassword(req.Password, req.Email, req.Name); err != nil {
+		return nil, err
 	}
 
-	// 3. 检查邮箱是否已存在
+	// 3. 检查邮箱是否已存在（软删除的用户可以恢复，邮箱仍被占用）
 	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := database.DB.Unscoped().Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
 		return nil, ErrEmailExists
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("查询用户失败: %w", err)
 	}
 
-	// 4. 加密密码（使用 bcrypt）
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// 4. 加密密码（使用配置的哈希算法）
+	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
-		return nil, fmt.Errorf("密码加密失败: %w", err)
+		return nil, err
 	}
 
 	// 5. 创建用户
 	user := &models.User{
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     req.Name,
 	}
 
@@ -99,44 +155,173 @@ func (s *AuthService) Register(req RegisterRequest) (*models.User, error) {
 		return nil, fmt.Errorf("创建用户失败: %w", err)
 	}
 
+	// 6. 发送邮箱验证链接
+	s.sendVerificationAfterRegister(user)
+
 	return user, nil
 }
 
+// SetPasswordPolicy 设置密码策略
+func (s *AuthService) SetPasswordPolicy(policy *PasswordPolicy) {
+	s.passwordPolicy = policy
+}
+
+// validatePassword 验证密码是否符合策略，不符合时返回列出所有违反规则的 *PasswordPolicyError
+func (s *AuthService) validatePassword(password, email, name string) error {
+	return s.passwordPolicy.Check(password, email, name)
+}
+
+// SetPasswordHasher 设置密码哈希器
+func (s *AuthService) SetPasswordHasher(hasher *PasswordHasher) error {
+	if err := hasher.Validate(); err != nil {
+		return err
+	}
+	s.passwordHasher = hasher
+	return nil
+}
+
+// hashPassword 使用当前配置的算法加密密码
+func (s *AuthService) hashPassword(password string) (string, error) {
+	return s.passwordHasher.Hash(password)
+}
+
+// checkPassword 验证用户密码，哈希无法识别时视为不匹配
+func (s *AuthService) checkPassword(user *models.User, password string) bool {
+	ok, _, err := s.passwordHasher.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("验证用户 %d 的密码失败: %v", user.ID, err)
+	}
+	return ok
+}
+
 // Login 用户登录
 func (s *AuthService) Login(req LoginRequest) (*LoginResponse, error) {
-	// 1. 查询用户
+	// 0. 校验登录后需要恢复的授权请求
+	if req.Continue != "" {
+		if _, err := s.ParseContinuation(req.Continue); err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. 检查账户和 IP 是否因多次失败被锁定
+	if err := s.checkLoginThrottle(req); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询用户（不存在时执行一次同等开销的哈希计算，使响应时间与密码错误时一致）
 	var user models.User
 	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.passwordHasher.VerifyDummy(req.Password)
+			s.recordLoginFailure(req, nil)
 			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("查询用户失败: %w", err)
 	}
 
-	// 2. 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	// 3. 验证密码，哈希使用旧的算法或参数时用当前配置重新计算（失败不影响登录）
+	ok, needsRehash, err := s.passwordHasher.Verify(req.Password, user.Password)
+	if err != nil {
+		log.Printf("验证用户 %d 的密码失败: %v", user.ID, err)
+	}
+	if !ok {
+		s.recordLoginFailure(req, &user)
 		return nil, ErrInvalidCredentials
 	}
+	s.resetLoginThrottle(req)
+	if needsRehash {
+		s.rehashPassword(&user, req.Password)
+	}
 
-	// 3. 生成 JWT Token
-	token, err := s.GenerateToken(user.ID)
+	// 4. 管理员要求重置密码时不能再使用当前密码登录；要求验证邮箱后才能登录
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+	if s.emailVerification == EmailVerificationLogin && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 5. 启用了两步验证、注册了通行密钥（或账户要求两步验证）时返回 MFA 令牌，完成第二步验证后才创建会话
+	amr := []string{AMRPassword}
+	if user.MFAEnabled() || user.MFARequired || s.hasPasskeys(user.ID) {
+		return s.beginMFA(&user, req, amr)
+	}
+
+	// 6. 创建会话
+	return s.completeLogin(&user, amr, req.Continue, req.Mode, req.SessionInfo)
+}
+
+// completeLogin 认证完成后创建服务端会话，token 模式同时生成 JWT
+func (s *AuthService) completeLogin(user *models.User, amr []string, continuation, mode string, info SessionInfo) (*LoginResponse, error) {
+	// 0. 停用的账户不能登录（所有登录方式最终都经过这里）
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	// 1. 创建服务端会话
+	session, sessionToken, err := s.CreateSession(user.ID, time.Now(), amr, info)
 	if err != nil {
-		return nil, fmt.Errorf("生成 Token 失败: %w", err)
+		return nil, err
+	}
+	userResp := user.ToResponse()
+	resp := &LoginResponse{
+		User:         &userResp,
+		SessionToken: sessionToken,
 	}
 
-	return &LoginResponse{
-		Token: token,
-		User:  user.ToResponse(),
-	}, nil
+	// 2. 生成 JWT Token（cookie 模式只使用会话 Cookie）
+	if mode != SessionModeCookie {
+		token, err := s.GenerateToken(session)
+		if err != nil {
+			return nil, fmt.Errorf("生成 Token 失败: %w", err)
+		}
+		resp.Token = token
+	}
+	if continuation != "" {
+		resp.RedirectURL = s.ResumeURL(continuation)
+	}
+	return resp, nil
 }
 
-// GenerateToken 生成 JWT Token
-func (s *AuthService) GenerateToken(userID uint) (string, error) {
+// rehashPassword 用当前配置重新计算密码哈希
+// 条件更新保证密码在此期间被修改时不会被覆盖
+func (s *AuthService) rehashPassword(user *models.User, password string) {
+	hashed, err := s.hashPassword(password)
+	if err != nil {
+		log.Printf("升级用户 %d 的密码哈希失败: %v", user.ID, err)
+		return
+	}
+	if err := database.DB.Model(&models.User{}).Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashed).Error; err != nil {
+		log.Printf("升级用户 %d 的密码哈希失败: %v", user.ID, err)
+		return
+	}
+	user.Password = hashed
+}
+
+// SessionExpire 登录会话的有效期
+func (s *AuthService) SessionExpire() time.Duration {
+	return s.jwtExpire
+}
+
+// GenerateToken 为登录会话生成 JWT Token
+// Token 通过 sid 关联服务端会话，会话被撤销后 Token 随即失效
+func (s *AuthService) GenerateToken(session *models.Session) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", fmt.Errorf("生成 Token 标识失败: %w", err)
+	}
+
 	// 创建 JWT Claims
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID,                             // 用户ID
-		"exp":     time.Now().Add(s.jwtExpire).Unix(), // 过期时间
-		"iat":     time.Now().Unix(),                  // 签发时间
+		"iss":       s.issuer,                 // 签发者
+		"user_id":   session.UserID,           // 用户ID
+		"sid":       session.SessionID,        // 会话标识
+		"jti":       jti,                      // Token 标识
+		"exp":       session.ExpiresAt.Unix(), // 过期时间（与会话一致）
+		"iat":       now.Unix(),               // 签发时间
+		"auth_time": session.AuthTime.Unix(),  // 认证时间（用于 max_age / prompt=login 判断）
 	}
 
 	// 创建 Token
@@ -151,8 +336,8 @@ func (s *AuthService) GenerateToken(userID uint) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken 验证 JWT Token
-func (s *AuthService) ValidateToken(tokenString string) (uint, error) {
+// ValidateToken 验证 JWT Token，并检查关联的会话仍然有效（未退出登录、未被撤销）
+func (s *AuthService) ValidateToken(tokenString string) (*SessionClaims, error) {
 	// 解析 Token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// 验证签名方法
@@ -160,22 +345,37 @@ func (s *AuthService) ValidateToken(tokenString string) (uint, error) {
 			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
 		}
 		return []byte(s.jwtSecret), nil
-	})
+	}, jwt.WithIssuer(s.issuer))
 
 	if err != nil {
-		return 0, fmt.Errorf("Token 解析失败: %w", err)
+		return nil, fmt.Errorf("Token 解析失败: %w", err)
 	}
 
 	// 提取 Claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			return 0, errors.New("Token 中缺少 user_id")
-		}
-		return uint(userID), nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("无效的 Token")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("Token 中缺少 user_id")
+	}
+
+	// 没有 sid 的 Token 无法撤销，不再接受
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil, errors.New("Token 中缺少 sid")
 	}
 
-	return 0, errors.New("无效的 Token")
+	// 查询关联的会话
+	session, err := s.loadSession("session_id = ?", sid)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != uint(userID) {
+		return nil, ErrInvalidSession
+	}
+	return session, nil
 }
 
 // GetUserByID 根据 ID 获取用户
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// ErrInvalidAuthorizationDetails 无效的授权详情（RFC 9396 invalid_authorization_details）
+var ErrInvalidAuthorizationDetails = errors.New("无效的授权详情")
+
+// ValidateAuthorizationDetails 验证 authorization_details 参数（RFC 9396）
+// 参数必须是 JSON 对象数组，每个对象的 type 必须已登记，并符合该类型的 JSON Schema
+// 返回规范化后的 JSON，参数为空时返回空字符串
+func (s *OAuthService) ValidateAuthorizationDetails(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+
+	// 1. 解析为对象数组
+	var details []map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &details); err != nil {
+		return "", fmt.Errorf("%w: 必须是 JSON 对象数组", ErrInvalidAuthorizationDetails)
+	}
+	if len(details) == 0 {
+		return "", fmt.Errorf("%w: 不能为空数组", ErrInvalidAuthorizationDetails)
+	}
+
+	// 2. 按类型校验每个对象
+	for i, detail := range details {
+		detailType, _ := detail["type"].(string)
+		if detailType == "" {
+			return "", fmt.Errorf("%w: 第 %d 项缺少 type", ErrInvalidAuthorizationDetails, i+1)
+		}
+
+		var registered models.AuthorizationDetailType
+		if err := database.DB.Where("type = ?", detailType).First(&registered).Error; err != nil {
+			return "", fmt.Errorf("%w: 不支持的类型 %s", ErrInvalidAuthorizationDetails, detailType)
+		}
+		schema, err := compileJSONSchema(registered.Schema)
+		if err != nil {
+			return "", fmt.Errorf("类型 %s 的 Schema 无效: %w", detailType, err)
+		}
+		if problems := schema.validate(fmt.Sprintf("authorization_details[%d]", i), detail); len(problems) > 0 {
+			return "", fmt.Errorf("%w: %s", ErrInvalidAuthorizationDetails, strings.Join(problems, "; "))
+		}
+	}
+
+	// 3. 返回规范化的 JSON
+	normalized, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAuthorizationDetails, err)
+	}
+	return string(normalized), nil
+}
+
+// AuthorizationDetailTypes 返回已登记的授权详情类型
+func (s *OAuthService) AuthorizationDetailTypes() ([]string, error) {
+	var types []string
+	if err := database.DB.Model(&models.AuthorizationDetailType{}).Order("type").Pluck("type", &types).Error; err != nil {
+		return nil, fmt.Errorf("查询授权详情类型失败: %w", err)
+	}
+	return types, nil
+}
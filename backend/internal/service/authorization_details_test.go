@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// testPaymentSchema 测试使用的 payment_initiation 类型
+const testPaymentSchema = `{
+	"type": "object",
+	"required": ["type", "instructedAmount", "creditorAccount"],
+	"additionalProperties": false,
+	"properties": {
+		"type": {"const": "payment_initiation"},
+		"actions": {"type": "array", "minItems": 1, "items": {"enum": ["initiate", "status", "cancel"]}},
+		"instructedAmount": {
+			"type": "object",
+			"required": ["currency", "amount"],
+			"properties": {
+				"currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+				"amount": {"type": "number", "minimum": 0.01, "maximum": 10000}
+			}
+		},
+		"creditorAccount": {
+			"type": "object",
+			"required": ["iban"],
+			"properties": {"iban": {"type": "string", "minLength": 15, "maxLength": 34}}
+		},
+		"remittanceInformation": {"type": ["string", "null"]}
+	}
+}`
+
+func TestValidateAuthorizationDetails(t *testing.T) {
+	newTestDB(t)
+	types := []models.AuthorizationDetailType{
+		{Type: "payment_initiation", Description: "发起付款", Schema: testPaymentSchema},
+		{Type: "account_information", Description: "查看账户", Schema: `{"type": "object", "properties": {"locations": {"type": "array", "maxItems": 2}}}`},
+		{Type: "broken", Schema: `{"type": "object", "properties": {"x": {"pattern": "("}}}`},
+	}
+	if err := database.DB.Create(&types).Error; err != nil {
+		t.Fatalf("登记授权详情类型失败: %v", err)
+	}
+	s := NewOAuthService(testSecret, 1, testIssuer)
+
+	const payment = `{"actions":["initiate"],"creditorAccount":{"iban":"DE02100100109307118603"},"instructedAmount":{"amount":123.5,"currency":"EUR"},"type":"payment_initiation"}`
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{name: "参数为空", raw: "  "},
+		{name: "不是数组", raw: payment, wantErr: true},
+		{name: "单个付款", raw: "[" + payment + "]", want: "[" + payment + "]"},
+		{
+			name: "规范化 JSON",
+			raw:  `[ {"type": "account_information", "locations": ["https://bank.example.com"]} ]`,
+			want: `[{"locations":["https://bank.example.com"],"type":"account_information"}]`,
+		},
+		{name: "多种类型", raw: `[` + payment + `,{"type":"account_information"}]`, want: `[` + payment + `,{"type":"account_information"}]`},
+		{name: "允许 null 的字段", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":1},"creditorAccount":{"iban":"DE02100100109307118603"},"remittanceInformation":null}]`, want: `[{"creditorAccount":{"iban":"DE02100100109307118603"},"instructedAmount":{"amount":1,"currency":"EUR"},"remittanceInformation":null,"type":"payment_initiation"}]`},
+		{name: "不是 JSON", raw: "payment", wantErr: true},
+		{name: "空数组", raw: "[]", wantErr: true},
+		{name: "数组元素不是对象", raw: `["payment_initiation"]`, wantErr: true},
+		{name: "缺少 type", raw: `[{"actions":["initiate"]}]`, wantErr: true},
+		{name: "未登记的类型", raw: `[{"type":"unknown"}]`, wantErr: true},
+		{name: "缺少必填字段", raw: `[{"type":"payment_initiation","creditorAccount":{"iban":"DE02100100109307118603"}}]`, wantErr: true},
+		{name: "不允许的字段", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":1},"creditorAccount":{"iban":"DE02100100109307118603"},"extra":true}]`, wantErr: true},
+		{name: "币种不匹配 pattern", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"eur","amount":1},"creditorAccount":{"iban":"DE02100100109307118603"}}]`, wantErr: true},
+		{name: "金额超过最大值", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":10001},"creditorAccount":{"iban":"DE02100100109307118603"}}]`, wantErr: true},
+		{name: "金额类型错误", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"1"},"creditorAccount":{"iban":"DE02100100109307118603"}}]`, wantErr: true},
+		{name: "IBAN 过短", raw: `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":1},"creditorAccount":{"iban":"DE02"}}]`, wantErr: true},
+		{name: "不在枚举中的操作", raw: `[{"type":"payment_initiation","actions":["refund"],"instructedAmount":{"currency":"EUR","amount":1},"creditorAccount":{"iban":"DE02100100109307118603"}}]`, wantErr: true},
+		{name: "数组元素过多", raw: `[{"type":"account_information","locations":["a","b","c"]}]`, wantErr: true},
+		{name: "任一项无效", raw: `[{"type":"account_information"},{"type":"unknown"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ValidateAuthorizationDetails(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAuthorizationDetails) {
+					t.Fatalf("期望错误 %v，实际 %v", ErrInvalidAuthorizationDetails, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("规范化结果 = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+
+	// 登记的 Schema 本身无效属于服务器配置错误，不是请求错误
+	if _, err := s.ValidateAuthorizationDetails(`[{"type":"broken"}]`); err == nil || errors.Is(err, ErrInvalidAuthorizationDetails) {
+		t.Fatalf("Schema 无效时应返回服务器错误，实际 %v", err)
+	}
+
+	names, err := s.AuthorizationDetailTypes()
+	if err != nil {
+		t.Fatalf("查询授权详情类型失败: %v", err)
+	}
+	if want := []string{"account_information", "broken", "payment_initiation"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("授权详情类型 = %v，期望 %v", names, want)
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		schema       string
+		value        interface{}
+		wantProblems []string
+	}{
+		{name: "integer 接受整数", schema: `{"type": "integer"}`, value: 3.0},
+		{name: "integer 拒绝小数", schema: `{"type": "integer"}`, value: 3.5, wantProblems: []string{"$: 类型应为 integer"}},
+		{name: "类型数组", schema: `{"type": ["string", "boolean"]}`, value: true},
+		{name: "按字符计算长度", schema: `{"type": "string", "maxLength": 2}`, value: "付款"},
+		{name: "const", schema: `{"const": "a"}`, value: "b", wantProblems: []string{"$: 取值应为 a"}},
+		{
+			name:   "列出所有问题并按字段排序",
+			schema: `{"type": "object", "required": ["id"], "properties": {"a": {"type": "string"}, "b": {"type": "number", "minimum": 1}}}`,
+			value:  map[string]interface{}{"b": 0.0, "a": 1.0},
+			wantProblems: []string{
+				"$: 缺少必填字段 id",
+				"$.a: 类型应为 string",
+				"$.b: 不能小于 1",
+			},
+		},
+		{
+			name:         "数组元素的位置",
+			schema:       `{"type": "array", "items": {"type": "string"}}`,
+			value:        []interface{}{"a", 2.0},
+			wantProblems: []string{"$[1]: 类型应为 string"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := compileJSONSchema(tt.schema)
+			if err != nil {
+				t.Fatalf("解析 Schema 失败: %v", err)
+			}
+			if problems := schema.validate("$", tt.value); !reflect.DeepEqual(problems, tt.wantProblems) {
+				t.Fatalf("问题 = %q，期望 %q", problems, tt.wantProblems)
+			}
+		})
+	}
+
+	if _, err := compileJSONSchema(`{"items": {"pattern": "["}}`); err == nil {
+		t.Fatal("嵌套的无效 pattern 应在解析时报错")
+	}
+}
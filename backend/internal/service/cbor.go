@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errInvalidCBOR CBOR 数据格式错误
+var errInvalidCBOR = errors.New("CBOR 数据格式错误")
+
+// cborMaxDepth 嵌套层数上限（WebAuthn 的数据只有两三层，防止恶意数据耗尽栈空间）
+const cborMaxDepth = 16
+
+// decodeCBOR 解码一个 CBOR 数据项（RFC 8949），返回解码结果和剩余的字节
+// 只支持 WebAuthn 用到的类型：整数返回 int64，字节串返回 []byte，文本返回 string，
+// 数组返回 []interface{}，映射返回 map[interface{}]interface{}，以及 true、false、null；
+// 不支持不定长编码、标签和浮点数
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w: 嵌套层数过多", errInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: 数据不完整", errInvalidCBOR)
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// 简单值：false、true、null
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("%w: 不支持的简单值 %d", errInvalidCBOR, info)
+	}
+
+	// 1. 读取长度或整数值
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(data) >= 1:
+		arg, data = uint64(data[0]), data[1:]
+	case info == 25 && len(data) >= 2:
+		arg, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26 && len(data) >= 4:
+		arg, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27 && len(data) >= 8:
+		arg, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, fmt.Errorf("%w: 不支持的长度编码", errInvalidCBOR)
+	}
+
+	// 2. 按类型解码
+	switch major {
+	case 0: // 非负整数
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: 整数溢出", errInvalidCBOR)
+		}
+		return int64(arg), data, nil
+	case 1: // 负整数（-1 - arg）
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: 整数溢出", errInvalidCBOR)
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3: // 字节串、文本
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: 数据不完整", errInvalidCBOR)
+		}
+		value := data[:arg]
+		if major == 3 {
+			return string(value), data[arg:], nil
+		}
+		return append([]byte(nil), value...), data[arg:], nil
+	case 4: // 数组
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: 数据不完整", errInvalidCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items, data = append(items, item), rest
+		}
+		return items, data, nil
+	case 5: // 映射（键只支持整数和文本）
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: 数据不完整", errInvalidCBOR)
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: 不支持的映射键", errInvalidCBOR)
+			}
+			if _, exists := items[key]; exists {
+				return nil, nil, fmt.Errorf("%w: 重复的映射键", errInvalidCBOR)
+			}
+			value, rest, err := decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key], data = value, rest
+		}
+		return items, data, nil
+	}
+	return nil, nil, fmt.Errorf("%w: 不支持的类型 %d", errInvalidCBOR, major)
+}
@@ -0,0 +1,600 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidClientMetadata 客户端配置无效（重定向URI、授权类型、认证方式等）
+	ErrInvalidClientMetadata = errors.New("无效的客户端配置")
+	// ErrClientNotFound 客户端不存在
+	ErrClientNotFound = errors.New("客户端不存在")
+)
+
+const (
+	maxTokenLifetime      = 30 * 24 * 60 * 60 // 客户端可以设置的 Token 最长有效期（秒）
+	defaultClientPageSize = 20                // 客户端列表默认每页数量
+)
+
+// ClientRequest 创建或修改客户端的请求（修改时整体替换可配置的字段）
+type ClientRequest struct {
+	Name                    string   `json:"name" binding:"required,max=100"`                 // 客户端名称
+	RedirectURIs            []string `json:"redirect_uris" binding:"required,min=1"`          // 重定向URI（授权请求中的 redirect_uri 必须与其中之一完全一致）
+	GrantTypes              []string `json:"grant_types"`                                     // 允许的授权类型（默认 authorization_code）
+	Scopes                  []string `json:"scopes"`                                          // 允许请求的权限范围（为空表示不限制）
+	AccessTokenLifetime     int      `json:"access_token_lifetime" binding:"min=0"`           // Access Token 有效期（秒，0 表示使用服务器默认值）
+	IDTokenLifetime         int      `json:"id_token_lifetime" binding:"min=0"`               // ID Token 有效期（秒，0 表示使用服务器默认值）
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`                      // Token 端点认证方式（默认 client_secret_post）
+	TLSClientAuthSubjectDN  string   `json:"tls_client_auth_subject_dn" binding:"max=255"`    // tls_client_auth：证书主题 DN
+	TLSClientCertificates   string   `json:"tls_client_certificates"`                         // self_signed_tls_client_auth：自签名证书（PEM，可包含多个）
+	LogoURI                 string   `json:"logo_uri" binding:"omitempty,url,max=500"`        // 客户端 Logo
+	ClientURI               string   `json:"client_uri" binding:"omitempty,url,max=500"`      // 客户端主页
+	PolicyURI               string   `json:"policy_uri" binding:"omitempty,url,max=500"`      // 隐私政策地址
+	TOSURI                  string   `json:"tos_uri" binding:"omitempty,url,max=500"`         // 服务条款地址
+	PostLogoutRedirectURIs  []string `json:"post_logout_redirect_uris"`                       // 注销后允许跳转的地址
+	FrontchannelLogoutURI   string   `json:"frontchannel_logout_uri" binding:"omitempty,url"` // 前端通道注销地址
+	BackchannelLogoutURI    string   `json:"backchannel_logout_uri" binding:"omitempty,url"`  // 后端通道注销地址
+}
+
+// ClientListRequest 客户端列表的查询参数
+type ClientListRequest struct {
+	Query    string `form:"q"`                                                                 // 按客户端ID或名称搜索
+	Status   string `form:"status" binding:"omitempty,oneof=active disabled pending rejected"` // 客户端状态
+	OwnerID  uint   `form:"owner_id"`                                                          // 按所有者筛选
+	Page     int    `form:"page" binding:"omitempty,min=1"`                                    // 页码（从 1 开始）
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`                       // 每页数量（默认 20）
+}
+
+// ClientList 客户端列表（分页）
+type ClientList struct {
+	Clients  []models.OAuthClient `json:"clients"`
+	Total    int64                `json:"total"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+}
+
+// ClientSecretResponse 创建客户端或重新生成密钥的结果（密钥只返回这一次）
+type ClientSecretResponse struct {
+	Client       *models.OAuthClient `json:"client"`
+	ClientSecret string              `json:"client_secret,omitempty"` // 使用证书认证的客户端没有密钥
+}
+
+// ClientToken 客户端持有的有效 Access Token（不包含 Token 本身）
+type ClientToken struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	UserEmail string    `json:"user_email"`
+	Scope     string    `json:"scope"`
+	Audience  string    `json:"audience,omitempty"`
+	Bound     bool      `json:"bound"` // 是否绑定了 DPoP 密钥或客户端证书
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ClientConsent 对客户端授权过的用户
+type ClientConsent struct {
+	UserID    uint      `json:"user_id"`
+	UserEmail string    `json:"user_email"`
+	UserName  string    `json:"user_name"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"` // 首次授权时间
+	UpdatedAt time.Time `json:"updated_at"` // 最近授权时间
+}
+
+// ValidateClientScope 检查请求的权限范围是否都在客户端允许的范围内（客户端没有限制时不检查）
+func (s *OAuthService) ValidateClientScope(client *models.OAuthClient, scope string) error {
+	if client.Scopes == "" {
+		return nil
+	}
+	allowed := ParseScope(client.Scopes)
+	for _, item := range ParseScope(scope) {
+		if !contains(allowed, item) {
+			return fmt.Errorf("%w: 客户端不允许请求 %s", ErrInvalidScope, item)
+		}
+	}
+	return nil
+}
+
+// accessTokenLifetime 客户端的 Access Token 有效期（未设置时使用服务器默认值）
+func (s *OAuthService) accessTokenLifetime(client *models.OAuthClient) time.Duration {
+	if client.AccessTokenLifetime > 0 {
+		return time.Duration(client.AccessTokenLifetime) * time.Second
+	}
+	return s.jwtExpire
+}
+
+// idTokenLifetime 客户端的 ID Token 有效期（未设置时使用服务器默认值）
+func (s *OAuthService) idTokenLifetime(client *models.OAuthClient) time.Duration {
+	if client.IDTokenLifetime > 0 {
+		return time.Duration(client.IDTokenLifetime) * time.Second
+	}
+	return s.jwtExpire
+}
+
+// ListClients 分页列出客户端，支持按客户端ID或名称搜索
+func (s *OAuthService) ListClients(req ClientListRequest) (*ClientList, error) {
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultClientPageSize
+	}
+
+	query := database.DB.Model(&models.OAuthClient{})
+	switch req.Status {
+	case "active":
+		query = query.Where("disabled_at IS NULL AND approval_status = ?", models.ClientApprovalApproved)
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case models.ClientApprovalPending, models.ClientApprovalRejected:
+		query = query.Where("approval_status = ?", req.Status)
+	}
+	if req.OwnerID != 0 {
+		query = query.Where("owner_id = ?", req.OwnerID)
+	}
+	if req.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(req.Query)) + "%"
+		query = query.Where(`(LOWER(client_id) LIKE ? ESCAPE '\' OR LOWER(name) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	list := &ClientList{Page: req.Page, PageSize: req.PageSize}
+	if err := query.Count(&list.Total).Error; err != nil {
+		return nil, fmt.Errorf("查询客户端失败: %w", err)
+	}
+	if err := query.Order("id").Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Find(&list.Clients).Error; err != nil {
+		return nil, fmt.Errorf("查询客户端失败: %w", err)
+	}
+	return list, nil
+}
+
+// GetClient 按客户端ID查询客户端（包括已停用的客户端）
+func (s *OAuthService) GetClient(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClientNotFound
+		}
+		return nil, fmt.Errorf("查询客户端失败: %w", err)
+	}
+	return &client, nil
+}
+
+// CreateClient 创建客户端，生成客户端ID和密钥（使用证书认证时不生成密钥）
+func (s *OAuthService) CreateClient(req ClientRequest) (*ClientSecretResponse, error) {
+	return createClient(req, nil, models.ClientApprovalApproved)
+}
+
+// createClient 创建指定所有者和审核状态的客户端
+func createClient(req ClientRequest, ownerID *uint, approvalStatus string) (*ClientSecretResponse, error) {
+	// 1. 校验配置
+	client := &models.OAuthClient{OwnerID: ownerID, ApprovalStatus: approvalStatus}
+	if err := applyClientRequest(client, req); err != nil {
+		return nil, err
+	}
+
+	// 2. 生成客户端ID和密钥
+	clientID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("生成客户端ID失败: %w", err)
+	}
+	client.ClientID = clientID
+	secret, err := newClientSecret(client)
+	if err != nil {
+		return nil, err
+	}
+	client.ClientSecret = secret
+
+	// 3. 保存
+	if err := database.DB.Create(client).Error; err != nil {
+		return nil, fmt.Errorf("创建客户端失败: %w", err)
+	}
+	return &ClientSecretResponse{Client: client, ClientSecret: secret}, nil
+}
+
+// UpdateClient 修改客户端配置
+// 改为使用证书认证时清除原有密钥；从证书认证改为 client_secret_post 时需要重新生成密钥
+func (s *OAuthService) UpdateClient(clientID string, req ClientRequest) (*models.OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateClient(client, req); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// updateClient 校验请求并保存客户端配置
+func updateClient(client *models.OAuthClient, req ClientRequest) error {
+	if err := applyClientRequest(client, req); err != nil {
+		return err
+	}
+	if client.AuthMethod() != models.AuthMethodClientSecretPost {
+		client.ClientSecret = ""
+	}
+	if err := database.DB.Save(client).Error; err != nil {
+		return fmt.Errorf("保存客户端失败: %w", err)
+	}
+	return nil
+}
+
+// RegenerateClientSecret 重新生成客户端密钥，旧密钥立即失效（已签发的 Token 不受影响）
+func (s *OAuthService) RegenerateClientSecret(clientID string) (*ClientSecretResponse, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.AuthMethod() != models.AuthMethodClientSecretPost {
+		return nil, fmt.Errorf("%w: 使用证书认证的客户端没有密钥", ErrInvalidClientMetadata)
+	}
+	secret, err := newClientSecret(client)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(client).Update("client_secret", secret).Error; err != nil {
+		return nil, fmt.Errorf("保存客户端失败: %w", err)
+	}
+	return &ClientSecretResponse{Client: client, ClientSecret: secret}, nil
+}
+
+// SetClientDisabled 停用或重新启用客户端
+// 停用时撤销客户端持有的 Access Token 和未使用的授权码
+func (s *OAuthService) SetClientDisabled(clientID string, disabled bool) (*models.OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !disabled {
+		if err := database.DB.Model(client).Update("disabled_at", nil).Error; err != nil {
+			return nil, fmt.Errorf("启用客户端失败: %w", err)
+		}
+		client.DisabledAt = nil
+		return client, nil
+	}
+
+	if !client.Disabled() {
+		now := time.Now()
+		if err := database.DB.Model(client).Update("disabled_at", now).Error; err != nil {
+			return nil, fmt.Errorf("停用客户端失败: %w", err)
+		}
+		client.DisabledAt = &now
+	}
+	if err := revokeClientTokens(client.ClientID); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ReviewClient 审核开发者创建的客户端（通过或不通过），并通知所有者
+// 审核不通过时撤销客户端持有的 Token 和未使用的授权码
+func (s *OAuthService) ReviewClient(clientID string, approve bool) (*models.OAuthClient, error) {
+	// 1. 更新审核状态
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	status := models.ClientApprovalRejected
+	if approve {
+		status = models.ClientApprovalApproved
+	}
+	if err := database.DB.Model(client).Update("approval_status", status).Error; err != nil {
+		return nil, fmt.Errorf("保存审核结果失败: %w", err)
+	}
+	if !approve {
+		if err := revokeClientTokens(client.ClientID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 通知所有者
+	if client.OwnerID != nil {
+		if owner, err := findDeveloper(*client.OwnerID); err == nil {
+			result := "已通过审核，现在可以使用了"
+			if !approve {
+				result = "未通过审核，修改配置后会重新提交审核"
+			}
+			deliverMailAsync(s.mailer, mail.Message{
+				To:      owner.Email,
+				Subject: "客户端审核结果 - Shadow OAuth",
+				Body:    fmt.Sprintf("您好 %s：\n\n您的 OAuth 客户端「%s」（%s）%s。\n", owner.Name, client.Name, client.ClientID, result),
+			})
+		}
+	}
+	return client, nil
+}
+
+// DeleteClient 删除客户端（软删除），同时撤销 Token、未使用的授权码、用户的授权记录和协作者
+func (s *OAuthService) DeleteClient(clientID string) error {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+	if err := revokeClientTokens(client.ClientID); err != nil {
+		return err
+	}
+	if err := database.DB.Where("client_id = ?", client.ClientID).Delete(&models.Consent{}).Error; err != nil {
+		return fmt.Errorf("删除授权记录失败: %w", err)
+	}
+	for _, model := range []interface{}{&models.ClientCollaborator{}, &models.ClientInvitation{}} {
+		if err := database.DB.Where("client_id = ?", client.ClientID).Delete(model).Error; err != nil {
+			return fmt.Errorf("删除协作者失败: %w", err)
+		}
+	}
+	if err := database.DB.Delete(client).Error; err != nil {
+		return fmt.Errorf("删除客户端失败: %w", err)
+	}
+	return nil
+}
+
+// ClientTokens 列出客户端持有的未过期 Access Token（最新签发的在前）
+func (s *OAuthService) ClientTokens(clientID string) ([]ClientToken, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []models.AccessToken
+	if err := database.DB.Where("client_id = ? AND expires_at > ?", client.ClientID, time.Now()).
+		Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("查询 Access Token 失败: %w", err)
+	}
+	emails, err := userEmails(tokens, func(token models.AccessToken) uint { return token.UserID })
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ClientToken, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, ClientToken{
+			ID:        token.ID,
+			UserID:    token.UserID,
+			UserEmail: emails[token.UserID],
+			Scope:     token.Scope,
+			Audience:  token.Audience,
+			Bound:     token.JKT != "" || token.X5tS256 != "",
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+	return result, nil
+}
+
+// ClientConsents 列出对客户端授权过的用户（最近授权的在前）
+func (s *OAuthService) ClientConsents(clientID string) ([]ClientConsent, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	var consents []models.Consent
+	if err := database.DB.Where("client_id = ?", client.ClientID).Order("updated_at DESC").Find(&consents).Error; err != nil {
+		return nil, fmt.Errorf("查询授权记录失败: %w", err)
+	}
+	var users []models.User
+	ids := make([]uint, 0, len(consents))
+	for _, consent := range consents {
+		ids = append(ids, consent.UserID)
+	}
+	if len(ids) > 0 {
+		if err := database.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("查询用户失败: %w", err)
+		}
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	result := make([]ClientConsent, 0, len(consents))
+	for _, consent := range consents {
+		user := byID[consent.UserID]
+		result = append(result, ClientConsent{
+			UserID:    consent.UserID,
+			UserEmail: user.Email,
+			UserName:  user.Name,
+			Scope:     consent.Scope,
+			CreatedAt: consent.CreatedAt,
+			UpdatedAt: consent.UpdatedAt,
+		})
+	}
+	return result, nil
+}
+
+// applyClientRequest 校验请求并写入客户端的可配置字段
+func applyClientRequest(client *models.OAuthClient, req ClientRequest) error {
+	// 1. 重定向URI：必须是不带片段的 https 绝对地址（本机回环地址允许 http）
+	for _, uri := range req.RedirectURIs {
+		if err := ValidateClientURI(uri); err != nil {
+			return fmt.Errorf("%w: redirect_uri %v", ErrInvalidClientMetadata, err)
+		}
+	}
+	for _, uri := range req.PostLogoutRedirectURIs {
+		if err := ValidateClientURI(uri); err != nil {
+			return fmt.Errorf("%w: post_logout_redirect_uri %v", ErrInvalidClientMetadata, err)
+		}
+	}
+
+	// 2. 授权类型和认证方式必须是服务器支持的
+	grantTypes := ParseScope(strings.Join(req.GrantTypes, " "))
+	for _, grantType := range grantTypes {
+		if grantType != models.GrantTypeAuthorizationCode && grantType != models.GrantTypeDeviceCode {
+			return fmt.Errorf("%w: 不支持的授权类型 %s", ErrInvalidClientMetadata, grantType)
+		}
+	}
+	authMethod := req.TokenEndpointAuthMethod
+	switch authMethod {
+	case "", models.AuthMethodClientSecretPost:
+	case models.AuthMethodSelfSignedTLSClientAuth:
+		if !validCertificates(req.TLSClientCertificates) {
+			return fmt.Errorf("%w: self_signed_tls_client_auth 需要有效的 PEM 证书", ErrInvalidClientMetadata)
+		}
+	case models.AuthMethodTLSClientAuth:
+		if req.TLSClientAuthSubjectDN == "" {
+			return fmt.Errorf("%w: tls_client_auth 需要 tls_client_auth_subject_dn", ErrInvalidClientMetadata)
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的认证方式 %s", ErrInvalidClientMetadata, authMethod)
+	}
+
+	// 3. Token 有效期
+	if req.AccessTokenLifetime > maxTokenLifetime || req.IDTokenLifetime > maxTokenLifetime {
+		return fmt.Errorf("%w: Token 有效期不能超过 %d 秒", ErrInvalidClientMetadata, maxTokenLifetime)
+	}
+
+	if req.FrontchannelLogoutURI != "" {
+		if err := ValidateClientURI(req.FrontchannelLogoutURI); err != nil {
+			return fmt.Errorf("%w: frontchannel_logout_uri %v", ErrInvalidClientMetadata, err)
+		}
+	}
+	if req.BackchannelLogoutURI != "" {
+		if err := ValidateBackchannelLogoutURI(req.BackchannelLogoutURI); err != nil {
+			return fmt.Errorf("%w: backchannel_logout_uri %v", ErrInvalidClientMetadata, err)
+		}
+	}
+
+	// 4. 同意页面展示的 Logo 和链接：与跳转地址相同的规则（binding 的 url 校验接受任意协议）
+	for _, field := range []struct{ name, uri string }{
+		{"logo_uri", req.LogoURI},
+		{"client_uri", req.ClientURI},
+		{"policy_uri", req.PolicyURI},
+		{"tos_uri", req.TOSURI},
+	} {
+		if field.uri == "" {
+			continue
+		}
+		if err := ValidateClientURI(field.uri); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidClientMetadata, field.name, err)
+		}
+	}
+
+	client.Name = req.Name
+	client.RedirectURI = JoinScope(req.RedirectURIs)
+	client.GrantTypes = JoinScope(grantTypes)
+	client.Scopes = JoinScope(ParseScope(strings.Join(req.Scopes, " ")))
+	client.AccessTokenLifetime = req.AccessTokenLifetime
+	client.IDTokenLifetime = req.IDTokenLifetime
+	client.TokenEndpointAuthMethod = authMethod
+	if authMethod == "" {
+		client.TokenEndpointAuthMethod = models.AuthMethodClientSecretPost
+	}
+	client.TLSClientAuthSubjectDN = req.TLSClientAuthSubjectDN
+	client.TLSClientCertificates = req.TLSClientCertificates
+	client.LogoURI = req.LogoURI
+	client.ClientURI = req.ClientURI
+	client.PolicyURI = req.PolicyURI
+	client.TOSURI = req.TOSURI
+	client.PostLogoutRedirectURIs = JoinScope(req.PostLogoutRedirectURIs)
+	client.FrontchannelLogoutURI = req.FrontchannelLogoutURI
+	client.BackchannelLogoutURI = req.BackchannelLogoutURI
+	return nil
+}
+
+// ValidateClientURI 校验客户端登记的跳转地址：https（本机回环地址允许 http）的绝对地址，不包含片段和空白
+// javascript: 等不透明地址会被退出页面的脚本执行，必须拒绝
+func ValidateClientURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || parsed.Opaque != "" {
+		return fmt.Errorf("%q 必须是绝对地址", uri)
+	}
+	if !SafeRedirectURL(parsed) {
+		return fmt.Errorf("%q 必须使用 https（本机回环地址可以使用 http）", uri)
+	}
+	if parsed.Fragment != "" || strings.ContainsAny(uri, " \t\r\n") {
+		return fmt.Errorf("%q 不能包含片段或空白", uri)
+	}
+	return nil
+}
+
+// SafeRedirectURL 判断地址能否用于重定向：https，或指向本机回环地址的 http
+func SafeRedirectURL(u *url.URL) bool {
+	if u.Opaque != "" || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		return isLoopbackHost(u.Hostname())
+	}
+	return false
+}
+
+// isLoopbackHost 判断主机名是否是本机回环地址
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validCertificates 检查 PEM 内容是否至少包含一个证书，且所有证书都能解析
+func validCertificates(data string) bool {
+	rest := []byte(data)
+	count := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return count > 0
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return false
+		}
+		count++
+	}
+}
+
+// newClientSecret 为使用 client_secret_post 的客户端生成密钥
+func newClientSecret(client *models.OAuthClient) (string, error) {
+	if client.AuthMethod() != models.AuthMethodClientSecretPost {
+		return "", nil
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("生成客户端密钥失败: %w", err)
+	}
+	return secret, nil
+}
+
+// revokeClientTokens 撤销客户端持有的 Access Token 和未使用的授权码
+func revokeClientTokens(clientID string) error {
+	if err := database.DB.Where("client_id = ?", clientID).Delete(&models.AccessToken{}).Error; err != nil {
+		return fmt.Errorf("撤销 Access Token 失败: %w", err)
+	}
+	if err := database.DB.Model(&models.AuthorizationCode{}).Where("client_id = ? AND used = ?", clientID, false).
+		Update("used", true).Error; err != nil {
+		return fmt.Errorf("作废授权码失败: %w", err)
+	}
+	return nil
+}
+
+// userEmails 批量查询记录所属用户的邮箱
+func userEmails[T any](records []T, userID func(T) uint) (map[uint]string, error) {
+	emails := make(map[uint]string)
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, userID(record))
+	}
+	if len(ids) == 0 {
+		return emails, nil
+	}
+	var users []models.User
+	if err := database.DB.Select("id", "email").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	for _, user := range users {
+		emails[user.ID] = user.Email
+	}
+	return emails, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// HasConsent 检查用户是否已同意授予客户端指定的权限范围和资源（RFC 8707）
+// 携带授权详情（RFC 9396）的请求针对具体交易，每次都需要用户确认
+func (s *OAuthService) HasConsent(userID uint, clientID, scope string, resources []string, authorizationDetails string) (bool, error) {
+	if authorizationDetails != "" {
+		return false, nil
+	}
+
+	var consent models.Consent
+	if err := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("查询授权记录失败: %w", err)
+	}
+
+	granted := ParseScope(consent.Scope)
+	for _, item := range ParseScope(scope) {
+		if !contains(granted, item) {
+			return false, nil
+		}
+	}
+	grantedResources := ParseScope(consent.Resource)
+	for _, resource := range resources {
+		if !contains(grantedResources, resource) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SaveConsent 记录用户同意授予客户端的权限范围和资源（与已有记录合并）
+func (s *OAuthService) SaveConsent(userID uint, clientID, scope string, resources []string) error {
+	var consent models.Consent
+	err := database.DB.Unscoped().Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查询授权记录失败: %w", err)
+	}
+
+	// 撤销过的授权重新生效时，不保留之前的权限范围和资源
+	if consent.DeletedAt.Valid {
+		consent.Scope = ""
+		consent.Resource = ""
+		consent.DeletedAt = gorm.DeletedAt{}
+	}
+	consent.UserID = userID
+	consent.ClientID = clientID
+	consent.Scope = JoinScope(ParseScope(consent.Scope + " " + scope))
+	consent.Resource = JoinScope(ParseScope(consent.Resource + " " + JoinScope(resources)))
+
+	if err := database.DB.Unscoped().Save(&consent).Error; err != nil {
+		return fmt.Errorf("保存授权记录失败: %w", err)
+	}
+	return nil
+}
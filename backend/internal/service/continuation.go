@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidContinuation 无效的登录后跳转参数
+var ErrInvalidContinuation = errors.New("登录跳转参数无效或已过期")
+
+const (
+	continuationType = "authorize_continuation" // continuation 的 type 声明，避免与其他 Token 混用
+	continuationTTL  = 10 * time.Minute         // 用户需要在此时间内完成登录
+)
+
+// Continuation 登录完成后需要恢复的授权请求
+type Continuation struct {
+	Query    string    // 原始授权请求的查询参数
+	IssuedAt time.Time // 跳转到登录页的时间（此后完成的登录才算满足 prompt=login）
+	Device   bool      // 是否为设备授权页面的请求（登录后回到 /device，而不是授权端点）
+}
+
+// SignContinuation 为授权请求生成签名的 continuation，登录页在登录成功后带着它回到授权端点
+func (s *AuthService) SignContinuation(query string) (string, error) {
+	return s.signContinuation(query, false)
+}
+
+// SignDeviceContinuation 为设备授权页面生成签名的 continuation，登录页在登录成功后带着它回到 /device
+func (s *AuthService) SignDeviceContinuation(query string) (string, error) {
+	return s.signContinuation(query, true)
+}
+
+// signContinuation 生成签名的 continuation
+func (s *AuthService) signContinuation(query string, device bool) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   s.issuer,
+		"type":  continuationType,
+		"query": query,
+		"iat":   now.Unix(),
+		"exp":   now.Add(continuationTTL).Unix(),
+	}
+	if device {
+		claims["device"] = true
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.jwtSecret))
+}
+
+// ParseContinuation 验证并解析 continuation
+func (s *AuthService) ParseContinuation(tokenString string) (*Continuation, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(s.issuer), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidContinuation, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["type"] != continuationType {
+		return nil, ErrInvalidContinuation
+	}
+	query, _ := claims["query"].(string)
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return nil, ErrInvalidContinuation
+	}
+	device, _ := claims["device"].(bool)
+	return &Continuation{Query: query, IssuedAt: iat.Time, Device: device}, nil
+}
+
+// ResumeURL 登录完成后恢复授权请求的地址（设备授权回到 /device 页面）
+func (s *AuthService) ResumeURL(continuation string) string {
+	if cont, err := s.ParseContinuation(continuation); err == nil && cont.Device {
+		return s.issuer + "/device?" + cont.Query
+	}
+	return s.issuer + "/oauth/authorize?" + url.Values{"continue": {continuation}}.Encode()
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseContinuation(t *testing.T) {
+	s := NewAuthService(testSecret, 1, testIssuer)
+	const query = "client_id=test_client&redirect_uri=https%3A%2F%2Fapp.example.com%2Fcallback&response_type=code&state=xyz"
+	valid, err := s.SignContinuation(query)
+	if err != nil {
+		t.Fatalf("生成 continuation 失败: %v", err)
+	}
+
+	// sign 使用指定的密钥签发自定义声明的 continuation
+	sign := func(secret string, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("签名失败: %v", err)
+		}
+		return token
+	}
+	now := time.Now()
+	claims := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": testIssuer, "type": continuationType, "query": query, "iat": now.Unix(), "exp": now.Add(continuationTTL).Unix()}
+		mutate(c)
+		return c
+	}
+	// tamper 替换 JWT 的声明部分，保留原来的签名
+	tamper := func(token string, claims jwt.MapClaims) string {
+		payload, _ := json.Marshal(claims)
+		parts := strings.Split(token, ".")
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+	// flip 修改签名中间的一个字符
+	flip := func(token string) string {
+		b := []byte(token)
+		i := len(b) - 10
+		if b[i] == 'A' {
+			b[i] = 'B'
+		} else {
+			b[i] = 'A'
+		}
+		return string(b)
+	}
+	loginJWT, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": testIssuer, "user_id": 1, "sid": "sid", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}).SignedString([]byte(testSecret))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "有效的 continuation", token: valid},
+		{name: "篡改查询参数", token: tamper(valid, claims(func(c jwt.MapClaims) { c["query"] = "client_id=evil" })), wantErr: true},
+		{name: "篡改签名", token: flip(valid), wantErr: true},
+		{name: "其他密钥签名", token: sign("other-secret", claims(func(c jwt.MapClaims) { c["query"] = "client_id=evil" })), wantErr: true},
+		{name: "其他签发者", token: sign(testSecret, claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })), wantErr: true},
+		{name: "已过期", token: sign(testSecret, claims(func(c jwt.MapClaims) {
+			c["iat"] = now.Add(-continuationTTL - time.Minute).Unix()
+			c["exp"] = now.Add(-time.Minute).Unix()
+		})), wantErr: true},
+		{name: "签发时间在未来", token: sign(testSecret, claims(func(c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() })), wantErr: true},
+		{name: "缺少签发时间", token: sign(testSecret, claims(func(c jwt.MapClaims) { delete(c, "iat") })), wantErr: true},
+		{name: "登录 JWT 不能当作 continuation", token: loginJWT, wantErr: true},
+		{name: "空字符串", token: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			continuation, err := s.ParseContinuation(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidContinuation) {
+					t.Fatalf("期望错误 %v，实际 %v", ErrInvalidContinuation, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if continuation.Query != query {
+				t.Fatalf("query = %q，期望 %q", continuation.Query, query)
+			}
+			if d := time.Since(continuation.IssuedAt); d < 0 || d > time.Minute {
+				t.Fatalf("签发时间 = %v", continuation.IssuedAt)
+			}
+		})
+	}
+
+	// 恢复地址指向授权端点，并携带 continuation
+	resume, err := url.Parse(s.ResumeURL(valid))
+	if err != nil || resume.Scheme+"://"+resume.Host+resume.Path != testIssuer+"/oauth/authorize" || resume.Query().Get("continue") != valid {
+		t.Fatalf("恢复地址不正确: %s", s.ResumeURL(valid))
+	}
+
+	// 设备授权页面的 continuation 登录后回到 /device，并带上用户代码
+	device, err := s.SignDeviceContinuation("user_code=BCDF-GHJK")
+	if err != nil {
+		t.Fatalf("生成 continuation 失败: %v", err)
+	}
+	if continuation, err := s.ParseContinuation(device); err != nil || !continuation.Device {
+		t.Fatalf("设备授权的 continuation 解析不正确: %+v, %v", continuation, err)
+	}
+	if got := s.ResumeURL(device); got != testIssuer+"/device?user_code=BCDF-GHJK" {
+		t.Fatalf("恢复地址 = %s，期望回到设备授权页面", got)
+	}
+	if continuation, _ := s.ParseContinuation(valid); continuation.Device {
+		t.Fatal("授权请求的 continuation 不应标记为设备授权")
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE 签名算法（RFC 9053），通行密钥注册时按顺序声明支持
+const (
+	coseAlgES256 = -7   // ECDSA P-256 + SHA-256
+	coseAlgEdDSA = -8   // Ed25519
+	coseAlgRS256 = -257 // RSASSA-PKCS1-v1_5 + SHA-256
+)
+
+// coseAlgorithms 支持的签名算法（注册选项中的 pubKeyCredParams）
+var coseAlgorithms = []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256}
+
+// COSE 密钥参数（RFC 9052 / RFC 9053）
+const (
+	coseKeyKty = 1  // 密钥类型
+	coseKeyAlg = 3  // 算法
+	coseKeyCrv = -1 // 曲线（OKP、EC2），RSA 为模数 n
+	coseKeyX   = -2 // x 坐标（OKP、EC2），RSA 为指数 e
+	coseKeyY   = -3 // y 坐标（EC2）
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// errInvalidCOSEKey 不支持或格式错误的 COSE 公钥
+var errInvalidCOSEKey = errors.New("不支持的通行密钥公钥")
+
+// coseKey 解析后的 COSE 公钥
+type coseKey struct {
+	Algorithm int
+	PublicKey crypto.PublicKey
+}
+
+// parseCOSEKey 解析 COSE 格式的公钥（认证器数据中的 credentialPublicKey）
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	decoded, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := decoded.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errInvalidCOSEKey
+	}
+	kty, _ := fields[int64(coseKeyKty)].(int64)
+	alg, _ := fields[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == coseAlgES256:
+		crv, _ := fields[int64(coseKeyCrv)].(int64)
+		x, _ := fields[int64(coseKeyX)].([]byte)
+		y, _ := fields[int64(coseKeyY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errInvalidCOSEKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errInvalidCOSEKey
+		}
+		return &coseKey{Algorithm: coseAlgES256, PublicKey: key}, nil
+	case kty == coseKtyOKP && alg == coseAlgEdDSA:
+		crv, _ := fields[int64(coseKeyCrv)].(int64)
+		x, _ := fields[int64(coseKeyX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errInvalidCOSEKey
+		}
+		return &coseKey{Algorithm: coseAlgEdDSA, PublicKey: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == coseAlgRS256:
+		n, _ := fields[int64(coseKeyCrv)].([]byte)
+		e, _ := fields[int64(coseKeyX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errInvalidCOSEKey
+		}
+		return &coseKey{Algorithm: coseAlgRS256, PublicKey: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	}
+	return nil, fmt.Errorf("%w: kty=%d alg=%d", errInvalidCOSEKey, kty, alg)
+}
+
+// Verify 验证签名（ES256 为 ASN.1 DER 格式的签名）
+func (k *coseKey) Verify(data, signature []byte) bool {
+	switch key := k.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,514 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNotClientOwner 只有客户端所有者可以执行的操作
+	ErrNotClientOwner = errors.New("只有客户端所有者可以执行此操作")
+	// ErrTooManyClients 用户拥有的客户端数量已达上限
+	ErrTooManyClients = errors.New("创建的客户端数量已达上限")
+	// ErrInvitationNotFound 邀请不存在、已处理或已过期
+	ErrInvitationNotFound = errors.New("邀请不存在或已过期")
+	// ErrAlreadyCollaborator 被邀请的用户已经是客户端的所有者或协作者
+	ErrAlreadyCollaborator = errors.New("该用户已经是客户端的所有者或协作者")
+	// ErrCollaboratorNotFound 协作者不存在
+	ErrCollaboratorNotFound = errors.New("协作者不存在")
+)
+
+const (
+	defaultMaxDeveloperClients = 10                 // 每个用户默认最多拥有的客户端数量
+	clientInvitationTTL        = 7 * 24 * time.Hour // 协作邀请有效期
+)
+
+// 用户在客户端中的身份
+const (
+	ClientRoleOwner        = "owner"        // 所有者：可以删除客户端、移除协作者和转让所有权
+	ClientRoleCollaborator = "collaborator" // 协作者：可以修改配置、重新生成密钥和邀请其他协作者
+)
+
+// DeveloperPolicy 开发者自助注册客户端的规则
+type DeveloperPolicy struct {
+	RequireApproval bool // 开发者创建的客户端需要管理员审核通过后才能使用
+	MaxClients      int  // 每个用户最多拥有的客户端数量（0 表示不限制）
+}
+
+// DeveloperClient 开发者可以管理的客户端
+type DeveloperClient struct {
+	models.OAuthClient
+	Role string `json:"role"` // 当前用户的身份（owner 或 collaborator）
+}
+
+// ClientMember 客户端的所有者或协作者
+type ClientMember struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"` // 加入时间（所有者为客户端创建时间）
+}
+
+// ClientMembers 客户端的成员和待接受的邀请
+type ClientMembers struct {
+	Members     []ClientMember            `json:"members"`
+	Invitations []models.ClientInvitation `json:"invitations"`
+}
+
+// InviteCollaboratorRequest 邀请协作者请求
+type InviteCollaboratorRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"` // 被邀请人邮箱
+}
+
+// TransferOwnershipRequest 转让客户端所有权请求（新所有者必须是协作者）
+type TransferOwnershipRequest struct {
+	UserID uint `json:"user_id" binding:"required"` // 新所有者的用户ID
+}
+
+// ReceivedInvitation 用户收到的协作邀请
+type ReceivedInvitation struct {
+	models.ClientInvitation
+	ClientName string `json:"client_name"`
+}
+
+// SetMailer 设置发送协作邀请等使用的邮件发送器
+func (s *OAuthService) SetMailer(mailer mail.Mailer) {
+	s.mailer = mailer
+}
+
+// SetDeveloperPolicy 设置开发者自助注册客户端的规则
+func (s *OAuthService) SetDeveloperPolicy(policy DeveloperPolicy) {
+	s.developer = policy
+}
+
+// DeveloperClients 列出用户拥有或参与协作的客户端
+func (s *OAuthService) DeveloperClients(userID uint) ([]DeveloperClient, error) {
+	var clients []models.OAuthClient
+	if err := database.DB.Where("owner_id = ? OR client_id IN (?)", userID,
+		database.DB.Model(&models.ClientCollaborator{}).Select("client_id").Where("user_id = ?", userID)).
+		Order("id").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("查询客户端失败: %w", err)
+	}
+
+	result := make([]DeveloperClient, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, DeveloperClient{OAuthClient: client, Role: clientRole(&client, userID)})
+	}
+	return result, nil
+}
+
+// CreateDeveloperClient 开发者创建客户端，创建者成为所有者
+// 需要审核时客户端在管理员审核通过前不能使用
+func (s *OAuthService) CreateDeveloperClient(userID uint, req ClientRequest) (*ClientSecretResponse, error) {
+	// 1. 只有验证过邮箱的用户可以创建客户端
+	user, err := findDeveloper(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 2. 检查数量上限
+	if s.developer.MaxClients > 0 {
+		var count int64
+		if err := database.DB.Model(&models.OAuthClient{}).Where("owner_id = ?", user.ID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("查询客户端失败: %w", err)
+		}
+		if count >= int64(s.developer.MaxClients) {
+			return nil, ErrTooManyClients
+		}
+	}
+
+	// 3. 创建客户端
+	status := models.ClientApprovalApproved
+	if s.developer.RequireApproval {
+		status = models.ClientApprovalPending
+	}
+	return createClient(req, &user.ID, status)
+}
+
+// GetDeveloperClient 获取用户可以管理的客户端
+func (s *OAuthService) GetDeveloperClient(userID uint, clientID string) (*DeveloperClient, error) {
+	client, role, err := clientMembership(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &DeveloperClient{OAuthClient: *client, Role: role}, nil
+}
+
+// UpdateDeveloperClient 所有者或协作者修改客户端配置
+// 审核未通过的客户端修改后重新提交审核；需要审核时，已通过的客户端修改了涉及安全的配置也要重新审核
+func (s *OAuthService) UpdateDeveloperClient(userID uint, clientID string, req ClientRequest) (*DeveloperClient, error) {
+	client, role, err := clientMembership(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	updated := *client
+	if err := applyClientRequest(&updated, req); err != nil {
+		return nil, err
+	}
+	if client.ApprovalStatus == models.ClientApprovalRejected ||
+		s.developer.RequireApproval && client.ApprovalStatus == models.ClientApprovalApproved && reviewRequired(*client, updated) {
+		client.ApprovalStatus = models.ClientApprovalPending
+	}
+	if err := updateClient(client, req); err != nil {
+		return nil, err
+	}
+	return &DeveloperClient{OAuthClient: *client, Role: role}, nil
+}
+
+// reviewRequired 判断修改是否涉及需要管理员重新审核的配置
+// 包括重定向和退出地址、授权类型、权限范围、认证方式、Token 有效期，以及授权确认页上展示的名称、图标、主页、隐私政策和服务条款
+func reviewRequired(before, after models.OAuthClient) bool {
+	return before.RedirectURI != after.RedirectURI ||
+		before.GrantTypes != after.GrantTypes ||
+		before.Scopes != after.Scopes ||
+		before.TokenEndpointAuthMethod != after.TokenEndpointAuthMethod ||
+		before.TLSClientAuthSubjectDN != after.TLSClientAuthSubjectDN ||
+		before.TLSClientCertificates != after.TLSClientCertificates ||
+		before.PostLogoutRedirectURIs != after.PostLogoutRedirectURIs ||
+		before.FrontchannelLogoutURI != after.FrontchannelLogoutURI ||
+		before.BackchannelLogoutURI != after.BackchannelLogoutURI ||
+		before.AccessTokenLifetime != after.AccessTokenLifetime ||
+		before.IDTokenLifetime != after.IDTokenLifetime ||
+		before.Name != after.Name ||
+		before.LogoURI != after.LogoURI ||
+		before.ClientURI != after.ClientURI ||
+		before.PolicyURI != after.PolicyURI ||
+		before.TOSURI != after.TOSURI
+}
+
+// RegenerateDeveloperClientSecret 所有者或协作者重新生成客户端密钥
+func (s *OAuthService) RegenerateDeveloperClientSecret(userID uint, clientID string) (*ClientSecretResponse, error) {
+	if _, _, err := clientMembership(userID, clientID); err != nil {
+		return nil, err
+	}
+	return s.RegenerateClientSecret(clientID)
+}
+
+// DeleteDeveloperClient 所有者删除客户端
+func (s *OAuthService) DeleteDeveloperClient(userID uint, clientID string) error {
+	_, role, err := clientMembership(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if role != ClientRoleOwner {
+		return ErrNotClientOwner
+	}
+	return s.DeleteClient(clientID)
+}
+
+// ClientMembers 列出客户端的所有者、协作者和待接受的邀请
+func (s *OAuthService) ClientMembers(userID uint, clientID string) (*ClientMembers, error) {
+	// 1. 检查当前用户是否为成员
+	client, _, err := clientMembership(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 查询所有者和协作者
+	result := &ClientMembers{Members: []ClientMember{}}
+	if client.OwnerID != nil {
+		var owner models.User
+		if err := database.DB.First(&owner, *client.OwnerID).Error; err == nil {
+			result.Members = append(result.Members, ClientMember{
+				UserID: owner.ID, Email: owner.Email, Name: owner.Name, Role: ClientRoleOwner, CreatedAt: client.CreatedAt,
+			})
+		}
+	}
+	var collaborators []models.ClientCollaborator
+	if err := database.DB.Where("client_id = ?", client.ClientID).Order("created_at").Find(&collaborators).Error; err != nil {
+		return nil, fmt.Errorf("查询协作者失败: %w", err)
+	}
+	for _, collaborator := range collaborators {
+		var user models.User
+		if err := database.DB.First(&user, collaborator.UserID).Error; err != nil {
+			continue
+		}
+		result.Members = append(result.Members, ClientMember{
+			UserID: user.ID, Email: user.Email, Name: user.Name, Role: ClientRoleCollaborator, CreatedAt: collaborator.CreatedAt,
+		})
+	}
+
+	// 3. 查询待接受的邀请
+	if err := database.DB.Where("client_id = ? AND accepted_at IS NULL AND expires_at > ?", client.ClientID, time.Now()).
+		Order("created_at").Find(&result.Invitations).Error; err != nil {
+		return nil, fmt.Errorf("查询邀请失败: %w", err)
+	}
+	return result, nil
+}
+
+// InviteCollaborator 所有者或协作者邀请用户成为协作者，并向被邀请的邮箱发送通知
+// 重复邀请同一邮箱时延长原邀请的有效期并重新发送通知
+func (s *OAuthService) InviteCollaborator(userID uint, clientID string, req InviteCollaboratorRequest) (*models.ClientInvitation, error) {
+	// 1. 检查当前用户是否为成员
+	client, _, err := clientMembership(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	inviter, err := findDeveloper(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 被邀请人已经是成员时不需要邀请
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	var invitee models.User
+	err = database.DB.Where("LOWER(email) = ?", email).First(&invitee).Error
+	if err == nil && clientRole(client, invitee.ID) != "" {
+		return nil, ErrAlreadyCollaborator
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	// 3. 创建邀请或延长已有邀请（限制重新发送的频率）
+	now := time.Now()
+	var invitation models.ClientInvitation
+	err = database.DB.Where("client_id = ? AND email = ? AND accepted_at IS NULL", client.ClientID, email).First(&invitation).Error
+	switch {
+	case err == nil:
+		if now.Sub(invitation.CreatedAt) < emailResendInterval {
+			return nil, ErrTooManyEmails
+		}
+		invitation.InvitedBy = inviter.ID
+		invitation.ExpiresAt = now.Add(clientInvitationTTL)
+		invitation.CreatedAt = now
+		if err := database.DB.Save(&invitation).Error; err != nil {
+			return nil, fmt.Errorf("保存邀请失败: %w", err)
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		invitation = models.ClientInvitation{
+			ClientID:  client.ClientID,
+			Email:     email,
+			InvitedBy: inviter.ID,
+			ExpiresAt: now.Add(clientInvitationTTL),
+		}
+		if err := database.DB.Create(&invitation).Error; err != nil {
+			return nil, fmt.Errorf("保存邀请失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("查询邀请失败: %w", err)
+	}
+
+	// 4. 发送通知
+	deliverMailAsync(s.mailer, mail.Message{
+		To:      email,
+		Subject: "客户端协作邀请 - Shadow OAuth",
+		Body: fmt.Sprintf("您好：\n\n%s（%s）邀请您共同管理 OAuth 客户端「%s」。\n\n请使用此邮箱登录 %s 后在开发者中心接受或拒绝邀请（%d 天内有效）。\n\n如果您不认识邀请人，请忽略这封邮件。\n",
+			inviter.Name, inviter.Email, client.Name, s.issuer, int(clientInvitationTTL.Hours()/24)),
+	})
+	return &invitation, nil
+}
+
+// CancelInvitation 所有者或协作者撤回尚未接受的邀请
+func (s *OAuthService) CancelInvitation(userID uint, clientID string, invitationID uint) error {
+	client, _, err := clientMembership(userID, clientID)
+	if err != nil {
+		return err
+	}
+	result := database.DB.Where("id = ? AND client_id = ? AND accepted_at IS NULL", invitationID, client.ClientID).
+		Delete(&models.ClientInvitation{})
+	if result.Error != nil {
+		return fmt.Errorf("撤回邀请失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// RemoveCollaborator 移除协作者：所有者可以移除任何协作者，协作者可以退出协作
+func (s *OAuthService) RemoveCollaborator(userID uint, clientID string, collaboratorID uint) error {
+	client, role, err := clientMembership(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if role != ClientRoleOwner && collaboratorID != userID {
+		return ErrNotClientOwner
+	}
+	result := database.DB.Where("client_id = ? AND user_id = ?", client.ClientID, collaboratorID).Delete(&models.ClientCollaborator{})
+	if result.Error != nil {
+		return fmt.Errorf("移除协作者失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCollaboratorNotFound
+	}
+	return nil
+}
+
+// TransferClientOwnership 所有者把客户端转让给一位协作者，原所有者成为协作者
+func (s *OAuthService) TransferClientOwnership(userID uint, clientID string, req TransferOwnershipRequest) (*DeveloperClient, error) {
+	// 1. 只有所有者可以转让
+	client, role, err := clientMembership(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if role != ClientRoleOwner {
+		return nil, ErrNotClientOwner
+	}
+
+	// 2. 新所有者必须是协作者；交换两人的身份
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("client_id = ? AND user_id = ?", client.ClientID, req.UserID).Delete(&models.ClientCollaborator{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCollaboratorNotFound
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ClientCollaborator{ClientID: client.ClientID, UserID: userID, InvitedBy: req.UserID}).Error; err != nil {
+			return err
+		}
+		return tx.Model(client).Update("owner_id", req.UserID).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrCollaboratorNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("转让所有权失败: %w", err)
+	}
+	client.OwnerID = &req.UserID
+	return &DeveloperClient{OAuthClient: *client, Role: ClientRoleCollaborator}, nil
+}
+
+// ReceivedInvitations 列出发送到用户邮箱、尚未处理的协作邀请（邮箱必须已验证）
+func (s *OAuthService) ReceivedInvitations(userID uint) ([]ReceivedInvitation, error) {
+	user, err := findDeveloper(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	var invitations []models.ClientInvitation
+	if err := database.DB.Where("email = ? AND accepted_at IS NULL AND expires_at > ?", strings.ToLower(user.Email), time.Now()).
+		Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("查询邀请失败: %w", err)
+	}
+	result := make([]ReceivedInvitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		client, err := s.GetClient(invitation.ClientID)
+		if err != nil {
+			continue
+		}
+		result = append(result, ReceivedInvitation{ClientInvitation: invitation, ClientName: client.Name})
+	}
+	return result, nil
+}
+
+// AcceptInvitation 接受协作邀请，成为客户端的协作者
+// 使用条件更新保证邀请只能被接受一次
+func (s *OAuthService) AcceptInvitation(userID uint, invitationID uint) (*DeveloperClient, error) {
+	// 1. 邀请必须发送到用户已验证的邮箱
+	user, err := findDeveloper(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 2. 标记邀请已接受
+	now := time.Now()
+	result := database.DB.Model(&models.ClientInvitation{}).
+		Where("id = ? AND email = ? AND accepted_at IS NULL AND expires_at > ?", invitationID, strings.ToLower(user.Email), now).
+		Update("accepted_at", now)
+	if result.Error != nil {
+		return nil, fmt.Errorf("接受邀请失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvitationNotFound
+	}
+	var invitation models.ClientInvitation
+	if err := database.DB.First(&invitation, invitationID).Error; err != nil {
+		return nil, fmt.Errorf("查询邀请失败: %w", err)
+	}
+	client, err := s.GetClient(invitation.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	// 3. 加入协作者（已经是所有者时不做任何操作）
+	if clientRole(client, user.ID) == "" {
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ClientCollaborator{ClientID: client.ClientID, UserID: user.ID, InvitedBy: invitation.InvitedBy}).Error; err != nil {
+			return nil, fmt.Errorf("加入协作者失败: %w", err)
+		}
+	}
+	return &DeveloperClient{OAuthClient: *client, Role: clientRole(client, user.ID)}, nil
+}
+
+// DeclineInvitation 拒绝协作邀请
+func (s *OAuthService) DeclineInvitation(userID uint, invitationID uint) error {
+	user, err := findDeveloper(userID)
+	if err != nil {
+		return err
+	}
+	result := database.DB.Where("id = ? AND email = ? AND accepted_at IS NULL", invitationID, strings.ToLower(user.Email)).
+		Delete(&models.ClientInvitation{})
+	if result.Error != nil {
+		return fmt.Errorf("拒绝邀请失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// findDeveloper 查询当前用户
+func findDeveloper(userID uint) (*models.User, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return &user, nil
+}
+
+// clientMembership 查询客户端和用户在其中的身份
+// 用户不是所有者或协作者时返回 ErrClientNotFound，不泄露客户端是否存在
+func clientMembership(userID uint, clientID string) (*models.OAuthClient, string, error) {
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrClientNotFound
+		}
+		return nil, "", fmt.Errorf("查询客户端失败: %w", err)
+	}
+	role := clientRole(&client, userID)
+	if role == "" {
+		return nil, "", ErrClientNotFound
+	}
+	return &client, role, nil
+}
+
+// clientRole 返回用户在客户端中的身份，不是成员时返回空字符串
+func clientRole(client *models.OAuthClient, userID uint) string {
+	if client.OwnerID != nil && *client.OwnerID == userID {
+		return ClientRoleOwner
+	}
+	var count int64
+	database.DB.Model(&models.ClientCollaborator{}).Where("client_id = ? AND user_id = ?", client.ClientID, userID).Count(&count)
+	if count > 0 {
+		return ClientRoleCollaborator
+	}
+	return ""
+}
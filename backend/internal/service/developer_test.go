@@ -0,0 +1,368 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// createTestDeveloper 注册用户并标记邮箱已验证（开发者中心要求已验证的邮箱）
+func createTestDeveloper(t *testing.T, auth *AuthService, email string) *models.User {
+	t.Helper()
+	user := createTestUser(t, auth, email)
+	if err := database.DB.Model(user).Update("email_verified", true).Error; err != nil {
+		t.Fatalf("标记邮箱已验证失败: %v", err)
+	}
+	return user
+}
+
+// developerFixture 一个客户端及其所有者、两位协作者和一个无关用户
+type developerFixture struct {
+	s             *OAuthService
+	clientID      string
+	owner         *models.User
+	collaborator  *models.User
+	collaborator2 *models.User
+	outsider      *models.User
+}
+
+func newDeveloperFixture(t *testing.T) *developerFixture {
+	t.Helper()
+	newTestDB(t)
+	auth := newTestAuthService(t)
+	f := &developerFixture{
+		s:             NewOAuthService(testSecret, 1, testIssuer),
+		owner:         createTestDeveloper(t, auth, "owner@example.com"),
+		collaborator:  createTestDeveloper(t, auth, "collaborator@example.com"),
+		collaborator2: createTestDeveloper(t, auth, "collaborator2@example.com"),
+		outsider:      createTestDeveloper(t, auth, "outsider@example.com"),
+	}
+	created, err := f.s.CreateDeveloperClient(f.owner.ID, validClientRequest())
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	f.clientID = created.Client.ClientID
+	for _, user := range []*models.User{f.collaborator, f.collaborator2} {
+		if err := database.DB.Create(&models.ClientCollaborator{ClientID: f.clientID, UserID: user.ID, InvitedBy: f.owner.ID}).Error; err != nil {
+			t.Fatalf("添加协作者失败: %v", err)
+		}
+	}
+	return f
+}
+
+func TestDeveloperClientAccess(t *testing.T) {
+	type action func(f *developerFixture, userID uint) error
+	get := func(f *developerFixture, userID uint) error {
+		_, err := f.s.GetDeveloperClient(userID, f.clientID)
+		return err
+	}
+	update := func(f *developerFixture, userID uint) error {
+		_, err := f.s.UpdateDeveloperClient(userID, f.clientID, validClientRequest())
+		return err
+	}
+	regenerate := func(f *developerFixture, userID uint) error {
+		_, err := f.s.RegenerateDeveloperClientSecret(userID, f.clientID)
+		return err
+	}
+	members := func(f *developerFixture, userID uint) error {
+		_, err := f.s.ClientMembers(userID, f.clientID)
+		return err
+	}
+	invite := func(f *developerFixture, userID uint) error {
+		_, err := f.s.InviteCollaborator(userID, f.clientID, InviteCollaboratorRequest{Email: "new@example.com"})
+		return err
+	}
+	remove := func(f *developerFixture, userID uint) error {
+		return f.s.RemoveCollaborator(userID, f.clientID, f.collaborator2.ID)
+	}
+	leave := func(f *developerFixture, userID uint) error {
+		return f.s.RemoveCollaborator(userID, f.clientID, userID)
+	}
+	transfer := func(f *developerFixture, userID uint) error {
+		_, err := f.s.TransferClientOwnership(userID, f.clientID, TransferOwnershipRequest{UserID: f.collaborator.ID})
+		return err
+	}
+	del := func(f *developerFixture, userID uint) error {
+		return f.s.DeleteDeveloperClient(userID, f.clientID)
+	}
+
+	tests := []struct {
+		name    string
+		actor   func(f *developerFixture) *models.User
+		action  action
+		wantErr error
+	}{
+		{name: "所有者查看", actor: ownerOf, action: get},
+		{name: "所有者修改", actor: ownerOf, action: update},
+		{name: "所有者重新生成密钥", actor: ownerOf, action: regenerate},
+		{name: "所有者移除协作者", actor: ownerOf, action: remove},
+		{name: "所有者转让", actor: ownerOf, action: transfer},
+		{name: "所有者删除", actor: ownerOf, action: del},
+		{name: "协作者查看", actor: collaboratorOf, action: get},
+		{name: "协作者修改", actor: collaboratorOf, action: update},
+		{name: "协作者重新生成密钥", actor: collaboratorOf, action: regenerate},
+		{name: "协作者查看成员", actor: collaboratorOf, action: members},
+		{name: "协作者邀请", actor: collaboratorOf, action: invite},
+		{name: "协作者退出", actor: collaboratorOf, action: leave},
+		{name: "协作者不能移除其他协作者", actor: collaboratorOf, action: remove, wantErr: ErrNotClientOwner},
+		{name: "协作者不能转让", actor: collaboratorOf, action: transfer, wantErr: ErrNotClientOwner},
+		{name: "协作者不能删除", actor: collaboratorOf, action: del, wantErr: ErrNotClientOwner},
+		{name: "无关用户查看", actor: outsiderOf, action: get, wantErr: ErrClientNotFound},
+		{name: "无关用户修改", actor: outsiderOf, action: update, wantErr: ErrClientNotFound},
+		{name: "无关用户重新生成密钥", actor: outsiderOf, action: regenerate, wantErr: ErrClientNotFound},
+		{name: "无关用户查看成员", actor: outsiderOf, action: members, wantErr: ErrClientNotFound},
+		{name: "无关用户邀请", actor: outsiderOf, action: invite, wantErr: ErrClientNotFound},
+		{name: "无关用户移除协作者", actor: outsiderOf, action: remove, wantErr: ErrClientNotFound},
+		{name: "无关用户转让", actor: outsiderOf, action: transfer, wantErr: ErrClientNotFound},
+		{name: "无关用户删除", actor: outsiderOf, action: del, wantErr: ErrClientNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newDeveloperFixture(t)
+			before, _ := f.s.GetClient(f.clientID)
+
+			err := tt.action(f, tt.actor(f).ID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				// 被拒绝的操作不能产生任何修改
+				after, err := f.s.GetClient(f.clientID)
+				if err != nil || after.ClientSecret != before.ClientSecret || *after.OwnerID != f.owner.ID {
+					t.Fatalf("被拒绝的操作修改了客户端: %v", err)
+				}
+				if clientRole(after, f.collaborator2.ID) != ClientRoleCollaborator {
+					t.Fatal("被拒绝的操作移除了协作者")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("操作失败: %v", err)
+			}
+		})
+	}
+}
+
+func ownerOf(f *developerFixture) *models.User        { return f.owner }
+func collaboratorOf(f *developerFixture) *models.User { return f.collaborator }
+func outsiderOf(f *developerFixture) *models.User     { return f.outsider }
+
+func TestCreateDeveloperClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     DeveloperPolicy
+		verified   bool
+		existing   int // 用户已经拥有的客户端数量
+		req        func() ClientRequest
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "不需要审核", policy: DeveloperPolicy{MaxClients: 2}, verified: true, wantStatus: models.ClientApprovalApproved},
+		{name: "需要审核", policy: DeveloperPolicy{RequireApproval: true}, verified: true, wantStatus: models.ClientApprovalPending},
+		{name: "邮箱未验证", policy: DeveloperPolicy{}, wantErr: ErrEmailNotVerified},
+		{name: "未达数量上限", policy: DeveloperPolicy{MaxClients: 2}, verified: true, existing: 1, wantStatus: models.ClientApprovalApproved},
+		{name: "达到数量上限", policy: DeveloperPolicy{MaxClients: 2}, verified: true, existing: 2, wantErr: ErrTooManyClients},
+		{name: "不限制数量", policy: DeveloperPolicy{}, verified: true, existing: 3, wantStatus: models.ClientApprovalApproved},
+		{
+			name:     "无效的配置",
+			policy:   DeveloperPolicy{},
+			verified: true,
+			req: func() ClientRequest {
+				req := validClientRequest()
+				req.RedirectURIs = []string{"javascript:alert(1)"}
+				return req
+			},
+			wantErr: ErrInvalidClientMetadata,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			auth := newTestAuthService(t)
+			s := NewOAuthService(testSecret, 1, testIssuer)
+			user := createTestUser(t, auth, "dev@example.com")
+			if tt.verified {
+				database.DB.Model(user).Update("email_verified", true)
+			}
+			for i := 0; i < tt.existing; i++ {
+				ownerID := user.ID
+				if _, err := createClient(validClientRequest(), &ownerID, models.ClientApprovalApproved); err != nil {
+					t.Fatalf("创建已有客户端失败: %v", err)
+				}
+			}
+			s.SetDeveloperPolicy(tt.policy)
+			req := validClientRequest()
+			if tt.req != nil {
+				req = tt.req()
+			}
+
+			created, err := s.CreateDeveloperClient(user.ID, req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("创建客户端失败: %v", err)
+			}
+			if created.Client.ApprovalStatus != tt.wantStatus || *created.Client.OwnerID != user.ID {
+				t.Fatalf("审核状态 = %q，所有者 = %d，期望 %q、%d", created.Client.ApprovalStatus, *created.Client.OwnerID, tt.wantStatus, user.ID)
+			}
+			// 审核通过前不能用于授权
+			_, err = s.ValidateClientID(created.Client.ClientID)
+			if live := err == nil; live != (tt.wantStatus == models.ClientApprovalApproved) {
+				t.Fatalf("审核状态 %q 下 ValidateClientID = %v", tt.wantStatus, err)
+			}
+		})
+	}
+}
+
+func TestUpdateDeveloperClientReview(t *testing.T) {
+	tests := []struct {
+		name            string
+		requireApproval bool
+		status          string // 修改前的审核状态
+		mutate          func(req *ClientRequest)
+		wantStatus      string
+	}{
+		{name: "修改重定向地址需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.RedirectURIs = []string{"https://evil.example.com/callback"}
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改名称需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.Name = "Bank Login"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改权限范围需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.Scopes = []string{"openid", "roles"}
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改 Logo 需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.LogoURI = "https://cdn.example.com/logo.png"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改后端通道注销地址需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.BackchannelLogoutURI = "https://93.184.216.34/logout"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改隐私政策地址需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.PolicyURI = "https://app.example.com/privacy"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "修改服务条款地址需要重新审核", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.TOSURI = "https://app.example.com/terms"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "没有修改", requireApproval: true, status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+		}, wantStatus: models.ClientApprovalApproved},
+		{name: "不需要审核时直接生效", status: models.ClientApprovalApproved, mutate: func(req *ClientRequest) {
+			req.RedirectURIs = []string{"https://other.example.com/callback"}
+		}, wantStatus: models.ClientApprovalApproved},
+		{name: "审核未通过的客户端修改后重新提交", status: models.ClientApprovalRejected, mutate: func(req *ClientRequest) {
+			req.PolicyURI = "https://app.example.com/privacy"
+		}, wantStatus: models.ClientApprovalPending},
+		{name: "等待审核的客户端保持等待", requireApproval: true, status: models.ClientApprovalPending, mutate: func(req *ClientRequest) {
+			req.Name = "Renamed"
+		}, wantStatus: models.ClientApprovalPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newDeveloperFixture(t)
+			database.DB.Model(&models.OAuthClient{}).Where("client_id = ?", f.clientID).Update("approval_status", tt.status)
+			f.s.SetDeveloperPolicy(DeveloperPolicy{RequireApproval: tt.requireApproval})
+			req := validClientRequest()
+			tt.mutate(&req)
+
+			updated, err := f.s.UpdateDeveloperClient(f.collaborator.ID, f.clientID, req)
+			if err != nil {
+				t.Fatalf("修改客户端失败: %v", err)
+			}
+			stored, _ := f.s.GetClient(f.clientID)
+			if updated.ApprovalStatus != tt.wantStatus || stored.ApprovalStatus != tt.wantStatus {
+				t.Fatalf("审核状态 = %q（数据库 %q），期望 %q", updated.ApprovalStatus, stored.ApprovalStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	tests := []struct {
+		name    string
+		invitee string // 接受邀请的用户邮箱
+		prepare func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User)
+		wantErr error
+	}{
+		{name: "被邀请的用户接受"},
+		{name: "邮箱大小写不同", invitee: "Invitee@Example.com"},
+		{
+			name: "邮箱未验证",
+			prepare: func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User) {
+				database.DB.Model(invitee).Update("email_verified", false)
+			},
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name: "其他用户不能接受",
+			prepare: func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User) {
+				database.DB.Model(invitation).Update("email", "someone-else@example.com")
+			},
+			wantErr: ErrInvitationNotFound,
+		},
+		{
+			name: "已过期",
+			prepare: func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User) {
+				database.DB.Model(invitation).Update("expires_at", time.Now().Add(-time.Second))
+			},
+			wantErr: ErrInvitationNotFound,
+		},
+		{
+			name: "只能接受一次",
+			prepare: func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User) {
+				if _, err := f.s.AcceptInvitation(invitee.ID, invitation.ID); err != nil {
+					t.Fatalf("第一次接受失败: %v", err)
+				}
+			},
+			wantErr: ErrInvitationNotFound,
+		},
+		{
+			name: "客户端已删除",
+			prepare: func(t *testing.T, f *developerFixture, invitation *models.ClientInvitation, invitee *models.User) {
+				if err := f.s.DeleteDeveloperClient(f.owner.ID, f.clientID); err != nil {
+					t.Fatalf("删除客户端失败: %v", err)
+				}
+			},
+			wantErr: ErrInvitationNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newDeveloperFixture(t)
+			email := "invitee@example.com"
+			if tt.invitee != "" {
+				email = tt.invitee
+			}
+			invitee := createTestDeveloper(t, newTestAuthService(t), email)
+			invitation, err := f.s.InviteCollaborator(f.owner.ID, f.clientID, InviteCollaboratorRequest{Email: "invitee@example.com"})
+			if err != nil {
+				t.Fatalf("邀请失败: %v", err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, f, invitation, invitee)
+			}
+
+			joined, err := f.s.AcceptInvitation(invitee.ID, invitation.ID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("接受邀请失败: %v", err)
+			}
+			if joined.Role != ClientRoleCollaborator {
+				t.Fatalf("身份 = %q，期望 %q", joined.Role, ClientRoleCollaborator)
+			}
+			if _, err := f.s.GetDeveloperClient(invitee.ID, f.clientID); err != nil {
+				t.Fatalf("接受邀请后无法管理客户端: %v", err)
+			}
+		})
+	}
+}
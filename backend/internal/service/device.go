@@ -0,0 +1,301 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAuthorizationPending 用户还没有在浏览器中完成授权，设备需要继续轮询（RFC 8628 的 authorization_pending）
+	ErrAuthorizationPending = errors.New("用户尚未完成授权")
+	// ErrSlowDown 设备轮询过于频繁，轮询间隔已增加（RFC 8628 的 slow_down）
+	ErrSlowDown = errors.New("轮询过于频繁，请降低轮询频率")
+	// ErrExpiredDeviceCode 设备代码已过期，设备需要重新发起授权（RFC 8628 的 expired_token）
+	ErrExpiredDeviceCode = errors.New("设备代码已过期")
+	// ErrDeviceAccessDenied 用户拒绝了设备授权（RFC 8628 的 access_denied）
+	ErrDeviceAccessDenied = errors.New("用户拒绝了授权")
+	// ErrInvalidDeviceCode 设备代码无效或已换取过 Token
+	ErrInvalidDeviceCode = errors.New("无效或已使用的设备代码")
+	// ErrInvalidUserCode 用户输入的代码不存在、已使用或已过期
+	ErrInvalidUserCode = errors.New("代码无效或已过期，请检查设备上显示的代码")
+)
+
+const (
+	DeviceCodeTTL      = 10 * time.Minute       // 设备代码和用户代码的有效期
+	deviceCodeInterval = 5                      // 设备轮询的最小间隔（秒，RFC 8628 默认值）
+	deviceSlowDownStep = 5                      // 轮询过快时间隔增加的秒数
+	userCodeLength     = 8                      // 用户代码的字符数（显示为 XXXX-XXXX）
+	userCodeAlphabet   = "BCDFGHJKLMNPQRSTVWXZ" // 用户代码字符集（不含元音和易混淆字符，RFC 8628 6.1）
+)
+
+// DeviceAuthorizationRequest 设备授权请求（RFC 8628 3.1）
+type DeviceAuthorizationRequest struct {
+	Client    ClientCredentials // 客户端认证凭证
+	Scope     string            // 请求的权限范围（空格分隔）
+	Resources []string          // 请求访问的资源（RFC 8707）
+}
+
+// DeviceAuthorization 设备授权响应（RFC 8628 3.2）
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`               // 设备轮询 Token 端点时使用的代码
+	UserCode                string `json:"user_code"`                 // 用户在浏览器中输入的代码
+	VerificationURI         string `json:"verification_uri"`          // 用户输入代码的页面
+	VerificationURIComplete string `json:"verification_uri_complete"` // 已带上用户代码的页面地址（可生成二维码）
+	ExpiresIn               int    `json:"expires_in"`                // 有效期（秒）
+	Interval                int    `json:"interval"`                  // 轮询的最小间隔（秒）
+}
+
+// DeviceCodeExchangeRequest 设备用设备代码交换 Access Token 的请求
+type DeviceCodeExchangeRequest struct {
+	DeviceCode string            // 设备代码
+	Client     ClientCredentials // 客户端认证凭证
+	Resources  []string          // 本次 Token 的目标资源，为空时使用授权时的全部资源
+	Binding    TokenBinding      // 非空时签发的 Token 将绑定到对应密钥（DPoP 或客户端证书）
+}
+
+// StartDeviceAuthorization 发起设备授权，返回设备代码和用户代码
+// 客户端必须开启设备授权；权限范围和资源的校验与授权端点相同
+func (s *OAuthService) StartDeviceAuthorization(req DeviceAuthorizationRequest) (*DeviceAuthorization, error) {
+	// 1. 验证客户端
+	client, err := s.AuthenticateClient(req.Client)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(models.GrantTypeDeviceCode) {
+		return nil, ErrUnauthorizedClient
+	}
+
+	// 2. 验证权限范围和目标资源
+	if err := s.ValidateClientScope(client, req.Scope); err != nil {
+		return nil, err
+	}
+	if err := s.ValidateResources(req.Resources, req.Scope); err != nil {
+		return nil, err
+	}
+
+	// 3. 生成设备代码和用户代码
+	deviceCode, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成设备代码失败: %w", err)
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		return nil, fmt.Errorf("生成用户代码失败: %w", err)
+	}
+
+	// 4. 保存授权请求（只保存哈希）
+	record := &models.DeviceCode{
+		DeviceCodeHash: hashSessionToken(deviceCode),
+		UserCodeHash:   hashSessionToken(userCode),
+		ClientID:       client.ClientID,
+		Scope:          req.Scope,
+		Resource:       JoinScope(req.Resources),
+		Status:         models.DeviceCodePending,
+		Interval:       deviceCodeInterval,
+		ExpiresAt:      time.Now().Add(DeviceCodeTTL),
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("保存设备授权失败: %w", err)
+	}
+
+	display := formatUserCode(userCode)
+	verificationURI := s.issuer + "/device"
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {display}}.Encode(),
+		ExpiresIn:               int(DeviceCodeTTL.Seconds()),
+		Interval:                deviceCodeInterval,
+	}, nil
+}
+
+// FindDeviceCode 查找用户输入的代码对应的待授权请求，用于在设备授权页面展示客户端和权限
+// 输入错误的代码按 IP 计数，防止暴力猜测
+func (s *OAuthService) FindDeviceCode(userCode, ipAddress string) (*models.DeviceCode, *models.OAuthClient, error) {
+	// 1. 检查 IP 是否因多次输错被锁定
+	if err := s.throttle.Check(map[string]string{models.ThrottleKindIP: ipAddress}); err != nil {
+		return nil, nil, err
+	}
+
+	// 2. 查找未过期、未处理的授权请求
+	var record models.DeviceCode
+	err := database.DB.Where("user_code_hash = ? AND status = ? AND expires_at > ?",
+		hashSessionToken(normalizeUserCode(userCode)), models.DeviceCodePending, time.Now()).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if _, err := s.throttle.Fail(models.ThrottleKindIP, ipAddress); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, ErrInvalidUserCode
+		}
+		return nil, nil, fmt.Errorf("查询设备授权失败: %w", err)
+	}
+
+	// 3. 客户端必须仍然可用
+	client, err := s.ValidateClientID(record.ClientID)
+	if err != nil {
+		return nil, nil, ErrInvalidUserCode
+	}
+	return &record, client, nil
+}
+
+// DecideDeviceCode 记录用户对设备授权的决定，同意时同时保存授权记录
+// 只有仍在等待的请求可以处理，同一代码不能被同意或拒绝两次
+func (s *OAuthService) DecideDeviceCode(record *models.DeviceCode, session *SessionClaims, approve bool) error {
+	// 1. 条件更新状态，已处理或已过期的请求不会被修改
+	updates := map[string]interface{}{"status": models.DeviceCodeDenied}
+	if approve {
+		updates = map[string]interface{}{
+			"status":     models.DeviceCodeApproved,
+			"user_id":    session.UserID,
+			"session_id": session.SessionID,
+			"auth_time":  session.AuthTime,
+			"acr":        ACRForAMR(session.AMR),
+			"amr":        strings.Join(session.AMR, " "),
+		}
+	}
+	result := database.DB.Model(&models.DeviceCode{}).
+		Where("id = ? AND status = ? AND expires_at > ?", record.ID, models.DeviceCodePending, time.Now()).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("更新设备授权失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidUserCode
+	}
+
+	// 2. 同意时记录授权（用户可以在已授权应用中撤销）
+	if approve {
+		if err := s.SaveConsent(session.UserID, record.ClientID, record.Scope, ParseScope(record.Resource)); err != nil {
+			return fmt.Errorf("保存授权记录失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// ExchangeDeviceCode 用设备代码交换 Access Token（RFC 8628 3.4）
+// 用户完成授权前返回 ErrAuthorizationPending，轮询间隔小于要求时返回 ErrSlowDown 并增加间隔
+func (s *OAuthService) ExchangeDeviceCode(req DeviceCodeExchangeRequest) (*models.AccessToken, error) {
+	// 1. 验证客户端
+	client, err := s.AuthenticateClient(req.Client)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(models.GrantTypeDeviceCode) {
+		return nil, ErrUnauthorizedClient
+	}
+
+	// 2. 查找设备授权（必须是签发给该客户端的）
+	var record models.DeviceCode
+	if err := database.DB.Where("device_code_hash = ? AND client_id = ?", hashSessionToken(req.DeviceCode), client.ClientID).
+		First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidDeviceCode
+		}
+		return nil, fmt.Errorf("查询设备授权失败: %w", err)
+	}
+	if record.UsedAt != nil {
+		return nil, ErrInvalidDeviceCode
+	}
+	if record.IsExpired() {
+		return nil, ErrExpiredDeviceCode
+	}
+
+	// 3. 检查轮询间隔，过快时增加间隔
+	now := time.Now()
+	updates := map[string]interface{}{"last_polled_at": now}
+	tooFast := record.LastPolledAt != nil && now.Sub(*record.LastPolledAt) < time.Duration(record.Interval)*time.Second
+	if tooFast {
+		updates["interval"] = record.Interval + deviceSlowDownStep
+	}
+	if err := database.DB.Model(&record).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新设备授权失败: %w", err)
+	}
+	if tooFast {
+		return nil, ErrSlowDown
+	}
+
+	// 4. 用户尚未处理或拒绝了授权
+	switch record.Status {
+	case models.DeviceCodePending:
+		return nil, ErrAuthorizationPending
+	case models.DeviceCodeDenied:
+		return nil, ErrDeviceAccessDenied
+	}
+
+	// 5. 确定 Token 的受众和权限范围（只能是授权时资源的子集）
+	grant := deviceGrant(&record)
+	audience, scope, err := s.narrowToResources(grant, req.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. 标记设备代码为已使用（条件更新，并发轮询时只有一个请求能换取 Token）
+	result := database.DB.Model(&models.DeviceCode{}).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, fmt.Errorf("更新设备授权失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	// 7. 签发 Access Token（请求了 openid 权限时同时签发 ID Token）
+	return s.issueAccessToken(client, grant, audience, scope, req.Binding)
+}
+
+// deviceGrant 把用户同意的设备授权转换为等价的授权码记录，用于签发 Token
+func deviceGrant(record *models.DeviceCode) *models.AuthorizationCode {
+	grant := &models.AuthorizationCode{
+		ClientID:  record.ClientID,
+		UserID:    record.UserID,
+		Scope:     record.Scope,
+		Resource:  record.Resource,
+		SessionID: record.SessionID,
+		ACR:       record.ACR,
+		AMR:       record.AMR,
+	}
+	if record.AuthTime != nil {
+		grant.AuthTime = *record.AuthTime
+	}
+	return grant
+}
+
+// randomUserCode 生成用户代码（不含分隔符）
+func randomUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode 把用户代码显示为 XXXX-XXXX
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode 规范化用户输入的代码：忽略大小写、分隔符和空格
+func normalizeUserCode(input string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// newTestDeviceClient 创建开启了设备授权的客户端 device_client（密钥为 secret）
+func newTestDeviceClient(t *testing.T) *models.OAuthClient {
+	t.Helper()
+	client := &models.OAuthClient{ClientID: "device_client", ClientSecret: "secret", Name: "TV App", RedirectURI: "https://app.example.com/callback", GrantTypes: models.GrantTypeDeviceCode}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	return client
+}
+
+// allowNextPoll 把上次轮询时间提前，下一次轮询不会被视为过快
+func allowNextPoll(t *testing.T, deviceCode string) {
+	t.Helper()
+	if err := database.DB.Model(&models.DeviceCode{}).Where("device_code_hash = ?", hashSessionToken(deviceCode)).
+		Update("last_polled_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("更新轮询时间失败: %v", err)
+	}
+}
+
+func TestStartDeviceAuthorization(t *testing.T) {
+	newTestDB(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	newTestDeviceClient(t)
+	plain := &models.OAuthClient{ClientID: "web_client", ClientSecret: "secret", Name: "Web App", RedirectURI: "https://app.example.com/callback"}
+	limited := &models.OAuthClient{ClientID: "limited_client", ClientSecret: "secret", Name: "Limited App", RedirectURI: "https://app.example.com/callback", GrantTypes: models.GrantTypeDeviceCode, Scopes: "profile"}
+	for _, client := range []*models.OAuthClient{plain, limited} {
+		if err := database.DB.Create(client).Error; err != nil {
+			t.Fatalf("创建客户端失败: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		req     DeviceAuthorizationRequest
+		wantErr error
+	}{
+		{name: "发起设备授权", req: DeviceAuthorizationRequest{Client: ClientCredentials{ClientID: "device_client", ClientSecret: "secret"}, Scope: "openid profile"}},
+		{name: "客户端密钥错误", req: DeviceAuthorizationRequest{Client: ClientCredentials{ClientID: "device_client", ClientSecret: "wrong"}}, wantErr: ErrInvalidClient},
+		{name: "客户端未开启设备授权", req: DeviceAuthorizationRequest{Client: ClientCredentials{ClientID: "web_client", ClientSecret: "secret"}}, wantErr: ErrUnauthorizedClient},
+		{name: "超出客户端允许的权限范围", req: DeviceAuthorizationRequest{Client: ClientCredentials{ClientID: "limited_client", ClientSecret: "secret"}, Scope: "profile email"}, wantErr: ErrInvalidScope},
+		{name: "未登记的资源", req: DeviceAuthorizationRequest{Client: ClientCredentials{ClientID: "device_client", ClientSecret: "secret"}, Resources: []string{"https://unknown.example.com/api"}}, wantErr: ErrInvalidTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.StartDeviceAuthorization(tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("发起设备授权失败: %v", err)
+			}
+			if len(resp.UserCode) != userCodeLength+1 || resp.UserCode[userCodeLength/2] != '-' || normalizeUserCode(resp.UserCode) != strings.ReplaceAll(resp.UserCode, "-", "") {
+				t.Fatalf("用户代码格式不正确: %q", resp.UserCode)
+			}
+			complete := testIssuer + "/device?" + url.Values{"user_code": {resp.UserCode}}.Encode()
+			if resp.VerificationURI != testIssuer+"/device" || resp.VerificationURIComplete != complete {
+				t.Fatalf("验证地址不正确: %s, %s", resp.VerificationURI, resp.VerificationURIComplete)
+			}
+			if resp.ExpiresIn != int(DeviceCodeTTL.Seconds()) || resp.Interval != deviceCodeInterval || resp.DeviceCode == "" {
+				t.Fatalf("响应不正确: %+v", resp)
+			}
+
+			// 数据库只保存哈希
+			var record models.DeviceCode
+			if err := database.DB.Where("device_code_hash = ?", hashSessionToken(resp.DeviceCode)).First(&record).Error; err != nil {
+				t.Fatalf("查询设备授权失败: %v", err)
+			}
+			if record.UserCodeHash != hashSessionToken(normalizeUserCode(resp.UserCode)) || record.Status != models.DeviceCodePending || record.Scope != "openid profile" {
+				t.Fatalf("设备授权记录不正确: %+v", record)
+			}
+		})
+	}
+}
+
+func TestDeviceCodeFlow(t *testing.T) {
+	newTestDB(t)
+	auth := newTestAuthService(t)
+	user := createTestUser(t, auth, "alice@example.com")
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	s.throttle = NewThrottle(map[string]ThrottleRule{models.ThrottleKindIP: testThrottleRule(3)})
+	newTestDeviceClient(t)
+	creds := ClientCredentials{ClientID: "device_client", ClientSecret: "secret"}
+
+	start, err := s.StartDeviceAuthorization(DeviceAuthorizationRequest{Client: creds, Scope: "profile"})
+	if err != nil {
+		t.Fatalf("发起设备授权失败: %v", err)
+	}
+	poll := func() (*models.AccessToken, error) {
+		return s.ExchangeDeviceCode(DeviceCodeExchangeRequest{DeviceCode: start.DeviceCode, Client: creds})
+	}
+
+	// 1. 用户完成授权前，设备得到 authorization_pending；轮询过快时得到 slow_down，间隔增加
+	if _, err := poll(); !errors.Is(err, ErrAuthorizationPending) {
+		t.Fatalf("期望 %v，实际 %v", ErrAuthorizationPending, err)
+	}
+	if _, err := poll(); !errors.Is(err, ErrSlowDown) {
+		t.Fatalf("期望 %v，实际 %v", ErrSlowDown, err)
+	}
+	var record models.DeviceCode
+	database.DB.Where("device_code_hash = ?", hashSessionToken(start.DeviceCode)).First(&record)
+	if record.Interval != deviceCodeInterval+deviceSlowDownStep {
+		t.Fatalf("轮询间隔 = %d，期望 %d", record.Interval, deviceCodeInterval+deviceSlowDownStep)
+	}
+
+	// 2. 其他客户端不能使用这个设备代码
+	other := &models.OAuthClient{ClientID: "other_client", ClientSecret: "secret", Name: "Other", RedirectURI: "https://other.example.com/cb", GrantTypes: models.GrantTypeDeviceCode}
+	database.DB.Create(other)
+	if _, err := s.ExchangeDeviceCode(DeviceCodeExchangeRequest{DeviceCode: start.DeviceCode, Client: ClientCredentials{ClientID: "other_client", ClientSecret: "secret"}}); !errors.Is(err, ErrInvalidDeviceCode) {
+		t.Fatalf("期望 %v，实际 %v", ErrInvalidDeviceCode, err)
+	}
+
+	// 3. 用户输入的代码忽略大小写和分隔符；输错的代码按 IP 计数
+	found, client, err := s.FindDeviceCode(strings.ToLower(strings.ReplaceAll(start.UserCode, "-", " ")), "203.0.113.1")
+	if err != nil {
+		t.Fatalf("查找设备授权失败: %v", err)
+	}
+	if client.ClientID != "device_client" || found.ID != record.ID {
+		t.Fatalf("找到的设备授权不正确: %+v", found)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.FindDeviceCode("BBBB-BBBB", "203.0.113.2"); !errors.Is(err, ErrInvalidUserCode) {
+			t.Fatalf("第 %d 次: 期望 %v，实际 %v", i+1, ErrInvalidUserCode, err)
+		}
+	}
+	if _, _, err := s.FindDeviceCode(start.UserCode, "203.0.113.2"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("期望 %v，实际 %v", ErrTooManyAttempts, err)
+	}
+
+	// 4. 用户同意后，设备换取 Token，并记录用户的授权
+	session := &SessionClaims{UserID: user.ID, SessionID: "sid", AuthTime: time.Now().Add(-time.Minute), AMR: []string{AMRPassword}}
+	if err := s.DecideDeviceCode(found, session, true); err != nil {
+		t.Fatalf("同意设备授权失败: %v", err)
+	}
+	if err := s.DecideDeviceCode(found, session, false); !errors.Is(err, ErrInvalidUserCode) {
+		t.Fatalf("同一代码处理两次: 期望 %v，实际 %v", ErrInvalidUserCode, err)
+	}
+	if ok, err := s.HasConsent(user.ID, "device_client", "profile", nil, ""); err != nil || !ok {
+		t.Fatalf("同意设备授权后没有记录授权: %v", err)
+	}
+	allowNextPoll(t, start.DeviceCode)
+	token, err := poll()
+	if err != nil {
+		t.Fatalf("换取 Token 失败: %v", err)
+	}
+	claims, err := s.ValidateAccessToken(token.Token)
+	if err != nil {
+		t.Fatalf("验证 Token 失败: %v", err)
+	}
+	if claims.UserID != user.ID || claims.ClientID != "device_client" || claims.Scope != "profile" || token.ACR != ACRSingleFactor {
+		t.Fatalf("Token 不正确: %+v, acr = %q", claims, token.ACR)
+	}
+
+	// 5. 设备代码只能换取一次，用户代码也不能再使用
+	allowNextPoll(t, start.DeviceCode)
+	if _, err := poll(); !errors.Is(err, ErrInvalidDeviceCode) {
+		t.Fatalf("期望 %v，实际 %v", ErrInvalidDeviceCode, err)
+	}
+	if _, _, err := s.FindDeviceCode(start.UserCode, "203.0.113.1"); !errors.Is(err, ErrInvalidUserCode) {
+		t.Fatalf("期望 %v，实际 %v", ErrInvalidUserCode, err)
+	}
+}
+
+func TestDeviceCodeDeniedAndExpired(t *testing.T) {
+	newTestDB(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	newTestDeviceClient(t)
+	creds := ClientCredentials{ClientID: "device_client", ClientSecret: "secret"}
+	session := &SessionClaims{UserID: 1, SessionID: "sid", AuthTime: time.Now(), AMR: []string{AMRPassword}}
+
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, record *models.DeviceCode)
+		wantErr error
+	}{
+		{
+			name: "用户拒绝授权",
+			prepare: func(t *testing.T, record *models.DeviceCode) {
+				if err := s.DecideDeviceCode(record, session, false); err != nil {
+					t.Fatalf("拒绝设备授权失败: %v", err)
+				}
+			},
+			wantErr: ErrDeviceAccessDenied,
+		},
+		{
+			name: "设备代码已过期",
+			prepare: func(t *testing.T, record *models.DeviceCode) {
+				database.DB.Model(record).Update("expires_at", time.Now().Add(-time.Second))
+				if err := s.DecideDeviceCode(record, session, true); !errors.Is(err, ErrInvalidUserCode) {
+					t.Fatalf("过期后同意: 期望 %v，实际 %v", ErrInvalidUserCode, err)
+				}
+			},
+			wantErr: ErrExpiredDeviceCode,
+		},
+		{
+			name: "客户端关闭了设备授权",
+			prepare: func(t *testing.T, record *models.DeviceCode) {
+				database.DB.Model(&models.OAuthClient{}).Where("client_id = ?", "device_client").Update("grant_types", models.GrantTypeAuthorizationCode)
+			},
+			wantErr: ErrUnauthorizedClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database.DB.Model(&models.OAuthClient{}).Where("client_id = ?", "device_client").Update("grant_types", models.GrantTypeDeviceCode)
+			start, err := s.StartDeviceAuthorization(DeviceAuthorizationRequest{Client: creds, Scope: "profile"})
+			if err != nil {
+				t.Fatalf("发起设备授权失败: %v", err)
+			}
+			var record models.DeviceCode
+			database.DB.Where("device_code_hash = ?", hashSessionToken(start.DeviceCode)).First(&record)
+			tt.prepare(t, &record)
+
+			_, err = s.ExchangeDeviceCode(DeviceCodeExchangeRequest{DeviceCode: start.DeviceCode, Client: creds})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+			}
+			var count int64
+			database.DB.Model(&models.AccessToken{}).Count(&count)
+			if count != 0 {
+				t.Fatalf("签发了 %d 个 Token，期望 0", count)
+			}
+		})
+	}
+}
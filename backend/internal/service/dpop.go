@@ -0,0 +1,344 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidDPoPProof 无效的 DPoP 证明
+	ErrInvalidDPoPProof = errors.New("无效的 DPoP 证明")
+	// ErrDPoPProofReplayed DPoP 证明被重放
+	ErrDPoPProofReplayed = errors.New("DPoP 证明已被使用")
+	// ErrTokenBindingMismatch Token 绑定的密钥与请求不匹配
+	ErrTokenBindingMismatch = errors.New("Token 绑定校验失败")
+)
+
+// DPoPSigningAlgs 支持的 DPoP 证明签名算法（只允许非对称算法）
+var DPoPSigningAlgs = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+const (
+	dpopProofType   = "dpop+jwt"       // DPoP 证明的 typ 头
+	dpopMaxAge      = 5 * time.Minute  // DPoP 证明的最长有效期
+	dpopClockSkew   = 30 * time.Second // 允许的时钟偏差
+	dpopReplayLimit = dpopMaxAge + dpopClockSkew
+)
+
+// DPoPProof 验证通过的 DPoP 证明
+type DPoPProof struct {
+	JKT string // 证明公钥的 JWK SHA-256 指纹（RFC 7638）
+	JTI string // 证明的唯一标识
+}
+
+// dpopReplayCache 记录已使用过的 DPoP 证明 jti，防止重放
+// 记录分为当前和上一代两张表，每隔 dpopReplayLimit 轮换一次并整体丢弃更早的一代：
+// 每条记录至少保留 dpopReplayLimit（证明的有效窗口），且每次检查只需查表，不必遍历全部记录
+type dpopReplayCache struct {
+	mu        sync.Mutex
+	current   map[string]struct{}
+	previous  map[string]struct{}
+	rotatedAt time.Time // 上次轮换的时间
+}
+
+func newDPoPReplayCache() *dpopReplayCache {
+	return &dpopReplayCache{current: make(map[string]struct{}), previous: make(map[string]struct{})}
+}
+
+// use 记录一次 jti 使用，已存在时返回 false
+func (c *dpopReplayCache) use(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 当前一代已满一个有效窗口时轮换；超过两个窗口没有使用时两代都已过期
+	if elapsed := now.Sub(c.rotatedAt); elapsed >= dpopReplayLimit {
+		if elapsed >= 2*dpopReplayLimit {
+			c.previous = make(map[string]struct{})
+		} else {
+			c.previous = c.current
+		}
+		c.current = make(map[string]struct{})
+		c.rotatedAt = now
+	}
+
+	if _, exists := c.current[key]; exists {
+		return false
+	}
+	if _, exists := c.previous[key]; exists {
+		return false
+	}
+	c.current[key] = struct{}{}
+	return true
+}
+
+// ValidateDPoPProof 验证 DPoP 证明（RFC 9449 第 4.3 节）
+// method 和 htu 为当前请求的方法和地址；accessToken 非空时同时校验 ath
+func (s *OAuthService) ValidateDPoPProof(proof, method, htu, accessToken string) (*DPoPProof, error) {
+	if proof == "" {
+		return nil, fmt.Errorf("%w: 缺少 DPoP 头", ErrInvalidDPoPProof)
+	}
+
+	// 1. 校验签名（公钥来自证明自身的 jwk 头）
+	var jwkKey *JWK
+	token, err := jwt.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, errors.New("typ 必须为 dpop+jwt")
+		}
+		raw, err := json.Marshal(token.Header["jwk"])
+		if err != nil || token.Header["jwk"] == nil {
+			return nil, errors.New("缺少 jwk 头")
+		}
+		jwkKey, err = ParseJWK(raw)
+		if err != nil {
+			return nil, err
+		}
+		return jwkKey.PublicKey()
+	}, jwt.WithValidMethods(DPoPSigningAlgs), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidDPoPProof
+	}
+
+	// 2. 校验 htm 和 htu
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, fmt.Errorf("%w: htm 不匹配", ErrInvalidDPoPProof)
+	}
+	if claimHTU, _ := claims["htu"].(string); normalizeHTU(claimHTU) != normalizeHTU(htu) {
+		return nil, fmt.Errorf("%w: htu 不匹配", ErrInvalidDPoPProof)
+	}
+
+	// 3. 校验 iat（证明只在短时间内有效）
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: 缺少 iat", ErrInvalidDPoPProof)
+	}
+	now := time.Now()
+	issuedAt := time.Unix(int64(iat), 0)
+	if issuedAt.After(now.Add(dpopClockSkew)) || now.Sub(issuedAt) > dpopMaxAge {
+		return nil, fmt.Errorf("%w: iat 超出有效范围", ErrInvalidDPoPProof)
+	}
+
+	// 4. 校验 ath（携带 Access Token 时必须绑定该 Token）
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != AccessTokenHash(accessToken) {
+			return nil, fmt.Errorf("%w: ath 不匹配", ErrInvalidDPoPProof)
+		}
+	}
+
+	thumbprint, err := jwkKey.Thumbprint()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	// 5. 校验 jti 未被使用过
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("%w: 缺少 jti", ErrInvalidDPoPProof)
+	}
+	if !s.dpopReplay.use(thumbprint+":"+jti, now) {
+		return nil, ErrDPoPProofReplayed
+	}
+
+	return &DPoPProof{JKT: thumbprint, JTI: jti}, nil
+}
+
+// AccessTokenHash 计算 DPoP 证明中 ath 的取值（Access Token 的 SHA-256，base64url 编码）
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// normalizeHTU 去掉 htu 中的查询参数和片段（RFC 9449 第 4.3 节）
+func normalizeHTU(htu string) string {
+	if i := strings.IndexAny(htu, "?#"); i >= 0 {
+		htu = htu[:i]
+	}
+	return strings.TrimSuffix(htu, "/")
+}
+
+// RequestURL 还原当前请求的完整地址（不含查询参数），用于校验 DPoP 的 htu
+func RequestURL(r *http.Request) string {
+	scheme := "http"
+	if IsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// IsHTTPS 请求是否通过 HTTPS 访问（直接 TLS 连接，或可信反向代理转发的 HTTPS 请求）
+func IsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// trustedProxies 可信的反向代理，只有来自这些地址的 X-Forwarded-Proto 才会被采用
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies 设置可信的反向代理（IP 或 CIDR），在启动时调用一次
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("无效的代理地址: %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("无效的代理地址: %s", proxy)
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// fromTrustedProxy 请求是否由可信的反向代理转发（按连接的对端地址判断）
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// JWK JSON Web Key（只包含公钥部分）
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`   // 私钥参数，出现即视为无效
+	Kid string `json:"kid,omitempty"` // 密钥标识（JWKS 中使用）
+	Use string `json:"use,omitempty"` // 用途（sig）
+	Alg string `json:"alg,omitempty"` // 签名算法
+}
+
+// ParseJWK 解析 JWK
+func ParseJWK(raw []byte) (*JWK, error) {
+	var key JWK
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, fmt.Errorf("jwk 格式错误: %w", err)
+	}
+	if key.D != "" {
+		return nil, errors.New("jwk 不能包含私钥")
+	}
+	return &key, nil
+}
+
+// PublicKey 将 JWK 转换为 Go 公钥
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("无效的 EC 公钥")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("无效的 RSA 公钥")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("无效的 Ed25519 公钥")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+}
+
+// Thumbprint 计算 JWK 的 SHA-256 指纹（RFC 7638），结果为 base64url 编码
+func (k *JWK) Thumbprint() (string, error) {
+	// 按 RFC 7638 要求，只取必需成员并按字典序排列
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// decodeBigInt 解码 base64url 编码的大整数
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("jwk 参数编码错误")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,428 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testHTU = testIssuer + "/api/resource"
+
+// dpopTestKey 测试用的 DPoP 密钥（ES256）
+type dpopTestKey struct {
+	private *ecdsa.PrivateKey
+	jwk     map[string]interface{}
+}
+
+func newDPoPTestKey(t *testing.T) *dpopTestKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	coordinate := func(b interface{ FillBytes([]byte) []byte }) string {
+		return base64.RawURLEncoding.EncodeToString(b.FillBytes(make([]byte, 32)))
+	}
+	return &dpopTestKey{
+		private: private,
+		jwk: map[string]interface{}{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   coordinate(private.X),
+			"y":   coordinate(private.Y),
+		},
+	}
+}
+
+// thumbprint 公钥的 JWK 指纹
+func (k *dpopTestKey) thumbprint(t *testing.T) string {
+	t.Helper()
+	jwk := JWK{Kty: "EC", Crv: "P-256", X: k.jwk["x"].(string), Y: k.jwk["y"].(string)}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("计算指纹失败: %v", err)
+	}
+	return thumbprint
+}
+
+// proof 生成 DPoP 证明，mutate 可以在签名前修改头和声明
+func (k *dpopTestKey) proof(t *testing.T, method, htu, accessToken string, mutate func(header map[string]interface{}, claims jwt.MapClaims)) string {
+	t.Helper()
+	jti, err := randomToken(16)
+	if err != nil {
+		t.Fatalf("生成 jti 失败: %v", err)
+	}
+	claims := jwt.MapClaims{"htm": method, "htu": htu, "iat": time.Now().Unix(), "jti": jti}
+	if accessToken != "" {
+		claims["ath"] = AccessTokenHash(accessToken)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = k.jwk
+	if mutate != nil {
+		mutate(token.Header, claims)
+	}
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return signed
+}
+
+func TestValidateDPoPProof(t *testing.T) {
+	key := newDPoPTestKey(t)
+	other := newDPoPTestKey(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		htu         string
+		accessToken string
+		proof       func() string
+		wantErr     error
+	}{
+		{
+			name:   "有效证明",
+			method: "GET", htu: testHTU,
+			proof: func() string { return key.proof(t, "GET", testHTU, "", nil) },
+		},
+		{
+			name:   "htu 忽略查询参数和片段",
+			method: "GET", htu: testHTU + "?page=2",
+			proof: func() string { return key.proof(t, "GET", testHTU+"#top", "", nil) },
+		},
+		{
+			name:   "携带 Access Token 时 ath 匹配",
+			method: "GET", htu: testHTU, accessToken: "token-a",
+			proof: func() string { return key.proof(t, "GET", testHTU, "token-a", nil) },
+		},
+		{
+			name:   "缺少证明",
+			method: "GET", htu: testHTU,
+			proof:   func() string { return "" },
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "typ 不是 dpop+jwt",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(header map[string]interface{}, _ jwt.MapClaims) { header["typ"] = "JWT" })
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "缺少 jwk 头",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(header map[string]interface{}, _ jwt.MapClaims) { delete(header, "jwk") })
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "jwk 包含私钥",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(header map[string]interface{}, _ jwt.MapClaims) {
+					jwk := map[string]interface{}{"d": "c2VjcmV0"}
+					for k, v := range key.jwk {
+						jwk[k] = v
+					}
+					header["jwk"] = jwk
+				})
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "签名密钥与 jwk 不一致",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(header map[string]interface{}, _ jwt.MapClaims) { header["jwk"] = other.jwk })
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "对称签名算法",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"htm": "GET", "htu": testHTU, "iat": time.Now().Unix(), "jti": "hs256"})
+				token.Header["typ"] = dpopProofType
+				token.Header["jwk"] = key.jwk
+				signed, _ := token.SignedString([]byte("secret"))
+				return signed
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "htm 不匹配",
+			method: "POST", htu: testHTU,
+			proof:   func() string { return key.proof(t, "GET", testHTU, "", nil) },
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "htu 不匹配",
+			method: "GET", htu: testHTU,
+			proof:   func() string { return key.proof(t, "GET", testIssuer+"/other", "", nil) },
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "iat 过旧",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(_ map[string]interface{}, claims jwt.MapClaims) {
+					claims["iat"] = time.Now().Add(-dpopMaxAge - time.Minute).Unix()
+				})
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "iat 在未来",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(_ map[string]interface{}, claims jwt.MapClaims) {
+					claims["iat"] = time.Now().Add(dpopClockSkew + time.Minute).Unix()
+				})
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "缺少 jti",
+			method: "GET", htu: testHTU,
+			proof: func() string {
+				return key.proof(t, "GET", testHTU, "", func(_ map[string]interface{}, claims jwt.MapClaims) { delete(claims, "jti") })
+			},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "ath 对应其他 Token",
+			method: "GET", htu: testHTU, accessToken: "token-a",
+			proof:   func() string { return key.proof(t, "GET", testHTU, "token-b", nil) },
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "携带 Access Token 时缺少 ath",
+			method: "GET", htu: testHTU, accessToken: "token-a",
+			proof:   func() string { return key.proof(t, "GET", testHTU, "", nil) },
+			wantErr: ErrInvalidDPoPProof,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewOAuthService(testSecret, 1, testIssuer)
+			proof, err := s.ValidateDPoPProof(tt.proof(), tt.method, tt.htu, tt.accessToken)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+			if proof.JKT != key.thumbprint(t) {
+				t.Fatalf("jkt 不匹配: %s", proof.JKT)
+			}
+		})
+	}
+}
+
+func TestValidateDPoPProofReplay(t *testing.T) {
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	proof := newDPoPTestKey(t).proof(t, "GET", testHTU, "", nil)
+
+	if _, err := s.ValidateDPoPProof(proof, "GET", testHTU, ""); err != nil {
+		t.Fatalf("第一次使用失败: %v", err)
+	}
+	if _, err := s.ValidateDPoPProof(proof, "GET", testHTU, ""); !errors.Is(err, ErrDPoPProofReplayed) {
+		t.Fatalf("重放的证明应被拒绝，实际 %v", err)
+	}
+}
+
+func TestDPoPReplayCache(t *testing.T) {
+	c := newDPoPReplayCache()
+	start := time.Unix(1700000000, 0)
+
+	if !c.use("a", start) {
+		t.Fatal("第一次使用应成功")
+	}
+	tests := []struct {
+		name   string
+		key    string
+		at     time.Duration // 相对第一次使用的时间
+		wantOK bool
+	}{
+		{name: "立即重放", key: "a", at: time.Second},
+		{name: "其他 jti", key: "b", at: time.Second, wantOK: true},
+		{name: "有效窗口末尾重放", key: "a", at: dpopReplayLimit - time.Second},
+		{name: "轮换后仍在有效窗口内重放", key: "b", at: dpopReplayLimit + time.Second},
+		{name: "超过两个窗口后记录已丢弃", key: "a", at: 2*dpopReplayLimit + time.Second, wantOK: true},
+	}
+	for _, tt := range tests {
+		if ok := c.use(tt.key, start.Add(tt.at)); ok != tt.wantOK {
+			t.Errorf("%s: use = %v，期望 %v", tt.name, ok, tt.wantOK)
+		}
+	}
+
+	// 长时间没有使用后，旧记录不会继续占用内存
+	c.use("c", start.Add(10*dpopReplayLimit))
+	if n := len(c.current) + len(c.previous); n != 1 {
+		t.Fatalf("缓存中有 %d 条记录，期望 1", n)
+	}
+}
+
+// issueTestAccessToken 签发并保存一个 Access Token，jkt 非空时绑定到 DPoP 密钥
+func issueTestAccessToken(t *testing.T, s *OAuthService, jkt string) string {
+	t.Helper()
+	accessToken := &models.AccessToken{
+		ClientID:  "test_client",
+		UserID:    1,
+		Scope:     "profile",
+		JKT:       jkt,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	token, err := s.GenerateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("生成 Access Token 失败: %v", err)
+	}
+	accessToken.Token = token
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		t.Fatalf("保存 Access Token 失败: %v", err)
+	}
+	return token
+}
+
+func TestAuthenticateResourceRequestBinding(t *testing.T) {
+	newTestDB(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	key := newDPoPTestKey(t)
+	other := newDPoPTestKey(t)
+	bearerToken := issueTestAccessToken(t, s, "")
+	boundToken := issueTestAccessToken(t, s, key.thumbprint(t))
+
+	tests := []struct {
+		name    string
+		scheme  string
+		token   string
+		proof   func() string
+		wantErr error
+	}{
+		{
+			name:   "Bearer Token 以 Bearer 方案出示",
+			scheme: "Bearer", token: bearerToken,
+			proof: func() string { return "" },
+		},
+		{
+			name:   "Bearer Token 不能以 DPoP 方案出示",
+			scheme: "DPoP", token: bearerToken,
+			proof:   func() string { return key.proof(t, "GET", testHTU, bearerToken, nil) },
+			wantErr: ErrTokenBindingMismatch,
+		},
+		{
+			name:   "DPoP Token 附带正确的证明",
+			scheme: "DPoP", token: boundToken,
+			proof: func() string { return key.proof(t, "GET", testHTU, boundToken, nil) },
+		},
+		{
+			name:   "DPoP Token 不能作为 Bearer Token 使用",
+			scheme: "Bearer", token: boundToken,
+			proof:   func() string { return "" },
+			wantErr: ErrTokenBindingMismatch,
+		},
+		{
+			name:   "DPoP Token 缺少证明",
+			scheme: "DPoP", token: boundToken,
+			proof:   func() string { return "" },
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:   "DPoP Token 的证明由其他密钥签名",
+			scheme: "DPoP", token: boundToken,
+			proof:   func() string { return other.proof(t, "GET", testHTU, boundToken, nil) },
+			wantErr: ErrTokenBindingMismatch,
+		},
+		{
+			name:   "DPoP 证明没有绑定当前 Token",
+			scheme: "DPoP", token: boundToken,
+			proof:   func() string { return key.proof(t, "GET", testHTU, "", nil) },
+			wantErr: ErrInvalidDPoPProof,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.AuthenticateResourceRequest(ResourceRequest{
+				Scheme:    tt.scheme,
+				Token:     tt.token,
+				DPoPProof: tt.proof(),
+				Method:    "GET",
+				URL:       testHTU,
+			})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("已撤销的 Token", func(t *testing.T) {
+		if err := database.DB.Where("token = ?", bearerToken).Delete(&models.AccessToken{}).Error; err != nil {
+			t.Fatalf("撤销 Token 失败: %v", err)
+		}
+		if _, err := s.AuthenticateResourceRequest(ResourceRequest{Scheme: "Bearer", Token: bearerToken, Method: "GET", URL: testHTU}); err == nil {
+			t.Fatal("已撤销的 Token 应被拒绝")
+		}
+	})
+}
+
+func TestIsHTTPSTrustedProxies(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16"}); err != nil {
+		t.Fatalf("设置可信代理失败: %v", err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		tls        bool
+		want       bool
+	}{
+		{name: "直接 TLS 连接", remoteAddr: "203.0.113.9:5000", tls: true, want: true},
+		{name: "可信代理（IP）转发的 HTTPS", remoteAddr: "10.0.0.1:5000", proto: "https", want: true},
+		{name: "可信代理（CIDR）转发的 HTTPS", remoteAddr: "192.168.3.4:5000", proto: "https", want: true},
+		{name: "可信代理转发的 HTTP", remoteAddr: "10.0.0.1:5000", proto: "http", want: false},
+		{name: "不可信的客户端伪造 X-Forwarded-Proto", remoteAddr: "203.0.113.9:5000", proto: "https", want: false},
+		{name: "不可信的客户端", remoteAddr: "203.0.113.9:5000", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://auth.example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := IsHTTPS(r); got != tt.want {
+				t.Fatalf("IsHTTPS = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("无效的代理地址应返回错误")
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidEmailLogin 登录验证码错误，或登录链接无效、已使用、已过期
+	ErrInvalidEmailLogin = errors.New("验证码错误或已过期，请重新获取")
+	// ErrEmailLoginBrowserMismatch 登录链接没有在发起登录的浏览器中打开
+	ErrEmailLoginBrowserMismatch = errors.New("请在发起登录的浏览器中打开登录链接")
+)
+
+// EmailLoginCookieName 邮件登录浏览器绑定 Cookie 的名称（保存发起登录时生成的密钥，HttpOnly）
+const EmailLoginCookieName = "shadow_email_login"
+
+const (
+	EmailLoginTTL           = 10 * time.Minute // 登录链接和验证码的有效期
+	emailLoginCodeDigits    = 6                // 验证码位数
+	emailLoginMaxAttempts   = 5                // 验证码错误次数上限，达到后作废
+	emailLoginIPHourlyLimit = 20               // 同一 IP 每小时最多发送的登录邮件数
+)
+
+// EmailLoginRequest 申请邮件登录请求
+type EmailLoginRequest struct {
+	Email    string `json:"email" binding:"required"` // 邮箱
+	Continue string `json:"continue"`                 // 登录后需要恢复的授权请求（可选，由授权端点签发）
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// EmailLoginVerifyRequest 完成邮件登录请求（验证码和登录链接中的令牌二选一）
+type EmailLoginVerifyRequest struct {
+	Code  string `json:"code"`                                        // 邮件中的六位验证码
+	Token string `json:"token"`                                       // 登录链接中的令牌
+	Mode  string `json:"mode" binding:"omitempty,oneof=token cookie"` // 登录方式：token（默认）或 cookie
+
+	Binding string `json:"-"` // 浏览器绑定密钥（由处理器从 Cookie 读取）
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// StartEmailLogin 向邮箱发送登录链接和六位验证码，返回浏览器绑定密钥（由处理器写入 Cookie）
+// 登录只能在持有绑定密钥的浏览器中完成。为避免泄露邮箱是否注册，邮箱不存在或该账户发送过于频繁时同样返回绑定密钥，只是不发送邮件
+func (s *AuthService) StartEmailLogin(req EmailLoginRequest) (string, error) {
+	// 0. 校验登录后需要恢复的授权请求
+	if req.Continue != "" {
+		if _, err := s.ParseContinuation(req.Continue); err != nil {
+			return "", err
+		}
+	}
+
+	// 1. 检查账户和 IP 是否被锁定，同一 IP 发送过多时拒绝
+	login := LoginRequest{Email: req.Email, SessionInfo: req.SessionInfo}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var sent int64
+	if err := database.DB.Model(&models.EmailLogin{}).
+		Where("ip_address = ? AND created_at > ?", truncate(req.IPAddress, 64), now.Add(-time.Hour)).
+		Count(&sent).Error; err != nil {
+		return "", fmt.Errorf("查询登录邮件失败: %w", err)
+	}
+	if sent >= emailLoginIPHourlyLimit {
+		return "", ErrTooManyEmails
+	}
+
+	// 2. 生成浏览器绑定密钥
+	binding, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+
+	// 3. 查询用户
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return binding, nil
+		}
+		return "", fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	// 4. 同一账户限制发送频率（与其他邮件相同）
+	var recent []models.EmailLogin
+	if err := database.DB.Where("user_id = ? AND created_at > ?", user.ID, now.Add(-time.Hour)).
+		Order("created_at DESC").Find(&recent).Error; err != nil {
+		return "", fmt.Errorf("查询登录邮件失败: %w", err)
+	}
+	if len(recent) >= emailHourlyLimit || (len(recent) > 0 && now.Sub(recent[0].CreatedAt) < emailResendInterval) {
+		return binding, nil
+	}
+
+	// 5. 生成登录链接令牌和验证码，作废之前未使用的登录邮件
+	token, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	code, err := randomDigits(emailLoginCodeDigits)
+	if err != nil {
+		return "", fmt.Errorf("生成验证码失败: %w", err)
+	}
+	record := &models.EmailLogin{
+		UserID:      user.ID,
+		Email:       user.Email,
+		LinkHash:    hashSessionToken(token),
+		CodeHash:    emailLoginCodeHash(binding, code),
+		BrowserHash: hashSessionToken(binding),
+		Continue:    req.Continue,
+		IPAddress:   truncate(req.IPAddress, 64),
+		ExpiresAt:   now.Add(EmailLoginTTL),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailLogin{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("保存登录邮件失败: %w", err)
+	}
+
+	// 6. 发送邮件
+	link := s.issuer + "/login/email?" + url.Values{"token": {token}}.Encode()
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "登录验证码 - Shadow OAuth",
+		Body: fmt.Sprintf("您好 %s：\n\n您的登录验证码是：\n\n    %s\n\n也可以点击以下链接直接登录（需要在发起登录的浏览器中打开）：\n\n%s\n\n验证码和链接 %d 分钟内有效，只能使用一次。如果这不是您本人的操作，请忽略这封邮件。\n",
+			user.Name, code, link, int(EmailLoginTTL.Minutes())),
+	})
+	return binding, nil
+}
+
+// FinishEmailLogin 使用邮件中的验证码或登录链接完成登录，响应与 Login 相同
+// 必须在发起登录的浏览器中完成；账户启用了两步验证或注册了通行密钥时，邮件只代替密码，仍需完成第二步验证
+func (s *AuthService) FinishEmailLogin(req EmailLoginVerifyRequest) (*LoginResponse, error) {
+	// 1. 检查 IP 是否因多次失败被锁定（此时还不知道账户）
+	login := LoginRequest{Mode: req.Mode, SessionInfo: req.SessionInfo}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询登录请求：登录链接按令牌查询并校验浏览器绑定，验证码按浏览器绑定查询
+	record, err := findEmailLogin(req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidEmailLogin) && req.Token == "" {
+			s.recordLoginFailure(login, nil)
+		}
+		return nil, err
+	}
+
+	// 3. 检查账户是否被锁定，然后验证验证码（错误次数达到上限后作废）
+	login.Email = record.Email
+	if err := s.checkLoginThrottle(login); err != nil {
+		return nil, err
+	}
+	if req.Token == "" && subtle.ConstantTimeCompare([]byte(emailLoginCodeHash(req.Binding, normalizeMFACode(req.Code))), []byte(record.CodeHash)) != 1 {
+		if err := recordEmailLoginAttempt(record.ID); err != nil {
+			return nil, err
+		}
+		s.recordLoginFailure(login, nil)
+		return nil, ErrInvalidEmailLogin
+	}
+
+	// 4. 标记为已使用（条件更新保证并发请求中只有一个能成功）
+	result := database.DB.Model(&models.EmailLogin{}).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("使用登录邮件失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidEmailLogin
+	}
+
+	// 5. 登录邮件必须发送到用户当前的邮箱；能收到邮件说明邮箱属于用户，同时标记为已验证
+	user, err := s.GetUserByID(record.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidEmailLogin
+		}
+		return nil, err
+	}
+	if user.Email != record.Email {
+		return nil, ErrInvalidEmailLogin
+	}
+	s.resetLoginThrottle(login)
+	if !user.EmailVerified {
+		verifiedAt := time.Now()
+		if err := database.DB.Model(user).Updates(map[string]interface{}{"email_verified": true, "email_verified_at": verifiedAt}).Error; err != nil {
+			return nil, fmt.Errorf("更新邮箱验证状态失败: %w", err)
+		}
+	}
+
+	// 6. 启用了两步验证、注册了通行密钥（或账户要求两步验证）时返回 MFA 令牌
+	amr := []string{AMREmail}
+	login.Continue = record.Continue
+	if user.MFAEnabled() || user.MFARequired || s.hasPasskeys(user.ID) {
+		return s.beginMFA(user, login, amr)
+	}
+
+	// 7. 创建会话
+	return s.completeLogin(user, amr, record.Continue, req.Mode, req.SessionInfo)
+}
+
+// findEmailLogin 查询未使用、未过期的登录请求
+// 登录链接可能被转发或被邮件安全网关预先访问，只有携带发起登录时绑定密钥的浏览器才能使用
+func findEmailLogin(req EmailLoginVerifyRequest) (*models.EmailLogin, error) {
+	query := database.DB.Where("used_at IS NULL AND expires_at > ?", time.Now())
+	switch {
+	case req.Token != "":
+		query = query.Where("link_hash = ?", hashSessionToken(req.Token))
+	case req.Code != "" && req.Binding != "":
+		query = query.Where("browser_hash = ?", hashSessionToken(req.Binding)).Order("id DESC")
+	default:
+		return nil, ErrInvalidEmailLogin
+	}
+
+	var record models.EmailLogin
+	if err := query.First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidEmailLogin
+		}
+		return nil, fmt.Errorf("查询登录邮件失败: %w", err)
+	}
+	if req.Binding == "" || subtle.ConstantTimeCompare([]byte(hashSessionToken(req.Binding)), []byte(record.BrowserHash)) != 1 {
+		return nil, ErrEmailLoginBrowserMismatch
+	}
+	return &record, nil
+}
+
+// recordEmailLoginAttempt 记录一次验证码错误，达到上限后作废该登录请求
+func recordEmailLoginAttempt(id uint) error {
+	if err := database.DB.Model(&models.EmailLogin{}).Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return fmt.Errorf("记录验证码错误失败: %w", err)
+	}
+	if err := database.DB.Model(&models.EmailLogin{}).
+		Where("id = ? AND used_at IS NULL AND attempts >= ?", id, emailLoginMaxAttempts).
+		Update("used_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("作废登录邮件失败: %w", err)
+	}
+	return nil
+}
+
+// emailLoginCodeHash 验证码与浏览器绑定密钥一起计算哈希，只有数据库中的哈希无法穷举出验证码
+func emailLoginCodeHash(binding, code string) string {
+	return hashSessionToken(binding + ":" + code)
+}
+
+// randomDigits 生成指定位数的随机数字（可能以 0 开头）
+func randomDigits(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+var mailCodePattern = regexp.MustCompile(`\n\s+(\d{6})\n`)
+
+// startTestEmailLogin 申请邮件登录，返回浏览器绑定密钥、登录链接中的令牌和验证码
+// sentBefore 为此前已经发送的邮件数
+func startTestEmailLogin(t *testing.T, s *AuthService, outbox, email string, sentBefore int) (string, string, string) {
+	t.Helper()
+	// 此前的邮件（如注册验证邮件）在后台发送，先等它们写入，登录邮件才是最新的一封
+	waitForMails(t, outbox, sentBefore)
+	binding, err := s.StartEmailLogin(EmailLoginRequest{Email: email, SessionInfo: SessionInfo{IPAddress: "203.0.113.7"}})
+	if err != nil {
+		t.Fatalf("申请邮件登录失败: %v", err)
+	}
+	mails := waitForMails(t, outbox, sentBefore+1)
+	body := mails[len(mails)-1]
+	match := mailCodePattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("邮件中没有验证码: %s", body)
+	}
+	return binding, mailLinkParam(t, body, "token"), match[1]
+}
+
+// emailLoginFixture 已申请邮件登录的用户，以及邮件中的令牌和验证码
+type emailLoginFixture struct {
+	s       *AuthService
+	user    *models.User
+	outbox  string
+	binding string // 浏览器绑定密钥
+	token   string // 登录链接中的令牌
+	code    string // 验证码
+}
+
+func TestFinishEmailLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error)
+		wantErr error
+		wantMFA bool
+	}{
+		{
+			name: "验证码登录",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+		},
+		{
+			name: "登录链接",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token, Binding: f.binding})
+			},
+		},
+		{
+			name: "在其他浏览器打开登录链接",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token, Binding: "other-browser"})
+			},
+			wantErr: ErrEmailLoginBrowserMismatch,
+		},
+		{
+			name: "没有绑定 Cookie 时打开登录链接",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token})
+			},
+			wantErr: ErrEmailLoginBrowserMismatch,
+		},
+		{
+			name: "在其他浏览器输入验证码",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: "other-browser"})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "错误次数未达上限时仍可登录",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				submitWrongEmailLoginCodes(t, f, emailLoginMaxAttempts-1)
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+		},
+		{
+			name: "错误次数达到上限后作废",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				submitWrongEmailLoginCodes(t, f, emailLoginMaxAttempts)
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "错误次数达到上限后登录链接也作废",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				submitWrongEmailLoginCodes(t, f, emailLoginMaxAttempts)
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "过期",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				var record models.EmailLogin
+				database.DB.Where("user_id = ?", f.user.ID).First(&record)
+				if ttl := record.ExpiresAt.Sub(record.CreatedAt); ttl < EmailLoginTTL-time.Second || ttl > EmailLoginTTL+time.Second {
+					t.Fatalf("有效期 = %v，期望 %v", ttl, EmailLoginTTL)
+				}
+				database.DB.Model(&record).Update("expires_at", time.Now().Add(-time.Second))
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "登录链接只能使用一次",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				if _, err := f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token, Binding: f.binding}); err != nil {
+					t.Fatalf("第一次登录失败: %v", err)
+				}
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "新的登录邮件使旧的作废",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				database.DB.Model(&models.EmailLogin{}).Where("user_id = ?", f.user.ID).Update("created_at", time.Now().Add(-2*time.Minute))
+				if _, err := f.s.StartEmailLogin(EmailLoginRequest{Email: f.user.Email}); err != nil {
+					t.Fatalf("再次申请失败: %v", err)
+				}
+				waitForMails(t, f.outbox, 3)
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Token: f.token, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "邮箱修改后作废",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				database.DB.Model(f.user).Update("email", "new@example.com")
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+			wantErr: ErrInvalidEmailLogin,
+		},
+		{
+			name: "启用两步验证时仍需第二步",
+			attempt: func(t *testing.T, f *emailLoginFixture) (*LoginResponse, error) {
+				enrollTestTOTP(t, f.s, f.user.ID)
+				return f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: f.code, Binding: f.binding})
+			},
+			wantMFA: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			outbox := newTestOutbox(t, s)
+			alice := createTestUser(t, s, "alice@example.com")
+			f := &emailLoginFixture{s: s, user: alice, outbox: outbox}
+			f.binding, f.token, f.code = startTestEmailLogin(t, s, outbox, alice.Email, 1)
+
+			resp, err := tt.attempt(t, f)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("登录失败: %v", err)
+			}
+			if tt.wantMFA {
+				if !resp.MFARequired || resp.Token != "" {
+					t.Fatalf("期望要求两步验证，实际 %+v", resp)
+				}
+				return
+			}
+			claims, err := s.ValidateToken(resp.Token)
+			if err != nil || claims.UserID != alice.ID || !contains(claims.AMR, AMREmail) {
+				t.Fatalf("登录 Token 不正确: %v %+v", err, claims)
+			}
+			// 能收到邮件说明邮箱属于用户
+			if user, _ := s.GetUserByID(alice.ID); !user.EmailVerified {
+				t.Fatal("邮件登录后邮箱应标记为已验证")
+			}
+		})
+	}
+}
+
+// submitWrongEmailLoginCodes 提交 n 次错误的验证码
+func submitWrongEmailLoginCodes(t *testing.T, f *emailLoginFixture, n int) {
+	t.Helper()
+	wrong := "000000"
+	if f.code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < n; i++ {
+		if _, err := f.s.FinishEmailLogin(EmailLoginVerifyRequest{Code: wrong, Binding: f.binding}); !errors.Is(err, ErrInvalidEmailLogin) {
+			t.Fatalf("第 %d 次错误的验证码: 期望 %v，实际 %v", i+1, ErrInvalidEmailLogin, err)
+		}
+	}
+	if n >= emailLoginMaxAttempts {
+		// 账户同时因连续失败被锁定，等待后台发送的锁定通知写入后再结束测试
+		waitForMails(t, f.outbox, 3)
+	}
+}
+
+func TestStartEmailLoginDoesNotRevealAccounts(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	outbox := newTestOutbox(t, s)
+	alice := createTestUser(t, s, "alice@example.com")
+	startTestEmailLogin(t, s, outbox, alice.Email, 1)
+
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{name: "未注册的邮箱", email: "nobody@example.com"},
+		{name: "发送过于频繁", email: alice.Email},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding, err := s.StartEmailLogin(EmailLoginRequest{Email: tt.email})
+			if err != nil || binding == "" {
+				t.Fatalf("期望照常返回绑定密钥，实际 %q %v", binding, err)
+			}
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	if mails := waitForMails(t, outbox, 2); len(mails) != 2 {
+		t.Fatalf("只应发送注册和第一次登录的邮件，实际 %d 封", len(mails))
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrEmailNotVerified 邮箱尚未验证
+	ErrEmailNotVerified = errors.New("邮箱尚未验证，请先点击验证邮件中的链接")
+	// ErrEmailAlreadyVerified 邮箱已经验证过
+	ErrEmailAlreadyVerified = errors.New("邮箱已验证")
+)
+
+// 邮箱验证要求
+const (
+	EmailVerificationOptional  = "optional"  // 不要求验证（默认）
+	EmailVerificationAuthorize = "authorize" // 可以登录，但验证前不能授权第三方应用
+	EmailVerificationLogin     = "login"     // 验证前不能登录
+)
+
+const (
+	purposeVerifyEmail = "verify_email" // 邮箱验证令牌的用途
+	verifyEmailTTL     = 24 * time.Hour // 验证链接有效期
+)
+
+// SetMailer 设置发送验证邮件等使用的邮件发送器
+func (s *AuthService) SetMailer(mailer mail.Mailer) {
+	s.mailer = mailer
+}
+
+// SetEmailVerification 设置邮箱验证要求（optional、authorize、login）
+func (s *AuthService) SetEmailVerification(mode string) error {
+	switch mode {
+	case EmailVerificationOptional, EmailVerificationAuthorize, EmailVerificationLogin:
+		s.emailVerification = mode
+		return nil
+	default:
+		return fmt.Errorf("不支持的邮箱验证要求: %s", mode)
+	}
+}
+
+// CheckAuthorizeAllowed 检查用户是否可以授权第三方应用（邮箱验证要求为 authorize 或 login 时必须已验证）
+func (s *AuthService) CheckAuthorizeAllowed(userID uint) error {
+	if s.emailVerification == EmailVerificationOptional {
+		return nil
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// SendVerificationEmail 向用户的邮箱发送验证链接
+// 令牌在返回前生成（发送过于频繁时返回 ErrTooManyEmails），邮件在后台发送，
+// 避免注册和重新发送等待邮件服务器，也避免响应时间泄露邮箱是否注册
+func (s *AuthService) SendVerificationEmail(user *models.User) error {
+	token, err := issueVerificationToken(database.DB, user.ID, purposeVerifyEmail, user.Email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	link := s.issuer + "/verify-email?" + url.Values{"token": {token}}.Encode()
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "验证您的邮箱 - Shadow OAuth",
+		Body: fmt.Sprintf("您好 %s：\n\n请点击以下链接验证您的邮箱（%d 小时内有效）：\n\n%s\n\n如果这不是您本人的操作，请忽略这封邮件。\n",
+			user.Name, int(verifyEmailTTL.Hours()), link),
+	})
+	return nil
+}
+
+// ResendVerificationEmail 为已登录的用户重新发送验证邮件
+func (s *AuthService) ResendVerificationEmail(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.SendVerificationEmail(user)
+}
+
+// ResendVerificationEmailTo 按邮箱重新发送验证邮件（未登录时使用）
+// 为避免泄露邮箱是否注册，邮箱不存在、已验证或发送过于频繁时都不返回错误
+func (s *AuthService) ResendVerificationEmailTo(email string) error {
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("查询用户失败: %w", err)
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	if err := s.SendVerificationEmail(&user); err != nil && !errors.Is(err, ErrTooManyEmails) {
+		return err
+	}
+	return nil
+}
+
+// VerifyEmail 使用验证链接中的令牌验证邮箱（注册后的验证，或修改邮箱时对新邮箱的验证）
+func (s *AuthService) VerifyEmail(token string, info SessionInfo) (*models.User, error) {
+	// 1. 使用令牌
+	record, err := consumeVerificationToken(token, purposeVerifyEmail, purposeChangeEmail)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := AuditContext{SessionInfo: info}
+
+	// 2. 修改邮箱：新邮箱验证通过后生效
+	if record.Purpose == purposeChangeEmail {
+		if err := s.confirmEmailChange(user, record, ctx); err != nil {
+			return nil, err
+		}
+		return s.GetUserByID(user.ID)
+	}
+
+	// 3. 令牌必须发送到用户当前的邮箱（修改邮箱后旧链接失效）
+	if user.Email != record.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// 4. 标记为已验证
+	if !user.EmailVerified {
+		now := time.Now()
+		if err := database.DB.Model(user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("更新用户失败: %w", err)
+		}
+		recordAudit(user.ID, AuditEmailVerified, ctx, map[string]interface{}{"email": user.Email})
+	}
+	return user, nil
+}
+
+// sendVerificationAfterRegister 注册后发送验证邮件（失败只记录日志，用户可以稍后重新发送）
+func (s *AuthService) sendVerificationAfterRegister(user *models.User) {
+	if err := s.SendVerificationEmail(user); err != nil {
+		log.Printf("发送验证邮件失败: %v", err)
+	}
+}
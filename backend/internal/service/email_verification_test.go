@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// backdateVerificationTokens 把用户已签发的令牌的发送时间提前（模拟时间流逝）
+func backdateVerificationTokens(t *testing.T, userID uint, d time.Duration) {
+	t.Helper()
+	if err := database.DB.Model(&models.VerificationToken{}).Where("user_id = ?", userID).
+		Update("created_at", time.Now().Add(-d)).Error; err != nil {
+		t.Fatalf("修改令牌时间失败: %v", err)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, s *AuthService, user *models.User, registered string) string
+		valid bool
+		// 验证后用户是否已验证邮箱（第二次使用的用例中第一次已经验证成功）
+		wantVerified bool
+	}{
+		{
+			name:         "注册邮件中的链接",
+			token:        func(t *testing.T, s *AuthService, user *models.User, registered string) string { return registered },
+			valid:        true,
+			wantVerified: true,
+		},
+		{
+			name:         "同一链接第二次使用",
+			wantVerified: true,
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string {
+				if _, err := s.VerifyEmail(registered, SessionInfo{}); err != nil {
+					t.Fatalf("第一次验证失败: %v", err)
+				}
+				return registered
+			},
+		},
+		{
+			name: "过期的链接",
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string {
+				database.DB.Model(&models.VerificationToken{}).Where("user_id = ?", user.ID).
+					Update("expires_at", time.Now().Add(-time.Second))
+				return registered
+			},
+		},
+		{
+			name: "其他用途的令牌",
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string {
+				token, err := issueVerificationToken(database.DB, user.ID, purposeResetPassword, user.Email, time.Hour)
+				if err != nil {
+					t.Fatalf("签发令牌失败: %v", err)
+				}
+				return token
+			},
+		},
+		{
+			name: "发送到旧邮箱的链接",
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string {
+				database.DB.Model(user).Update("email", "new@example.com")
+				return registered
+			},
+		},
+		{
+			name:  "未知的令牌",
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string { return "unknown" },
+		},
+		{
+			name:  "空令牌",
+			token: func(t *testing.T, s *AuthService, user *models.User, registered string) string { return "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			outbox := newTestOutbox(t, s)
+			user := createTestUser(t, s, "alice@example.com")
+			mails := waitForMails(t, outbox, 1)
+			registered := mailLinkParam(t, mails[0], "token")
+
+			verified, err := s.VerifyEmail(tt.token(t, s, user, registered), SessionInfo{})
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("期望验证成功，实际 %v", err)
+				}
+				if verified.ID != user.ID {
+					t.Fatalf("验证的用户 = %d，期望 %d", verified.ID, user.ID)
+				}
+			} else if !errors.Is(err, ErrInvalidVerificationToken) {
+				t.Fatalf("期望 %v，实际 %v", ErrInvalidVerificationToken, err)
+			}
+
+			reloaded, _ := s.GetUserByID(user.ID)
+			if reloaded.EmailVerified != tt.wantVerified {
+				t.Fatalf("email_verified = %v，期望 %v", reloaded.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestResendVerificationEmailLimits(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	outbox := newTestOutbox(t, s)
+	user := createTestUser(t, s, "alice@example.com")
+	waitForMails(t, outbox, 1)
+
+	// 1. 间隔不足一分钟时拒绝
+	if err := s.ResendVerificationEmail(user.ID); !errors.Is(err, ErrTooManyEmails) {
+		t.Fatalf("立即重发: 期望 %v，实际 %v", ErrTooManyEmails, err)
+	}
+	// 未登录的重发接口不暴露频率限制
+	if err := s.ResendVerificationEmailTo(user.Email); err != nil {
+		t.Fatalf("按邮箱重发不应返回错误: %v", err)
+	}
+
+	// 2. 间隔足够时每小时最多发送 emailHourlyLimit 封
+	for sent := 1; sent < emailHourlyLimit; sent++ {
+		backdateVerificationTokens(t, user.ID, 2*time.Minute)
+		if err := s.ResendVerificationEmail(user.ID); err != nil {
+			t.Fatalf("第 %d 次重发失败: %v", sent+1, err)
+		}
+	}
+	backdateVerificationTokens(t, user.ID, 2*time.Minute)
+	if err := s.ResendVerificationEmail(user.ID); !errors.Is(err, ErrTooManyEmails) {
+		t.Fatalf("超过每小时上限: 期望 %v，实际 %v", ErrTooManyEmails, err)
+	}
+	mails := waitForMails(t, outbox, emailHourlyLimit)
+	if len(mails) != emailHourlyLimit {
+		t.Fatalf("发送了 %d 封邮件，期望 %d", len(mails), emailHourlyLimit)
+	}
+
+	// 3. 一小时后可以再次发送
+	backdateVerificationTokens(t, user.ID, time.Hour+time.Minute)
+	if err := s.ResendVerificationEmail(user.ID); err != nil {
+		t.Fatalf("一小时后重发失败: %v", err)
+	}
+
+	// 4. 已验证的邮箱不再发送
+	latest := waitForMails(t, outbox, emailHourlyLimit+1)
+	if _, err := s.VerifyEmail(mailLinkParam(t, latest[len(latest)-1], "token"), SessionInfo{}); err != nil {
+		t.Fatalf("验证失败: %v", err)
+	}
+	if err := s.ResendVerificationEmail(user.ID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Fatalf("已验证: 期望 %v，实际 %v", ErrEmailAlreadyVerified, err)
+	}
+}
+
+// blockingMailer 在 release 关闭前阻塞发送，模拟很慢的邮件服务器
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan mail.Message
+}
+
+func (m *blockingMailer) Send(msg mail.Message) error {
+	<-m.release
+	m.sent <- msg
+	return nil
+}
+
+func TestVerificationEmailDoesNotWaitForMailer(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	mailer := &blockingMailer{release: make(chan struct{}), sent: make(chan mail.Message, 4)}
+	s.SetMailer(mailer)
+
+	// 1. 注册和按邮箱重发都不等待邮件服务器
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		user, err := s.Register(RegisterRequest{Email: "alice@example.com", Password: testPassword, Name: "tester"})
+		if err != nil {
+			t.Errorf("注册用户失败: %v", err)
+			return
+		}
+		database.DB.Model(&models.VerificationToken{}).Where("user_id = ?", user.ID).Update("created_at", time.Now().Add(-2*time.Minute))
+		if err := s.ResendVerificationEmailTo(user.Email); err != nil {
+			t.Errorf("按邮箱重发失败: %v", err)
+		}
+		// 频率限制仍然同步返回
+		if err := s.ResendVerificationEmail(user.ID); !errors.Is(err, ErrTooManyEmails) {
+			t.Errorf("立即重发: 期望 %v，实际 %v", ErrTooManyEmails, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("注册或重发在等待邮件服务器")
+	}
+
+	// 2. 邮件服务器恢复后邮件照常送达
+	close(mailer.release)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-mailer.sent:
+			if msg.To != "alice@example.com" {
+				t.Fatalf("收件人 = %s", msg.To)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("只收到 %d 封邮件，期望 2 封", i)
+		}
+	}
+}
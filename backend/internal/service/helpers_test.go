@@ -0,0 +1,144 @@
+package service
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testIssuer   = "https://auth.example.com" // 测试使用的签发者标识
+	testSecret   = "test-secret"              // 测试使用的 JWT 签名密钥
+	testPassword = "Correct-Horse-42"         // 测试用户的密码
+)
+
+// newTestDB 为当前测试创建独立的 SQLite 数据库（替换全局连接），测试结束后关闭
+func newTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+	if err := database.AutoMigrate(
+		&models.User{},
+		&models.OAuthClient{},
+		&models.AuthorizationCode{},
+		&models.DeviceCode{},
+		&models.AccessToken{},
+		&models.ProtectedResource{},
+		&models.AuthorizationDetailType{},
+		&models.Consent{},
+		&models.Session{},
+		&models.VerificationToken{},
+		&models.AuditEvent{},
+		&models.LoginThrottle{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.EmailLogin{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.ClientCollaborator{},
+		&models.ClientInvitation{},
+	); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	if err := EnsureBuiltinRoles(); err != nil {
+		t.Fatalf("初始化内置角色失败: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+}
+
+// newTestAuthService 创建认证服务（使用最低 cost 的 bcrypt，加快测试）
+func newTestAuthService(t *testing.T) *AuthService {
+	t.Helper()
+	s := NewAuthService(testSecret, 1, testIssuer)
+	if err := s.SetPasswordHasher(&PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost}); err != nil {
+		t.Fatalf("设置密码哈希器失败: %v", err)
+	}
+	return s
+}
+
+// createTestUser 注册一个使用 testPassword 的用户
+func createTestUser(t *testing.T, s *AuthService, email string) *models.User {
+	t.Helper()
+	user, err := s.Register(RegisterRequest{Email: email, Password: testPassword, Name: "tester"})
+	if err != nil {
+		t.Fatalf("注册用户失败: %v", err)
+	}
+	return user
+}
+
+// newTestSession 为用户创建会话，返回会话记录、会话令牌和登录 JWT
+func newTestSession(t *testing.T, s *AuthService, userID uint) (*models.Session, string, string) {
+	t.Helper()
+	session, token, err := s.CreateSession(userID, time.Now(), []string{AMRPassword}, SessionInfo{IPAddress: "203.0.113.1"})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	jwtToken, err := s.GenerateToken(session)
+	if err != nil {
+		t.Fatalf("生成 Token 失败: %v", err)
+	}
+	return session, token, jwtToken
+}
+
+// newTestOutbox 让认证服务把邮件写入临时目录，返回目录路径
+func newTestOutbox(t *testing.T, s *AuthService) string {
+	t.Helper()
+	dir := t.TempDir()
+	s.SetMailer(mail.NewFileMailer(dir, "Shadow OAuth <noreply@example.com>"))
+	return dir
+}
+
+// waitForMails 等待目录中至少有 n 封邮件（部分邮件在后台发送），按写入顺序返回内容
+func waitForMails(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		names, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(names) >= n {
+			sort.Strings(names)
+			mails := make([]string, 0, len(names))
+			for _, name := range names {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("读取邮件失败: %v", err)
+				}
+				mails = append(mails, string(data))
+			}
+			return mails
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("期望至少 %d 封邮件，实际 %d 封", n, len(names))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var mailLinkPattern = regexp.MustCompile(`https?://\S+`)
+
+// mailLinkParam 取出邮件正文中链接的查询参数
+func mailLinkParam(t *testing.T, body, param string) string {
+	t.Helper()
+	link := mailLinkPattern.FindString(body)
+	parsed, err := url.Parse(link)
+	if link == "" || err != nil {
+		t.Fatalf("邮件中没有链接: %s", body)
+	}
+	value := parsed.Query().Get(param)
+	if value == "" {
+		t.Fatalf("链接 %s 中没有 %s 参数", link, param)
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ScopeOpenID 请求 ID Token 的权限范围（OIDC）
+const ScopeOpenID = "openid"
+
+// ErrInvalidIDTokenHint 无效的 id_token_hint
+var ErrInvalidIDTokenHint = errors.New("无效的 id_token_hint")
+
+// IDTokenHint 从 id_token_hint 中解析出的信息
+type IDTokenHint struct {
+	UserID    uint     // 用户ID（sub）
+	SessionID string   // 登录会话（sid）
+	Audience  []string // 签发给的客户端（aud）
+}
+
+// GenerateIDToken 生成 ID Token（OIDC Core 2），使用非对称密钥签名，客户端通过 JWKS 验证
+func (s *OAuthService) GenerateIDToken(client *models.OAuthClient, code *models.AuthorizationCode, accessToken string) (string, error) {
+	if s.signingKey == nil {
+		return "", errors.New("未配置签名密钥")
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, code.UserID).Error; err != nil {
+		return "", fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":     s.issuer,                                    // 签发者
+		"sub":     strconv.FormatUint(uint64(code.UserID), 10), // 用户标识
+		"aud":     code.ClientID,                               // 受众（客户端）
+		"exp":     now.Add(s.idTokenLifetime(client)).Unix(),   // 过期时间
+		"iat":     now.Unix(),                                  // 签发时间
+		"at_hash": leftHalfHash(accessToken),                   // Access Token 哈希
+
+		"email":          user.Email,         // 邮箱
+		"email_verified": user.EmailVerified, // 邮箱是否已验证
+	}
+	if !code.AuthTime.IsZero() {
+		claims["auth_time"] = code.AuthTime.Unix() // 认证时间
+	}
+	if code.SessionID != "" {
+		claims["sid"] = code.SessionID // 登录会话（用于注销通知）
+	}
+	if code.ACR != "" {
+		claims["acr"] = code.ACR // 授权时达到的认证级别
+	}
+	if amr := strings.Fields(code.AMR); len(amr) > 0 {
+		claims["amr"] = amr // 授权时的认证方式
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	roles, err := s.RoleClaims(code.UserID, code.Scope)
+	if err != nil {
+		return "", err
+	}
+	if roles != nil {
+		claims["roles"] = roles // 用户角色（授权包含 roles 权限范围时）
+	}
+	return s.signingKey.sign(claims, "")
+}
+
+// ParseIDTokenHint 验证 id_token_hint（OIDC RP-Initiated Logout）
+// 必须是本服务器签发的 ID Token；已过期的 ID Token 仍然可以作为提示使用
+func (s *OAuthService) ParseIDTokenHint(idToken string) (*IDTokenHint, error) {
+	if s.signingKey == nil {
+		return nil, ErrInvalidIDTokenHint
+	}
+	claims, err := s.signingKey.parse(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDTokenHint, err)
+	}
+	if iss, _ := claims.GetIssuer(); iss != s.issuer {
+		return nil, fmt.Errorf("%w: iss 不匹配", ErrInvalidIDTokenHint)
+	}
+
+	sub, _ := claims.GetSubject()
+	userID, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的 sub", ErrInvalidIDTokenHint)
+	}
+	audience, _ := claims.GetAudience()
+	sid, _ := claims["sid"].(string)
+	return &IDTokenHint{UserID: uint(userID), SessionID: sid, Audience: audience}, nil
+}
+
+// leftHalfHash 计算 at_hash：SHA-256 左半部分的 base64url 编码（OIDC Core 3.1.3.6）
+func leftHalfHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// IntrospectionResponse Token 内省响应（RFC 7662）
+type IntrospectionResponse struct {
+	Active               bool              `json:"active"`                          // Token 是否有效
+	Scope                string            `json:"scope,omitempty"`                 // 权限范围
+	ClientID             string            `json:"client_id,omitempty"`             // 客户端ID
+	Iss                  string            `json:"iss,omitempty"`                   // 签发者
+	Sub                  string            `json:"sub,omitempty"`                   // 用户ID
+	Aud                  []string          `json:"aud,omitempty"`                   // 受众（资源服务器应检查其中包含自己）
+	Exp                  int64             `json:"exp,omitempty"`                   // 过期时间
+	Iat                  int64             `json:"iat,omitempty"`                   // 签发时间
+	TokenType            string            `json:"token_type,omitempty"`            // Token 类型（Bearer 或 DPoP）
+	Cnf                  map[string]string `json:"cnf,omitempty"`                   // 绑定的密钥指纹
+	AuthorizationDetails json.RawMessage   `json:"authorization_details,omitempty"` // 授予的授权详情（RFC 9396）
+	Acr                  string            `json:"acr,omitempty"`                   // 用户授权时达到的认证级别
+	Amr                  []string          `json:"amr,omitempty"`                   // 用户授权时的认证方式
+	AuthTime             int64             `json:"auth_time,omitempty"`             // 用户完成认证的时间
+	Roles                []string          `json:"roles,omitempty"`                 // 用户当前的角色（授权包含 roles 权限范围时）
+}
+
+// IntrospectToken Token 内省
+// 调用方需要通过客户端认证；无效、过期或已撤销的 Token 只返回 active=false
+func (s *OAuthService) IntrospectToken(creds ClientCredentials, token string) (*IntrospectionResponse, error) {
+	// 1. 验证调用方
+	if _, err := s.AuthenticateClient(creds); err != nil {
+		return nil, err
+	}
+
+	// 2. 验证 Token 签名和有效期
+	claims, err := s.ValidateAccessToken(token)
+	if err != nil {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	// 3. 确认 Token 仍存在（未被撤销）
+	var accessToken models.AccessToken
+	if err := database.DB.Where("token = ?", token).First(&accessToken).Error; err != nil {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	resp := &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Iss:       s.issuer,
+		Sub:       strconv.FormatUint(uint64(claims.UserID), 10),
+		Aud:       claims.Audience,
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		TokenType: "Bearer",
+		Acr:       accessToken.ACR,
+		Amr:       strings.Fields(accessToken.AMR),
+	}
+	if accessToken.AuthTime != nil {
+		resp.AuthTime = accessToken.AuthTime.Unix()
+	}
+	if claims.Binding.IsBound() {
+		resp.Cnf = claims.Binding.claims()
+	}
+	if claims.Binding.JKT != "" {
+		resp.TokenType = "DPoP"
+	}
+	if claims.Details != "" {
+		resp.AuthorizationDetails = json.RawMessage(claims.Details)
+	}
+	if resp.Roles, err = s.RoleClaims(claims.UserID, claims.Scope); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
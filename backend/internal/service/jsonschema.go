@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// jsonSchema JSON Schema 的常用子集，用于校验 authorization_details
+// 支持：type、enum、const、properties、required、additionalProperties、items、
+// minLength、maxLength、pattern、minimum、maximum、minItems、maxItems
+type jsonSchema struct {
+	Type                 interface{}            `json:"type"` // 字符串或字符串数组
+	Enum                 []interface{}          `json:"enum"`
+	Const                interface{}            `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// compileJSONSchema 解析 JSON Schema 并预编译其中的正则表达式
+func compileJSONSchema(raw string) (*jsonSchema, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, fmt.Errorf("JSON Schema 格式错误: %w", err)
+	}
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("无效的 pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// validate 校验 JSON 值，返回所有不符合的位置
+func (s *jsonSchema) validate(path string, value interface{}) []string {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if !s.matchesType(value) {
+		fail("类型应为 %v", s.Type)
+		return problems
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.Const, value) {
+		fail("取值应为 %v", s.Const)
+	}
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		fail("取值必须是 %v 之一", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("长度不能小于 %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("长度不能大于 %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("不匹配 %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("不能小于 %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("不能大于 %v", *s.Maximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("元素个数不能少于 %d", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("元素个数不能多于 %d", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("缺少必填字段 %s", name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				problems = append(problems, prop.validate(path+"."+key, v[key])...)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("不允许的字段 %s", key)
+			}
+		}
+	}
+	return problems
+}
+
+// matchesType 检查值是否符合 type 约束
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		return jsonTypeIs(t, value)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && jsonTypeIs(name, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeIs 检查 encoding/json 解码出的值是否为指定的 JSON Schema 类型
+func jsonTypeIs(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// enumContains 检查值是否在枚举中
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, item := range enum {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// SetThrottle 设置认证失败计数器
+func (s *AuthService) SetThrottle(throttle *Throttle) {
+	s.throttle = throttle
+}
+
+// checkLoginThrottle 登录前检查账户和 IP 是否被锁定
+// 账户按提交的邮箱计数，不区分账户是否存在，因此锁定状态不会暴露邮箱是否注册
+func (s *AuthService) checkLoginThrottle(req LoginRequest) error {
+	return s.throttle.Check(map[string]string{
+		models.ThrottleKindAccount: req.Email,
+		models.ThrottleKindIP:      req.IPAddress,
+	})
+}
+
+// recordLoginFailure 记录登录失败，账户因此被锁定时通知账户所有者（user 为空表示账户不存在）
+func (s *AuthService) recordLoginFailure(req LoginRequest, user *models.User) {
+	if _, err := s.throttle.Fail(models.ThrottleKindIP, req.IPAddress); err != nil {
+		log.Printf("记录登录失败失败: %v", err)
+	}
+	locked, err := s.throttle.Fail(models.ThrottleKindAccount, req.Email)
+	if err != nil {
+		log.Printf("记录登录失败失败: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	if user == nil {
+		// 计数不区分邮箱大小写，按小写邮箱查找账户所有者
+		var owner models.User
+		if err := database.DB.Where("LOWER(email) = ?", throttleKey(models.ThrottleKindAccount, req.Email)).First(&owner).Error; err != nil {
+			return
+		}
+		user = &owner
+	}
+
+	recordAudit(user.ID, AuditAccountLocked, AuditContext{SessionInfo: req.SessionInfo}, nil)
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "账户因多次登录失败被暂时锁定 - Shadow OAuth",
+		Body: fmt.Sprintf("您好 %s：\n\n您的账户在 %s 连续多次登录失败（最近一次来自 IP %s），已被暂时锁定，稍后会自动解锁。\n\n如果这不是您本人的操作，建议尽快修改密码。\n",
+			user.Name, time.Now().Format("2006-01-02 15:04:05"), req.IPAddress),
+	})
+}
+
+// resetLoginThrottle 登录成功后清零账户的失败计数（IP 的计数不清零，避免攻击者用自己的账户重置）
+func (s *AuthService) resetLoginThrottle(req LoginRequest) {
+	if err := s.throttle.Reset(models.ThrottleKindAccount, req.Email); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Lockouts 列出认证失败计数和锁定状态（管理接口）
+func (s *AuthService) Lockouts() ([]models.LoginThrottle, error) {
+	return s.throttle.Lockouts()
+}
+
+// Unlock 解除锁定（管理接口），解除账户锁定时写入该账户的审计记录
+func (s *AuthService) Unlock(id uint, ctx AuditContext) (*models.LoginThrottle, error) {
+	record, err := s.throttle.Unlock(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Kind == models.ThrottleKindAccount {
+		var user models.User
+		if err := database.DB.Where("LOWER(email) = ?", record.Key).First(&user).Error; err == nil {
+			recordAudit(user.ID, AuditAccountUnlocked, ctx, nil)
+		}
+	}
+	return record, nil
+}
+
+// UnlockUser 解除用户账户的锁定（管理接口）
+func (s *AuthService) UnlockUser(userID uint, ctx AuditContext) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.throttle.Reset(models.ThrottleKindAccount, user.Email); err != nil {
+		return err
+	}
+	recordAudit(user.ID, AuditAccountUnlocked, ctx, nil)
+	return nil
+}
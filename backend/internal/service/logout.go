@@ -0,0 +1,299 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidPostLogoutRedirectURI 未注册的退出后重定向地址
+var ErrInvalidPostLogoutRedirectURI = errors.New("post_logout_redirect_uri 未注册")
+
+const (
+	backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout" // 注销 Token 的事件类型
+	logoutTokenType        = "logout+jwt"                                         // 注销 Token 的 typ 头
+	logoutTokenTTL         = 2 * time.Minute                                      // 注销 Token 有效期
+	backchannelTimeout     = 5 * time.Second                                      // 单次通知的超时时间
+	backchannelAttempts    = 3                                                    // 通知失败时的最多尝试次数
+	backchannelBackoff     = time.Second                                          // 首次重试的等待时间（之后每次翻倍）
+)
+
+// SetBackchannelAllowPrivate 设置是否允许向内网地址发送后端通道注销通知（只用于本地开发）
+func (s *OAuthService) SetBackchannelAllowPrivate(allow bool) {
+	s.httpClient = newBackchannelClient(allow)
+}
+
+// ValidateBackchannelLogoutURI 校验后端通道注销地址
+// 服务器会主动 POST 到这个地址，因此必须是 https，且主机不能是回环、私有或链路本地地址（防止 SSRF 访问内网服务）
+func ValidateBackchannelLogoutURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || parsed.Opaque != "" {
+		return fmt.Errorf("%q 必须是 https 绝对地址", uri)
+	}
+	if parsed.Fragment != "" || parsed.User != nil || strings.ContainsAny(uri, " \t\r\n") {
+		return fmt.Errorf("%q 不能包含片段、用户信息或空白", uri)
+	}
+
+	// 域名解析失败时不拒绝（可能是暂时的），发送时还会检查实际连接的地址
+	host := parsed.Hostname()
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if isLoopbackHost(host) {
+		return fmt.Errorf("%q 不能指向内网地址", uri)
+	} else if resolved, err := net.LookupIP(host); err == nil {
+		ips = resolved
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return fmt.Errorf("%q 不能指向内网地址", uri)
+		}
+	}
+	return nil
+}
+
+// publicIP 判断是否是公网地址（不是回环、私有、链路本地、组播或未指定地址）
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// newBackchannelClient 创建发送后端通道注销通知的 HTTP 客户端
+// 建立连接时检查实际连接的 IP（登记后域名可能被改为解析到内网），不跟随重定向，不使用代理
+func newBackchannelClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: backchannelTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("拒绝连接内网地址 %s", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   backchannelTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// LogoutRequest RP 发起的退出登录请求（OIDC RP-Initiated Logout 1.0）
+type LogoutRequest struct {
+	IDTokenHint           string // 之前签发给客户端的 ID Token
+	ClientID              string // 客户端ID（没有 id_token_hint 时用于验证重定向地址）
+	PostLogoutRedirectURI string // 退出后重定向地址（必须预先注册）
+	State                 string // 原样返回给客户端的状态
+}
+
+// ValidatedLogout 验证通过的退出登录请求
+type ValidatedLogout struct {
+	Client      *models.OAuthClient // 发起退出的客户端（可能为空）
+	Hint        *IDTokenHint        // id_token_hint 中的信息（可能为空）
+	RedirectURL string              // 退出后重定向地址（已附加 state，可能为空）
+}
+
+// ValidateLogoutRequest 验证退出登录请求
+func (s *OAuthService) ValidateLogoutRequest(req LogoutRequest) (*ValidatedLogout, error) {
+	result := &ValidatedLogout{}
+
+	// 1. 验证 id_token_hint，并确认与 client_id 一致
+	clientID := req.ClientID
+	if req.IDTokenHint != "" {
+		hint, err := s.ParseIDTokenHint(req.IDTokenHint)
+		if err != nil {
+			return nil, err
+		}
+		if clientID == "" && len(hint.Audience) > 0 {
+			clientID = hint.Audience[0]
+		} else if clientID != "" && !contains(hint.Audience, clientID) {
+			return nil, fmt.Errorf("%w: 与 client_id 不匹配", ErrInvalidIDTokenHint)
+		}
+		result.Hint = hint
+	}
+
+	// 2. 查询客户端
+	if clientID != "" {
+		client, err := s.ValidateClientID(clientID)
+		if err != nil {
+			return nil, err
+		}
+		result.Client = client
+	}
+
+	// 3. 退出后重定向地址必须与客户端注册的地址完全一致
+	if req.PostLogoutRedirectURI == "" {
+		return result, nil
+	}
+	if result.Client == nil || !contains(strings.Fields(result.Client.PostLogoutRedirectURIs), req.PostLogoutRedirectURI) {
+		return nil, ErrInvalidPostLogoutRedirectURI
+	}
+	redirectURL, err := url.Parse(req.PostLogoutRedirectURI)
+	if err != nil || !SafeRedirectURL(redirectURL) {
+		return nil, ErrInvalidPostLogoutRedirectURI
+	}
+	if req.State != "" {
+		query := redirectURL.Query()
+		query.Set("state", req.State)
+		redirectURL.RawQuery = query.Encode()
+	}
+	result.RedirectURL = redirectURL.String()
+	return result, nil
+}
+
+// sessionClient 会话中授权过的客户端
+type sessionClient struct {
+	Session models.Session
+	Client  models.OAuthClient
+}
+
+// sessionClients 查询在这些会话中获得过授权的客户端
+func sessionClients(sessions []models.Session) ([]sessionClient, error) {
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	sessionIDs := make([]string, 0, len(sessions))
+	bySessionID := make(map[string]models.Session, len(sessions))
+	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.SessionID)
+		bySessionID[session.SessionID] = session
+	}
+
+	var pairs []struct {
+		SessionID string
+		ClientID  string
+	}
+	if err := database.DB.Model(&models.AuthorizationCode{}).Distinct("session_id", "client_id").
+		Where("session_id IN ?", sessionIDs).Scan(&pairs).Error; err != nil {
+		return nil, fmt.Errorf("查询会话客户端失败: %w", err)
+	}
+
+	var result []sessionClient
+	clients := map[string]*models.OAuthClient{}
+	for _, pair := range pairs {
+		client, ok := clients[pair.ClientID]
+		if !ok {
+			var found models.OAuthClient
+			if err := database.DB.Where("client_id = ?", pair.ClientID).First(&found).Error; err == nil {
+				client = &found
+			}
+			clients[pair.ClientID] = client
+		}
+		if client != nil {
+			result = append(result, sessionClient{Session: bySessionID[pair.SessionID], Client: *client})
+		}
+	}
+	return result, nil
+}
+
+// SessionsEnded 会话结束后通过后端通道通知客户端（OIDC Back-Channel Logout 1.0）
+// 通知在后台发送，失败时按指数退避重试，不阻塞退出登录
+func (s *OAuthService) SessionsEnded(sessions []models.Session) {
+	pairs, err := sessionClients(sessions)
+	if err != nil {
+		log.Printf("后端通道注销通知失败: %v", err)
+		return
+	}
+	for _, pair := range pairs {
+		if pair.Client.BackchannelLogoutURI == "" {
+			continue
+		}
+		logoutToken, err := s.generateLogoutToken(pair.Client.ClientID, pair.Session)
+		if err != nil {
+			log.Printf("生成注销 Token 失败: %v", err)
+			continue
+		}
+		go s.sendLogoutToken(pair.Client.BackchannelLogoutURI, logoutToken)
+	}
+}
+
+// FrontchannelLogoutURLs 需要在退出页面通过 iframe 加载的客户端注销地址（OIDC Front-Channel Logout 1.0）
+func (s *OAuthService) FrontchannelLogoutURLs(sessions []models.Session) []string {
+	pairs, err := sessionClients(sessions)
+	if err != nil {
+		log.Printf("前端通道注销失败: %v", err)
+		return nil
+	}
+	var urls []string
+	for _, pair := range pairs {
+		if pair.Client.FrontchannelLogoutURI == "" {
+			continue
+		}
+		logoutURL, err := url.Parse(pair.Client.FrontchannelLogoutURI)
+		if err != nil || !SafeRedirectURL(logoutURL) {
+			continue
+		}
+		query := logoutURL.Query()
+		query.Set("iss", s.issuer)
+		query.Set("sid", pair.Session.SessionID)
+		logoutURL.RawQuery = query.Encode()
+		urls = append(urls, logoutURL.String())
+	}
+	return urls
+}
+
+// generateLogoutToken 生成注销 Token（Back-Channel Logout 2.4）
+func (s *OAuthService) generateLogoutToken(clientID string, session models.Session) (string, error) {
+	if s.signingKey == nil {
+		return "", errors.New("未配置签名密钥")
+	}
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    s.issuer,
+		"aud":    clientID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(logoutTokenTTL).Unix(),
+		"jti":    jti,
+		"sub":    strconv.FormatUint(uint64(session.UserID), 10),
+		"sid":    session.SessionID,
+		"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+	}
+	return s.signingKey.sign(claims, logoutTokenType)
+}
+
+// sendLogoutToken 把注销 Token POST 到客户端的 backchannel_logout_uri
+// 网络错误和 5xx 响应会重试；其他非 2xx 响应（包括重定向）表示客户端拒绝，不再重试
+func (s *OAuthService) sendLogoutToken(uri, logoutToken string) {
+	backoff := backchannelBackoff
+	for attempt := 1; attempt <= backchannelAttempts; attempt++ {
+		resp, err := s.httpClient.PostForm(uri, url.Values{"logout_token": {logoutToken}})
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusInternalServerError {
+				if resp.StatusCode >= http.StatusMultipleChoices {
+					log.Printf("客户端拒绝注销通知 %s: %s", uri, resp.Status)
+				}
+				return
+			}
+			err = errors.New(resp.Status)
+		}
+		log.Printf("发送注销通知到 %s 失败（第 %d 次）: %v", uri, attempt, err)
+		if attempt < backchannelAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newLogoutTestService 创建配置了签名密钥的 OAuth 服务（允许向测试服务器的回环地址发送通知）
+func newLogoutTestService(t *testing.T, key *SigningKey) *OAuthService {
+	t.Helper()
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	s.SetSigningKey(key)
+	s.SetBackchannelAllowPrivate(true)
+	return s
+}
+
+// newTestSigningKey 生成测试使用的签名密钥
+func newTestSigningKey(t *testing.T) *SigningKey {
+	t.Helper()
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("生成签名密钥失败: %v", err)
+	}
+	return key
+}
+
+// createLogoutTestClient 创建登记了退出后重定向地址的客户端
+func createLogoutTestClient(t *testing.T, clientID, backchannelURI string) *models.OAuthClient {
+	t.Helper()
+	client := &models.OAuthClient{
+		ClientID:               clientID,
+		ClientSecret:           "secret",
+		Name:                   clientID,
+		RedirectURI:            "https://app.example.com/callback",
+		PostLogoutRedirectURIs: "https://app.example.com/logged-out http://localhost:3000/",
+		BackchannelLogoutURI:   backchannelURI,
+	}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	return client
+}
+
+func TestBackchannelLogoutToken(t *testing.T) {
+	newTestDB(t)
+	key := newTestSigningKey(t)
+	s := newLogoutTestService(t, key)
+	auth := newTestAuthService(t)
+	alice := createTestUser(t, auth, "alice@example.com")
+	session, _, _ := newTestSession(t, auth, alice.ID)
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.PostFormValue("logout_token")
+	}))
+	defer server.Close()
+
+	createLogoutTestClient(t, "rp", server.URL)
+	// 授权请求带有 nonce，注销 Token 中也不能出现
+	if err := database.DB.Create(&models.AuthorizationCode{
+		Code: "code", ClientID: "rp", UserID: alice.ID, SessionID: session.SessionID, Nonce: "n-0S6",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}).Error; err != nil {
+		t.Fatalf("创建授权码失败: %v", err)
+	}
+
+	s.SessionsEnded([]models.Session{*session})
+	var logoutToken string
+	select {
+	case logoutToken = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到注销通知")
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(logoutToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("解析注销 Token 失败: %v", err)
+	}
+	if typ := token.Header["typ"]; typ != logoutTokenType {
+		t.Errorf("typ = %v，期望 %s", typ, logoutTokenType)
+	}
+	claims, err := key.parse(logoutToken)
+	if err != nil {
+		t.Fatalf("注销 Token 签名无效: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		claim string
+		want  interface{}
+	}{
+		{name: "签发者", claim: "iss", want: testIssuer},
+		{name: "受众", claim: "aud", want: "rp"},
+		{name: "会话", claim: "sid", want: session.SessionID},
+		{name: "用户", claim: "sub", want: strconv.FormatUint(uint64(alice.ID), 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claims[tt.claim]; got != tt.want {
+				t.Fatalf("%s = %v，期望 %v", tt.claim, got, tt.want)
+			}
+		})
+	}
+	t.Run("事件", func(t *testing.T) {
+		events, _ := claims["events"].(map[string]interface{})
+		if _, ok := events[backchannelLogoutEvent]; !ok {
+			t.Fatalf("events 缺少 %s: %v", backchannelLogoutEvent, claims["events"])
+		}
+	})
+	t.Run("不包含 nonce", func(t *testing.T) {
+		if _, ok := claims["nonce"]; ok {
+			t.Fatal("注销 Token 不能包含 nonce")
+		}
+	})
+	t.Run("包含 jti 和有效期", func(t *testing.T) {
+		if claims["jti"] == nil || claims["iat"] == nil || claims["exp"] == nil {
+			t.Fatalf("缺少 jti/iat/exp: %v", claims)
+		}
+	})
+}
+
+func TestSendLogoutTokenRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // 依次返回的状态码（用完后返回最后一个）
+		wantHits int32
+	}{
+		{name: "成功时只发送一次", statuses: []int{http.StatusOK}, wantHits: 1},
+		{name: "5xx 后重试", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantHits: 2},
+		{name: "4xx 不重试", statuses: []int{http.StatusBadRequest}, wantHits: 1},
+		{name: "不跟随重定向", statuses: []int{http.StatusFound}, wantHits: 1},
+	}
+	key := newTestSigningKey(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&hits, 1)
+				status := tt.statuses[len(tt.statuses)-1]
+				if int(n) <= len(tt.statuses) {
+					status = tt.statuses[n-1]
+				}
+				if status == http.StatusFound {
+					// 重定向回自身，跟随的话会多出一次请求
+					w.Header().Set("Location", "/redirected")
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			s := newLogoutTestService(t, key)
+			s.sendLogoutToken(server.URL, "logout-token")
+			if got := atomic.LoadInt32(&hits); got != tt.wantHits {
+				t.Fatalf("请求次数 = %d，期望 %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestBackchannelClientRefusesPrivateAddresses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	// 默认客户端在建立连接时拒绝回环地址
+	resp, err := newBackchannelClient(false).PostForm(server.URL, nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("期望拒绝连接回环地址")
+	}
+	if atomic.LoadInt32(&hits) != 0 {
+		t.Fatal("请求不应到达服务器")
+	}
+}
+
+func TestValidateLogoutRequest(t *testing.T) {
+	newTestDB(t)
+	key := newTestSigningKey(t)
+	s := newLogoutTestService(t, key)
+	auth := newTestAuthService(t)
+	alice := createTestUser(t, auth, "alice@example.com")
+	client := createLogoutTestClient(t, "rp", "")
+	createLogoutTestClient(t, "other", "")
+
+	idToken := func(s *OAuthService, clientID string) string {
+		t.Helper()
+		token, err := s.GenerateIDToken(client, &models.AuthorizationCode{ClientID: clientID, UserID: alice.ID, SessionID: "sid-1"}, "at")
+		if err != nil {
+			t.Fatalf("生成 ID Token 失败: %v", err)
+		}
+		return token
+	}
+	validHint := idToken(s, "rp")
+	foreignKeyHint := idToken(newLogoutTestService(t, newTestSigningKey(t)), "rp")
+	wrongIssuer := NewOAuthService(testSecret, 1, "https://evil.example.com")
+	wrongIssuer.SetSigningKey(key)
+	wrongIssuerHint := idToken(wrongIssuer, "rp")
+
+	tests := []struct {
+		name         string
+		req          LogoutRequest
+		wantErr      error
+		wantRedirect string
+		wantSession  string
+	}{
+		{name: "有效的 id_token_hint", req: LogoutRequest{IDTokenHint: validHint}, wantSession: "sid-1"},
+		{name: "id_token_hint 与 client_id 一致", req: LogoutRequest{IDTokenHint: validHint, ClientID: "rp"}, wantSession: "sid-1"},
+		{name: "其他密钥签名的 id_token_hint", req: LogoutRequest{IDTokenHint: foreignKeyHint}, wantErr: ErrInvalidIDTokenHint},
+		{name: "签发者不匹配的 id_token_hint", req: LogoutRequest{IDTokenHint: wrongIssuerHint}, wantErr: ErrInvalidIDTokenHint},
+		{name: "无法解析的 id_token_hint", req: LogoutRequest{IDTokenHint: "garbage"}, wantErr: ErrInvalidIDTokenHint},
+		{name: "client_id 不是 id_token_hint 的受众", req: LogoutRequest{IDTokenHint: validHint, ClientID: "other"}, wantErr: ErrInvalidIDTokenHint},
+		{
+			name:         "完全匹配的重定向地址",
+			req:          LogoutRequest{IDTokenHint: validHint, PostLogoutRedirectURI: "https://app.example.com/logged-out", State: "xyz"},
+			wantRedirect: "https://app.example.com/logged-out?state=xyz",
+			wantSession:  "sid-1",
+		},
+		{
+			name:         "只有 client_id 时匹配的重定向地址",
+			req:          LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "http://localhost:3000/"},
+			wantRedirect: "http://localhost:3000/",
+		},
+		{name: "多出结尾斜杠", req: LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "https://app.example.com/logged-out/"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "多出查询参数", req: LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "https://app.example.com/logged-out?next=/"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "只匹配前缀", req: LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "https://app.example.com/logged"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "大小写不同", req: LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "https://APP.example.com/logged-out"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "其他主机", req: LogoutRequest{ClientID: "rp", PostLogoutRedirectURI: "https://evil.example.com/logged-out"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "其他客户端的地址", req: LogoutRequest{ClientID: "other", PostLogoutRedirectURI: "https://evil.example.com/"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+		{name: "没有客户端时不能重定向", req: LogoutRequest{PostLogoutRedirectURI: "https://app.example.com/logged-out"}, wantErr: ErrInvalidPostLogoutRedirectURI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.ValidateLogoutRequest(tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+			if result.RedirectURL != tt.wantRedirect {
+				t.Fatalf("重定向地址 = %q，期望 %q", result.RedirectURL, tt.wantRedirect)
+			}
+			if tt.wantSession != "" && (result.Hint == nil || result.Hint.SessionID != tt.wantSession) {
+				t.Fatalf("id_token_hint 会话 = %+v，期望 %s", result.Hint, tt.wantSession)
+			}
+			if result.Client == nil || result.Client.ClientID != "rp" {
+				t.Fatalf("客户端 = %+v，期望 rp", result.Client)
+			}
+		})
+	}
+}
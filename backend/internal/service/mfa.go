@@ -0,0 +1,488 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidMFACode 两步验证码或恢复码错误
+	ErrInvalidMFACode = errors.New("验证码错误")
+	// ErrInvalidMFAToken 无效或已过期的两步验证令牌
+	ErrInvalidMFAToken = errors.New("两步验证已过期，请重新登录")
+	// ErrMFAAlreadyEnabled 已启用两步验证
+	ErrMFAAlreadyEnabled = errors.New("已启用两步验证")
+	// ErrMFANotEnabled 未启用两步验证
+	ErrMFANotEnabled = errors.New("未启用两步验证")
+	// ErrMFASetupRequired 尚未生成 TOTP 密钥
+	ErrMFASetupRequired = errors.New("请先设置验证器")
+	// ErrMFARequired 账户必须启用两步验证，不能关闭
+	ErrMFARequired = errors.New("该账户必须启用两步验证")
+)
+
+// 认证方式（RFC 8176 Authentication Method Reference）
+const (
+	AMRPassword    = "pwd"   // 密码
+	AMROTP         = "otp"   // 一次性验证码（TOTP 或恢复码）
+	AMRHardwareKey = "hwk"   // 通行密钥（WebAuthn）
+	AMREmail       = "email" // 邮件中的登录链接或验证码（RFC 8176 未定义，沿用常见实现的取值）
+	AMRMFA         = "mfa"   // 多因素认证
+)
+
+// 两步验证方式（登录第一步响应中的 mfa_methods）
+const (
+	MFAMethodTOTP     = "totp"     // TOTP 验证码（也可以使用恢复码）
+	MFAMethodWebAuthn = "webauthn" // 通行密钥
+)
+
+// 认证级别（ID Token 的 acr）
+const (
+	ACRSingleFactor = "urn:shadow-oauth:acr:1fa" // 单因素认证
+	ACRMultiFactor  = "urn:shadow-oauth:acr:2fa" // 多因素认证
+)
+
+const (
+	mfaTokenType      = "mfa_pending"   // MFA 令牌的 type 声明，避免与其他 Token 混用
+	mfaTokenTTL       = 5 * time.Minute // 用户需要在此时间内完成第二步验证
+	recoveryCodeCount = 10              // 每次生成的恢复码数量
+)
+
+// acrLevels 认证级别的强弱（数值越大越强）
+var acrLevels = map[string]int{
+	ACRSingleFactor: 1,
+	ACRMultiFactor:  2,
+}
+
+// ACRForAMR 根据认证方式得出认证级别
+func ACRForAMR(amr []string) string {
+	for _, method := range amr {
+		if method == AMRMFA {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// RequiredACR 从授权请求的 acr_values（按偏好排列，满足其中任意一个即可）中得出最低要求的认证级别
+// 忽略不支持的取值；全部不支持时返回 false
+func RequiredACR(acrValues []string) (string, bool) {
+	required := ""
+	for _, value := range acrValues {
+		level, ok := acrLevels[value]
+		if ok && (required == "" || level < acrLevels[required]) {
+			required = value
+		}
+	}
+	return required, required != ""
+}
+
+// SatisfiesACR 检查认证方式达到的级别是否不低于要求的级别
+func SatisfiesACR(amr []string, required string) bool {
+	return acrLevels[ACRForAMR(amr)] >= acrLevels[required]
+}
+
+// TOTPSetup 设置验证器所需的信息
+type TOTPSetup struct {
+	Secret string `json:"secret"`      // Base32 密钥（无法扫码时手动输入）
+	URI    string `json:"otpauth_uri"` // otpauth URI（生成二维码供验证器应用扫描）
+}
+
+// MFAVerifyRequest 登录第二步验证请求
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"` // 登录第一步返回的 MFA 令牌
+	Code     string `json:"code" binding:"required"`      // TOTP 验证码或恢复码
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// MFACodeRequest 需要当前验证码的操作（关闭两步验证、重新生成恢复码）
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"` // TOTP 验证码或恢复码
+}
+
+// mfaPending MFA 令牌中保存的待完成登录
+type mfaPending struct {
+	UserID   uint     // 用户ID
+	AMR      []string // 已完成的认证方式
+	Enroll   bool     // 账户要求两步验证但尚未启用，需要先设置验证器
+	Continue string   // 登录后需要恢复的授权请求
+	Mode     string   // 登录方式（token 或 cookie）
+	StepUp   string   // 提升认证级别的已有会话（sid），为空表示新的登录
+}
+
+// beginMFA 第一步认证通过后签发 MFA 令牌，完成第二步验证前不创建会话
+func (s *AuthService) beginMFA(user *models.User, req LoginRequest, amr []string) (*LoginResponse, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	return s.issueMFAToken(user, mfaPending{
+		UserID:   user.ID,
+		AMR:      amr,
+		Continue: req.Continue,
+		Mode:     req.Mode,
+	})
+}
+
+// issueMFAToken 签发 MFA 令牌；用户还没有任何两步验证方式时要求先设置验证器
+func (s *AuthService) issueMFAToken(user *models.User, pending mfaPending) (*LoginResponse, error) {
+	methods := s.mfaMethods(user)
+	pending.Enroll = len(methods) == 0
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":      s.issuer,
+		"type":     mfaTokenType,
+		"sub":      strconv.FormatUint(uint64(pending.UserID), 10),
+		"amr":      pending.AMR,
+		"enroll":   pending.Enroll,
+		"continue": pending.Continue,
+		"mode":     pending.Mode,
+		"step_up":  pending.StepUp,
+		"iat":      now.Unix(),
+		"exp":      now.Add(mfaTokenTTL).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return nil, fmt.Errorf("生成 MFA 令牌失败: %w", err)
+	}
+	return &LoginResponse{
+		MFARequired:           true,
+		MFAEnrollmentRequired: pending.Enroll,
+		MFAToken:              token,
+		MFAMethods:            methods,
+	}, nil
+}
+
+// PendingMFAMethods 返回 MFA 令牌对应的用户可以使用的两步验证方式（令牌无效时为空）
+func (s *AuthService) PendingMFAMethods(mfaToken string) []string {
+	pending, err := s.parseMFAToken(mfaToken)
+	if err != nil {
+		return nil
+	}
+	user, err := s.GetUserByID(pending.UserID)
+	if err != nil {
+		return nil
+	}
+	return s.mfaMethods(user)
+}
+
+// mfaMethods 用户可以使用的两步验证方式
+func (s *AuthService) mfaMethods(user *models.User) []string {
+	var methods []string
+	if user.MFAEnabled() {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if s.hasPasskeys(user.ID) {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods
+}
+
+// parseMFAToken 验证并解析 MFA 令牌
+func (s *AuthService) parseMFAToken(tokenString string) (*mfaPending, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMFAToken, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["type"] != mfaTokenType {
+		return nil, ErrInvalidMFAToken
+	}
+	sub, _ := claims.GetSubject()
+	userID, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	pending := &mfaPending{UserID: uint(userID)}
+	pending.Enroll, _ = claims["enroll"].(bool)
+	pending.Continue, _ = claims["continue"].(string)
+	pending.Mode, _ = claims["mode"].(string)
+	pending.StepUp, _ = claims["step_up"].(string)
+	if amr, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range amr {
+			if m, ok := method.(string); ok {
+				pending.AMR = append(pending.AMR, m)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// VerifyMFA 登录第二步：验证 TOTP 验证码或恢复码，通过后创建会话
+// 账户要求两步验证但尚未启用时，验证码同时用于确认验证器，响应中返回新生成的恢复码
+func (s *AuthService) VerifyMFA(req MFAVerifyRequest) (*LoginResponse, error) {
+	// 1. 验证 MFA 令牌
+	pending, err := s.parseMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserByID(pending.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// 2. 验证验证码（尚未启用时确认验证器并生成恢复码）
+	var recoveryCodes []string
+	if !user.MFAEnabled() && pending.Enroll {
+		recoveryCodes, err = s.enableTOTP(user, req.Code, AuditContext{ActorID: user.ID, SessionInfo: req.SessionInfo})
+	} else {
+		err = s.checkMFACode(user, req.Code, req.SessionInfo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 创建会话（提升认证级别时更新原有会话）
+	amr := appendAMR(pending.AMR, AMROTP, AMRMFA)
+	resp, err := s.completeMFA(user, pending, amr, req.SessionInfo)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// EnrollmentUserID 返回要求先设置验证器的 MFA 令牌对应的用户（登录时设置验证器使用）
+func (s *AuthService) EnrollmentUserID(mfaToken string) (uint, error) {
+	pending, err := s.parseMFAToken(mfaToken)
+	if err != nil {
+		return 0, err
+	}
+	if !pending.Enroll {
+		return 0, ErrInvalidMFAToken
+	}
+	return pending.UserID, nil
+}
+
+// SetupTOTP 生成新的 TOTP 密钥（确认验证码之前不生效）
+func (s *AuthService) SetupTOTP(userID uint) (*TOTPSetup, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, fmt.Errorf("保存 TOTP 密钥失败: %w", err)
+	}
+	return &TOTPSetup{Secret: secret, URI: totpURI(secret, user.Email)}, nil
+}
+
+// PendingTOTPSetup 返回等待确认的 TOTP 密钥，还没有时生成（托管页面重新显示时使用同一个密钥）
+func (s *AuthService) PendingTOTPSetup(userID uint) (*TOTPSetup, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return s.SetupTOTP(userID)
+	}
+	return &TOTPSetup{Secret: user.TOTPSecret, URI: totpURI(user.TOTPSecret, user.Email)}, nil
+}
+
+// ConfirmTOTP 用验证器生成的验证码确认 TOTP 密钥，启用两步验证，返回恢复码（只显示这一次）
+func (s *AuthService) ConfirmTOTP(userID uint, code string, ctx AuditContext) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return s.enableTOTP(user, code, ctx)
+}
+
+// DisableTOTP 关闭两步验证（需要当前验证码或恢复码），删除密钥和恢复码
+func (s *AuthService) DisableTOTP(userID uint, code string, ctx AuditContext) error {
+	// 1. 检查状态并验证
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+	if user.MFARequired && !s.hasPasskeys(user.ID) {
+		return ErrMFARequired
+	}
+	if err := s.checkMFACode(user, code, ctx.SessionInfo); err != nil {
+		return err
+	}
+
+	// 2. 删除密钥和恢复码
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"totp_last_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("关闭两步验证失败: %w", err)
+	}
+	recordAudit(user.ID, AuditMFADisabled, ctx, nil)
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（需要当前验证码或恢复码），之前的恢复码全部作废
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, code string, ctx AuditContext) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled() {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.checkMFACode(user, code, ctx.SessionInfo); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(database.DB, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(user.ID, AuditRecoveryCodesReset, ctx, nil)
+	return codes, nil
+}
+
+// enableTOTP 验证等待确认的 TOTP 密钥并启用两步验证，返回恢复码
+func (s *AuthService) enableTOTP(user *models.User, code string, ctx AuditContext) ([]string, error) {
+	// 1. 验证码必须由等待确认的密钥生成
+	if user.TOTPSecret == "" {
+		return nil, ErrMFASetupRequired
+	}
+	login := LoginRequest{Email: user.Email, SessionInfo: ctx.SessionInfo}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return nil, err
+	}
+	counter, ok := verifyTOTP(user.TOTPSecret, normalizeMFACode(code), 0, time.Now())
+	if !ok {
+		s.recordLoginFailure(login, user)
+		return nil, ErrInvalidMFACode
+	}
+	s.resetLoginThrottle(login)
+
+	// 2. 启用并生成恢复码
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled_at":   now,
+			"totp_last_counter": counter,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("启用两步验证失败: %w", err)
+	}
+	recordAudit(user.ID, AuditMFAEnabled, ctx, nil)
+	return codes, nil
+}
+
+// checkMFACode 验证 TOTP 验证码或恢复码，失败计入账户和 IP 的失败次数
+func (s *AuthService) checkMFACode(user *models.User, code string, info SessionInfo) error {
+	login := LoginRequest{Email: user.Email, SessionInfo: info}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return err
+	}
+
+	ok, err := s.verifyMFACode(user, code, info)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.recordLoginFailure(login, user)
+		return ErrInvalidMFACode
+	}
+	s.resetLoginThrottle(login)
+	return nil
+}
+
+// verifyMFACode 6 位数字按 TOTP 验证，其他按恢复码验证
+func (s *AuthService) verifyMFACode(user *models.User, code string, info SessionInfo) (bool, error) {
+	code = normalizeMFACode(code)
+	if len(code) == totpDigits {
+		if !user.MFAEnabled() {
+			return false, nil
+		}
+		counter, ok := verifyTOTP(user.TOTPSecret, code, user.TOTPLastCounter, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// 条件更新保证同一验证码在并发请求中只能使用一次
+		result := database.DB.Model(&models.User{}).Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+			Update("totp_last_counter", counter)
+		if result.Error != nil {
+			return false, fmt.Errorf("更新 TOTP 状态失败: %w", result.Error)
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashSessionToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("使用恢复码失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	var remaining int64
+	database.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	recordAudit(user.ID, AuditRecoveryCodeUsed, AuditContext{ActorID: user.ID, SessionInfo: info},
+		map[string]interface{}{"remaining": remaining})
+	return true, nil
+}
+
+// replaceRecoveryCodes 删除用户的旧恢复码并生成新的一组（数据库只保存哈希）
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("删除恢复码失败: %w", err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %w", err)
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		record := &models.RecoveryCode{UserID: userID, CodeHash: hashSessionToken(normalizeMFACode(code))}
+		if err := tx.Create(record).Error; err != nil {
+			return nil, fmt.Errorf("保存恢复码失败: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// normalizeMFACode 去掉验证码中的空格和连字符，统一为小写
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
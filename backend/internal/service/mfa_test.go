@@ -0,0 +1,270 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTOTPCode 计算密钥在某个时间步的验证码（模拟验证器应用）
+func testTOTPCode(t *testing.T, secret string, counter int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("解码 TOTP 密钥失败: %v", err)
+	}
+	return totpCode(key, counter)
+}
+
+// currentTOTPCounter 当前的时间步
+func currentTOTPCounter() int64 {
+	return time.Now().Unix() / int64(totpPeriod.Seconds())
+}
+
+// enrollTestTOTP 为用户设置并确认验证器，返回密钥、确认时使用的时间步和恢复码
+func enrollTestTOTP(t *testing.T, s *AuthService, userID uint) (string, int64, []string) {
+	t.Helper()
+	setup, err := s.SetupTOTP(userID)
+	if err != nil {
+		t.Fatalf("设置验证器失败: %v", err)
+	}
+	counter := currentTOTPCounter()
+	codes, err := s.ConfirmTOTP(userID, testTOTPCode(t, setup.Secret, counter), AuditContext{ActorID: userID})
+	if err != nil {
+		t.Fatalf("确认验证器失败: %v", err)
+	}
+	return setup.Secret, counter, codes
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量（取 8 位结果的后 6 位）
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/int64(totpPeriod.Seconds())); got != tt.want {
+			t.Errorf("T=%d: 验证码 = %s，期望 %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	code := func(counter int64) string { return testTOTPCode(t, secret, counter) }
+
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		lastCounter int64
+		wantCounter int64
+		wantOK      bool
+	}{
+		{name: "当前时间步", code: code(current), wantCounter: current, wantOK: true},
+		{name: "上一个时间步（时钟偏差）", code: code(current - 1), wantCounter: current - 1, wantOK: true},
+		{name: "下一个时间步（时钟偏差）", code: code(current + 1), wantCounter: current + 1, wantOK: true},
+		{name: "超出允许偏差（过去）", code: code(current - 2)},
+		{name: "超出允许偏差（未来）", code: code(current + 2)},
+		{name: "重放已使用的验证码", code: code(current), lastCounter: current},
+		{name: "比已使用的时间步更早", code: code(current - 1), lastCounter: current},
+		{name: "已使用上一个时间步后当前验证码仍可用", code: code(current), lastCounter: current - 1, wantCounter: current, wantOK: true},
+		{name: "小写密钥", secret: strings.ToLower(secret), code: code(current), wantCounter: current, wantOK: true},
+		{name: "错误的验证码", code: "000000"},
+		{name: "位数不对", code: code(current)[:5]},
+		{name: "无效的密钥", secret: "!!!", code: code(current)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useSecret := secret
+			if tt.secret != "" {
+				useSecret = tt.secret
+			}
+			counter, ok := verifyTOTP(useSecret, tt.code, tt.lastCounter, now)
+			if ok != tt.wantOK || counter != tt.wantCounter {
+				t.Fatalf("verifyTOTP = (%d, %v)，期望 (%d, %v)", counter, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVerifyMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		// code 返回第二步提交的验证码；可以在提交前使用验证码模拟已经用过
+		code     func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string
+		mfaToken func(loginToken string) string // 为空时使用登录第一步返回的 MFA 令牌
+		wantErr  error
+	}{
+		{
+			name: "验证器的下一个验证码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return testTOTPCode(t, secret, counter+1)
+			},
+		},
+		{
+			name: "确认验证器时用过的验证码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return testTOTPCode(t, secret, counter)
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "恢复码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return recovery[0]
+			},
+		},
+		{
+			name: "大写并带空格的恢复码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return " " + strings.ToUpper(strings.Replace(recovery[1], "-", " ", 1)) + " "
+			},
+		},
+		{
+			name: "已使用的恢复码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				if _, err := s.RegenerateRecoveryCodes(userID, recovery[0], AuditContext{ActorID: userID}); err != nil {
+					t.Fatalf("使用恢复码失败: %v", err)
+				}
+				return recovery[0]
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "重新生成后旧的恢复码作废",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				if _, err := s.RegenerateRecoveryCodes(userID, recovery[0], AuditContext{ActorID: userID}); err != nil {
+					t.Fatalf("重新生成恢复码失败: %v", err)
+				}
+				return recovery[1]
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "错误的验证码",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return "000000"
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "登录 JWT 不能作为 MFA 令牌",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return testTOTPCode(t, secret, counter+1)
+			},
+			mfaToken: func(loginToken string) string { return loginToken },
+			wantErr:  ErrInvalidMFAToken,
+		},
+		{
+			name: "无效的 MFA 令牌",
+			code: func(t *testing.T, s *AuthService, userID uint, secret string, counter int64, recovery []string) string {
+				return testTOTPCode(t, secret, counter+1)
+			},
+			mfaToken: func(string) string { return "garbage" },
+			wantErr:  ErrInvalidMFAToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			alice := createTestUser(t, s, "alice@example.com")
+			secret, counter, recovery := enrollTestTOTP(t, s, alice.ID)
+			_, _, loginJWT := newTestSession(t, s, alice.ID)
+
+			// 第一步：密码正确后要求两步验证，不创建会话
+			first, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword})
+			if err != nil {
+				t.Fatalf("登录第一步失败: %v", err)
+			}
+			if !first.MFARequired || first.Token != "" || first.SessionToken != "" {
+				t.Fatalf("期望只返回 MFA 令牌，实际 %+v", first)
+			}
+
+			mfaToken := first.MFAToken
+			if tt.mfaToken != nil {
+				mfaToken = tt.mfaToken(loginJWT)
+			}
+			resp, err := s.VerifyMFA(MFAVerifyRequest{MFAToken: mfaToken, Code: tt.code(t, s, alice.ID, secret, counter, recovery)})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("第二步验证失败: %v", err)
+			}
+			claims, err := s.ValidateToken(resp.Token)
+			if err != nil {
+				t.Fatalf("登录 Token 无效: %v", err)
+			}
+			if ACRForAMR(claims.AMR) != ACRMultiFactor {
+				t.Fatalf("amr = %v，期望包含 %s", claims.AMR, AMRMFA)
+			}
+		})
+	}
+}
+
+func TestCheckMFACodeThrottle(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	secret, counter, _ := enrollTestTOTP(t, s, alice.ID)
+	user, _ := s.GetUserByID(alice.ID)
+	info := SessionInfo{IPAddress: "203.0.113.9"}
+
+	// 连续 5 次错误后锁定，正确的验证码也不再接受
+	for i := 0; i < 5; i++ {
+		if err := s.checkMFACode(user, "000000", info); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("第 %d 次: 期望 %v，实际 %v", i+1, ErrInvalidMFACode, err)
+		}
+	}
+	err := s.checkMFACode(user, testTOTPCode(t, secret, counter+1), info)
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter <= 0 {
+		t.Fatalf("期望 ThrottledError，实际 %v", err)
+	}
+	if err := s.DisableTOTP(alice.ID, testTOTPCode(t, secret, counter+1), AuditContext{ActorID: alice.ID, SessionInfo: info}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("锁定期间关闭两步验证: 期望 %v，实际 %v", ErrTooManyAttempts, err)
+	}
+}
+
+func TestSatisfiesACR(t *testing.T) {
+	tests := []struct {
+		name     string
+		amr      []string
+		acr      []string
+		wantOK   bool // acr_values 中是否有支持的取值
+		wantPass bool
+	}{
+		{name: "密码满足单因素", amr: []string{AMRPassword}, acr: []string{ACRSingleFactor}, wantOK: true, wantPass: true},
+		{name: "密码不满足多因素", amr: []string{AMRPassword}, acr: []string{ACRMultiFactor}, wantOK: true},
+		{name: "两步验证满足多因素", amr: []string{AMRPassword, AMROTP, AMRMFA}, acr: []string{ACRMultiFactor}, wantOK: true, wantPass: true},
+		{name: "只有 otp 不算多因素", amr: []string{AMROTP}, acr: []string{ACRMultiFactor}, wantOK: true},
+		{name: "任一取值满足即可", amr: []string{AMRPassword}, acr: []string{ACRMultiFactor, ACRSingleFactor}, wantOK: true, wantPass: true},
+		{name: "忽略不支持的取值", amr: []string{AMRPassword}, acr: []string{"urn:unknown", ACRMultiFactor}, wantOK: true},
+		{name: "全部不支持", amr: []string{AMRPassword}, acr: []string{"urn:unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			required, ok := RequiredACR(tt.acr)
+			if ok != tt.wantOK {
+				t.Fatalf("RequiredACR ok = %v，期望 %v", ok, tt.wantOK)
+			}
+			if ok && SatisfiesACR(tt.amr, required) != tt.wantPass {
+				t.Fatalf("SatisfiesACR(%v, %s) = %v，期望 %v", tt.amr, required, !tt.wantPass, tt.wantPass)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ClientCredentials 客户端在 Token 端点出示的认证凭证
+type ClientCredentials struct {
+	ClientID     string              // 客户端ID
+	ClientSecret string              // 客户端密钥（client_secret_post）
+	Certificate  *x509.Certificate   // 双向 TLS 中客户端出示的证书（可为空）
+	Chain        []*x509.Certificate // 客户端证书之后一起出示的中间 CA 证书（可为空）
+	IPAddress    string              // 请求来源 IP（用于失败计数）
+}
+
+// EnableMutualTLS 启用 tls_client_auth 认证方式
+// clientCAs 为签发客户端证书的可信 CA
+func (s *OAuthService) EnableMutualTLS(clientCAs *x509.CertPool) {
+	s.clientCAs = clientCAs
+}
+
+// SetThrottle 设置认证失败计数器（客户端认证失败按客户端ID和 IP 计数）
+func (s *OAuthService) SetThrottle(throttle *Throttle) {
+	s.throttle = throttle
+}
+
+// AuthenticateClient 按客户端登记的认证方式验证客户端（RFC 6749 / RFC 8705）
+// 同一客户端ID或 IP 连续失败过多时暂时锁定，返回 *ThrottledError
+func (s *OAuthService) AuthenticateClient(creds ClientCredentials) (*models.OAuthClient, error) {
+	// 1. 检查客户端和 IP 是否因多次失败被锁定
+	if err := s.throttle.Check(map[string]string{
+		models.ThrottleKindClient: creds.ClientID,
+		models.ThrottleKindIP:     creds.IPAddress,
+	}); err != nil {
+		return nil, err
+	}
+
+	// 2. 验证凭证，失败时计数，成功时清零客户端的计数
+	client, err := s.verifyClientCredentials(creds)
+	if errors.Is(err, ErrInvalidClient) {
+		s.recordClientFailure(models.ThrottleKindClient, creds.ClientID)
+		s.recordClientFailure(models.ThrottleKindIP, creds.IPAddress)
+	} else if err == nil {
+		if err := s.throttle.Reset(models.ThrottleKindClient, creds.ClientID); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	return client, err
+}
+
+// recordClientFailure 记录一次客户端认证失败，开始锁定时写入日志
+func (s *OAuthService) recordClientFailure(kind, key string) {
+	locked, err := s.throttle.Fail(kind, key)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	if locked {
+		log.Printf("⚠️  客户端认证连续失败，已暂时锁定: %s=%s", kind, key)
+	}
+}
+
+// verifyClientCredentials 查询客户端并按登记的认证方式校验凭证
+func (s *OAuthService) verifyClientCredentials(creds ClientCredentials) (*models.OAuthClient, error) {
+	// 1. 查询客户端
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", creds.ClientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, fmt.Errorf("查询客户端失败: %w", err)
+	}
+	if !client.Live() {
+		return nil, ErrInvalidClient
+	}
+
+	// 2. 按认证方式校验凭证
+	switch client.AuthMethod() {
+	case models.AuthMethodClientSecretPost:
+		if creds.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(creds.ClientSecret), []byte(client.ClientSecret)) != 1 {
+			return nil, ErrInvalidClient
+		}
+	case models.AuthMethodTLSClientAuth:
+		if !s.verifyPKICertificate(&client, creds.Certificate, creds.Chain) {
+			return nil, ErrInvalidClient
+		}
+	case models.AuthMethodSelfSignedTLSClientAuth:
+		if !verifySelfSignedCertificate(&client, creds.Certificate) {
+			return nil, ErrInvalidClient
+		}
+	default:
+		return nil, ErrInvalidClient
+	}
+
+	return &client, nil
+}
+
+// verifyPKICertificate 校验 CA 签发的客户端证书，并比对登记的主题 DN
+// chain 为客户端一起出示的中间 CA 证书，用于构建到可信根 CA 的证书链
+func (s *OAuthService) verifyPKICertificate(client *models.OAuthClient, cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if cert == nil || s.clientCAs == nil || client.TLSClientAuthSubjectDN == "" {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range chain {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         s.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return false
+	}
+	return cert.Subject.String() == client.TLSClientAuthSubjectDN
+}
+
+// verifySelfSignedCertificate 校验客户端证书是否为预先登记的自签名证书
+func verifySelfSignedCertificate(client *models.OAuthClient, cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	thumbprint := CertificateThumbprint(cert)
+	rest := []byte(client.TLSClientCertificates)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return false
+		}
+		registered, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if CertificateThumbprint(registered) == thumbprint {
+			return true
+		}
+	}
+}
+
+// CertificateThumbprint 计算证书的 SHA-256 指纹（cnf 中的 x5t#S256），结果为 base64url 编码
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ClientCertificate 获取请求中客户端出示的 TLS 证书（未使用双向 TLS 时返回 nil）
+func ClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// ClientCertificateChain 获取客户端证书之后一起出示的中间 CA 证书（TLS 握手中的 PeerCertificates[1:]）
+func ClientCertificateChain(r *http.Request) []*x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) < 2 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[1:]
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// testCert 测试用的证书及其私钥
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert 签发测试证书，parent 为空时生成自签名证书
+func newTestCert(t *testing.T, cn string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("生成序列号失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	issuerCert, issuerKey := template, key
+	if parent != nil {
+		issuerCert, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuerCert, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("解析证书失败: %v", err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// pem 证书的 PEM 编码
+func (c *testCert) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+}
+
+func TestAuthenticateClientMutualTLS(t *testing.T) {
+	root := newTestCert(t, "Test Root CA", true, nil)
+	intermediate := newTestCert(t, "Test Intermediate CA", true, root)
+	leaf := newTestCert(t, "app.example.com", false, root)
+	chained := newTestCert(t, "chained.example.com", false, intermediate)
+	untrusted := newTestCert(t, "app.example.com", false, newTestCert(t, "Other CA", true, nil))
+	selfSigned := newTestCert(t, "self.example.com", false, nil)
+	otherSelfSigned := newTestCert(t, "self.example.com", false, nil)
+
+	tests := []struct {
+		name    string
+		client  models.OAuthClient
+		creds   ClientCredentials
+		wantErr bool
+	}{
+		{
+			name:   "tls_client_auth 根 CA 签发且主题 DN 一致",
+			client: models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: leaf.cert.Subject.String()},
+			creds:  ClientCredentials{Certificate: leaf.cert},
+		},
+		{
+			name:   "tls_client_auth 通过出示的中间 CA 构建证书链",
+			client: models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: chained.cert.Subject.String()},
+			creds:  ClientCredentials{Certificate: chained.cert, Chain: []*x509.Certificate{intermediate.cert}},
+		},
+		{
+			name:    "tls_client_auth 缺少中间 CA",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: chained.cert.Subject.String()},
+			creds:   ClientCredentials{Certificate: chained.cert},
+			wantErr: true,
+		},
+		{
+			name:    "tls_client_auth 主题 DN 不一致",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: "CN=other.example.com,O=Example"},
+			creds:   ClientCredentials{Certificate: leaf.cert},
+			wantErr: true,
+		},
+		{
+			name:    "tls_client_auth 不受信任的 CA",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: untrusted.cert.Subject.String()},
+			creds:   ClientCredentials{Certificate: untrusted.cert},
+			wantErr: true,
+		},
+		{
+			name:    "tls_client_auth 没有出示证书",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: leaf.cert.Subject.String()},
+			wantErr: true,
+		},
+		{
+			name:   "self_signed_tls_client_auth 已登记的证书",
+			client: models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodSelfSignedTLSClientAuth, TLSClientCertificates: otherSelfSigned.pem() + selfSigned.pem()},
+			creds:  ClientCredentials{Certificate: selfSigned.cert},
+		},
+		{
+			name:    "self_signed_tls_client_auth 主题相同但指纹不同",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodSelfSignedTLSClientAuth, TLSClientCertificates: otherSelfSigned.pem()},
+			creds:   ClientCredentials{Certificate: selfSigned.cert},
+			wantErr: true,
+		},
+		{
+			name:    "self_signed_tls_client_auth 没有出示证书",
+			client:  models.OAuthClient{TokenEndpointAuthMethod: models.AuthMethodSelfSignedTLSClientAuth, TLSClientCertificates: selfSigned.pem()},
+			wantErr: true,
+		},
+		{
+			name:    "client_secret_post 不接受证书代替密钥",
+			client:  models.OAuthClient{ClientSecret: "secret"},
+			creds:   ClientCredentials{Certificate: leaf.cert},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := NewOAuthService(testSecret, 1, testIssuer)
+			roots := x509.NewCertPool()
+			roots.AddCert(root.cert)
+			s.EnableMutualTLS(roots)
+
+			client := tt.client
+			client.ClientID, client.Name, client.RedirectURI = "mtls_client", "mTLS App", "https://app.example.com/callback"
+			if client.ClientSecret == "" {
+				client.ClientSecret = "unused"
+			}
+			if err := database.DB.Create(&client).Error; err != nil {
+				t.Fatalf("创建客户端失败: %v", err)
+			}
+
+			creds := tt.creds
+			creds.ClientID, creds.IPAddress = client.ClientID, "192.0.2.1"
+			_, err := s.AuthenticateClient(creds)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidClient) {
+					t.Fatalf("期望错误 %v，实际 %v", ErrInvalidClient, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("认证失败: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateResourceRequestCertificateBinding(t *testing.T) {
+	newTestDB(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	cert := newTestCert(t, "app.example.com", false, nil)
+	other := newTestCert(t, "app.example.com", false, nil)
+
+	accessToken := &models.AccessToken{
+		ClientID:  "test_client",
+		UserID:    1,
+		X5tS256:   CertificateThumbprint(cert.cert),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	token, err := s.GenerateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("生成 Access Token 失败: %v", err)
+	}
+	accessToken.Token = token
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		t.Fatalf("保存 Access Token 失败: %v", err)
+	}
+
+	// Token 中的 cnf 声明携带证书指纹
+	claims, err := s.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("验证 Token 失败: %v", err)
+	}
+	if claims.Binding.X5tS256 != CertificateThumbprint(cert.cert) {
+		t.Fatalf("cnf.x5t#S256 = %q，期望 %q", claims.Binding.X5tS256, CertificateThumbprint(cert.cert))
+	}
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr error
+	}{
+		{name: "通过同一证书出示", cert: cert.cert},
+		{name: "通过其他证书出示", cert: other.cert, wantErr: ErrTokenBindingMismatch},
+		{name: "没有出示证书", wantErr: ErrTokenBindingMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.AuthenticateResourceRequest(ResourceRequest{Scheme: "Bearer", Token: token, Certificate: tt.cert})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+		})
+	}
+}
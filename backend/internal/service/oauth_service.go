@@ -2,12 +2,17 @@ package service
 
 import (
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
 	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
@@ -22,35 +27,110 @@ var (
 	ErrInvalidAuthorizationCode = errors.New("无效或已过期的授权码")
 	// ErrAuthorizationCodeUsed 授权码已使用
 	ErrAuthorizationCodeUsed = errors.New("授权码已被使用")
+	// ErrUnauthorizedClient 客户端不允许使用该授权类型
+	ErrUnauthorizedClient = errors.New("客户端不允许使用该授权类型")
 )
 
 // OAuthService OAuth 服务
 type OAuthService struct {
-	jwtSecret string        // JWT 签名密钥
-	jwtExpire time.Duration // Token 过期时间
+	issuer     string           // 签发者标识（RFC 9207 / RFC 8414）
+	jwtSecret  string           // JWT 签名密钥
+	jwtExpire  time.Duration    // Token 过期时间
+	dpopReplay *dpopReplayCache // 已使用的 DPoP 证明（防重放）
+	clientCAs  *x509.CertPool   // 签发客户端证书的可信 CA（tls_client_auth）
+	signingKey *SigningKey      // ID Token 和注销 Token 的签名密钥
+	httpClient *http.Client     // 发送后端通道注销通知
+	throttle   *Throttle        // 客户端认证失败计数
+	mailer     mail.Mailer      // 邮件发送器（客户端协作邀请）
+	developer  DeveloperPolicy  // 开发者自助注册客户端的规则
 }
 
 // NewOAuthService 创建 OAuth 服务实例
-func NewOAuthService(jwtSecret string, expireHours int) *OAuthService {
+func NewOAuthService(jwtSecret string, expireHours int, issuer string) *OAuthService {
 	return &OAuthService{
-		jwtSecret: jwtSecret,
-		jwtExpire: time.Duration(expireHours) * time.Hour,
+		issuer:     issuer,
+		jwtSecret:  jwtSecret,
+		jwtExpire:  time.Duration(expireHours) * time.Hour,
+		dpopReplay: newDPoPReplayCache(),
+		httpClient: newBackchannelClient(false),
+		throttle:   DefaultThrottle(),
+		mailer:     mail.NewLogMailer(),
+		developer:  DeveloperPolicy{MaxClients: defaultMaxDeveloperClients},
 	}
 }
 
-// ValidateClient 验证客户端（简化版：只验证 client_id 和 client_secret）
-func (s *OAuthService) ValidateClient(clientID, clientSecret string) (*models.OAuthClient, error) {
-	var client models.OAuthClient
-	
-	// 查询客户端
-	if err := database.DB.Where("client_id = ? AND client_secret = ?", clientID, clientSecret).First(&client).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrInvalidClient
+// Issuer 返回授权服务器的签发者标识
+func (s *OAuthService) Issuer() string {
+	return s.issuer
+}
+
+// TokenBinding Token 绑定信息（发送方约束令牌）
+type TokenBinding struct {
+	JKT     string // DPoP 公钥指纹（cnf.jkt）
+	X5tS256 string // 客户端证书指纹（cnf.x5t#S256）
+}
+
+// IsBound 是否绑定了密钥
+func (b TokenBinding) IsBound() bool {
+	return b.JKT != "" || b.X5tS256 != ""
+}
+
+// claims 生成 JWT 中的 cnf 声明
+func (b TokenBinding) claims() map[string]string {
+	cnf := map[string]string{}
+	if b.JKT != "" {
+		cnf["jkt"] = b.JKT
+	}
+	if b.X5tS256 != "" {
+		cnf["x5t#S256"] = b.X5tS256
+	}
+	return cnf
+}
+
+// AccessTokenClaims Access Token 中携带的信息
+type AccessTokenClaims struct {
+	UserID    uint     // 用户ID
+	ClientID  string   // 客户端ID
+	Scope     string   // 权限范围（空格分隔）
+	Audience  []string // 受众（可使用该 Token 的资源，RFC 8707）
+	Details   string   // 授权详情（JSON 数组，RFC 9396）
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Binding   TokenBinding
+}
+
+// HasAudience 检查 Token 是否签发给指定资源
+func (c *AccessTokenClaims) HasAudience(resource string) bool {
+	for _, aud := range c.Audience {
+		if aud == resource {
+			return true
 		}
-		return nil, fmt.Errorf("查询客户端失败: %w", err)
 	}
-	
-	return &client, nil
+	return false
+}
+
+// AuthorizationGrant 用户授权的内容，用于生成授权码
+type AuthorizationGrant struct {
+	ClientID             string   // 客户端ID
+	UserID               uint     // 用户ID
+	RedirectURI          string   // 重定向URI
+	Scope                string   // 授权的权限范围
+	Resources            []string // 授权访问的资源（RFC 8707）
+	AuthorizationDetails string   // 授权详情（已校验并规范化的 JSON 数组，RFC 9396）
+	Nonce                string    // OIDC nonce
+	SessionID            string    // 用户授权时的登录会话（sid）
+	AuthTime             time.Time // 用户完成认证的时间
+	ACR                  string    // 用户授权时达到的认证级别
+	AMR                  []string  // 用户授权时的认证方式
+}
+
+// CodeExchangeRequest 用授权码交换 Access Token 的请求
+type CodeExchangeRequest struct {
+	Code        string            // 授权码
+	RedirectURI string            // 重定向URI（必须与授权时一致）
+	Client      ClientCredentials // 客户端认证凭证
+	Resources   []string          // 本次 Token 的目标资源，为空时使用授权时的全部资源
+	Binding     TokenBinding      // 非空时签发的 Token 将绑定到对应密钥（DPoP 或客户端证书）
 }
 
 // ValidateClientID 只验证客户端ID（用于授权页面，不需要密钥）
@@ -63,13 +143,16 @@ func (s *OAuthService) ValidateClientID(clientID string) (*models.OAuthClient, e
 		}
 		return nil, fmt.Errorf("查询客户端失败: %w", err)
 	}
+	if !client.Live() {
+		return nil, ErrInvalidClient
+	}
 	
 	return &client, nil
 }
 
-// ValidateRedirectURI 验证重定向URI是否匹配
+// ValidateRedirectURI 验证重定向URI是否与登记的某个地址完全一致
 func (s *OAuthService) ValidateRedirectURI(client *models.OAuthClient, redirectURI string) error {
-	if client.RedirectURI != redirectURI {
+	if !contains(client.RedirectURIs(), redirectURI) {
 		return ErrInvalidRedirectURI
 	}
 	return nil
@@ -77,7 +160,7 @@ func (s *OAuthService) ValidateRedirectURI(client *models.OAuthClient, redirectU
 
 // GenerateAuthorizationCode 生成授权码
 // 授权码是临时的一次性令牌，用于交换 Access Token
-func (s *OAuthService) GenerateAuthorizationCode(clientID string, userID uint, redirectURI string) (string, error) {
+func (s *OAuthService) GenerateAuthorizationCode(grant AuthorizationGrant) (string, error) {
 	// 1. 生成随机授权码（32字节，64个十六进制字符）
 	codeBytes := make([]byte, 32)
 	if _, err := rand.Read(codeBytes); err != nil {
@@ -87,12 +170,20 @@ func (s *OAuthService) GenerateAuthorizationCode(clientID string, userID uint, r
 	
 	// 2. 创建授权码记录（有效期10分钟）
 	authCode := &models.AuthorizationCode{
-		Code:        code,
-		ClientID:    clientID,
-		UserID:      userID,
-		RedirectURI: redirectURI,
-		ExpiresAt:   time.Now().Add(10 * time.Minute), // 10分钟过期
-		Used:        false,
+		Code:                 code,
+		ClientID:             grant.ClientID,
+		UserID:               grant.UserID,
+		RedirectURI:          grant.RedirectURI,
+		Scope:                grant.Scope,
+		Resource:             JoinScope(grant.Resources),
+		AuthorizationDetails: grant.AuthorizationDetails,
+		Nonce:                grant.Nonce,
+		SessionID:            grant.SessionID,
+		AuthTime:             grant.AuthTime,
+		ACR:                  grant.ACR,
+		AMR:                  strings.Join(grant.AMR, " "),
+		ExpiresAt:            time.Now().Add(10 * time.Minute), // 10分钟过期
+		Used:                 false,
 	}
 	
 	// 3. 保存到数据库
@@ -105,21 +196,25 @@ func (s *OAuthService) GenerateAuthorizationCode(clientID string, userID uint, r
 
 // ExchangeAuthorizationCode 用授权码交换 Access Token
 // 这是 OAuth 2.0 的核心步骤：授权码 → Access Token
-func (s *OAuthService) ExchangeAuthorizationCode(code, clientID, clientSecret, redirectURI string) (*models.AccessToken, error) {
+func (s *OAuthService) ExchangeAuthorizationCode(req CodeExchangeRequest) (*models.AccessToken, error) {
 	// 1. 验证客户端
-	client, err := s.ValidateClient(clientID, clientSecret)
+	client, err := s.AuthenticateClient(req.Client)
 	if err != nil {
 		return nil, err
 	}
+	clientID := client.ClientID
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return nil, ErrUnauthorizedClient
+	}
 	
 	// 2. 验证重定向URI
-	if err := s.ValidateRedirectURI(client, redirectURI); err != nil {
+	if err := s.ValidateRedirectURI(client, req.RedirectURI); err != nil {
 		return nil, err
 	}
 	
 	// 3. 查找授权码
 	var authCode models.AuthorizationCode
-	if err := database.DB.Where("code = ? AND client_id = ?", code, clientID).First(&authCode).Error; err != nil {
+	if err := database.DB.Where("code = ? AND client_id = ?", req.Code, clientID).First(&authCode).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrInvalidAuthorizationCode
 		}
@@ -134,40 +229,86 @@ func (s *OAuthService) ExchangeAuthorizationCode(code, clientID, clientSecret, r
 		return nil, ErrInvalidAuthorizationCode
 	}
 	
-	// 5. 标记授权码为已使用（授权码只能使用一次）
+	// 5. 确定 Token 的受众和权限范围（只能是授权时资源的子集）
+	audience, scope, err := s.narrowToResources(&authCode, req.Resources)
+	if err != nil {
+		return nil, err
+	}
+	
+	// 6. 标记授权码为已使用（授权码只能使用一次）
 	authCode.Used = true
 	database.DB.Save(&authCode)
 	
-	// 6. 生成 Access Token（JWT格式）
-	tokenString, err := s.GenerateAccessToken(authCode.UserID, clientID)
+	// 7. 签发 Access Token（请求了 openid 权限时同时签发 ID Token）
+	return s.issueAccessToken(client, &authCode, audience, scope, req.Binding)
+}
+
+// issueAccessToken 按用户的授权签发 Access Token，授权包含 openid 权限时同时签发 ID Token（OIDC）
+// grant 为授权码，或由设备授权转换而来的等价记录；audience 和 scope 为已收窄到目标资源的受众和权限范围
+func (s *OAuthService) issueAccessToken(client *models.OAuthClient, grant *models.AuthorizationCode, audience []string, scope string, binding TokenBinding) (*models.AccessToken, error) {
+	// 1. 生成 Access Token（JWT格式）
+	accessToken := &models.AccessToken{
+		ClientID:             client.ClientID,
+		UserID:               grant.UserID,
+		Scope:                scope,
+		Audience:             JoinScope(audience),
+		AuthorizationDetails: grant.AuthorizationDetails,
+		JKT:                  binding.JKT,
+		X5tS256:              binding.X5tS256,
+		ACR:                  grant.ACR,
+		AMR:                  grant.AMR,
+		ExpiresAt:            time.Now().Add(s.accessTokenLifetime(client)),
+	}
+	if !grant.AuthTime.IsZero() {
+		authTime := grant.AuthTime
+		accessToken.AuthTime = &authTime
+	}
+	tokenString, err := s.GenerateAccessToken(accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("生成 Access Token 失败: %w", err)
 	}
+	accessToken.Token = tokenString
 	
-	// 7. 保存 Access Token 到数据库
-	accessToken := &models.AccessToken{
-		Token:     tokenString,
-		ClientID:  clientID,
-		UserID:    authCode.UserID,
-		ExpiresAt: time.Now().Add(s.jwtExpire),
-	}
-	
+	// 2. 保存 Access Token 到数据库
 	if err := database.DB.Create(accessToken).Error; err != nil {
 		return nil, fmt.Errorf("保存 Access Token 失败: %w", err)
 	}
 	
+	// 3. 请求了 openid 权限时同时签发 ID Token（OIDC）
+	if contains(ParseScope(grant.Scope), ScopeOpenID) {
+		idToken, err := s.GenerateIDToken(client, grant, tokenString)
+		if err != nil {
+			return nil, fmt.Errorf("生成 ID Token 失败: %w", err)
+		}
+		accessToken.IDToken = idToken
+	}
+	
 	return accessToken, nil
 }
 
 // GenerateAccessToken 生成 Access Token（JWT格式）
-func (s *OAuthService) GenerateAccessToken(userID uint, clientID string) (string, error) {
+func (s *OAuthService) GenerateAccessToken(at *models.AccessToken) (string, error) {
 	// 创建 JWT Claims
 	claims := jwt.MapClaims{
-		"user_id":  userID,                                    // 用户ID
-		"client_id": clientID,                                // 客户端ID
-		"exp":      time.Now().Add(s.jwtExpire).Unix(),       // 过期时间
-		"iat":      time.Now().Unix(),                         // 签发时间
-		"type":     "oauth_access_token",                       // Token类型标识
+		"iss":       s.issuer,             // 签发者
+		"user_id":   at.UserID,            // 用户ID
+		"client_id": at.ClientID,          // 客户端ID
+		"exp":       at.ExpiresAt.Unix(),  // 过期时间
+		"iat":       time.Now().Unix(),    // 签发时间
+		"type":      "oauth_access_token", // Token类型标识
+	}
+	if at.Scope != "" {
+		claims["scope"] = at.Scope // 权限范围
+	}
+	if audience := ParseScope(at.Audience); len(audience) > 0 {
+		claims["aud"] = audience // 受众（RFC 8707）
+	}
+	if at.AuthorizationDetails != "" {
+		claims["authorization_details"] = json.RawMessage(at.AuthorizationDetails) // 授权详情（RFC 9396）
+	}
+	binding := TokenBinding{JKT: at.JKT, X5tS256: at.X5tS256}
+	if binding.IsBound() {
+		claims["cnf"] = binding.claims() // 绑定的密钥指纹
 	}
 	
 	// 创建并签名 Token
@@ -181,7 +322,7 @@ func (s *OAuthService) GenerateAccessToken(userID uint, clientID string) (string
 }
 
 // ValidateAccessToken 验证 Access Token
-func (s *OAuthService) ValidateAccessToken(tokenString string) (uint, string, error) {
+func (s *OAuthService) ValidateAccessToken(tokenString string) (*AccessTokenClaims, error) {
 	// 解析 Token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// 验证签名方法
@@ -189,48 +330,125 @@ func (s *OAuthService) ValidateAccessToken(tokenString string) (uint, string, er
 			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
 		}
 		return []byte(s.jwtSecret), nil
-	})
+	}, jwt.WithIssuer(s.issuer))
 	
 	if err != nil {
-		return 0, "", fmt.Errorf("Token 解析失败: %w", err)
+		return nil, fmt.Errorf("Token 解析失败: %w", err)
 	}
 	
 	// 提取 Claims
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		// 检查 Token 类型
 		if tokenType, ok := claims["type"].(string); !ok || tokenType != "oauth_access_token" {
-			return 0, "", errors.New("无效的 Token 类型")
+			return nil, errors.New("无效的 Token 类型")
 		}
 		
 		// 提取用户ID和客户端ID
 		userID, ok := claims["user_id"].(float64)
 		if !ok {
-			return 0, "", errors.New("Token 中缺少 user_id")
+			return nil, errors.New("Token 中缺少 user_id")
 		}
 		
 		clientID, ok := claims["client_id"].(string)
 		if !ok {
-			return 0, "", errors.New("Token 中缺少 client_id")
+			return nil, errors.New("Token 中缺少 client_id")
 		}
 		
-		return uint(userID), clientID, nil
+		result := &AccessTokenClaims{
+			UserID:   uint(userID),
+			ClientID: clientID,
+		}
+		result.Scope, _ = claims["scope"].(string)
+		if aud, err := claims.GetAudience(); err == nil {
+			result.Audience = aud
+		}
+		if details, ok := claims["authorization_details"]; ok {
+			raw, _ := json.Marshal(details)
+			result.Details = string(raw)
+		}
+		if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+			result.IssuedAt = iat.Time
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			result.ExpiresAt = exp.Time
+		}
+		
+		// 提取绑定信息（发送方约束令牌）
+		if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+			result.Binding.JKT, _ = cnf["jkt"].(string)
+			result.Binding.X5tS256, _ = cnf["x5t#S256"].(string)
+		}
+		
+		return result, nil
 	}
 	
-	return 0, "", errors.New("无效的 Token")
+	return nil, errors.New("无效的 Token")
 }
 
-// GetUserInfo 使用 Access Token 获取用户信息
-// 这是 OAuth 的典型用法：第三方应用使用 Token 访问用户资源
-func (s *OAuthService) GetUserInfo(tokenString string) (*models.User, error) {
-	// 1. 验证 Token
-	userID, _, err := s.ValidateAccessToken(tokenString)
+// ResourceRequest 访问受保护资源的请求
+type ResourceRequest struct {
+	Scheme      string            // Authorization 头的认证方案（Bearer 或 DPoP）
+	Token       string            // Access Token
+	DPoPProof   string            // DPoP 请求头
+	Method      string            // 请求方法
+	URL         string            // 请求地址（不含查询参数）
+	Certificate *x509.Certificate // 双向 TLS 中客户端出示的证书（可为空）
+	Audience    string            // 当前资源的标识，非空时 Token 必须签发给该资源
+}
+
+// AuthenticateResourceRequest 验证访问受保护资源的请求
+// 除校验 Token 本身外，还会校验发送方约束令牌的绑定关系
+func (s *OAuthService) AuthenticateResourceRequest(req ResourceRequest) (*AccessTokenClaims, error) {
+	// 1. 验证 Token，并确认 Token 未被撤销（重置密码等操作会撤销用户的所有 Token）
+	claims, err := s.ValidateAccessToken(req.Token)
 	if err != nil {
 		return nil, err
 	}
+	if err := database.DB.Where("token = ?", req.Token).First(&models.AccessToken{}).Error; err != nil {
+		return nil, errors.New("Token 已被撤销")
+	}
 	
-	// 2. 查询用户信息
+	// 2. 资源只接受签发给自己的 Token（RFC 8707）
+	if req.Audience != "" && !claims.HasAudience(req.Audience) {
+		return nil, fmt.Errorf("%w: Token 不是签发给当前资源的", ErrInvalidTarget)
+	}
+	
+	// 3. 证书绑定的 Token 必须通过同一证书建立的 TLS 连接出示（RFC 8705）
+	if claims.Binding.X5tS256 != "" {
+		if req.Certificate == nil || CertificateThumbprint(req.Certificate) != claims.Binding.X5tS256 {
+			return nil, fmt.Errorf("%w: 客户端证书不匹配", ErrTokenBindingMismatch)
+		}
+	}
+	
+	// 4. 普通 Bearer Token 不能以 DPoP 方案出示
+	isDPoP := strings.EqualFold(req.Scheme, "DPoP")
+	if claims.Binding.JKT == "" {
+		if isDPoP {
+			return nil, fmt.Errorf("%w: Token 未绑定 DPoP 密钥", ErrTokenBindingMismatch)
+		}
+		return claims, nil
+	}
+	
+	// 5. DPoP 绑定的 Token 必须以 DPoP 方案出示，并附带对应密钥签名的证明
+	if !isDPoP {
+		return nil, fmt.Errorf("%w: DPoP 绑定的 Token 不能作为 Bearer Token 使用", ErrTokenBindingMismatch)
+	}
+	proof, err := s.ValidateDPoPProof(req.DPoPProof, req.Method, req.URL, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if proof.JKT != claims.Binding.JKT {
+		return nil, fmt.Errorf("%w: DPoP 密钥不匹配", ErrTokenBindingMismatch)
+	}
+	
+	return claims, nil
+}
+
+// GetUserInfo 获取 Access Token 对应的用户信息
+// 这是 OAuth 的典型用法：第三方应用使用 Token 访问用户资源
+func (s *OAuthService) GetUserInfo(claims *AccessTokenClaims) (*models.User, error) {
 	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.First(&user, claims.UserID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
 		}
@@ -239,4 +457,3 @@ func (s *OAuthService) GetUserInfo(tokenString string) (*models.User, error) {
 	
 	return &user, nil
 }
-
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedPasswordHash 无法识别的密码哈希格式
+var ErrUnsupportedPasswordHash = errors.New("不支持的密码哈希格式")
+
+// 密码哈希算法
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// Argon2Params argon2id 参数
+type Argon2Params struct {
+	Memory      uint32 // 内存（KiB）
+	Iterations  uint32 // 迭代次数
+	Parallelism uint8  // 并行度
+	SaltLength  uint32 // 盐长度（字节）
+	KeyLength   uint32 // 哈希长度（字节）
+}
+
+// PasswordHasher 密码哈希器
+// 哈希值自带算法和参数（argon2id 使用 PHC 格式 $argon2id$v=19$m=...,t=...,p=...$盐$哈希，bcrypt 使用 $2a$ 格式），
+// 因此可以验证任何算法生成的旧哈希，并判断是否需要用当前配置重新计算
+type PasswordHasher struct {
+	Algorithm  string       // 新密码使用的算法：argon2id 或 bcrypt
+	BcryptCost int          // bcrypt 的 cost
+	Argon2     Argon2Params // argon2id 的参数
+
+	dummyOnce sync.Once // 延迟生成 dummy
+	dummy     string    // 用于 VerifyDummy 的哈希（当前配置）
+}
+
+// DefaultPasswordHasher 默认密码哈希器（argon2id，参数参考 OWASP 建议：19 MiB 内存、2 次迭代、1 个线程）
+func DefaultPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm:  PasswordHashArgon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+// Validate 检查配置是否有效
+func (h *PasswordHasher) Validate() error {
+	switch h.Algorithm {
+	case PasswordHashArgon2id:
+		p := h.Argon2
+		if p.Memory < 8*uint32(p.Parallelism) || p.Iterations < 1 || p.Parallelism < 1 || p.SaltLength < 8 || p.KeyLength < 16 {
+			return fmt.Errorf("argon2id 参数无效: m=%d, t=%d, p=%d", p.Memory, p.Iterations, p.Parallelism)
+		}
+	case PasswordHashBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost 必须在 %d 到 %d 之间", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("不支持的密码哈希算法: %s", h.Algorithm)
+	}
+	return nil
+}
+
+// Hash 使用当前配置计算密码哈希
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == PasswordHashBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("密码加密失败: %w", err)
+		}
+		return string(hashed), nil
+	}
+
+	p := h.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("生成盐失败: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify 验证密码是否与哈希匹配
+// 匹配时 needsRehash 表示哈希使用的算法或参数与当前配置不同，应该用 Hash 重新计算并保存
+func (h *PasswordHasher) Verify(password, encoded string) (ok bool, needsRehash bool, err error) {
+	// 1. bcrypt
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+		}
+		return true, h.Algorithm != PasswordHashBcrypt || cost != h.BcryptCost, nil
+	}
+
+	// 2. argon2id
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false, nil
+	}
+	return true, h.Algorithm != PasswordHashArgon2id || params != h.Argon2, nil
+}
+
+// VerifyDummy 执行一次与验证真实密码开销相同的计算（结果丢弃）
+// 账户不存在时调用，使响应时间与密码错误时一致，避免通过响应时间判断邮箱是否注册
+func (h *PasswordHasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.Hash("dummy-password")
+	})
+	h.Verify(password, h.dummy)
+}
+
+// decodeArgon2id 解析 PHC 格式的 argon2id 哈希
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != PasswordHashArgon2id {
+		return params, nil, nil, ErrUnsupportedPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2 版本 %s", ErrUnsupportedPasswordHash, parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnsupportedPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
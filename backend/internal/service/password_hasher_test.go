@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params 测试使用的较小的 argon2id 参数
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherValidate(t *testing.T) {
+	argon2 := func(mutate func(p *Argon2Params)) *PasswordHasher {
+		p := testArgon2Params
+		mutate(&p)
+		return &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: p}
+	}
+	tests := []struct {
+		name    string
+		hasher  *PasswordHasher
+		wantErr bool
+	}{
+		{name: "默认配置", hasher: DefaultPasswordHasher()},
+		{name: "bcrypt 最低 cost", hasher: &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost}},
+		{name: "bcrypt cost 过低", hasher: &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost - 1}, wantErr: true},
+		{name: "bcrypt cost 过高", hasher: &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MaxCost + 1}, wantErr: true},
+		{name: "argon2id 测试参数", hasher: argon2(func(p *Argon2Params) {})},
+		{name: "argon2id 内存不足", hasher: argon2(func(p *Argon2Params) { p.Memory = 4 }), wantErr: true},
+		{name: "argon2id 内存少于 8 倍并行度", hasher: argon2(func(p *Argon2Params) { p.Memory, p.Parallelism = 16, 4 }), wantErr: true},
+		{name: "argon2id 迭代次数为 0", hasher: argon2(func(p *Argon2Params) { p.Iterations = 0 }), wantErr: true},
+		{name: "argon2id 并行度为 0", hasher: argon2(func(p *Argon2Params) { p.Parallelism = 0 }), wantErr: true},
+		{name: "argon2id 盐过短", hasher: argon2(func(p *Argon2Params) { p.SaltLength = 4 }), wantErr: true},
+		{name: "argon2id 哈希过短", hasher: argon2(func(p *Argon2Params) { p.KeyLength = 8 }), wantErr: true},
+		{name: "不支持的算法", hasher: &PasswordHasher{Algorithm: "md5"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hasher.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v，期望出错: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if err := newTestAuthService(t).SetPasswordHasher(tt.hasher); err == nil {
+					t.Fatal("SetPasswordHasher 应拒绝无效的配置")
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	argon2 := &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: testArgon2Params}
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	argon2Stronger := &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: stronger}
+	bcryptMin := &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost}
+	bcryptHigher := &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost + 1}
+
+	hash := func(h *PasswordHasher) string {
+		encoded, err := h.Hash(testPassword)
+		if err != nil {
+			t.Fatalf("计算哈希失败: %v", err)
+		}
+		return encoded
+	}
+	argon2Hash := hash(argon2)
+	bcryptHash := hash(bcryptMin)
+	if !strings.HasPrefix(argon2Hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("argon2id 哈希格式不正确: %s", argon2Hash)
+	}
+	if argon2Hash == hash(argon2) {
+		t.Fatal("相同密码的两次哈希应使用不同的盐")
+	}
+
+	tests := []struct {
+		name        string
+		hasher      *PasswordHasher
+		password    string
+		encoded     string
+		wantOK      bool
+		wantRehash  bool
+		wantErrKind error
+	}{
+		{name: "argon2id 正确密码", hasher: argon2, password: testPassword, encoded: argon2Hash, wantOK: true},
+		{name: "argon2id 错误密码", hasher: argon2, password: "wrong", encoded: argon2Hash},
+		{name: "argon2id 参数变化后需要重新计算", hasher: argon2Stronger, password: testPassword, encoded: argon2Hash, wantOK: true, wantRehash: true},
+		{name: "argon2id 参数变化后错误密码不需要重新计算", hasher: argon2Stronger, password: "wrong", encoded: argon2Hash},
+		{name: "bcrypt 正确密码", hasher: bcryptMin, password: testPassword, encoded: bcryptHash, wantOK: true},
+		{name: "bcrypt 错误密码", hasher: bcryptMin, password: "wrong", encoded: bcryptHash},
+		{name: "bcrypt cost 变化后需要重新计算", hasher: bcryptHigher, password: testPassword, encoded: bcryptHash, wantOK: true, wantRehash: true},
+		{name: "配置改为 argon2id 后 bcrypt 哈希需要重新计算", hasher: argon2, password: testPassword, encoded: bcryptHash, wantOK: true, wantRehash: true},
+		{name: "配置改为 bcrypt 后 argon2id 哈希需要重新计算", hasher: bcryptMin, password: testPassword, encoded: argon2Hash, wantOK: true, wantRehash: true},
+		{name: "无法识别的格式", hasher: argon2, password: testPassword, encoded: "plaintext", wantErrKind: ErrUnsupportedPasswordHash},
+		{name: "不支持的 argon2 版本", hasher: argon2, password: testPassword, encoded: strings.Replace(argon2Hash, "v=19", "v=16", 1), wantErrKind: ErrUnsupportedPasswordHash},
+		{name: "损坏的 argon2id 参数", hasher: argon2, password: testPassword, encoded: strings.Replace(argon2Hash, "m=64", "m=x", 1), wantErrKind: ErrUnsupportedPasswordHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.hasher.Verify(tt.password, tt.encoded)
+			if tt.wantErrKind != nil {
+				if ok || !errors.Is(err, tt.wantErrKind) {
+					t.Fatalf("Verify = (%v, %v)，期望错误 %v", ok, err, tt.wantErrKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("验证失败: %v", err)
+			}
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Fatalf("Verify = (%v, %v)，期望 (%v, %v)", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		old        *PasswordHasher // 注册时的配置
+		current    *PasswordHasher // 登录时的配置
+		password   string
+		wantPrefix string // 登录后数据库中哈希的前缀
+		wantRehash bool
+	}{
+		{
+			name:       "bcrypt 升级为 argon2id",
+			old:        &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost},
+			current:    &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: testArgon2Params},
+			password:   testPassword,
+			wantPrefix: "$argon2id$v=19$m=64,t=1,p=1$",
+			wantRehash: true,
+		},
+		{
+			name:       "提高 bcrypt cost",
+			old:        &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost},
+			current:    &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost + 1},
+			password:   testPassword,
+			wantPrefix: "$2a$05$",
+			wantRehash: true,
+		},
+		{
+			name:       "配置未变化时不重新计算",
+			old:        &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: testArgon2Params},
+			current:    &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: testArgon2Params},
+			password:   testPassword,
+			wantPrefix: "$argon2id$",
+		},
+		{
+			name:       "密码错误时不重新计算",
+			old:        &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost},
+			current:    &PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2: testArgon2Params},
+			password:   "wrong-password",
+			wantPrefix: "$2a$04$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			if err := s.SetPasswordHasher(tt.old); err != nil {
+				t.Fatalf("设置密码哈希器失败: %v", err)
+			}
+			alice := createTestUser(t, s, "alice@example.com")
+			if err := s.SetPasswordHasher(tt.current); err != nil {
+				t.Fatalf("设置密码哈希器失败: %v", err)
+			}
+
+			_, err := s.Login(LoginRequest{Email: alice.Email, Password: tt.password})
+			if (err == nil) != (tt.password == testPassword) {
+				t.Fatalf("登录结果不正确: %v", err)
+			}
+			var user models.User
+			database.DB.First(&user, alice.ID)
+			if !strings.HasPrefix(user.Password, tt.wantPrefix) {
+				t.Fatalf("登录后的哈希 %s 不以 %s 开头", user.Password, tt.wantPrefix)
+			}
+			if rehashed := user.Password != alice.Password; rehashed != tt.wantRehash {
+				t.Fatalf("重新计算哈希: %v，期望 %v", rehashed, tt.wantRehash)
+			}
+
+			// 升级后的哈希仍然可以登录，且不再需要重新计算
+			if tt.password == testPassword {
+				if _, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword}); err != nil {
+					t.Fatalf("升级后登录失败: %v", err)
+				}
+				var again models.User
+				database.DB.First(&again, alice.ID)
+				if again.Password != user.Password {
+					t.Fatal("第二次登录不应再次重新计算哈希")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 密码规则标识（出现在错误响应的 violations 中）
+const (
+	PasswordRuleMinLength    = "min_length"    // 长度不足
+	PasswordRuleMaxLength    = "max_length"    // 超过最大长度
+	PasswordRuleUppercase    = "uppercase"     // 缺少大写字母
+	PasswordRuleLowercase    = "lowercase"     // 缺少小写字母
+	PasswordRuleDigit        = "digit"         // 缺少数字
+	PasswordRuleSymbol       = "symbol"        // 缺少特殊字符
+	PasswordRulePersonalInfo = "personal_info" // 包含邮箱或用户名
+	PasswordRuleBreached     = "breached"      // 出现在已泄露的密码列表中
+)
+
+// bcryptMaxBytes bcrypt 只使用密码的前 72 字节，更长的密码会被拒绝
+const bcryptMaxBytes = 72
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength        int                // 最少字符数
+	MaxLength        int                // 最多字节数（不超过 bcrypt 的 72 字节）
+	RequireUppercase bool               // 必须包含大写字母
+	RequireLowercase bool               // 必须包含小写字母
+	RequireDigit     bool               // 必须包含数字
+	RequireSymbol    bool               // 必须包含特殊字符
+	DisallowPersonal bool               // 不能包含邮箱（@ 之前的部分）或用户名
+	Breached         *BreachedPasswords // 已泄露的密码列表（为空时不检查）
+}
+
+// DefaultPasswordPolicy 默认密码策略
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        bcryptMaxBytes,
+		DisallowPersonal: true,
+	}
+}
+
+// PasswordViolation 违反的密码规则
+type PasswordViolation struct {
+	Rule    string `json:"rule"`    // 规则标识
+	Message string `json:"message"` // 说明
+}
+
+// PasswordPolicyError 密码不符合策略，列出所有违反的规则
+// errors.Is(err, ErrWeakPassword) 为 true
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return ErrWeakPassword.Error() + "：" + strings.Join(messages, "；")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Check 检查密码是否符合策略，email 和 name 为用户的邮箱和用户名（用于个人信息规则）
+// 返回 *PasswordPolicyError 列出所有违反的规则；检查泄露列表失败时返回其他错误
+func (p *PasswordPolicy) Check(password, email, name string) error {
+	var violations []PasswordViolation
+	add := func(rule, message string) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: message})
+	}
+
+	// 1. 长度
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add(PasswordRuleMinLength, fmt.Sprintf("密码至少需要 %d 个字符", p.MinLength))
+	}
+	maxLength := p.MaxLength
+	if maxLength <= 0 || maxLength > bcryptMaxBytes {
+		maxLength = bcryptMaxBytes
+	}
+	if len(password) > maxLength {
+		add(PasswordRuleMaxLength, fmt.Sprintf("密码不能超过 %d 个字节", maxLength))
+	}
+
+	// 2. 字符类型
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		add(PasswordRuleUppercase, "密码需要包含大写字母")
+	}
+	if p.RequireLowercase && !hasLower {
+		add(PasswordRuleLowercase, "密码需要包含小写字母")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(PasswordRuleDigit, "密码需要包含数字")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(PasswordRuleSymbol, "密码需要包含特殊字符")
+	}
+
+	// 3. 个人信息（不区分大小写，过短的片段不检查）
+	if p.DisallowPersonal && containsPersonalInfo(password, email, name) {
+		add(PasswordRulePersonalInfo, "密码不能包含邮箱或用户名")
+	}
+
+	// 4. 已泄露的密码
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("检查泄露密码列表失败: %w", err)
+		}
+		if breached {
+			add(PasswordRuleBreached, "该密码已在数据泄露中出现，请换一个密码")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsPersonalInfo 密码是否包含邮箱用户部分或用户名（3 个字符以上才检查）
+func containsPersonalInfo(password, email, name string) bool {
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(email, "@")
+	for _, part := range []string{local, name} {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if utf8.RuneCountInString(part) >= 3 && strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachedPasswords 离线的已泄露密码列表（SHA-1，Have I Been Pwned 格式）
+// 支持两种格式：
+//   - 文件：每行一个完整的 SHA-1（可带 ":次数"），启动时全部加载，适合较小的列表
+//   - 目录：按 SHA-1 前 5 位拆分的范围文件（如 5BAA6 或 5BAA6.txt），每行为剩余 35 位（可带 ":次数"），
+//     查询时只读取对应前缀的文件（k-anonymity 范围查询），适合完整的泄露库
+type BreachedPasswords struct {
+	dir    string              // 范围文件目录（目录格式）
+	hashes map[string]struct{} // 完整的 SHA-1（文件格式）
+}
+
+// LoadBreachedPasswords 加载已泄露密码列表
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, ok := parseBreachedLine(scanner.Text())
+		if ok && len(hash) == sha1.Size*2 {
+			hashes[hash] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	return &BreachedPasswords{hashes: hashes}, nil
+}
+
+// Contains 密码是否出现在泄露列表中
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if b.hashes != nil {
+		_, ok := b.hashes[hash]
+		return ok, nil
+	}
+
+	// 目录格式：只读取对应前缀的范围文件
+	prefix, suffix := hash[:5], hash[5:]
+	for _, name := range []string{prefix, prefix + ".txt"} {
+		found, err := rangeFileContains(filepath.Join(b.dir, name), suffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return found, err
+	}
+	return false, nil
+}
+
+// rangeFileContains 在一个前缀范围文件中查找 SHA-1 的后缀部分
+func rangeFileContains(path, suffix string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if entry, ok := parseBreachedLine(scanner.Text()); ok && entry == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// parseBreachedLine 解析 "HASH[:次数]" 格式的一行，次数为 0 的填充行视为不存在
+func parseBreachedLine(line string) (string, bool) {
+	hash, count, hasCount := strings.Cut(strings.TrimSpace(line), ":")
+	if hash == "" {
+		return "", false
+	}
+	if hasCount {
+		if n, err := strconv.Atoi(strings.TrimSpace(count)); err == nil && n == 0 {
+			return "", false
+		}
+	}
+	return strings.ToUpper(hash), true
+}
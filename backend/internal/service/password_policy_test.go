@@ -0,0 +1,203 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sha1Password 为 "password" 的 SHA-1（大写十六进制）
+const sha1Password = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+// violatedRules 返回错误中违反的规则标识（没有违反时为 nil）
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("期望 PasswordPolicyError，实际 %v", err)
+	}
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+// writeTestFile 在目录中写入文件
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("写入 %s 失败: %v", name, err)
+	}
+	return path
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := &PasswordPolicy{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowPersonal: true,
+	}
+	tests := []struct {
+		name      string
+		policy    *PasswordPolicy
+		password  string
+		email     string
+		user      string
+		wantRules []string
+	}{
+		{name: "默认策略的合格密码", policy: DefaultPasswordPolicy(), password: "tangerine-sky"},
+		{name: "默认策略长度不足", policy: DefaultPasswordPolicy(), password: "short", wantRules: []string{PasswordRuleMinLength}},
+		{name: "按字符计算长度", policy: DefaultPasswordPolicy(), password: "密码密码密码密码"},
+		{name: "超过 bcrypt 的 72 字节", policy: DefaultPasswordPolicy(), password: strings.Repeat("a", 73), wantRules: []string{PasswordRuleMaxLength}},
+		{name: "最大长度不能超过 72 字节", policy: &PasswordPolicy{MaxLength: 200}, password: strings.Repeat("a", 73), wantRules: []string{PasswordRuleMaxLength}},
+		{name: "严格策略的合格密码", policy: strict, password: "Tangerine-42"},
+		{name: "严格策略超过最大长度", policy: strict, password: "Tangerine-42-Tangerine", wantRules: []string{PasswordRuleMaxLength}},
+		{
+			name:      "列出所有违反的规则",
+			policy:    strict,
+			password:  "aaa",
+			wantRules: []string{PasswordRuleMinLength, PasswordRuleUppercase, PasswordRuleDigit, PasswordRuleSymbol},
+		},
+		{name: "只有大写字母和数字", policy: strict, password: "TANGERINE42", wantRules: []string{PasswordRuleLowercase, PasswordRuleSymbol}},
+		{name: "空格算作特殊字符", policy: strict, password: "Tangerine 42"},
+		{name: "包含邮箱用户名", policy: DefaultPasswordPolicy(), password: "Alice-2024!", email: "alice@example.com", wantRules: []string{PasswordRulePersonalInfo}},
+		{name: "包含用户名（不区分大小写）", policy: DefaultPasswordPolicy(), password: "i-am-BOBBY-now", user: "Bobby", wantRules: []string{PasswordRulePersonalInfo}},
+		{name: "过短的个人信息不检查", policy: DefaultPasswordPolicy(), password: "jo-tangerine", email: "jo@example.com", user: "Jo"},
+		{name: "未启用个人信息规则", policy: &PasswordPolicy{MinLength: 8}, password: "alice-2024", email: "alice@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := violatedRules(t, tt.policy.Check(tt.password, tt.email, tt.user))
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Fatalf("违反的规则 = %v，期望 %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	// 文件格式：完整的 SHA-1，次数为 0 的填充行视为不存在
+	listDir := t.TempDir()
+	list := writeTestFile(t, listDir, "breached.txt", strings.Join([]string{
+		strings.ToLower(sha1Password) + ":3861493",
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B",   // 123456
+		"F7C3BC1D808E04732ADF679965CCC34CA7AE3441:0", // 123456789（填充行）
+		"not-a-hash",
+	}, "\n"))
+
+	// 目录格式：按前 5 位拆分的范围文件，文件名可以带 .txt
+	rangeDir := t.TempDir()
+	writeTestFile(t, rangeDir, "5BAA6", "0000000000000000000000000000000000A:1\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n")
+	writeTestFile(t, rangeDir, "7C4A8.txt", "D09CA3762AF61E59520943DC26494F8941B:100\n")
+	writeTestFile(t, rangeDir, "F7C3B", "C1D808E04732ADF679965CCC34CA7AE3441:0\n")
+	// k-anonymity：只读取对应前缀的文件，其他前缀文件中的相同后缀不算命中
+	unlisted := sha1.Sum([]byte("correct horse battery staple"))
+	writeTestFile(t, rangeDir, "00000", strings.ToUpper(hex.EncodeToString(unlisted[:]))[5:]+":1\n")
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "password", want: true},
+		{password: "123456", want: true},
+		{password: "123456789", want: false},
+		{password: "correct horse battery staple", want: false},
+	}
+	for _, path := range []string{list, rangeDir} {
+		breached, err := LoadBreachedPasswords(path)
+		if err != nil {
+			t.Fatalf("加载 %s 失败: %v", path, err)
+		}
+		for _, tt := range tests {
+			got, err := breached.Contains(tt.password)
+			if err != nil {
+				t.Fatalf("%s: 检查 %q 失败: %v", filepath.Base(path), tt.password, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s: Contains(%q) = %v，期望 %v", filepath.Base(path), tt.password, got, tt.want)
+			}
+		}
+	}
+
+	if _, err := LoadBreachedPasswords(filepath.Join(listDir, "missing.txt")); err == nil {
+		t.Fatal("加载不存在的列表应失败")
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	dir := t.TempDir()
+	writeTestFile(t, dir, "5BAA6", "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n")
+	breached, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatalf("加载泄露列表失败: %v", err)
+	}
+	policy := DefaultPasswordPolicy()
+	policy.Breached = breached
+	s.SetPasswordPolicy(policy)
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantRules []string
+	}{
+		{name: "已泄露的密码", email: "a@example.com", password: "password", wantRules: []string{PasswordRuleBreached}},
+		{name: "同时违反多条规则", email: "carol@example.com", password: "carol", wantRules: []string{PasswordRuleMinLength, PasswordRulePersonalInfo}},
+		{name: "合格的密码", email: "b@example.com", password: testPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Register(RegisterRequest{Email: tt.email, Password: tt.password})
+			rules := violatedRules(t, err)
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Fatalf("违反的规则 = %v，期望 %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestBreachedRangeFilesClosed(t *testing.T) {
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("无法统计打开的文件（需要 /proc）")
+		}
+		return len(entries)
+	}
+	dir := t.TempDir()
+	writeTestFile(t, dir, "5BAA6", "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n")
+	writeTestFile(t, dir, "7C4A8.txt", "D09CA3762AF61E59520943DC26494F8941B:100\n")
+	breached, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatalf("加载泄露列表失败: %v", err)
+	}
+
+	// 每次查询读取的范围文件都应在返回前关闭
+	before := openFiles()
+	for i := 0; i < 100; i++ {
+		for _, password := range []string{"password", "123456", "not-listed"} {
+			if _, err := breached.Contains(password); err != nil {
+				t.Fatalf("检查失败: %v", err)
+			}
+		}
+	}
+	if after := openFiles(); after > before {
+		t.Fatalf("查询后打开的文件从 %d 个增加到 %d 个", before, after)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/mail"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	purposeResetPassword = "reset_password" // 重置密码令牌的用途
+	resetPasswordTTL     = 30 * time.Minute // 重置链接有效期
+)
+
+// ResetPasswordRequest 重置密码请求
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`    // 重置邮件中的令牌
+	Password string `json:"password" binding:"required"` // 新密码
+
+	SessionInfo `json:"-"` // 请求的设备信息（用于审计，由处理器填写）
+}
+
+// ForgotPassword 向邮箱发送重置密码链接
+// 为避免泄露邮箱是否注册，邮箱不存在或发送过于频繁时都不返回错误；邮件在后台发送，响应时间不因邮箱是否存在而不同
+func (s *AuthService) ForgotPassword(email string) error {
+	// 1. 查询用户
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	// 2. 签发重置令牌并发送邮件
+	err := s.sendResetLink(&user, "我们收到了重置您账户密码的请求。", "如果这不是您本人的操作，请忽略这封邮件，您的密码不会改变。")
+	if errors.Is(err, ErrTooManyEmails) {
+		return nil
+	}
+	return err
+}
+
+// sendResetLink 签发重置令牌并发送重置密码邮件（intro 和 footer 分别是链接前后的说明）
+func (s *AuthService) sendResetLink(user *models.User, intro, footer string) error {
+	token, err := issueVerificationToken(database.DB, user.ID, purposeResetPassword, user.Email, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	link := s.issuer + "/reset-password?" + url.Values{"token": {token}}.Encode()
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "重置密码 - Shadow OAuth",
+		Body: fmt.Sprintf("您好 %s：\n\n%s请点击以下链接设置新密码（%d 分钟内有效，只能使用一次）：\n\n%s\n\n%s\n",
+			user.Name, intro, int(resetPasswordTTL.Minutes()), link, footer),
+	})
+	return nil
+}
+
+// ResetPassword 使用重置链接中的令牌设置新密码
+// 重置后撤销用户的所有登录会话和已签发的 Token
+func (s *AuthService) ResetPassword(req ResetPasswordRequest) error {
+	// 1. 查询令牌对应的用户，令牌必须发送到用户当前的邮箱
+	record, err := findVerificationToken(req.Token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+	user, err := s.GetUserByID(record.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email != record.Email {
+		return ErrInvalidVerificationToken
+	}
+
+	// 2. 验证新密码是否符合策略（先于使用令牌，密码不符合要求时令牌仍可再次使用），然后使用令牌
+	if err := s.validatePassword(req.Password, user.Email, user.Name); err != nil {
+		return err
+	}
+	if _, err := consumeVerificationToken(req.Token, purposeResetPassword); err != nil {
+		return err
+	}
+
+	// 3. 更新密码（能收到重置邮件说明邮箱属于用户，同时标记为已验证）
+	hashedPassword, err := s.hashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"password": hashedPassword, "password_reset_required": false}
+	if !user.EmailVerified {
+		updates["email_verified"] = true
+		updates["email_verified_at"] = time.Now()
+	}
+	if err := database.DB.Model(user).Updates(updates).Error; err != nil {
+		return fmt.Errorf("更新密码失败: %w", err)
+	}
+
+	// 4. 作废其他未使用的重置链接，撤销所有会话和 Token
+	if err := database.DB.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purposeResetPassword).
+		Update("used_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("作废重置链接失败: %w", err)
+	}
+	if err := s.revokeCredentials(user.ID, ""); err != nil {
+		return err
+	}
+	recordAudit(user.ID, AuditPasswordReset, AuditContext{SessionInfo: req.SessionInfo}, nil)
+
+	// 5. 通知用户密码已重置
+	s.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "您的密码已重置 - Shadow OAuth",
+		Body:    fmt.Sprintf("您好 %s：\n\n您的账户密码已于 %s 重置，所有设备上的登录已失效。\n\n如果这不是您本人的操作，请立即重置密码并联系我们。\n", user.Name, time.Now().Format("2006-01-02 15:04:05")),
+	})
+	return nil
+}
+
+// sendMailAsync 在后台发送邮件（失败只记录日志）
+func (s *AuthService) sendMailAsync(msg mail.Message) {
+	deliverMailAsync(s.mailer, msg)
+}
+
+// deliverMailAsync 使用指定的邮件发送器在后台发送邮件（失败只记录日志）
+func deliverMailAsync(mailer mail.Mailer, msg mail.Message) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("发送邮件到 %s 失败: %v", msg.To, err)
+		}
+	}()
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+const newTestPassword = "Brand-New-Secret-7" // 重置后的新密码
+
+// requestResetToken 为邮箱申请重置密码，返回第 n 封邮件（从 1 开始）中的令牌
+func requestResetToken(t *testing.T, s *AuthService, outbox, email string, n int) string {
+	t.Helper()
+	if err := s.ForgotPassword(email); err != nil {
+		t.Fatalf("申请重置密码失败: %v", err)
+	}
+	mails := waitForMails(t, outbox, n)
+	return mailLinkParam(t, mails[n-1], "token")
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	createTestUser(t, s, "alice@example.com")
+	outbox := newTestOutbox(t, s)
+
+	// 未注册的邮箱与已注册的邮箱返回相同结果，但不发送邮件
+	if err := s.ForgotPassword("nobody@example.com"); err != nil {
+		t.Fatalf("未注册的邮箱: %v", err)
+	}
+	if err := s.ForgotPassword("alice@example.com"); err != nil {
+		t.Fatalf("已注册的邮箱: %v", err)
+	}
+	// 发送过于频繁时同样不返回错误，也不再发送
+	if err := s.ForgotPassword("alice@example.com"); err != nil {
+		t.Fatalf("发送过于频繁: %v", err)
+	}
+	waitForMails(t, outbox, 1)
+	time.Sleep(50 * time.Millisecond) // 等待可能在后台发送的其他邮件
+	if mails := waitForMails(t, outbox, 1); len(mails) != 1 {
+		t.Fatalf("发送了 %d 封邮件，期望 1 封", len(mails))
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		// token 返回提交的令牌，可以在提交前修改令牌或用户
+		token    func(t *testing.T, s *AuthService, outbox string, user *models.User) string
+		password string
+		wantErr  error
+	}{
+		{
+			name: "有效的令牌",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				return requestResetToken(t, s, outbox, user.Email, 1)
+			},
+		},
+		{
+			name: "令牌只能使用一次",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				token := requestResetToken(t, s, outbox, user.Email, 1)
+				if err := s.ResetPassword(ResetPasswordRequest{Token: token, Password: "Another-Secret-99"}); err != nil {
+					t.Fatalf("第一次重置失败: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+		{
+			name: "过期的令牌",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				token := requestResetToken(t, s, outbox, user.Email, 1)
+				database.DB.Model(&models.VerificationToken{}).Where("user_id = ?", user.ID).
+					Update("expires_at", time.Now().Add(-time.Second))
+				return token
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+		{
+			name: "邮箱验证令牌不能用于重置密码",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				backdateVerificationTokens(t, user.ID, 2*time.Minute)
+				if err := s.SendVerificationEmail(user); err != nil {
+					t.Fatalf("发送验证邮件失败: %v", err)
+				}
+				return mailLinkParam(t, waitForMails(t, outbox, 1)[0], "token")
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+		{
+			name: "修改邮箱后旧链接失效",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				token := requestResetToken(t, s, outbox, user.Email, 1)
+				database.DB.Model(user).Update("email", "alice.new@example.com")
+				return token
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+		{
+			name: "未知的令牌",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				return "unknown-token"
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+		{
+			name: "新密码不符合策略",
+			token: func(t *testing.T, s *AuthService, outbox string, user *models.User) string {
+				return requestResetToken(t, s, outbox, user.Email, 1)
+			},
+			password: "short",
+			wantErr:  ErrWeakPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			user := createTestUser(t, s, "alice@example.com")
+			outbox := newTestOutbox(t, s)
+			password := tt.password
+			if password == "" {
+				password = newTestPassword
+			}
+
+			token := tt.token(t, s, outbox, user)
+			err := s.ResetPassword(ResetPasswordRequest{Token: token, Password: password})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("重置密码失败: %v", err)
+			}
+			if _, err := s.Login(LoginRequest{Email: user.Email, Password: password}); err != nil {
+				t.Fatalf("使用新密码登录失败: %v", err)
+			}
+			if _, err := s.Login(LoginRequest{Email: user.Email, Password: testPassword}); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("旧密码应无法登录，实际 %v", err)
+			}
+		})
+	}
+}
+
+func TestResetPasswordKeepsTokenWhenPasswordRejected(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	user := createTestUser(t, s, "alice@example.com")
+	outbox := newTestOutbox(t, s)
+	token := requestResetToken(t, s, outbox, user.Email, 1)
+
+	if err := s.ResetPassword(ResetPasswordRequest{Token: token, Password: "short"}); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("期望 %v，实际 %v", ErrWeakPassword, err)
+	}
+	if err := s.ResetPassword(ResetPasswordRequest{Token: token, Password: newTestPassword}); err != nil {
+		t.Fatalf("密码不符合要求后令牌应仍然可用: %v", err)
+	}
+}
+
+func TestResetPasswordRevokesCredentials(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	user := createTestUser(t, s, "alice@example.com")
+	_, sessionToken, loginJWT := newTestSession(t, s, user.ID)
+	accessToken := &models.AccessToken{Token: "access-token", ClientID: "test_client", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		t.Fatalf("保存 Access Token 失败: %v", err)
+	}
+	outbox := newTestOutbox(t, s)
+	first := requestResetToken(t, s, outbox, user.Email, 1)
+	backdateVerificationTokens(t, user.ID, 2*time.Minute)
+	second := requestResetToken(t, s, outbox, user.Email, 2)
+
+	if err := s.ResetPassword(ResetPasswordRequest{Token: second, Password: newTestPassword}); err != nil {
+		t.Fatalf("重置密码失败: %v", err)
+	}
+
+	// 1. 所有会话和 Token 都被撤销
+	if _, err := s.ValidateSession(sessionToken); err == nil {
+		t.Fatal("重置后会话应失效")
+	}
+	if _, err := s.ValidateToken(loginJWT); err == nil {
+		t.Fatal("重置后登录 JWT 应失效")
+	}
+	var count int64
+	database.DB.Model(&models.AccessToken{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("重置后还有 %d 个 Access Token", count)
+	}
+
+	// 2. 其他未使用的重置链接同时作废
+	if err := s.ResetPassword(ResetPasswordRequest{Token: first, Password: "Another-Secret-99"}); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Fatalf("旧的重置链接: 期望 %v，实际 %v", ErrInvalidVerificationToken, err)
+	}
+
+	// 3. 通知用户密码已重置
+	mails := waitForMails(t, outbox, 3)
+	if len(mails) != 3 {
+		t.Fatalf("发送了 %d 封邮件，期望 3 封", len(mails))
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRoleNotFound 角色不存在
+	ErrRoleNotFound = errors.New("角色不存在")
+	// ErrPermissionDenied 没有执行操作所需的权限
+	ErrPermissionDenied = errors.New("没有权限执行此操作")
+)
+
+// 权限（管理接口按权限授权，角色是权限的集合）
+const (
+	PermissionAll            = "*"               // 全部权限
+	PermissionUsersRead      = "users:read"      // 查看用户
+	PermissionUsersWrite     = "users:write"     // 管理用户（禁用、删除、修改角色等）
+	PermissionClientsRead    = "clients:read"    // 查看 OAuth 客户端
+	PermissionClientsWrite   = "clients:write"   // 管理 OAuth 客户端
+	PermissionLockoutsManage = "lockouts:manage" // 查看和解除登录锁定
+)
+
+// 内置角色
+const (
+	RoleAdmin   = "admin"   // 管理员：全部权限
+	RoleSupport = "support" // 客服：查看用户和客户端，解除登录锁定
+)
+
+// ScopeRoles 在 ID Token、UserInfo 和 Token 内省中返回用户角色的权限范围
+const ScopeRoles = "roles"
+
+// builtinRoles 内置角色的定义（服务启动时同步到数据库）
+var builtinRoles = []models.Role{
+	{Name: RoleAdmin, Description: "管理员", Permissions: PermissionAll},
+	{Name: RoleSupport, Description: "客服", Permissions: JoinScope([]string{PermissionUsersRead, PermissionClientsRead, PermissionLockoutsManage})},
+}
+
+// EnsureBuiltinRoles 创建内置角色，已存在时把说明和权限更新为当前定义
+func EnsureBuiltinRoles() error {
+	for _, role := range builtinRoles {
+		role.Builtin = true
+		if err := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description", "permissions", "builtin", "updated_at"}),
+		}).Create(&role).Error; err != nil {
+			return fmt.Errorf("创建内置角色 %s 失败: %w", role.Name, err)
+		}
+	}
+	return nil
+}
+
+// Roles 列出所有角色
+func (s *AuthService) Roles() ([]models.Role, error) {
+	var roles []models.Role
+	if err := database.DB.Order("name").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("查询角色失败: %w", err)
+	}
+	return roles, nil
+}
+
+// UserRoles 获取用户的角色
+func (s *AuthService) UserRoles(userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	if err := database.DB.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).Order("roles.name").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("查询用户角色失败: %w", err)
+	}
+	return roles, nil
+}
+
+// UserRoleNames 获取用户的角色名（用于 Token 中的 roles 声明）
+func (s *AuthService) UserRoleNames(userID uint) ([]string, error) {
+	return userRoleNames(userID)
+}
+
+// HasPermission 检查用户是否拥有指定权限
+// 每次从数据库读取，撤销角色后立即生效
+func (s *AuthService) HasPermission(userID uint, permission string) (bool, error) {
+	roles, err := s.UserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		for _, granted := range ParseScope(role.Permissions) {
+			if granted == PermissionAll || granted == permission {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// AssignRole 授予用户角色（已拥有时不做任何操作）
+func (s *AuthService) AssignRole(userID uint, roleName string, ctx AuditContext) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	role, err := findRole(roleName)
+	if err != nil {
+		return err
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserRole{UserID: user.ID, RoleID: role.ID, GrantedBy: ctx.ActorID})
+	if result.Error != nil {
+		return fmt.Errorf("授予角色失败: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		recordAudit(user.ID, AuditRoleGranted, ctx, map[string]interface{}{"role": role.Name})
+	}
+	return nil
+}
+
+// RevokeRole 撤销用户的角色（未拥有时不做任何操作）
+func (s *AuthService) RevokeRole(userID uint, roleName string, ctx AuditContext) error {
+	role, err := findRole(roleName)
+	if err != nil {
+		return err
+	}
+	result := database.DB.Where("user_id = ? AND role_id = ?", userID, role.ID).Delete(&models.UserRole{})
+	if result.Error != nil {
+		return fmt.Errorf("撤销角色失败: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		recordAudit(userID, AuditRoleRevoked, ctx, map[string]interface{}{"role": role.Name})
+	}
+	return nil
+}
+
+// RoleClaims 授权包含 roles 权限范围时返回用户的角色名，否则返回 nil
+// 在签发 ID Token、返回 UserInfo 和内省结果时读取，反映用户当前的角色
+func (s *OAuthService) RoleClaims(userID uint, scope string) ([]string, error) {
+	if !contains(ParseScope(scope), ScopeRoles) {
+		return nil, nil
+	}
+	return userRoleNames(userID)
+}
+
+// findRole 按名称查询角色
+func findRole(name string) (*models.Role, error) {
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("查询角色失败: %w", err)
+	}
+	return &role, nil
+}
+
+// userRoleNames 查询用户的角色名（按名称排序）
+func userRoleNames(userID uint) ([]string, error) {
+	var names []string
+	if err := database.DB.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).Pluck("roles.name", &names).Error; err != nil {
+		return nil, fmt.Errorf("查询用户角色失败: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
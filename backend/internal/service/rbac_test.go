@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// createTestRole 创建自定义角色
+func createTestRole(t *testing.T, name string, permissions ...string) {
+	t.Helper()
+	if err := database.DB.Create(&models.Role{Name: name, Permissions: JoinScope(permissions)}).Error; err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+}
+
+// createTestUserWithRoles 注册用户并授予角色
+func createTestUserWithRoles(t *testing.T, s *AuthService, email string, roles ...string) *models.User {
+	t.Helper()
+	user := createTestUser(t, s, email)
+	for _, role := range roles {
+		if err := s.AssignRole(user.ID, role, AuditContext{}); err != nil {
+			t.Fatalf("授予角色 %s 失败: %v", role, err)
+		}
+	}
+	return user
+}
+
+func TestHasPermission(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	createTestRole(t, "user-manager", PermissionUsersRead, PermissionUsersWrite)
+	admin := createTestUserWithRoles(t, s, "admin@example.com", RoleAdmin)
+	support := createTestUserWithRoles(t, s, "support@example.com", RoleSupport)
+	manager := createTestUserWithRoles(t, s, "manager@example.com", "user-manager")
+	both := createTestUserWithRoles(t, s, "both@example.com", RoleSupport, "user-manager")
+	nobody := createTestUser(t, s, "nobody@example.com")
+
+	tests := []struct {
+		user       *models.User
+		permission string
+		want       bool
+	}{
+		{admin, PermissionUsersWrite, true},
+		{admin, PermissionClientsWrite, true},
+		{admin, "anything:else", true}, // * 包含所有权限，包括以后新增的
+		{support, PermissionUsersRead, true},
+		{support, PermissionClientsRead, true},
+		{support, PermissionLockoutsManage, true},
+		{support, PermissionUsersWrite, false},
+		{support, PermissionClientsWrite, false},
+		{manager, PermissionUsersWrite, true},
+		{manager, PermissionLockoutsManage, false},
+		{both, PermissionUsersWrite, true}, // 多个角色的权限合并
+		{both, PermissionLockoutsManage, true},
+		{both, PermissionClientsWrite, false},
+		{nobody, PermissionUsersRead, false},
+		{support, PermissionAll, false}, // "*" 只能由角色授予，不能通过检查获得
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.user.Email, tt.permission), func(t *testing.T) {
+			got, err := s.HasPermission(tt.user.ID, tt.permission)
+			if err != nil {
+				t.Fatalf("检查权限失败: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("HasPermission = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	// 撤销角色后立即生效
+	if err := s.RevokeRole(support.ID, RoleSupport, AuditContext{ActorID: admin.ID}); err != nil {
+		t.Fatalf("撤销角色失败: %v", err)
+	}
+	if ok, _ := s.HasPermission(support.ID, PermissionUsersRead); ok {
+		t.Fatal("撤销角色后仍有权限")
+	}
+}
+
+func TestSetUserRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		actorRoles []string // 操作者的角色（nil 表示使用管理令牌，ActorID 为 0）
+		selfTarget bool     // 修改操作者自己的角色
+		before     []string // 目标用户原有的角色
+		roles      []string // 请求设置的角色
+		wantErr    error
+	}{
+		{name: "管理员授予管理员", actorRoles: []string{RoleAdmin}, roles: []string{RoleAdmin}},
+		{name: "管理员授予客服", actorRoles: []string{RoleAdmin}, roles: []string{RoleSupport}},
+		{name: "管理员撤销全部角色", actorRoles: []string{RoleAdmin}, before: []string{RoleAdmin, RoleSupport}, roles: []string{}},
+		{name: "管理令牌授予管理员", roles: []string{RoleAdmin}},
+		{name: "拥有客服全部权限时可以授予客服", actorRoles: []string{RoleSupport}, roles: []string{RoleSupport}},
+		{name: "用户管理员不能授予管理员", actorRoles: []string{"user-manager"}, roles: []string{RoleAdmin}, wantErr: ErrPermissionDenied},
+		{name: "用户管理员不能授予权限更多的客服", actorRoles: []string{"user-manager"}, roles: []string{RoleSupport}, wantErr: ErrPermissionDenied},
+		{name: "用户管理员不能撤销管理员", actorRoles: []string{"user-manager"}, before: []string{RoleAdmin}, roles: []string{}, wantErr: ErrPermissionDenied},
+		{name: "部分角色越权时全部不生效", actorRoles: []string{"user-manager"}, roles: []string{"user-manager", RoleAdmin}, wantErr: ErrPermissionDenied},
+		{name: "用户管理员授予相同角色", actorRoles: []string{"user-manager"}, roles: []string{"user-manager"}},
+		{name: "不能修改自己的角色", actorRoles: []string{"user-manager"}, selfTarget: true, roles: []string{RoleAdmin}, wantErr: ErrCannotModifySelf},
+		{name: "管理员也不能修改自己的角色", actorRoles: []string{RoleAdmin}, selfTarget: true, roles: []string{}, wantErr: ErrCannotModifySelf},
+		{name: "角色不存在", actorRoles: []string{RoleAdmin}, roles: []string{"root"}, wantErr: ErrRoleNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			createTestRole(t, "user-manager", PermissionUsersRead, PermissionUsersWrite)
+			target := createTestUserWithRoles(t, s, "target@example.com", tt.before...)
+			ctx := AuditContext{}
+			if tt.actorRoles != nil {
+				actor := createTestUserWithRoles(t, s, "actor@example.com", tt.actorRoles...)
+				ctx.ActorID = actor.ID
+				if tt.selfTarget {
+					target = actor
+				}
+			}
+			before, _ := s.UserRoleNames(target.ID)
+
+			got, err := s.SetUserRoles(target.ID, SetUserRolesRequest{Roles: tt.roles}, ctx)
+			after, _ := s.UserRoleNames(target.ID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				if fmt.Sprint(after) != fmt.Sprint(before) {
+					t.Fatalf("失败时角色不应改变: %v -> %v", before, after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("设置角色失败: %v", err)
+			}
+			want := append([]string{}, tt.roles...)
+			if fmt.Sprint(got) != fmt.Sprint(want) || fmt.Sprint(after) != fmt.Sprint(want) {
+				t.Fatalf("角色 = %v（数据库 %v），期望 %v", got, after, want)
+			}
+		})
+	}
+}
+
+func TestRoleClaims(t *testing.T) {
+	newTestDB(t)
+	auth := newTestAuthService(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	admin := createTestUserWithRoles(t, auth, "admin@example.com", RoleSupport, RoleAdmin)
+	nobody := createTestUser(t, auth, "nobody@example.com")
+
+	tests := []struct {
+		name  string
+		user  uint
+		scope string
+		want  []string
+	}{
+		{name: "包含 roles 权限范围", user: admin.ID, scope: "openid roles", want: []string{RoleAdmin, RoleSupport}},
+		{name: "不包含 roles 权限范围", user: admin.ID, scope: "openid profile"},
+		{name: "没有角色", user: nobody.ID, scope: "roles", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.RoleClaims(tt.user, tt.scope)
+			if err != nil {
+				t.Fatalf("查询角色失败: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("RoleClaims = %#v，期望 %#v", got, tt.want)
+			}
+		})
+	}
+}
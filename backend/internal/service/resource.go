@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+var (
+	// ErrInvalidTarget 无效的资源标识（RFC 8707 invalid_target）
+	ErrInvalidTarget = errors.New("无效的资源标识")
+	// ErrInvalidScope 无效的权限范围
+	ErrInvalidScope = errors.New("无效的权限范围")
+)
+
+// ParseScope 将空格分隔的字符串拆分为列表（去重）
+func ParseScope(scope string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, item := range strings.Fields(scope) {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// JoinScope 将列表合并为空格分隔的字符串
+func JoinScope(items []string) string {
+	return strings.Join(items, " ")
+}
+
+// ValidateResources 验证授权请求中的 resource 参数和权限范围（RFC 8707）
+// 每个资源都必须已登记；请求了资源时，每个权限范围都必须被其中至少一个资源允许
+func (s *OAuthService) ValidateResources(resources []string, scope string) error {
+	registered, err := s.findResources(resources)
+	if err != nil {
+		return err
+	}
+	if len(registered) == 0 {
+		return nil
+	}
+
+	for _, item := range ParseScope(scope) {
+		if item != ScopeOpenID && !anyAllowsScope(registered, item) {
+			return fmt.Errorf("%w: 请求的资源不允许 %s", ErrInvalidScope, item)
+		}
+	}
+	return nil
+}
+
+// narrowToResources 确定 Token 的受众和权限范围
+// 请求的资源必须是授权时资源的子集，权限范围收窄到这些资源允许的部分
+func (s *OAuthService) narrowToResources(authCode *models.AuthorizationCode, requested []string) ([]string, string, error) {
+	granted := ParseScope(authCode.Resource)
+	if len(requested) == 0 {
+		return granted, authCode.Scope, nil
+	}
+
+	for _, resource := range requested {
+		if !contains(granted, resource) {
+			return nil, "", fmt.Errorf("%w: 未授权访问 %s", ErrInvalidTarget, resource)
+		}
+	}
+
+	registered, err := s.findResources(requested)
+	if err != nil {
+		return nil, "", err
+	}
+	var scopes []string
+	for _, item := range ParseScope(authCode.Scope) {
+		if item == ScopeOpenID || anyAllowsScope(registered, item) {
+			scopes = append(scopes, item)
+		}
+	}
+	return ParseScope(JoinScope(requested)), JoinScope(scopes), nil
+}
+
+// findResources 查找已登记的资源，任意一个无效或未登记都返回 ErrInvalidTarget
+func (s *OAuthService) findResources(identifiers []string) ([]models.ProtectedResource, error) {
+	var result []models.ProtectedResource
+	for _, identifier := range identifiers {
+		// 资源标识必须是不含片段的绝对 URI
+		parsed, err := url.Parse(identifier)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTarget, identifier)
+		}
+
+		var resource models.ProtectedResource
+		if err := database.DB.Where("identifier = ?", identifier).First(&resource).Error; err != nil {
+			return nil, fmt.Errorf("%w: %s 未登记", ErrInvalidTarget, identifier)
+		}
+		result = append(result, resource)
+	}
+	return result, nil
+}
+
+// anyAllowsScope 检查是否有资源允许指定的权限范围
+func anyAllowsScope(resources []models.ProtectedResource, scope string) bool {
+	for i := range resources {
+		if resources[i].AllowsScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains 检查列表中是否包含指定值
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+const (
+	testCalendarAPI = "https://calendar.example.com/api" // 允许 calendar.read 和 profile
+	testMailAPI     = "https://mail.example.com/api"     // 允许 mail.read
+)
+
+// newTestResources 登记测试使用的受保护资源
+func newTestResources(t *testing.T) {
+	t.Helper()
+	resources := []models.ProtectedResource{
+		{Identifier: testCalendarAPI, Name: "Calendar", Scopes: "calendar.read profile"},
+		{Identifier: testMailAPI, Name: "Mail", Scopes: "mail.read"},
+	}
+	if err := database.DB.Create(&resources).Error; err != nil {
+		t.Fatalf("登记资源失败: %v", err)
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	newTestDB(t)
+	newTestResources(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+
+	tests := []struct {
+		name      string
+		resources []string
+		scope     string
+		wantErr   error
+	}{
+		{name: "没有请求资源时不限制权限范围", scope: "anything"},
+		{name: "资源允许请求的权限范围", resources: []string{testCalendarAPI}, scope: "openid calendar.read"},
+		{name: "多个资源共同允许请求的权限范围", resources: []string{testCalendarAPI, testMailAPI}, scope: "calendar.read mail.read"},
+		{name: "资源不允许请求的权限范围", resources: []string{testCalendarAPI}, scope: "mail.read", wantErr: ErrInvalidScope},
+		{name: "未登记的资源", resources: []string{"https://unknown.example.com/api"}, wantErr: ErrInvalidTarget},
+		{name: "任一资源未登记", resources: []string{testCalendarAPI, "https://unknown.example.com/api"}, scope: "calendar.read", wantErr: ErrInvalidTarget},
+		{name: "相对地址", resources: []string{"/api"}, wantErr: ErrInvalidTarget},
+		{name: "包含片段", resources: []string{testCalendarAPI + "#frag"}, wantErr: ErrInvalidTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateResources(tt.resources, tt.scope)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望通过，实际 %v", err)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthorizationCodeResources(t *testing.T) {
+	const redirectURI = "https://app.example.com/callback"
+	tests := []struct {
+		name      string
+		requested []string
+		wantAud   []string
+		wantScope string
+		wantErr   error
+	}{
+		{
+			name:      "未指定资源时使用授权时的全部资源",
+			wantAud:   []string{testCalendarAPI, testMailAPI},
+			wantScope: "profile calendar.read mail.read",
+		},
+		{
+			name:      "收窄到一个资源",
+			requested: []string{testMailAPI},
+			wantAud:   []string{testMailAPI},
+			wantScope: "mail.read",
+		},
+		{
+			name:      "未授权的资源",
+			requested: []string{"https://other.example.com/api"},
+			wantErr:   ErrInvalidTarget,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			newTestResources(t)
+			s := NewOAuthService(testSecret, 1, testIssuer)
+			client := &models.OAuthClient{ClientID: "test_client", ClientSecret: "secret", Name: "Test App", RedirectURI: redirectURI}
+			if err := database.DB.Create(client).Error; err != nil {
+				t.Fatalf("创建客户端失败: %v", err)
+			}
+			code, err := s.GenerateAuthorizationCode(AuthorizationGrant{
+				ClientID:    client.ClientID,
+				UserID:      1,
+				RedirectURI: redirectURI,
+				Scope:       "profile calendar.read mail.read",
+				Resources:   []string{testCalendarAPI, testMailAPI},
+			})
+			if err != nil {
+				t.Fatalf("生成授权码失败: %v", err)
+			}
+
+			token, err := s.ExchangeAuthorizationCode(CodeExchangeRequest{
+				Code:        code,
+				RedirectURI: redirectURI,
+				Client:      ClientCredentials{ClientID: client.ClientID, ClientSecret: "secret"},
+				Resources:   tt.requested,
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("交换授权码失败: %v", err)
+			}
+			claims, err := s.ValidateAccessToken(token.Token)
+			if err != nil {
+				t.Fatalf("验证 Token 失败: %v", err)
+			}
+			if !reflect.DeepEqual(claims.Audience, tt.wantAud) || claims.Scope != tt.wantScope {
+				t.Fatalf("aud = %v, scope = %q，期望 %v, %q", claims.Audience, claims.Scope, tt.wantAud, tt.wantScope)
+			}
+
+			// 资源只接受签发给自己的 Token
+			for _, resource := range []string{testCalendarAPI, testMailAPI} {
+				_, err := s.AuthenticateResourceRequest(ResourceRequest{Scheme: "Bearer", Token: token.Token, Audience: resource})
+				if want := contains(tt.wantAud, resource); (err == nil) != want {
+					t.Fatalf("%s 接受 Token: %v，期望 %v", resource, err == nil, want)
+				}
+				if err != nil && !errors.Is(err, ErrInvalidTarget) {
+					t.Fatalf("期望错误 %v，实际 %v", ErrInvalidTarget, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConsentResources(t *testing.T) {
+	newTestDB(t)
+	s := NewOAuthService(testSecret, 1, testIssuer)
+	if err := s.SaveConsent(1, "test_client", "profile calendar.read", []string{testCalendarAPI}); err != nil {
+		t.Fatalf("保存授权记录失败: %v", err)
+	}
+
+	// 1. 只有用户确认过的资源不再展示授权确认页面
+	tests := []struct {
+		name      string
+		scope     string
+		resources []string
+		want      bool
+	}{
+		{name: "已同意的资源", scope: "calendar.read", resources: []string{testCalendarAPI}, want: true},
+		{name: "没有请求资源", scope: "profile", want: true},
+		{name: "未同意的资源", scope: "mail.read", resources: []string{testMailAPI}},
+		{name: "已同意的权限范围但未同意的资源", scope: "profile", resources: []string{testMailAPI}},
+		{name: "部分资源未同意", scope: "calendar.read", resources: []string{testCalendarAPI, testMailAPI}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.HasConsent(1, "test_client", tt.scope, tt.resources, "")
+			if err != nil {
+				t.Fatalf("查询授权记录失败: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("HasConsent = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	// 2. 再次同意时与已有的资源合并
+	if err := s.SaveConsent(1, "test_client", "mail.read", []string{testMailAPI}); err != nil {
+		t.Fatalf("保存授权记录失败: %v", err)
+	}
+	if ok, _ := s.HasConsent(1, "test_client", "calendar.read mail.read", []string{testCalendarAPI, testMailAPI}, ""); !ok {
+		t.Fatal("合并后应包含两个资源")
+	}
+	var consent models.Consent
+	database.DB.Where("user_id = ? AND client_id = ?", 1, "test_client").First(&consent)
+	if want := testCalendarAPI + " " + testMailAPI; consent.Resource != want {
+		t.Fatalf("resource = %q，期望 %q", consent.Resource, want)
+	}
+}
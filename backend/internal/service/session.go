@@ -0,0 +1,202 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidSession 会话不存在、已撤销或已过期
+	ErrInvalidSession = errors.New("会话无效或已过期")
+	// ErrSessionNotFound 要撤销的会话不存在
+	ErrSessionNotFound = errors.New("会话不存在")
+)
+
+// lastSeenInterval 最近使用时间的更新间隔（避免每个请求都写数据库）
+const lastSeenInterval = time.Minute
+
+// LogoutNotifier 会话结束时通知在会话中获得授权的客户端（OIDC 后端通道注销）
+type LogoutNotifier interface {
+	SessionsEnded(sessions []models.Session)
+}
+
+// SetLogoutNotifier 设置会话结束通知
+func (s *AuthService) SetLogoutNotifier(notifier LogoutNotifier) {
+	s.logoutNotifier = notifier
+}
+
+// SessionInfo 创建会话时记录的设备信息
+type SessionInfo struct {
+	UserAgent string // 浏览器/设备信息
+	IPAddress string // 客户端 IP
+}
+
+// CreateSession 为用户创建服务端登录会话
+// 返回会话记录和写入 Cookie 的会话令牌（令牌原文只在此时可见）
+// amr 为本次登录使用的认证方式
+func (s *AuthService) CreateSession(userID uint, authTime time.Time, amr []string, info SessionInfo) (*models.Session, string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成会话标识失败: %w", err)
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成会话令牌失败: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		SessionID:  sessionID,
+		TokenHash:  hashSessionToken(token),
+		UserID:     userID,
+		UserAgent:  truncate(info.UserAgent, 255),
+		IPAddress:  truncate(info.IPAddress, 64),
+		AuthTime:   authTime,
+		AMR:        strings.Join(amr, " "),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.jwtExpire),
+	}
+	if err := database.DB.Create(session).Error; err != nil {
+		return nil, "", fmt.Errorf("创建会话失败: %w", err)
+	}
+	return session, token, nil
+}
+
+// ValidateSession 验证 Cookie 中的会话令牌
+func (s *AuthService) ValidateSession(token string) (*SessionClaims, error) {
+	return s.loadSession("token_hash = ?", hashSessionToken(token))
+}
+
+// loadSession 查询有效会话并更新最近使用时间
+func (s *AuthService) loadSession(query string, args ...interface{}) (*SessionClaims, error) {
+	var session models.Session
+	if err := database.DB.Where(query, args...).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidSession
+		}
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	if session.IsExpired() {
+		return nil, ErrInvalidSession
+	}
+
+	if time.Since(session.LastSeenAt) > lastSeenInterval {
+		database.DB.Model(&session).UpdateColumn("last_seen_at", time.Now())
+	}
+	return &SessionClaims{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		AuthTime:  session.AuthTime,
+		AMR:       strings.Fields(session.AMR),
+	}, nil
+}
+
+// ListSessions 列出用户所有未过期的会话（最近使用的在前）
+func (s *AuthService) ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession 撤销用户的一个会话（退出该设备的登录）
+func (s *AuthService) RevokeSession(userID uint, sessionID string) error {
+	sessions, err := s.endSessions("user_id = ? AND session_id = ?", userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions 撤销用户的所有会话（在所有设备上退出登录）
+func (s *AuthService) RevokeAllSessions(userID uint) error {
+	_, err := s.endSessions("user_id = ?", userID)
+	return err
+}
+
+// revokeCredentials 撤销用户的登录会话、Access Token 和未使用的授权码（重置或修改密码后使用）
+// keepSessionID 非空时保留该会话（用户修改密码时不退出当前设备）
+func (s *AuthService) revokeCredentials(userID uint, keepSessionID string) error {
+	if _, err := s.endSessions("user_id = ? AND session_id <> ?", userID, keepSessionID); err != nil {
+		return err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Delete(&models.AccessToken{}).Error; err != nil {
+		return fmt.Errorf("撤销 Access Token 失败: %w", err)
+	}
+	if err := database.DB.Model(&models.AuthorizationCode{}).Where("user_id = ? AND used = ?", userID, false).
+		Update("used", true).Error; err != nil {
+		return fmt.Errorf("作废授权码失败: %w", err)
+	}
+	return nil
+}
+
+// EndSession 结束指定的会话，返回被结束的会话（会话不存在时返回 nil）
+func (s *AuthService) EndSession(sessionID string) (*models.Session, error) {
+	sessions, err := s.endSessions("session_id = ?", sessionID)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// endSessions 删除符合条件的会话，并通知在这些会话中获得授权的客户端
+func (s *AuthService) endSessions(query string, args ...interface{}) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := database.DB.Where(query, args...).Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if err := database.DB.Delete(&models.Session{}, ids).Error; err != nil {
+		return nil, fmt.Errorf("撤销会话失败: %w", err)
+	}
+
+	if s.logoutNotifier != nil {
+		s.logoutNotifier.SessionsEnded(sessions)
+	}
+	return sessions, nil
+}
+
+// hashSessionToken 计算会话令牌的哈希（数据库不保存令牌原文）
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken 生成 base64url 编码的随机字符串
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// truncate 截断过长的字符串（按字节，保证不超过数据库字段长度）
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// recordingNotifier 记录被通知结束的会话
+type recordingNotifier struct {
+	ended []string
+}
+
+func (n *recordingNotifier) SessionsEnded(sessions []models.Session) {
+	for _, session := range sessions {
+		n.ended = append(n.ended, session.SessionID)
+	}
+}
+
+func TestLoginSessionModes(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	createTestUser(t, s, "alice@example.com")
+
+	tests := []struct {
+		mode      string
+		wantToken bool // 响应中返回 JWT
+	}{
+		{mode: "", wantToken: true},
+		{mode: SessionModeToken, wantToken: true},
+		{mode: SessionModeCookie, wantToken: false},
+	}
+	for _, tt := range tests {
+		resp, err := s.Login(LoginRequest{Email: "alice@example.com", Password: testPassword, Mode: tt.mode})
+		if err != nil {
+			t.Fatalf("mode=%q: 登录失败: %v", tt.mode, err)
+		}
+		if (resp.Token != "") != tt.wantToken {
+			t.Errorf("mode=%q: 返回 JWT = %v，期望 %v", tt.mode, resp.Token != "", tt.wantToken)
+		}
+		// 两种方式都创建服务端会话，会话令牌写入 HttpOnly Cookie
+		if _, err := s.ValidateSession(resp.SessionToken); err != nil {
+			t.Errorf("mode=%q: 会话令牌无效: %v", tt.mode, err)
+		}
+	}
+}
+
+func TestValidateSessionAndToken(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+
+	live, liveToken, liveJWT := newTestSession(t, s, alice.ID)
+	expired, expiredToken, expiredJWT := newTestSession(t, s, alice.ID)
+	database.DB.Model(expired).Update("expires_at", time.Now().Add(-time.Minute))
+	revoked, revokedToken, revokedJWT := newTestSession(t, s, alice.ID)
+	if _, err := s.EndSession(revoked.SessionID); err != nil {
+		t.Fatalf("结束会话失败: %v", err)
+	}
+
+	// 签名正确但 sid 指向其他用户的会话
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": testIssuer, "user_id": alice.ID + 1, "sid": live.SessionID, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	forgedJWT, _ := forged.SignedString([]byte(testSecret))
+	noSID := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": testIssuer, "user_id": alice.ID, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	noSIDJWT, _ := noSID.SignedString([]byte(testSecret))
+
+	tests := []struct {
+		name      string
+		validate  func() (*SessionClaims, error)
+		wantValid bool
+	}{
+		{name: "有效的会话令牌", validate: func() (*SessionClaims, error) { return s.ValidateSession(liveToken) }, wantValid: true},
+		{name: "有效的登录 JWT", validate: func() (*SessionClaims, error) { return s.ValidateToken(liveJWT) }, wantValid: true},
+		{name: "未知的会话令牌", validate: func() (*SessionClaims, error) { return s.ValidateSession("unknown") }},
+		{name: "过期的会话令牌", validate: func() (*SessionClaims, error) { return s.ValidateSession(expiredToken) }},
+		{name: "过期会话的 JWT", validate: func() (*SessionClaims, error) { return s.ValidateToken(expiredJWT) }},
+		{name: "已退出会话的令牌", validate: func() (*SessionClaims, error) { return s.ValidateSession(revokedToken) }},
+		{name: "已退出会话的 JWT", validate: func() (*SessionClaims, error) { return s.ValidateToken(revokedJWT) }},
+		{name: "sid 属于其他用户的 JWT", validate: func() (*SessionClaims, error) { return s.ValidateToken(forgedJWT) }},
+		{name: "缺少 sid 的 JWT", validate: func() (*SessionClaims, error) { return s.ValidateToken(noSIDJWT) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.validate()
+			if tt.wantValid {
+				if err != nil {
+					t.Fatalf("期望有效，实际 %v", err)
+				}
+				if claims.UserID != alice.ID || claims.SessionID != live.SessionID {
+					t.Fatalf("会话信息不匹配: %+v", claims)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("期望无效，实际通过")
+			}
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tests := []struct {
+		name        string
+		revokeOwner bool // true 表示由会话所有者撤销，否则由其他用户撤销
+		sessionID   string
+		wantErr     error
+	}{
+		{name: "撤销自己的会话", revokeOwner: true},
+		{name: "不能撤销其他用户的会话", revokeOwner: false, wantErr: ErrSessionNotFound},
+		{name: "会话不存在", revokeOwner: true, sessionID: "missing", wantErr: ErrSessionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			notifier := &recordingNotifier{}
+			s.SetLogoutNotifier(notifier)
+			alice := createTestUser(t, s, "alice@example.com")
+			bob := createTestUser(t, s, "bob@example.com")
+			session, token, _ := newTestSession(t, s, alice.ID)
+
+			actor := bob.ID
+			if tt.revokeOwner {
+				actor = alice.ID
+			}
+			sessionID := session.SessionID
+			if tt.sessionID != "" {
+				sessionID = tt.sessionID
+			}
+			err := s.RevokeSession(actor, sessionID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+			}
+
+			_, validateErr := s.ValidateSession(token)
+			if tt.wantErr == nil {
+				if validateErr == nil {
+					t.Fatal("撤销后会话仍然有效")
+				}
+				if len(notifier.ended) != 1 || notifier.ended[0] != session.SessionID {
+					t.Fatalf("应通知结束的会话，实际 %v", notifier.ended)
+				}
+				return
+			}
+			if validateErr != nil {
+				t.Fatalf("撤销失败时会话不应失效: %v", validateErr)
+			}
+			if len(notifier.ended) != 0 {
+				t.Fatalf("撤销失败时不应发送通知，实际 %v", notifier.ended)
+			}
+		})
+	}
+}
+
+func TestRevokeCredentialsKeepsCurrentSession(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	bob := createTestUser(t, s, "bob@example.com")
+	current, currentToken, _ := newTestSession(t, s, alice.ID)
+	_, otherToken, _ := newTestSession(t, s, alice.ID)
+	_, bobToken, _ := newTestSession(t, s, bob.ID)
+
+	for _, record := range []interface{}{
+		&models.AccessToken{Token: "alice-token", ClientID: "c", UserID: alice.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		&models.AccessToken{Token: "bob-token", ClientID: "c", UserID: bob.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		&models.AuthorizationCode{Code: "alice-code", ClientID: "c", UserID: alice.ID, ExpiresAt: time.Now().Add(time.Minute)},
+	} {
+		if err := database.DB.Create(record).Error; err != nil {
+			t.Fatalf("创建测试数据失败: %v", err)
+		}
+	}
+
+	if err := s.revokeCredentials(alice.ID, current.SessionID); err != nil {
+		t.Fatalf("撤销失败: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		check     func() bool
+		wantValid bool
+	}{
+		{name: "当前会话保留", check: func() bool { _, err := s.ValidateSession(currentToken); return err == nil }, wantValid: true},
+		{name: "其他会话撤销", check: func() bool { _, err := s.ValidateSession(otherToken); return err == nil }},
+		{name: "其他用户的会话不受影响", check: func() bool { _, err := s.ValidateSession(bobToken); return err == nil }, wantValid: true},
+		{name: "Access Token 撤销", check: func() bool {
+			return database.DB.Where("token = ?", "alice-token").First(&models.AccessToken{}).Error == nil
+		}},
+		{name: "其他用户的 Access Token 不受影响", check: func() bool {
+			return database.DB.Where("token = ?", "bob-token").First(&models.AccessToken{}).Error == nil
+		}, wantValid: true},
+		{name: "未使用的授权码作废", check: func() bool {
+			var code models.AuthorizationCode
+			database.DB.Where("code = ?", "alice-code").First(&code)
+			return !code.Used
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check(); got != tt.wantValid {
+				t.Fatalf("有效 = %v，期望 %v", got, tt.wantValid)
+			}
+		})
+	}
+}
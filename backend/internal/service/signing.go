@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey ID Token 和注销 Token 使用的非对称签名密钥（RS256）
+// 客户端通过 JWKS 端点获取公钥验证签名
+type SigningKey struct {
+	KeyID      string          // 密钥标识（kid，取公钥的 JWK 指纹）
+	privateKey *rsa.PrivateKey // RSA 私钥
+}
+
+// LoadSigningKey 从 PEM 文件加载 RSA 私钥（PKCS#1 或 PKCS#8）
+func LoadSigningKey(path string) (*SigningKey, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("%s 中没有 PEM 数据", path)
+	}
+
+	var key interface{}
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("解析私钥失败: %w", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("签名密钥必须是 RSA 私钥")
+	}
+	return newSigningKey(rsaKey)
+}
+
+// GenerateSigningKey 生成临时签名密钥（服务重启后之前签发的 ID Token 将无法验证，只用于开发环境）
+func GenerateSigningKey() (*SigningKey, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %w", err)
+	}
+	return newSigningKey(rsaKey)
+}
+
+func newSigningKey(rsaKey *rsa.PrivateKey) (*SigningKey, error) {
+	key := &SigningKey{privateKey: rsaKey}
+	kid, err := key.publicJWK().Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = kid
+	return key, nil
+}
+
+// publicJWK 公钥的 JWK 表示
+func (k *SigningKey) publicJWK() *JWK {
+	return &JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(k.privateKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.privateKey.E)).Bytes()),
+	}
+}
+
+// JWK 用于 JWKS 端点发布的公钥
+func (k *SigningKey) JWK() JWK {
+	jwk := *k.publicJWK()
+	jwk.Kid = k.KeyID
+	jwk.Use = "sig"
+	jwk.Alg = jwt.SigningMethodRS256.Alg()
+	return jwk
+}
+
+// sign 使用 RS256 签名 JWT，typ 为空时使用默认的 JWT
+func (k *SigningKey) sign(claims jwt.MapClaims, typ string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.KeyID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(k.privateKey)
+}
+
+// parse 验证本密钥签发的 JWT 的签名（不校验声明，由调用方按用途校验）
+func (k *SigningKey) parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return &k.privateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("无效的 Token")
+	}
+	return claims, nil
+}
+
+// SetSigningKey 设置 ID Token 和注销 Token 的签名密钥
+func (s *OAuthService) SetSigningKey(key *SigningKey) {
+	s.signingKey = key
+}
+
+// JWKS 返回授权服务器的公钥集合（/.well-known/jwks.json）
+func (s *OAuthService) JWKS() []JWK {
+	if s.signingKey == nil {
+		return []JWK{}
+	}
+	return []JWK{s.signingKey.JWK()}
+}
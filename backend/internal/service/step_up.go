@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// StepUpRequest 提升当前会话认证级别的请求
+type StepUpRequest struct {
+	Continue string `json:"continue"` // 完成后需要恢复的授权请求（由授权端点签发）
+}
+
+// BeginStepUp 当前会话的认证级别不满足授权请求（acr_values）时，要求完成两步验证
+// 返回与登录第一步相同的 MFA 响应；用户还没有两步验证方式时需要先设置验证器。完成后更新原有会话，不创建新会话
+func (s *AuthService) BeginStepUp(session *SessionClaims, req StepUpRequest) (*LoginResponse, error) {
+	if req.Continue != "" {
+		if _, err := s.ParseContinuation(req.Continue); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueMFAToken(user, mfaPending{
+		UserID:   user.ID,
+		AMR:      session.AMR,
+		Continue: req.Continue,
+		StepUp:   session.SessionID,
+	})
+}
+
+// completeMFA 第二步验证通过：新的登录创建会话，提升认证级别时更新原有会话
+func (s *AuthService) completeMFA(user *models.User, pending *mfaPending, amr []string, info SessionInfo) (*LoginResponse, error) {
+	if pending.StepUp == "" {
+		return s.completeLogin(user, amr, pending.Continue, pending.Mode, info)
+	}
+
+	// 1. 更新会话的认证方式和认证时间（会话必须仍然有效且属于该用户）
+	result := database.DB.Model(&models.Session{}).
+		Where("session_id = ? AND user_id = ? AND expires_at > ?", pending.StepUp, user.ID, time.Now()).
+		Updates(map[string]interface{}{"amr": strings.Join(amr, " "), "auth_time": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("更新会话失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// 2. 会话令牌和 JWT 不变，只返回用户信息和需要恢复的授权请求
+	userResp := user.ToResponse()
+	resp := &LoginResponse{User: &userResp}
+	if pending.Continue != "" {
+		resp.RedirectURL = s.ResumeURL(pending.Continue)
+	}
+	return resp, nil
+}
+
+// appendAMR 在已有的认证方式后追加本次完成的认证方式，返回新的切片且不重复
+// 提升认证级别时已有的认证方式来自会话，多次提升不能让同一方式重复出现
+func appendAMR(amr []string, methods ...string) []string {
+	result := make([]string, 0, len(amr)+len(methods))
+	seen := make(map[string]bool, len(amr)+len(methods))
+	for _, list := range [][]string{amr, methods} {
+		for _, method := range list {
+			if !seen[method] {
+				seen[method] = true
+				result = append(result, method)
+			}
+		}
+	}
+	return result
+}
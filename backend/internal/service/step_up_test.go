@@ -0,0 +1,92 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStepUpDoesNotRepeatAMR(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	_, _, recovery := enrollTestTOTP(t, s, alice.ID)
+	_, token, err := s.CreateSession(alice.ID, time.Now(), []string{AMRPassword}, SessionInfo{})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	// 同一会话连续两次提升认证级别，认证方式不应重复
+	want := []string{AMRPassword, AMROTP, AMRMFA}
+	for i := 0; i < 2; i++ {
+		session, err := s.ValidateSession(token)
+		if err != nil {
+			t.Fatalf("验证会话失败: %v", err)
+		}
+		begin, err := s.BeginStepUp(session, StepUpRequest{})
+		if err != nil {
+			t.Fatalf("第 %d 次提升认证级别失败: %v", i+1, err)
+		}
+		if _, err := s.VerifyMFA(MFAVerifyRequest{MFAToken: begin.MFAToken, Code: recovery[i]}); err != nil {
+			t.Fatalf("第 %d 次两步验证失败: %v", i+1, err)
+		}
+
+		session, err = s.ValidateSession(token)
+		if err != nil {
+			t.Fatalf("验证会话失败: %v", err)
+		}
+		if !reflect.DeepEqual(session.AMR, want) {
+			t.Fatalf("第 %d 次提升后 amr = %v，期望 %v", i+1, session.AMR, want)
+		}
+	}
+}
+
+func TestStepUpRaisesSessionACR(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	_, _, recovery := enrollTestTOTP(t, s, alice.ID)
+	_, token, err := s.CreateSession(alice.ID, time.Now().Add(-time.Hour), []string{AMRPassword}, SessionInfo{})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	session, err := s.ValidateSession(token)
+	if err != nil {
+		t.Fatalf("验证会话失败: %v", err)
+	}
+	if SatisfiesACR(session.AMR, ACRMultiFactor) {
+		t.Fatal("密码登录的会话不应满足多因素要求")
+	}
+
+	// 1. 无效的 continuation 不能发起提升
+	if _, err := s.BeginStepUp(session, StepUpRequest{Continue: "forged"}); err == nil {
+		t.Fatal("无效的 continuation 应被拒绝")
+	}
+
+	// 2. 完成两步验证后同一会话达到多因素级别，认证时间更新，会话令牌不变
+	continuation, err := s.SignContinuation("client_id=test_client&acr_values=" + ACRMultiFactor)
+	if err != nil {
+		t.Fatalf("签发 continuation 失败: %v", err)
+	}
+	begin, err := s.BeginStepUp(session, StepUpRequest{Continue: continuation})
+	if err != nil {
+		t.Fatalf("提升认证级别失败: %v", err)
+	}
+	resp, err := s.VerifyMFA(MFAVerifyRequest{MFAToken: begin.MFAToken, Code: recovery[0]})
+	if err != nil {
+		t.Fatalf("两步验证失败: %v", err)
+	}
+	if resp.RedirectURL == "" {
+		t.Fatal("完成后应返回恢复授权请求的地址")
+	}
+	raised, err := s.ValidateSession(token)
+	if err != nil {
+		t.Fatalf("提升后原会话应仍然有效: %v", err)
+	}
+	if raised.SessionID != session.SessionID || !SatisfiesACR(raised.AMR, ACRMultiFactor) || ACRForAMR(raised.AMR) != ACRMultiFactor {
+		t.Fatalf("提升后的会话不正确: %+v", raised)
+	}
+	if !raised.AuthTime.After(session.AuthTime) {
+		t.Fatalf("认证时间未更新: %v", raised.AuthTime)
+	}
+}
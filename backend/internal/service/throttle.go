@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTooManyAttempts 认证失败次数过多，暂时锁定（具体等待时间见 ThrottledError）
+	ErrTooManyAttempts = errors.New("尝试次数过多，请稍后再试")
+	// ErrLockoutNotFound 锁定记录不存在
+	ErrLockoutNotFound = errors.New("锁定记录不存在")
+)
+
+// ThrottledError 认证被暂时锁定
+// errors.Is(err, ErrTooManyAttempts) 为 true
+type ThrottledError struct {
+	RetryAfter time.Duration // 距离解锁的时间
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("尝试次数过多，请在 %d 秒后重试", e.RetryAfterSeconds())
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// RetryAfterSeconds 距离解锁的秒数（向上取整，用于 Retry-After 响应头）
+func (e *ThrottledError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// ThrottleRule 某一类失败计数的限制
+type ThrottleRule struct {
+	MaxFailures int           // 连续失败多少次后开始锁定（0 表示不限制）
+	BaseDelay   time.Duration // 第一次锁定的时长，之后每次失败翻倍
+	MaxDelay    time.Duration // 锁定时长上限
+	Window      time.Duration // 超过该时间没有失败（且不在锁定中）则清零计数
+}
+
+// delay 第 failures 次失败后的锁定时长（未达到阈值时为 0）
+func (r ThrottleRule) delay(failures int) time.Duration {
+	if r.MaxFailures <= 0 || failures < r.MaxFailures {
+		return 0
+	}
+	delay := r.BaseDelay
+	for i := r.MaxFailures; i < failures && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	return delay
+}
+
+// Throttle 认证失败计数与锁定（按账户、IP、客户端分别统计，保存在数据库中，重启后仍然有效）
+type Throttle struct {
+	rules map[string]ThrottleRule
+}
+
+// NewThrottle 创建失败计数器，rules 的键为 models.ThrottleKind*
+func NewThrottle(rules map[string]ThrottleRule) *Throttle {
+	return &Throttle{rules: rules}
+}
+
+// DefaultThrottle 默认限制：同一账户连续失败 5 次、同一 IP 20 次、同一客户端 10 次后锁定 1 分钟，之后每次失败翻倍，最长 1 小时
+func DefaultThrottle() *Throttle {
+	rule := func(maxFailures int) ThrottleRule {
+		return ThrottleRule{MaxFailures: maxFailures, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	}
+	return NewThrottle(map[string]ThrottleRule{
+		models.ThrottleKindAccount: rule(5),
+		models.ThrottleKindIP:      rule(20),
+		models.ThrottleKindClient:  rule(10),
+	})
+}
+
+// throttleKey 规范化计数的键（邮箱不区分大小写）
+func throttleKey(kind, key string) string {
+	key = strings.TrimSpace(key)
+	if kind == models.ThrottleKindAccount {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// Check 检查是否处于锁定状态，锁定时返回 *ThrottledError
+// keys 为 类型 -> 键，任一被锁定即拒绝（返回最长的等待时间）；键为空时跳过
+func (t *Throttle) Check(keys map[string]string) error {
+	var retryAfter time.Duration
+	now := time.Now()
+	for kind, key := range keys {
+		if key = throttleKey(kind, key); key == "" || t.rules[kind].MaxFailures <= 0 {
+			continue
+		}
+		var record models.LoginThrottle
+		if err := database.DB.Where("kind = ? AND key = ?", kind, key).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return fmt.Errorf("查询失败计数失败: %w", err)
+		}
+		if record.IsLocked() && record.LockedUntil.Sub(now) > retryAfter {
+			retryAfter = record.LockedUntil.Sub(now)
+		}
+	}
+	if retryAfter > 0 {
+		return &ThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail 记录一次认证失败，返回本次失败是否开始了新一轮锁定（达到阈值的那一次，用于通知）
+func (t *Throttle) Fail(kind, key string) (bool, error) {
+	rule := t.rules[kind]
+	if key = throttleKey(kind, key); key == "" || rule.MaxFailures <= 0 {
+		return false, nil
+	}
+
+	started := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 查询或创建计数
+		now := time.Now()
+		record := models.LoginThrottle{Kind: kind, Key: key}
+		if err := tx.Where("kind = ? AND key = ?", kind, key).FirstOrCreate(&record).Error; err != nil {
+			return err
+		}
+
+		// 2. 一段时间没有失败（且已解锁）则重新计数
+		lastActivity := record.LastFailureAt
+		if record.LockedUntil != nil && record.LockedUntil.After(lastActivity) {
+			lastActivity = *record.LockedUntil
+		}
+		if now.Sub(lastActivity) > rule.Window {
+			record.Failures = 0
+			record.LockedUntil = nil
+		}
+
+		// 3. 累加失败次数，达到阈值后按指数退避锁定
+		record.Failures++
+		record.LastFailureAt = now
+		if delay := rule.delay(record.Failures); delay > 0 {
+			lockedUntil := now.Add(delay)
+			record.LockedUntil = &lockedUntil
+			started = record.Failures == rule.MaxFailures
+		}
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("记录失败计数失败: %w", err)
+	}
+	return started, nil
+}
+
+// Reset 认证成功后清零计数
+func (t *Throttle) Reset(kind, key string) error {
+	if key = throttleKey(kind, key); key == "" {
+		return nil
+	}
+	if err := database.DB.Where("kind = ? AND key = ?", kind, key).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return fmt.Errorf("清除失败计数失败: %w", err)
+	}
+	return nil
+}
+
+// Lockouts 列出有失败记录的计数（锁定中的排在前面）
+func (t *Throttle) Lockouts() ([]models.LoginThrottle, error) {
+	var records []models.LoginThrottle
+	if err := database.DB.Order("locked_until IS NULL, locked_until DESC, last_failure_at DESC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询失败计数失败: %w", err)
+	}
+	return records, nil
+}
+
+// Unlock 解除锁定并清零计数，返回被删除的记录
+func (t *Throttle) Unlock(id uint) (*models.LoginThrottle, error) {
+	var record models.LoginThrottle
+	if err := database.DB.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLockoutNotFound
+		}
+		return nil, fmt.Errorf("查询失败计数失败: %w", err)
+	}
+	if err := database.DB.Delete(&record).Error; err != nil {
+		return nil, fmt.Errorf("解除锁定失败: %w", err)
+	}
+	return &record, nil
+}
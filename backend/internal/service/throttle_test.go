@@ -0,0 +1,298 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+// testThrottleRule 测试使用的限制：连续失败 maxFailures 次后锁定 1 分钟，之后每次翻倍，最长 4 分钟
+func testThrottleRule(maxFailures int) ThrottleRule {
+	return ThrottleRule{MaxFailures: maxFailures, BaseDelay: time.Minute, MaxDelay: 4 * time.Minute, Window: time.Hour}
+}
+
+// lockedFor 返回计数记录剩余的锁定时间（没有记录或未锁定时为 0）
+func lockedFor(t *testing.T, kind, key string) time.Duration {
+	t.Helper()
+	var record models.LoginThrottle
+	if err := database.DB.Where("kind = ? AND key = ?", kind, key).First(&record).Error; err != nil || record.LockedUntil == nil {
+		return 0
+	}
+	return time.Until(*record.LockedUntil)
+}
+
+func TestThrottleRuleDelay(t *testing.T) {
+	rule := testThrottleRule(3)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Minute},
+		{failures: 4, want: 2 * time.Minute},
+		{failures: 5, want: 4 * time.Minute},
+		{failures: 6, want: 4 * time.Minute}, // 不超过上限
+		{failures: 50, want: 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := rule.delay(tt.failures); got != tt.want {
+			t.Errorf("第 %d 次失败: 锁定 %v，期望 %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := (ThrottleRule{}).delay(100); got != 0 {
+		t.Errorf("没有限制的规则不应锁定，实际 %v", got)
+	}
+}
+
+func TestThrottleFailAndCheck(t *testing.T) {
+	newTestDB(t)
+	throttle := NewThrottle(map[string]ThrottleRule{models.ThrottleKindAccount: testThrottleRule(3)})
+	keys := map[string]string{models.ThrottleKindAccount: "alice@example.com"}
+
+	// 1. 达到阈值前不锁定，达到阈值的那一次开始锁定，之后锁定时间翻倍但不再算作新一轮锁定
+	tests := []struct {
+		key         string // 提交的邮箱（计数不区分大小写）
+		wantStarted bool
+		wantLocked  time.Duration
+	}{
+		{key: "alice@example.com"},
+		{key: "Alice@Example.com"},
+		{key: " alice@example.com ", wantStarted: true, wantLocked: time.Minute},
+		{key: "ALICE@example.com", wantLocked: 2 * time.Minute},
+		{key: "alice@example.com", wantLocked: 4 * time.Minute},
+		{key: "alice@example.com", wantLocked: 4 * time.Minute},
+	}
+	for i, tt := range tests {
+		started, err := throttle.Fail(models.ThrottleKindAccount, tt.key)
+		if err != nil {
+			t.Fatalf("第 %d 次失败: %v", i+1, err)
+		}
+		if started != tt.wantStarted {
+			t.Errorf("第 %d 次失败: started = %v，期望 %v", i+1, started, tt.wantStarted)
+		}
+		locked := lockedFor(t, models.ThrottleKindAccount, "alice@example.com")
+		if locked > tt.wantLocked || locked < tt.wantLocked-5*time.Second {
+			t.Errorf("第 %d 次失败: 锁定 %v，期望 %v", i+1, locked, tt.wantLocked)
+		}
+	}
+
+	// 2. 锁定中检查返回剩余时间
+	var throttled *ThrottledError
+	if err := throttle.Check(keys); !errors.As(err, &throttled) || !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("锁定中: 期望 ThrottledError，实际 %v", err)
+	}
+	if throttled.RetryAfterSeconds() <= 0 || throttled.RetryAfter > 4*time.Minute {
+		t.Fatalf("RetryAfter = %v", throttled.RetryAfter)
+	}
+	// 其他类型和其他账户不受影响，未配置规则的类型不计数
+	if err := throttle.Check(map[string]string{models.ThrottleKindAccount: "bob@example.com", models.ThrottleKindIP: "alice@example.com"}); err != nil {
+		t.Fatalf("其他账户不应被锁定: %v", err)
+	}
+	if started, err := throttle.Fail(models.ThrottleKindIP, "203.0.113.1"); started || err != nil {
+		t.Fatalf("未配置规则的类型: started = %v，err = %v", started, err)
+	}
+
+	// 3. 锁定结束且超过计数窗口后重新计数
+	past := time.Now().Add(-2 * time.Hour)
+	database.DB.Model(&models.LoginThrottle{}).Where("key = ?", "alice@example.com").
+		Updates(map[string]interface{}{"last_failure_at": past, "locked_until": past})
+	if err := throttle.Check(keys); err != nil {
+		t.Fatalf("锁定结束后不应被拒绝: %v", err)
+	}
+	if started, _ := throttle.Fail(models.ThrottleKindAccount, "alice@example.com"); started {
+		t.Fatal("重新计数后第一次失败不应锁定")
+	}
+	if locked := lockedFor(t, models.ThrottleKindAccount, "alice@example.com"); locked > 0 {
+		t.Fatalf("重新计数后不应锁定，剩余 %v", locked)
+	}
+
+	// 4. 清零后不再锁定
+	throttle.Fail(models.ThrottleKindAccount, "alice@example.com")
+	throttle.Fail(models.ThrottleKindAccount, "alice@example.com")
+	if err := throttle.Reset(models.ThrottleKindAccount, "ALICE@example.com"); err != nil {
+		t.Fatalf("清零失败: %v", err)
+	}
+	if err := throttle.Check(keys); err != nil {
+		t.Fatalf("清零后不应被拒绝: %v", err)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	const (
+		ipA = "203.0.113.1"
+		ipB = "203.0.113.2"
+	)
+	tests := []struct {
+		name string
+		// run 执行登录尝试，返回最后一次需要检查的登录结果
+		run     func(t *testing.T, s *AuthService) error
+		wantErr error
+	}{
+		{
+			name: "账户锁定后其他 IP 使用正确密码也被拒绝",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "alice@example.com", ipA, 3)
+				return login(s, "alice@example.com", testPassword, ipB)
+			},
+			wantErr: ErrTooManyAttempts,
+		},
+		{
+			name: "账户锁定不区分邮箱大小写",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "Alice@Example.com", ipA, 3)
+				return login(s, "alice@example.com", testPassword, ipB)
+			},
+			wantErr: ErrTooManyAttempts,
+		},
+		{
+			name: "未锁定的账户可以登录",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "alice@example.com", ipA, 2)
+				return login(s, "alice@example.com", testPassword, ipA)
+			},
+		},
+		{
+			name: "登录成功清零账户的失败次数",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "alice@example.com", ipA, 2)
+				if err := login(s, "alice@example.com", testPassword, ipA); err != nil {
+					t.Fatalf("登录失败: %v", err)
+				}
+				failLogins(s, "alice@example.com", ipA, 2)
+				return login(s, "alice@example.com", testPassword, ipA)
+			},
+		},
+		{
+			name: "同一 IP 尝试多个账户后该 IP 被锁定",
+			run: func(t *testing.T, s *AuthService) error {
+				for i := 0; i < 5; i++ {
+					failLogins(s, fmt.Sprintf("user%d@example.com", i), ipA, 1)
+				}
+				return login(s, "alice@example.com", testPassword, ipA)
+			},
+			wantErr: ErrTooManyAttempts,
+		},
+		{
+			name: "IP 被锁定时其他 IP 不受影响",
+			run: func(t *testing.T, s *AuthService) error {
+				for i := 0; i < 5; i++ {
+					failLogins(s, fmt.Sprintf("user%d@example.com", i), ipA, 1)
+				}
+				return login(s, "alice@example.com", testPassword, ipB)
+			},
+		},
+		{
+			name: "登录成功不清零 IP 的失败次数",
+			run: func(t *testing.T, s *AuthService) error {
+				for i := 0; i < 4; i++ {
+					failLogins(s, fmt.Sprintf("user%d@example.com", i), ipA, 1)
+				}
+				if err := login(s, "alice@example.com", testPassword, ipA); err != nil {
+					t.Fatalf("登录失败: %v", err)
+				}
+				failLogins(s, "user4@example.com", ipA, 1)
+				return login(s, "alice@example.com", testPassword, ipA)
+			},
+			wantErr: ErrTooManyAttempts,
+		},
+		{
+			name: "不存在的账户同样计数和锁定",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "nobody@example.com", ipA, 3)
+				return login(s, "nobody@example.com", testPassword, ipB)
+			},
+			wantErr: ErrTooManyAttempts,
+		},
+		{
+			name: "管理员按记录解除锁定",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "alice@example.com", ipA, 3)
+				lockouts, err := s.Lockouts()
+				if err != nil {
+					t.Fatalf("查询锁定失败: %v", err)
+				}
+				for _, record := range lockouts {
+					if record.Kind == models.ThrottleKindAccount && record.IsLocked() {
+						if _, err := s.Unlock(record.ID, AuditContext{}); err != nil {
+							t.Fatalf("解除锁定失败: %v", err)
+						}
+					}
+				}
+				return login(s, "alice@example.com", testPassword, ipB)
+			},
+		},
+		{
+			name: "管理员按用户解除锁定",
+			run: func(t *testing.T, s *AuthService) error {
+				failLogins(s, "alice@example.com", ipA, 3)
+				var alice models.User
+				database.DB.Where("email = ?", "alice@example.com").First(&alice)
+				if err := s.UnlockUser(alice.ID, AuditContext{}); err != nil {
+					t.Fatalf("解除锁定失败: %v", err)
+				}
+				return login(s, "alice@example.com", testPassword, ipB)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newTestAuthService(t)
+			s.SetThrottle(NewThrottle(map[string]ThrottleRule{
+				models.ThrottleKindAccount: testThrottleRule(3),
+				models.ThrottleKindIP:      testThrottleRule(5),
+			}))
+			createTestUser(t, s, "alice@example.com")
+
+			err := tt.run(t, s)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("期望登录成功，实际 %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望 %v，实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoginLockoutNotifiesOwner(t *testing.T) {
+	newTestDB(t)
+	s := newTestAuthService(t)
+	s.SetThrottle(NewThrottle(map[string]ThrottleRule{models.ThrottleKindAccount: testThrottleRule(3)}))
+	alice := createTestUser(t, s, "alice@example.com")
+	outbox := newTestOutbox(t, s)
+
+	// 只有开始锁定的那一次通知账户所有者，继续失败不再重复通知
+	failLogins(s, "ALICE@example.com", "203.0.113.1", 5)
+	mails := waitForMails(t, outbox, 1)
+	if len(mails) != 1 || !strings.Contains(mails[0], "alice@example.com") || !strings.Contains(mails[0], "203.0.113.1") {
+		t.Fatalf("锁定通知邮件不正确: %v", mails)
+	}
+	var count int64
+	database.DB.Model(&models.AuditEvent{}).Where("user_id = ? AND action = ?", alice.ID, AuditAccountLocked).Count(&count)
+	if count != 1 {
+		t.Fatalf("锁定审计记录 %d 条，期望 1", count)
+	}
+}
+
+// login 使用邮箱和密码从指定 IP 登录
+func login(s *AuthService, email, password, ip string) error {
+	_, err := s.Login(LoginRequest{Email: email, Password: password, SessionInfo: SessionInfo{IPAddress: ip}})
+	return err
+}
+
+// failLogins 从指定 IP 使用错误密码登录 n 次
+func failLogins(s *AuthService, email, ip string, n int) {
+	for i := 0; i < n; i++ {
+		login(s, email, "wrong-password", ip)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidVerificationToken 邮件中的令牌无效、已使用或已过期
+	ErrInvalidVerificationToken = errors.New("链接无效或已过期")
+	// ErrTooManyEmails 邮件发送过于频繁
+	ErrTooManyEmails = errors.New("发送过于频繁，请稍后再试")
+)
+
+const (
+	emailResendInterval = time.Minute // 同一用途的邮件两次发送的最小间隔
+	emailHourlyLimit    = 5           // 同一用途的邮件每小时最多发送次数
+)
+
+// issueVerificationToken 为用户签发一次性令牌，返回令牌原文（只通过邮件发送，数据库只保存哈希）
+// 同一用途的邮件发送过于频繁时返回 ErrTooManyEmails；tx 为执行查询和保存的数据库连接（可以是事务）
+func issueVerificationToken(tx *gorm.DB, userID uint, purpose, email string, ttl time.Duration) (string, error) {
+	// 1. 限制发送频率
+	now := time.Now()
+	var recent []models.VerificationToken
+	if err := tx.Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, now.Add(-time.Hour)).
+		Order("created_at DESC").Find(&recent).Error; err != nil {
+		return "", fmt.Errorf("查询令牌失败: %w", err)
+	}
+	if len(recent) >= emailHourlyLimit || (len(recent) > 0 && now.Sub(recent[0].CreatedAt) < emailResendInterval) {
+		return "", ErrTooManyEmails
+	}
+
+	// 2. 生成令牌
+	token, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	record := &models.VerificationToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		TokenHash: hashSessionToken(token),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", fmt.Errorf("保存令牌失败: %w", err)
+	}
+	return token, nil
+}
+
+// consumeVerificationToken 使用一次性令牌：令牌有效且用途是 purposes 之一时标记为已使用并返回
+// 使用条件更新保证并发请求中只有一个能成功
+func consumeVerificationToken(token string, purposes ...string) (*models.VerificationToken, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	now := time.Now()
+	hash := hashSessionToken(token)
+	result := database.DB.Model(&models.VerificationToken{}).
+		Where("token_hash = ? AND purpose IN ? AND used_at IS NULL AND expires_at > ?", hash, purposes, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, fmt.Errorf("使用令牌失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var record models.VerificationToken
+	if err := database.DB.Where("token_hash = ?", hash).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, fmt.Errorf("查询令牌失败: %w", err)
+	}
+	return &record, nil
+}
+
+// findVerificationToken 查询有效的一次性令牌但不使用它（用于在使用前校验请求的其他部分）
+func findVerificationToken(token string, purposes ...string) (*models.VerificationToken, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	var record models.VerificationToken
+	err := database.DB.Where("token_hash = ? AND purpose IN ? AND used_at IS NULL AND expires_at > ?",
+		hashSessionToken(token), purposes, time.Now()).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, fmt.Errorf("查询令牌失败: %w", err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,701 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/database"
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidPasskey 通行密钥验证失败（签名、来源或凭证不正确）
+	ErrInvalidPasskey = errors.New("通行密钥验证失败")
+	// ErrInvalidWebAuthnChallenge 挑战不存在、已使用或已过期
+	ErrInvalidWebAuthnChallenge = errors.New("通行密钥验证已过期，请重试")
+	// ErrPasskeyExists 通行密钥已注册
+	ErrPasskeyExists = errors.New("该通行密钥已注册")
+	// ErrPasskeyNotFound 通行密钥不存在
+	ErrPasskeyNotFound = errors.New("通行密钥不存在")
+	// ErrPasskeyCloned 签名计数没有增加，凭证可能被复制
+	ErrPasskeyCloned = errors.New("通行密钥签名计数异常，可能已被复制")
+)
+
+const (
+	webauthnChallengeTTL = 5 * time.Minute // 用户需要在此时间内完成通行密钥操作
+	webauthnDefaultName  = "通行密钥"          // 用户没有起名时的通行密钥名称
+)
+
+// 认证器数据的标志位（WebAuthn Level 2 §6.1）
+const (
+	authDataUserPresent    = 0x01 // UP：用户在场（触摸了认证器）
+	authDataUserVerified   = 0x04 // UV：用户已验证（PIN、指纹等）
+	authDataBackupEligible = 0x08 // BE：凭证可以同步备份
+	authDataAttested       = 0x40 // AT：包含凭证数据（注册时）
+	authDataExtensions     = 0x80 // ED：包含扩展数据
+)
+
+// WebAuthnConfig 依赖方（本服务）配置
+type WebAuthnConfig struct {
+	RPID    string   // 依赖方标识（网站的域名，通行密钥绑定到该域名）
+	RPName  string   // 依赖方名称（认证器中显示）
+	Origins []string // 允许发起 WebAuthn 操作的页面来源（如 https://example.com）
+}
+
+// SetWebAuthn 设置 WebAuthn 依赖方配置
+func (s *AuthService) SetWebAuthn(config WebAuthnConfig) {
+	s.webauthn = config
+}
+
+// WebAuthnRelyingParty 依赖方信息
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity 注册时的用户信息（id 为用户句柄，不包含个人信息）
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// WebAuthnCredentialParameter 支持的凭证类型和签名算法
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// WebAuthnCredentialDescriptor 已注册凭证的描述（注册时排除，登录时允许）
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// WebAuthnAuthenticatorSelection 注册时对认证器的要求
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// PublicKeyCredentialCreationOptions 注册通行密钥的选项（navigator.credentials.create 的 publicKey 参数）
+// 二进制字段为 Base64URL 编码，可以直接交给 PublicKeyCredential.parseCreationOptionsFromJSON
+type PublicKeyCredentialCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// PublicKeyCredentialRequestOptions 使用通行密钥的选项（navigator.credentials.get 的 publicKey 参数）
+// allowCredentials 为空时由用户选择设备上保存的通行密钥（无密码登录）
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnCredentialJSON 浏览器返回的凭证（PublicKeyCredential.toJSON 的格式，二进制字段为 Base64URL）
+type WebAuthnCredentialJSON struct {
+	ID       string                        `json:"id" binding:"required"`
+	Type     string                        `json:"type"`
+	Response WebAuthnAuthenticatorResponse `json:"response"`
+}
+
+// WebAuthnAuthenticatorResponse 认证器的响应（注册时有 attestationObject，登录时有 authenticatorData 和 signature）
+type WebAuthnAuthenticatorResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"`
+	AuthenticatorData string   `json:"authenticatorData,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	UserHandle        string   `json:"userHandle,omitempty"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// PasskeyRegisterRequest 注册通行密钥请求
+type PasskeyRegisterRequest struct {
+	Name       string                 `json:"name" binding:"max=100"`        // 通行密钥名称（可选）
+	Credential WebAuthnCredentialJSON `json:"credential" binding:"required"` // navigator.credentials.create 的结果
+}
+
+// PasskeyLoginRequest 使用通行密钥登录请求（无密码）
+type PasskeyLoginRequest struct {
+	Credential WebAuthnCredentialJSON `json:"credential" binding:"required"`               // navigator.credentials.get 的结果
+	Continue   string                 `json:"continue"`                                    // 登录后需要恢复的授权请求（可选）
+	Mode       string                 `json:"mode" binding:"omitempty,oneof=token cookie"` // 登录方式：token（默认）或 cookie
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// PasskeyMFARequest 使用通行密钥完成两步验证请求
+type PasskeyMFARequest struct {
+	MFAToken   string                 `json:"mfa_token" binding:"required"`  // 登录第一步返回的 MFA 令牌
+	Credential WebAuthnCredentialJSON `json:"credential" binding:"required"` // navigator.credentials.get 的结果
+
+	SessionInfo `json:"-"` // 登录设备信息（由处理器填写）
+}
+
+// clientData 浏览器生成并由认证器签名的 clientDataJSON
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData 解析后的认证器数据
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte // 以下字段只在注册时存在
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// BeginPasskeyRegistration 生成注册通行密钥的选项
+func (s *AuthService) BeginPasskeyRegistration(userID uint) (*PublicKeyCredentialCreationOptions, error) {
+	// 1. 用户句柄在第一次注册时生成，之后所有通行密钥共用
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.WebAuthnID == "" {
+		handle, err := randomToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("生成用户句柄失败: %w", err)
+		}
+		if err := database.DB.Model(&models.User{}).Where("id = ? AND (web_authn_id = '' OR web_authn_id IS NULL)", user.ID).
+			Update("web_authn_id", handle).Error; err != nil {
+			return nil, fmt.Errorf("保存用户句柄失败: %w", err)
+		}
+		if user, err = s.GetUserByID(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 已注册的通行密钥不能重复注册
+	credentials, err := s.ListPasskeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := newWebAuthnChallenge(models.WebAuthnPurposeRegister, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]WebAuthnCredentialParameter, 0, len(coseAlgorithms))
+	for _, alg := range coseAlgorithms {
+		params = append(params, WebAuthnCredentialParameter{Type: "public-key", Alg: alg})
+	}
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Email
+	}
+	return &PublicKeyCredentialCreationOptions{
+		Challenge:          challenge,
+		RP:                 WebAuthnRelyingParty{ID: s.webauthn.RPID, Name: s.webauthn.RPName},
+		User:               WebAuthnUserEntity{ID: user.WebAuthnID, Name: user.Email, DisplayName: displayName},
+		PubKeyCredParams:   params,
+		Timeout:            webauthnChallengeTTL.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(credentials),
+		// 要求可发现凭证，以便不输入邮箱直接登录
+		AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "preferred",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishPasskeyRegistration 验证认证器的注册响应并保存通行密钥
+// 不要求也不验证认证器的证明（attestation），只保存公钥
+func (s *AuthService) FinishPasskeyRegistration(userID uint, req PasskeyRegisterRequest, ctx AuditContext) (*models.WebAuthnCredential, error) {
+	// 1. 验证 clientDataJSON（类型、来源、挑战）
+	response := req.Credential.Response
+	rawClientData, err := base64.RawURLEncoding.DecodeString(response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	challenge, err := s.verifyClientData(rawClientData, "webauthn.create", models.WebAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	// 2. 解析 attestationObject 中的认证器数据
+	rawAttestation, err := base64.RawURLEncoding.DecodeString(response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	decoded, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidPasskey
+	}
+	rawAuthData, _ := attestation["authData"].([]byte)
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAuthenticatorData(authData, false); err != nil {
+		return nil, err
+	}
+	if authData.Flags&authDataAttested == 0 || !bytes.Equal(authData.CredentialID, decodeCredentialID(req.Credential.ID)) {
+		return nil, ErrInvalidPasskey
+	}
+
+	// 3. 解析公钥（只接受注册选项中声明的算法）
+	key, err := parseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	// 4. 保存通行密钥
+	credentialID := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	var count int64
+	if err := database.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credentialID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrPasskeyExists
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = webauthnDefaultName
+	}
+	credential := &models.WebAuthnCredential{
+		UserID:         userID,
+		CredentialID:   credentialID,
+		PublicKey:      authData.PublicKey,
+		Algorithm:      key.Algorithm,
+		SignCount:      authData.SignCount,
+		Transports:     strings.Join(response.Transports, " "),
+		AAGUID:         formatAAGUID(authData.AAGUID),
+		BackupEligible: authData.Flags&authDataBackupEligible != 0,
+		Name:           name,
+	}
+	if err := database.DB.Create(credential).Error; err != nil {
+		return nil, fmt.Errorf("保存通行密钥失败: %w", err)
+	}
+
+	recordAudit(userID, AuditPasskeyAdded, ctx, map[string]interface{}{"name": credential.Name})
+	return credential, nil
+}
+
+// BeginPasskeyLogin 生成无密码登录的选项（由用户选择设备上保存的通行密钥）
+func (s *AuthService) BeginPasskeyLogin() (*PublicKeyCredentialRequestOptions, error) {
+	challenge, err := newWebAuthnChallenge(models.WebAuthnPurposeLogin, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKeyCredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webauthnChallengeTTL.Milliseconds(),
+		RPID:             s.webauthn.RPID,
+		AllowCredentials: []WebAuthnCredentialDescriptor{},
+		UserVerification: "required",
+	}, nil
+}
+
+// FinishPasskeyLogin 使用通行密钥登录（无密码）
+// 认证器已验证用户（PIN、指纹等），通行密钥本身就是多因素认证，不再要求两步验证
+func (s *AuthService) FinishPasskeyLogin(req PasskeyLoginRequest) (*LoginResponse, error) {
+	// 0. 校验登录后需要恢复的授权请求
+	if req.Continue != "" {
+		if _, err := s.ParseContinuation(req.Continue); err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. 检查 IP 是否因多次失败被锁定（此时还不知道账户）
+	login := LoginRequest{SessionInfo: req.SessionInfo}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return nil, err
+	}
+
+	// 2. 验证签名，找到通行密钥所属的用户
+	user, err := s.verifyPasskeyAssertion(req.Credential, models.WebAuthnPurposeLogin, 0, true, AuditContext{SessionInfo: req.SessionInfo})
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasskey) || errors.Is(err, ErrPasskeyCloned) {
+			s.recordLoginFailure(login, nil)
+		}
+		return nil, err
+	}
+
+	// 3. 要求验证邮箱后才能登录
+	if s.emailVerification == EmailVerificationLogin && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 4. 创建会话
+	return s.completeLogin(user, []string{AMRHardwareKey, AMRMFA}, req.Continue, req.Mode, req.SessionInfo)
+}
+
+// BeginPasskeyMFA 生成使用通行密钥完成两步验证的选项（只允许该用户的通行密钥）
+func (s *AuthService) BeginPasskeyMFA(mfaToken string) (*PublicKeyCredentialRequestOptions, error) {
+	pending, err := s.parseMFAToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.ListPasskeys(pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		return nil, ErrPasskeyNotFound
+	}
+	challenge, err := newWebAuthnChallenge(models.WebAuthnPurposeMFA, pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKeyCredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webauthnChallengeTTL.Milliseconds(),
+		RPID:             s.webauthn.RPID,
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: "discouraged",
+	}, nil
+}
+
+// FinishPasskeyMFA 登录第二步：使用通行密钥代替 TOTP 验证码，通过后创建会话
+func (s *AuthService) FinishPasskeyMFA(req PasskeyMFARequest) (*LoginResponse, error) {
+	// 1. 验证 MFA 令牌
+	pending, err := s.parseMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserByID(pending.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// 2. 验证通行密钥，失败计入账户和 IP 的失败次数
+	login := LoginRequest{Email: user.Email, SessionInfo: req.SessionInfo}
+	if err := s.checkLoginThrottle(login); err != nil {
+		return nil, err
+	}
+	if _, err := s.verifyPasskeyAssertion(req.Credential, models.WebAuthnPurposeMFA, user.ID, false, AuditContext{ActorID: user.ID, SessionInfo: req.SessionInfo}); err != nil {
+		if errors.Is(err, ErrInvalidPasskey) || errors.Is(err, ErrPasskeyCloned) {
+			s.recordLoginFailure(login, user)
+		}
+		return nil, err
+	}
+	s.resetLoginThrottle(login)
+
+	// 3. 创建会话（提升认证级别时更新原有会话）
+	amr := appendAMR(pending.AMR, AMRHardwareKey, AMRMFA)
+	return s.completeMFA(user, pending, amr, req.SessionInfo)
+}
+
+// ListPasskeys 列出用户的通行密钥
+func (s *AuthService) ListPasskeys(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+	return credentials, nil
+}
+
+// DeletePasskey 删除用户的通行密钥
+// 账户要求两步验证且没有启用 TOTP 时，不能删除最后一个通行密钥
+func (s *AuthService) DeletePasskey(userID, id uint, ctx AuditContext) error {
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPasskeyNotFound
+		}
+		return fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.MFARequired && !user.MFAEnabled() {
+		var count int64
+		if err := database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("查询通行密钥失败: %w", err)
+		}
+		if count <= 1 {
+			return ErrMFARequired
+		}
+	}
+
+	if err := database.DB.Delete(&credential).Error; err != nil {
+		return fmt.Errorf("删除通行密钥失败: %w", err)
+	}
+	recordAudit(userID, AuditPasskeyRemoved, ctx, map[string]interface{}{"name": credential.Name})
+	return nil
+}
+
+// hasPasskeys 用户是否注册了通行密钥（可以作为两步验证的第二步）
+func (s *AuthService) hasPasskeys(userID uint) bool {
+	var count int64
+	if err := database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		log.Printf("查询用户 %d 的通行密钥失败: %v", userID, err)
+		return false
+	}
+	return count > 0
+}
+
+// verifyPasskeyAssertion 验证认证器的签名响应，更新签名计数，返回通行密钥所属的用户
+// userID 不为 0 时凭证必须属于该用户；requireUV 要求认证器验证了用户（无密码登录）
+func (s *AuthService) verifyPasskeyAssertion(credentialJSON WebAuthnCredentialJSON, purpose string, userID uint, requireUV bool, ctx AuditContext) (*models.User, error) {
+	// 1. 验证 clientDataJSON（类型、来源、挑战）
+	response := credentialJSON.Response
+	rawClientData, err := base64.RawURLEncoding.DecodeString(response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	challenge, err := s.verifyClientData(rawClientData, "webauthn.get", purpose)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	// 2. 查找通行密钥和用户（无密码登录时用户句柄必须与凭证的用户一致）
+	var credential models.WebAuthnCredential
+	credentialID := base64.RawURLEncoding.EncodeToString(decodeCredentialID(credentialJSON.ID))
+	if err := database.DB.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPasskey
+		}
+		return nil, fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+	if userID != 0 && credential.UserID != userID {
+		return nil, ErrInvalidPasskey
+	}
+	user, err := s.GetUserByID(credential.UserID)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	if response.UserHandle != "" || userID == 0 {
+		handle, err := base64.RawURLEncoding.DecodeString(response.UserHandle)
+		if err != nil || user.WebAuthnID == "" || subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(handle)), []byte(user.WebAuthnID)) != 1 {
+			return nil, ErrInvalidPasskey
+		}
+	}
+
+	// 3. 验证认证器数据和签名（签名内容为 authenticatorData || SHA-256(clientDataJSON)）
+	rawAuthData, err := base64.RawURLEncoding.DecodeString(response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(response.Signature)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	key, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("解析通行密钥公钥失败: %w", err)
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	if !key.Verify(append(rawAuthData, clientDataHash[:]...), signature) {
+		return nil, ErrInvalidPasskey
+	}
+
+	// 4. 签名计数必须增加（都为 0 表示认证器不支持计数）；条件更新防止并发使用同一计数
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		recordAudit(user.ID, AuditPasskeyCloned, ctx, map[string]interface{}{"name": credential.Name})
+		return nil, ErrPasskeyCloned
+	}
+	result := database.DB.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", credential.ID, credential.SignCount).
+		Updates(map[string]interface{}{"sign_count": authData.SignCount, "last_used_at": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("更新通行密钥失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 && authData.SignCount != 0 {
+		return nil, ErrPasskeyCloned
+	}
+	return user, nil
+}
+
+// verifyClientData 验证 clientDataJSON 的类型和来源，并使用其中的挑战（每个挑战只能使用一次）
+func (s *AuthService) verifyClientData(raw []byte, typ, purpose string) (*models.WebAuthnChallenge, error) {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	if data.Type != typ || data.CrossOrigin || !s.allowedWebAuthnOrigin(data.Origin) {
+		return nil, ErrInvalidPasskey
+	}
+	return consumeWebAuthnChallenge(data.Challenge, purpose)
+}
+
+// allowedWebAuthnOrigin 页面来源是否允许使用通行密钥
+func (s *AuthService) allowedWebAuthnOrigin(origin string) bool {
+	for _, allowed := range s.webauthn.Origins {
+		if origin == strings.TrimSuffix(allowed, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAuthenticatorData 验证认证器数据的依赖方标识和用户在场、用户验证标志
+func (s *AuthService) checkAuthenticatorData(authData *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(s.webauthn.RPID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return ErrInvalidPasskey
+	}
+	if authData.Flags&authDataUserPresent == 0 {
+		return ErrInvalidPasskey
+	}
+	if requireUV && authData.Flags&authDataUserVerified == 0 {
+		return ErrInvalidPasskey
+	}
+	return nil
+}
+
+// parseAuthenticatorData 解析认证器数据（WebAuthn Level 2 §6.1）
+// rpIdHash(32) | flags(1) | signCount(4) | [aaguid(16) | credIdLen(2) | credId | credentialPublicKey] | [extensions]
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidPasskey
+	}
+	authData := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	// 注册时包含凭证ID和公钥
+	if authData.Flags&authDataAttested != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidPasskey
+		}
+		authData.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, ErrInvalidPasskey
+		}
+		authData.CredentialID, rest = rest[:idLength], rest[idLength:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+		}
+		authData.PublicKey, rest = rest[:len(rest)-len(after)], after
+	}
+
+	// 扩展数据不使用，只检查格式
+	if authData.Flags&authDataExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidPasskey
+	}
+	return authData, nil
+}
+
+// newWebAuthnChallenge 生成挑战并保存其哈希
+func newWebAuthnChallenge(purpose string, userID uint) (string, error) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("生成挑战失败: %w", err)
+	}
+	record := &models.WebAuthnChallenge{
+		ChallengeHash: hashSessionToken(challenge),
+		Purpose:       purpose,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webauthnChallengeTTL),
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return "", fmt.Errorf("保存挑战失败: %w", err)
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge 使用挑战，条件更新保证同一挑战在并发请求中只能使用一次
+func consumeWebAuthnChallenge(challenge, purpose string) (*models.WebAuthnChallenge, error) {
+	if challenge == "" {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	now := time.Now()
+	hash := hashSessionToken(challenge)
+	result := database.DB.Model(&models.WebAuthnChallenge{}).
+		Where("challenge_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, fmt.Errorf("使用挑战失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	var record models.WebAuthnChallenge
+	if err := database.DB.Where("challenge_hash = ?", hash).First(&record).Error; err != nil {
+		return nil, fmt.Errorf("查询挑战失败: %w", err)
+	}
+	return &record, nil
+}
+
+// credentialDescriptors 把通行密钥转换为注册、登录选项中的凭证描述
+func credentialDescriptors(credentials []models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: credential.TransportList(),
+		})
+	}
+	return descriptors
+}
+
+// decodeCredentialID 解码浏览器提交的凭证ID（Base64URL，兼容带填充的写法）
+func decodeCredentialID(id string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(id, "="))
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// formatAAGUID 把认证器型号标识格式化为 UUID
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/NeoForeverYoung/shadow-oauth/backend/internal/models"
+)
+
+const (
+	testRPID   = "auth.example.com"         // 测试使用的依赖方标识
+	testOrigin = "https://auth.example.com" // 测试使用的页面来源
+)
+
+// newWebAuthnTestService 创建配置了 WebAuthn 依赖方的认证服务
+func newWebAuthnTestService(t *testing.T) *AuthService {
+	t.Helper()
+	s := newTestAuthService(t)
+	s.SetWebAuthn(WebAuthnConfig{RPID: testRPID, RPName: "Shadow OAuth", Origins: []string{testOrigin}})
+	return s
+}
+
+// softAuthenticator 进程内的软件认证器（ES256，attestation 格式为 none），同时扮演浏览器生成 clientDataJSON
+// 与 cmd/soft_authenticator 的行为一致；字段可以在测试中修改以构造异常的响应
+type softAuthenticator struct {
+	rpID        string // 认证器计算 rpIdHash 使用的依赖方标识
+	origin      string // 浏览器填写的页面来源
+	crossOrigin bool   // 是否在跨域 iframe 中调用
+	flags       byte   // 认证器数据的标志位
+	signCount   uint32 // 签名计数（每次签名前加一）
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("生成凭证ID失败: %v", err)
+	}
+	return &softAuthenticator{
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        authDataUserPresent | authDataUserVerified,
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// create 对注册选项生成 navigator.credentials.create 的结果
+func (a *softAuthenticator) create(t *testing.T, options *PublicKeyCredentialCreationOptions) WebAuthnCredentialJSON {
+	t.Helper()
+	a.userHandle = options.User.ID
+
+	// 认证器数据：rpIdHash | flags | signCount | aaguid | credIdLen | credId | COSE 公钥
+	coseKey := cborTestMap(
+		[]interface{}{int64(1), int64(2)},            // kty: EC2
+		[]interface{}{int64(3), int64(coseAlgES256)}, // alg: ES256
+		[]interface{}{int64(-1), int64(1)},           // crv: P-256
+		[]interface{}{int64(-2), a.key.X.FillBytes(make([]byte, 32))},
+		[]interface{}{int64(-3), a.key.Y.FillBytes(make([]byte, 32))},
+	)
+	attested := make([]byte, 16) // aaguid 全为 0（软件认证器）
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(append(attested, a.credentialID...), coseKey...)
+	attestationObject := cborTestMap(
+		[]interface{}{"fmt", "none"},
+		[]interface{}{"attStmt", cborTestMap()},
+		[]interface{}{"authData", a.authenticatorData(a.flags|authDataAttested, a.signCount, attested)},
+	)
+	return WebAuthnCredentialJSON{
+		ID:   base64.RawURLEncoding.EncodeToString(a.credentialID),
+		Type: "public-key",
+		Response: WebAuthnAuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", options.Challenge)),
+			AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// get 对挑战签名，生成 navigator.credentials.get 的结果
+func (a *softAuthenticator) get(t *testing.T, challenge string) WebAuthnCredentialJSON {
+	t.Helper()
+	a.signCount++
+	authData := a.authenticatorData(a.flags, a.signCount, nil)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return WebAuthnCredentialJSON{
+		ID:   base64.RawURLEncoding.EncodeToString(a.credentialID),
+		Type: "public-key",
+		Response: WebAuthnAuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+			AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+			Signature:         base64.RawURLEncoding.EncodeToString(signature),
+			UserHandle:        a.userHandle,
+		},
+	}
+}
+
+// authenticatorData 生成认证器数据
+func (a *softAuthenticator) authenticatorData(flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+// clientData 生成浏览器的 clientDataJSON
+func (a *softAuthenticator) clientData(t *testing.T, typ, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.origin, CrossOrigin: a.crossOrigin})
+	if err != nil {
+		t.Fatalf("生成 clientDataJSON 失败: %v", err)
+	}
+	return data
+}
+
+// registerTestPasskey 为用户注册软件认证器的通行密钥
+func registerTestPasskey(t *testing.T, s *AuthService, userID uint, a *softAuthenticator) *models.WebAuthnCredential {
+	t.Helper()
+	options, err := s.BeginPasskeyRegistration(userID)
+	if err != nil {
+		t.Fatalf("获取注册选项失败: %v", err)
+	}
+	credential, err := s.FinishPasskeyRegistration(userID, PasskeyRegisterRequest{Credential: a.create(t, options)}, AuditContext{ActorID: userID})
+	if err != nil {
+		t.Fatalf("注册通行密钥失败: %v", err)
+	}
+	return credential
+}
+
+// passkeyLogin 使用通行密钥完成一次无密码登录
+func passkeyLogin(t *testing.T, s *AuthService, a *softAuthenticator) (*LoginResponse, error) {
+	t.Helper()
+	options, err := s.BeginPasskeyLogin()
+	if err != nil {
+		t.Fatalf("获取登录选项失败: %v", err)
+	}
+	return s.FinishPasskeyLogin(PasskeyLoginRequest{Credential: a.get(t, options.Challenge)})
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(a *softAuthenticator)
+		before  func(t *testing.T, s *AuthService, userID uint, options *PublicKeyCredentialCreationOptions) // 认证器响应之前执行
+		after   func(c *WebAuthnCredentialJSON)                                                              // 修改认证器的响应
+		wantErr error
+	}{
+		{name: "注册成功"},
+		{name: "来源不匹配", mutate: func(a *softAuthenticator) { a.origin = "https://evil.example.com" }, wantErr: ErrInvalidPasskey},
+		{name: "跨域调用", mutate: func(a *softAuthenticator) { a.crossOrigin = true }, wantErr: ErrInvalidPasskey},
+		{name: "rpIdHash 不匹配", mutate: func(a *softAuthenticator) { a.rpID = "evil.example.com" }, wantErr: ErrInvalidPasskey},
+		{name: "用户不在场", mutate: func(a *softAuthenticator) { a.flags = authDataUserVerified }, wantErr: ErrInvalidPasskey},
+		{
+			name: "挑战重放",
+			before: func(t *testing.T, s *AuthService, userID uint, options *PublicKeyCredentialCreationOptions) {
+				// 另一个认证器先用同一个挑战完成注册
+				other := newSoftAuthenticator(t)
+				if _, err := s.FinishPasskeyRegistration(userID, PasskeyRegisterRequest{Credential: other.create(t, options)}, AuditContext{}); err != nil {
+					t.Fatalf("第一次注册失败: %v", err)
+				}
+			},
+			wantErr: ErrInvalidWebAuthnChallenge,
+		},
+		{
+			name: "登录挑战不能用于注册",
+			before: func(t *testing.T, s *AuthService, userID uint, options *PublicKeyCredentialCreationOptions) {
+				login, _ := s.BeginPasskeyLogin()
+				options.Challenge = login.Challenge
+			},
+			wantErr: ErrInvalidWebAuthnChallenge,
+		},
+		{
+			name: "凭证ID与认证器数据不一致",
+			after: func(c *WebAuthnCredentialJSON) {
+				c.ID = base64.RawURLEncoding.EncodeToString([]byte("another-credential"))
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newWebAuthnTestService(t)
+			alice := createTestUser(t, s, "alice@example.com")
+			a := newSoftAuthenticator(t)
+			if tt.mutate != nil {
+				tt.mutate(a)
+			}
+
+			options, err := s.BeginPasskeyRegistration(alice.ID)
+			if err != nil {
+				t.Fatalf("获取注册选项失败: %v", err)
+			}
+			if tt.before != nil {
+				tt.before(t, s, alice.ID, options)
+			}
+			credential := a.create(t, options)
+			if tt.after != nil {
+				tt.after(&credential)
+			}
+
+			saved, err := s.FinishPasskeyRegistration(alice.ID, PasskeyRegisterRequest{Name: "测试", Credential: credential}, AuditContext{ActorID: alice.ID})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("注册失败: %v", err)
+			}
+			if saved.UserID != alice.ID || saved.Algorithm != coseAlgES256 || saved.CredentialID != credential.ID {
+				t.Fatalf("保存的通行密钥不正确: %+v", saved)
+			}
+
+			// 同一凭证不能重复注册
+			again, _ := s.BeginPasskeyRegistration(alice.ID)
+			if len(again.ExcludeCredentials) != 1 || again.ExcludeCredentials[0].ID != credential.ID {
+				t.Fatalf("注册选项应排除已注册的凭证: %+v", again.ExcludeCredentials)
+			}
+			if _, err := s.FinishPasskeyRegistration(alice.ID, PasskeyRegisterRequest{Credential: a.create(t, again)}, AuditContext{}); !errors.Is(err, ErrPasskeyExists) {
+				t.Fatalf("重复注册: 期望 %v，实际 %v", ErrPasskeyExists, err)
+			}
+		})
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, s *AuthService, a *softAuthenticator) // 登录前对已注册的认证器执行的操作
+		tamper  func(t *testing.T, s *AuthService, c *WebAuthnCredentialJSON)
+		replay  bool // 先成功登录一次，再原样提交同一个响应
+		wantErr error
+	}{
+		{name: "登录成功"},
+		{name: "连续登录签名计数递增", prepare: func(t *testing.T, s *AuthService, a *softAuthenticator) {
+			if _, err := passkeyLogin(t, s, a); err != nil {
+				t.Fatalf("第一次登录失败: %v", err)
+			}
+		}},
+		{name: "来源不匹配", prepare: func(t *testing.T, s *AuthService, a *softAuthenticator) { a.origin = "https://evil.example.com" }, wantErr: ErrInvalidPasskey},
+		{name: "rpIdHash 不匹配", prepare: func(t *testing.T, s *AuthService, a *softAuthenticator) { a.rpID = "evil.example.com" }, wantErr: ErrInvalidPasskey},
+		{name: "无密码登录要求用户验证", prepare: func(t *testing.T, s *AuthService, a *softAuthenticator) { a.flags = authDataUserPresent }, wantErr: ErrInvalidPasskey},
+		{name: "挑战重放", replay: true, wantErr: ErrInvalidWebAuthnChallenge},
+		{
+			name: "签名计数回退",
+			prepare: func(t *testing.T, s *AuthService, a *softAuthenticator) {
+				if _, err := passkeyLogin(t, s, a); err != nil {
+					t.Fatalf("第一次登录失败: %v", err)
+				}
+				a.signCount = 0 // 复制出的认证器从旧的计数继续
+			},
+			wantErr: ErrPasskeyCloned,
+		},
+		{
+			name: "签名无效",
+			tamper: func(t *testing.T, s *AuthService, c *WebAuthnCredentialJSON) {
+				other := newSoftAuthenticator(t)
+				options, _ := s.BeginPasskeyLogin()
+				c.Response.Signature = other.get(t, options.Challenge).Response.Signature
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+		{
+			name: "用户句柄属于其他用户",
+			tamper: func(t *testing.T, s *AuthService, c *WebAuthnCredentialJSON) {
+				c.Response.UserHandle = base64.RawURLEncoding.EncodeToString([]byte("someone-else"))
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+		{
+			name: "未注册的凭证",
+			tamper: func(t *testing.T, s *AuthService, c *WebAuthnCredentialJSON) {
+				c.ID = base64.RawURLEncoding.EncodeToString([]byte("unknown"))
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			s := newWebAuthnTestService(t)
+			alice := createTestUser(t, s, "alice@example.com")
+			a := newSoftAuthenticator(t)
+			registerTestPasskey(t, s, alice.ID, a)
+			if tt.prepare != nil {
+				tt.prepare(t, s, a)
+			}
+
+			options, err := s.BeginPasskeyLogin()
+			if err != nil {
+				t.Fatalf("获取登录选项失败: %v", err)
+			}
+			credential := a.get(t, options.Challenge)
+			if tt.tamper != nil {
+				tt.tamper(t, s, &credential)
+			}
+			if tt.replay {
+				if _, err := s.FinishPasskeyLogin(PasskeyLoginRequest{Credential: credential}); err != nil {
+					t.Fatalf("第一次登录失败: %v", err)
+				}
+			}
+
+			resp, err := s.FinishPasskeyLogin(PasskeyLoginRequest{Credential: credential})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("登录失败: %v", err)
+			}
+			claims, err := s.ValidateToken(resp.Token)
+			if err != nil || claims.UserID != alice.ID {
+				t.Fatalf("登录 Token 无效: %v %+v", err, claims)
+			}
+			if fmt.Sprint(claims.AMR) != fmt.Sprint([]string{AMRHardwareKey, AMRMFA}) {
+				t.Fatalf("amr = %v", claims.AMR)
+			}
+			passkeys, _ := s.ListPasskeys(alice.ID)
+			if passkeys[0].SignCount != a.signCount || passkeys[0].LastUsedAt == nil {
+				t.Fatalf("签名计数 = %d，期望 %d", passkeys[0].SignCount, a.signCount)
+			}
+		})
+	}
+}
+
+func TestPasskeyMFA(t *testing.T) {
+	newTestDB(t)
+	s := newWebAuthnTestService(t)
+	alice := createTestUser(t, s, "alice@example.com")
+	bob := createTestUser(t, s, "bob@example.com")
+	a := newSoftAuthenticator(t)
+	registerTestPasskey(t, s, alice.ID, a)
+	bobKey := newSoftAuthenticator(t)
+	registerTestPasskey(t, s, bob.ID, bobKey)
+
+	// 注册通行密钥后密码登录需要第二步
+	first, err := s.Login(LoginRequest{Email: alice.Email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("登录第一步失败: %v", err)
+	}
+	if !first.MFARequired || !contains(first.MFAMethods, MFAMethodWebAuthn) {
+		t.Fatalf("期望要求通行密钥两步验证，实际 %+v", first)
+	}
+
+	options, err := s.BeginPasskeyMFA(first.MFAToken)
+	if err != nil {
+		t.Fatalf("获取两步验证选项失败: %v", err)
+	}
+	if len(options.AllowCredentials) != 1 || options.AllowCredentials[0].ID != base64.RawURLEncoding.EncodeToString(a.credentialID) {
+		t.Fatalf("只应允许该用户的通行密钥: %+v", options.AllowCredentials)
+	}
+
+	// 其他用户的通行密钥不能完成第二步
+	if _, err := s.FinishPasskeyMFA(PasskeyMFARequest{MFAToken: first.MFAToken, Credential: bobKey.get(t, options.Challenge)}); !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("其他用户的通行密钥: 期望 %v，实际 %v", ErrInvalidPasskey, err)
+	}
+	// 两步验证的挑战不能用于无密码登录
+	options, _ = s.BeginPasskeyMFA(first.MFAToken)
+	if _, err := s.FinishPasskeyLogin(PasskeyLoginRequest{Credential: a.get(t, options.Challenge)}); !errors.Is(err, ErrInvalidWebAuthnChallenge) {
+		t.Fatalf("挑战用途不符: 期望 %v，实际 %v", ErrInvalidWebAuthnChallenge, err)
+	}
+
+	// 第二步不要求用户验证（UV）
+	a.flags = authDataUserPresent
+	options, _ = s.BeginPasskeyMFA(first.MFAToken)
+	resp, err := s.FinishPasskeyMFA(PasskeyMFARequest{MFAToken: first.MFAToken, Credential: a.get(t, options.Challenge)})
+	if err != nil {
+		t.Fatalf("第二步验证失败: %v", err)
+	}
+	claims, err := s.ValidateToken(resp.Token)
+	if err != nil || claims.UserID != alice.ID || ACRForAMR(claims.AMR) != ACRMultiFactor {
+		t.Fatalf("登录 Token 不正确: %v %+v", err, claims)
+	}
+}
+
+// cborTestRaw 已编码的 CBOR 数据（作为映射的值时原样写入）
+type cborTestRaw []byte
+
+// cborTestMap 按给定顺序编码 CBOR 映射（每项为 [键, 值]）
+func cborTestMap(entries ...[]interface{}) cborTestRaw {
+	out := cborTestRaw(cborTestHead(5, uint64(len(entries))))
+	for _, entry := range entries {
+		out = append(out, cborTestValue(entry[0])...)
+		out = append(out, cborTestValue(entry[1])...)
+	}
+	return out
+}
+
+// cborTestValue 编码整数、字节串、文本和已编码的数据
+func cborTestValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborTestHead(1, uint64(-1-v))
+		}
+		return cborTestHead(0, uint64(v))
+	case string:
+		return append(cborTestHead(3, uint64(len(v))), v...)
+	case cborTestRaw:
+		return v
+	case []byte:
+		return append(cborTestHead(2, uint64(len(v))), v...)
+	}
+	panic(fmt.Sprintf("不支持的 CBOR 类型 %T", value))
+}
+
+// cborTestHead 编码类型和长度
+func cborTestHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultTemplates 内置的页面模板
+//
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// layoutFile 所有页面共用的布局模板，页面模板通过 {{define "title"}} 和 {{define "content"}} 填充
+const layoutFile = "layout.html"
+
+// Pages 授权服务器托管的页面
+var Pages = []string{"login", "email_login", "mfa", "register", "consent", "device", "logout", "verify_email", "forgot_password", "reset_password", "error"}
+
+// Renderer 页面渲染器
+type Renderer struct {
+	pages map[string]*template.Template
+}
+
+// NewRenderer 加载页面模板
+// dirs 为覆盖模板的目录，按顺序查找同名文件（如 login.html、layout.html），都没有时使用内置模板
+func NewRenderer(dirs []string) (*Renderer, error) {
+	layout, err := readTemplate(dirs, layoutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string]*template.Template, len(Pages))
+	for _, name := range Pages {
+		content, err := readTemplate(dirs, name+".html")
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Parse(layout)
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", layoutFile, err)
+		}
+		if _, err := tmpl.Parse(content); err != nil {
+			return nil, fmt.Errorf("解析 %s.html 失败: %w", name, err)
+		}
+		pages[name] = tmpl
+	}
+	return &Renderer{pages: pages}, nil
+}
+
+// readTemplate 读取模板文件，优先使用覆盖目录中的同名文件
+func readTemplate(dirs []string, file string) (string, error) {
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("读取模板 %s 失败: %w", file, err)
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("读取内置模板 %s 失败: %w", file, err)
+	}
+	return string(data), nil
+}
+
+// Render 渲染页面，出错时不会输出不完整的内容
+func (r *Renderer) Render(name string, data interface{}) ([]byte, error) {
+	tmpl, ok := r.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("页面 %s 不存在", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return nil, fmt.Errorf("渲染页面 %s 失败: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRendererOverrides(t *testing.T) {
+	// write 在目录中写入覆盖模板
+	write := func(dir, file, content string) {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatalf("写入模板失败: %v", err)
+		}
+	}
+	first, second := t.TempDir(), t.TempDir()
+	write(first, "login.html", `{{define "title"}}登录{{end}}{{define "content"}}first-login {{.CSRFToken}}{{end}}`)
+	write(second, "login.html", `{{define "title"}}登录{{end}}{{define "content"}}second-login{{end}}`)
+	write(second, "error.html", `{{define "title"}}出错了{{end}}{{define "content"}}second-error {{.Code}}{{end}}`)
+
+	tests := []struct {
+		name    string
+		dirs    []string
+		page    string
+		data    map[string]interface{}
+		want    string // 渲染结果应包含的内容
+		notWant string // 渲染结果不应包含的内容
+	}{
+		{name: "没有覆盖目录时使用内置模板", page: "login", data: map[string]interface{}{"CSRFToken": "t"}, want: `name="csrf_token" value="t"`},
+		{name: "覆盖目录中的模板优先于内置模板", dirs: []string{first}, page: "login", data: map[string]interface{}{"CSRFToken": "t"}, want: "first-login t", notWant: `name="csrf_token"`},
+		{name: "按顺序使用第一个目录中的模板", dirs: []string{first, second}, page: "login", want: "first-login", notWant: "second-login"},
+		{name: "前面的目录没有时查找后面的目录", dirs: []string{first, second}, page: "error", data: map[string]interface{}{"Code": "access_denied"}, want: "second-error access_denied"},
+		{name: "都没有时使用内置模板", dirs: []string{first, second}, page: "consent", want: "<form"},
+		{name: "覆盖的页面使用内置布局", dirs: []string{first}, page: "login", want: "<html"},
+		{name: "模板中的内容会被转义", dirs: []string{first}, page: "login", data: map[string]interface{}{"CSRFToken": "<b>t</b>"}, want: "&lt;b&gt;t&lt;/b&gt;", notWant: "<b>t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer, err := NewRenderer(tt.dirs)
+			if err != nil {
+				t.Fatalf("加载模板失败: %v", err)
+			}
+			body, err := renderer.Render(tt.page, tt.data)
+			if err != nil {
+				t.Fatalf("渲染失败: %v", err)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Fatalf("渲染结果缺少 %q:\n%s", tt.want, body)
+			}
+			if tt.notWant != "" && strings.Contains(string(body), tt.notWant) {
+				t.Fatalf("渲染结果不应包含 %q:\n%s", tt.notWant, body)
+			}
+		})
+	}
+
+	// 覆盖的布局模板对所有页面生效
+	layoutDir := t.TempDir()
+	write(layoutDir, "layout.html", `{{define "layout"}}custom-layout {{template "content" .}}{{end}}`)
+	renderer, err := NewRenderer([]string{layoutDir})
+	if err != nil {
+		t.Fatalf("加载模板失败: %v", err)
+	}
+	if body, err := renderer.Render("error", map[string]interface{}{"Code": "x"}); err != nil || !strings.HasPrefix(string(body), "custom-layout") {
+		t.Fatalf("覆盖的布局模板没有生效: %s, %v", body, err)
+	}
+
+	// 覆盖模板语法错误时加载失败，不会带着错误的模板启动
+	broken := t.TempDir()
+	write(broken, "login.html", `{{define "content"}}{{.Unclosed{{end}}`)
+	if _, err := NewRenderer([]string{broken}); err == nil {
+		t.Fatal("期望加载失败")
+	}
+}
@@ -2,14 +2,16 @@
 
 import { useEffect, useState } from 'react';
 import { useRouter } from 'next/navigation';
-import { getCurrentUser, User } from '@/lib/api';
+import { getCurrentUser, getPasskeyRegistrationOptions, registerPasskey, User } from '@/lib/api';
 import { isAuthenticated, logout } from '@/lib/auth';
+import { createPasskey, passkeySupported } from '@/lib/webauthn';
 
 export default function DashboardPage() {
   const router = useRouter();
   const [user, setUser] = useState<User | null>(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
+  const [passkeyMessage, setPasskeyMessage] = useState('');
 
   // 检查认证状态并获取用户信息
   useEffect(() => {
@@ -51,6 +53,20 @@ export default function DashboardPage() {
     logout();
   };
 
+  // 注册通行密钥（之后可以不输入密码直接登录，或在两步验证时使用）
+  const handleRegisterPasskey = async () => {
+    setPasskeyMessage('');
+    try {
+      const options = await getPasskeyRegistrationOptions();
+      const credential = await createPasskey(options.data);
+      const response = await registerPasskey(credential);
+      setPasskeyMessage(response.success ? '通行密钥已注册' : response.error || '注册通行密钥失败');
+    } catch (err: any) {
+      console.error('注册通行密钥错误:', err);
+      setPasskeyMessage(err.response?.data?.error || '注册通行密钥失败，请重试');
+    }
+  };
+
   // 加载中状态
   if (loading) {
     return (
@@ -141,6 +157,21 @@ export default function DashboardPage() {
           </div>
         </div>
 
+        {/* 通行密钥卡片 */}
+        {passkeySupported() && (
+          <div className="bg-white rounded-lg shadow-xl p-8 mb-6">
+            <h3 className="text-lg font-semibold text-gray-900 mb-4">🔑 通行密钥</h3>
+            <p className="text-gray-600 mb-4">注册通行密钥后，可以使用指纹、面容或设备 PIN 直接登录，无需输入密码</p>
+            <button
+              onClick={handleRegisterPasskey}
+              className="bg-indigo-600 text-white px-4 py-2 rounded-lg hover:bg-indigo-700 transition-colors text-sm font-medium"
+            >
+              注册通行密钥
+            </button>
+            {passkeyMessage && <p className="text-sm text-gray-700 mt-3">{passkeyMessage}</p>}
+          </div>
+        )}
+
         {/* 功能状态卡片 */}
         <div className="bg-white rounded-lg shadow-xl p-8">
           <h3 className="text-lg font-semibold text-gray-900 mb-4">✅ 已实现功能</h3>
@@ -3,6 +3,7 @@
 import { useEffect, useState } from 'react';
 import { useRouter, useSearchParams } from 'next/navigation';
 import Link from 'next/link';
+import { submitConsent } from '@/lib/api';
 
 export default function AuthorizePage() {
   const router = useRouter();
@@ -33,35 +34,23 @@ export default function AuthorizePage() {
     setLoading(false);
   }, [clientId, redirectUri, responseType]);
 
-  // 处理授权同意
-  const handleApprove = () => {
-    if (!clientId || !redirectUri) return;
-
-    // 构建授权 URL（后端会自动处理授权码生成和重定向）
-    const authorizeUrl = new URL('/oauth/authorize', 'http://localhost:8080');
-    authorizeUrl.searchParams.set('client_id', clientId);
-    authorizeUrl.searchParams.set('redirect_uri', redirectUri);
-    authorizeUrl.searchParams.set('response_type', 'code');
-    if (state) {
-      authorizeUrl.searchParams.set('state', state);
+  // 提交用户的决定，后端返回需要跳转的客户端地址（带授权码或错误信息）
+  const submitDecision = async (approve: boolean) => {
+    try {
+      const response = await submitConsent(searchParams.toString(), approve);
+      if (response.data) {
+        window.location.href = response.data.redirect_url;
+      }
+    } catch (err: any) {
+      setError(err.response?.data?.message || '授权失败');
     }
-
-    // 跳转到后端授权端点（需要登录）
-    window.location.href = authorizeUrl.toString();
   };
 
+  // 处理授权同意
+  const handleApprove = () => submitDecision(true);
+
   // 处理拒绝授权
-  const handleDeny = () => {
-    if (!redirectUri) return;
-
-    // 重定向回客户端，带上错误信息
-    const denyUrl = new URL(redirectUri);
-    denyUrl.searchParams.set('error', 'access_denied');
-    if (state) {
-      denyUrl.searchParams.set('state', state);
-    }
-    window.location.href = denyUrl.toString();
-  };
+  const handleDeny = () => submitDecision(false);
 
   if (loading) {
     return (
@@ -1,18 +1,45 @@
 'use client';
 
-import { useState } from 'react';
-import { useRouter } from 'next/navigation';
-import { login } from '@/lib/api';
-import { setToken, setUser } from '@/lib/auth';
+import { useEffect, useState } from 'react';
+import { useRouter, useSearchParams } from 'next/navigation';
+import {
+  login,
+  stepUp,
+  sendEmailLogin,
+  verifyEmailLogin,
+  verifyMFA,
+  setupTOTP,
+  getPasskeyLoginOptions,
+  passkeyLogin,
+  getPasskeyMFAOptions,
+  passkeyMFA,
+  LoginResponse,
+  TOTPSetup,
+} from '@/lib/api';
+import { getPasskey, passkeySupported } from '@/lib/webauthn';
+import { isAuthenticated, setToken, setUser } from '@/lib/auth';
 
 export default function LoginForm() {
   const router = useRouter();
+  const searchParams = useSearchParams();
+  // 从授权端点跳转过来时携带的 continuation，登录成功后回到授权端点继续授权
+  const continuation = searchParams.get('continue') || undefined;
   const [formData, setFormData] = useState({
-    email: '',
+    email: searchParams.get('login_hint') || '',
     password: '',
   });
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
+  // 两步验证：密码正确后的 MFA 令牌、需要先设置的验证器、首次启用后展示的恢复码
+  const [mfaToken, setMfaToken] = useState('');
+  const [mfaMethods, setMfaMethods] = useState<string[]>([]);
+  const [totpSetup, setTotpSetup] = useState<TOTPSetup | null>(null);
+  const [mfaCode, setMfaCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [completed, setCompleted] = useState<LoginResponse | null>(null);
+  // 邮件登录：已发送验证码时显示验证码输入框
+  const [emailSent, setEmailSent] = useState(false);
+  const [emailCode, setEmailCode] = useState('');
 
   // 处理表单输入变化
   const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
@@ -40,6 +67,53 @@ export default function LoginForm() {
     return true;
   };
 
+  // 登录完成：保存 Token 和用户信息，恢复授权请求或跳转到仪表盘（提升认证级别时沿用原有 Token）
+  const finishLogin = (data: LoginResponse) => {
+    if (data.token) {
+      setToken(data.token);
+    }
+    if (data.user) {
+      setUser(data.user);
+    }
+    if (data.redirect_url) {
+      window.location.href = data.redirect_url;
+    } else {
+      router.push('/dashboard');
+    }
+  };
+
+  // 第一步认证通过：启用了两步验证时进入第二步（必须启用但尚未设置时先获取验证器密钥），否则完成登录
+  const handleFirstFactor = async (data: LoginResponse) => {
+    if (data.mfa_required) {
+      setMfaToken(data.mfa_token!);
+      setMfaMethods(data.mfa_methods || []);
+      if (data.mfa_enrollment_required) {
+        const setup = await setupTOTP(data.mfa_token);
+        setTotpSetup(setup.data || null);
+      }
+      return;
+    }
+    finishLogin(data);
+  };
+
+  // 授权请求要求更高的认证级别（step_up=1）：已登录时直接对当前会话进行两步验证
+  useEffect(() => {
+    if (!searchParams.get('step_up') || !isAuthenticated()) {
+      return;
+    }
+    stepUp(continuation)
+      .then((response) => {
+        if (response.success && response.data) {
+          return handleFirstFactor(response.data);
+        }
+      })
+      .catch((err: any) => {
+        console.error('两步验证错误:', err);
+        setError(err.response?.data?.error || err.response?.data?.message || '请重新登录');
+      });
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
   // 处理表单提交
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -52,15 +126,10 @@ export default function LoginForm() {
     setError('');
 
     try {
-      const response = await login(formData.email, formData.password);
+      const response = await login(formData.email, formData.password, continuation);
       
       if (response.success && response.data) {
-        // 保存 Token 和用户信息
-        setToken(response.data.token);
-        setUser(response.data.user);
-        
-        // 登录成功，跳转到仪表盘
-        router.push('/dashboard');
+        await handleFirstFactor(response.data);
       } else {
         setError(response.error || '登录失败，请稍后重试');
       }
@@ -72,6 +141,254 @@ export default function LoginForm() {
     }
   };
 
+  // 发送邮件登录验证码（只需要邮箱）
+  const handleSendEmail = async () => {
+    if (!/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(formData.email)) {
+      setError('请输入正确的邮箱');
+      return;
+    }
+
+    setLoading(true);
+    setError('');
+
+    try {
+      const response = await sendEmailLogin(formData.email, continuation);
+      if (response.success) {
+        setEmailSent(true);
+      } else {
+        setError(response.error || '发送失败，请稍后重试');
+      }
+    } catch (err: any) {
+      console.error('发送登录邮件错误:', err);
+      setError(err.response?.data?.error || err.response?.data?.message || '发送失败，请稍后重试');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // 提交邮件中的验证码
+  const handleEmailCodeSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+
+    setLoading(true);
+    setError('');
+
+    try {
+      const response = await verifyEmailLogin(emailCode);
+      if (response.success && response.data) {
+        await handleFirstFactor(response.data);
+      } else {
+        setError(response.error || '验证失败，请稍后重试');
+      }
+    } catch (err: any) {
+      console.error('邮件登录错误:', err);
+      setError(err.response?.data?.error || err.response?.data?.message || '验证失败，请重新获取验证码');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // 提交两步验证码
+  const handleMFASubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+
+    setLoading(true);
+    setError('');
+
+    try {
+      const response = await verifyMFA(mfaToken, mfaCode);
+
+      if (response.success && response.data) {
+        // 首次启用时先展示恢复码，用户确认保存后再继续
+        if (response.data.recovery_codes?.length) {
+          setRecoveryCodes(response.data.recovery_codes);
+          setCompleted(response.data);
+          return;
+        }
+        finishLogin(response.data);
+      } else {
+        setError(response.error || '验证失败，请稍后重试');
+      }
+    } catch (err: any) {
+      console.error('两步验证错误:', err);
+      setError(err.response?.data?.error || err.response?.data?.message || '验证失败，请重新登录');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // 使用通行密钥：无密码登录，或在两步验证时代替验证码
+  const handlePasskey = async () => {
+    setLoading(true);
+    setError('');
+
+    try {
+      const options = mfaToken ? await getPasskeyMFAOptions(mfaToken) : await getPasskeyLoginOptions();
+      const credential = await getPasskey(options.data);
+      const response = mfaToken ? await passkeyMFA(mfaToken, credential) : await passkeyLogin(credential, continuation);
+
+      if (response.success && response.data) {
+        finishLogin(response.data);
+      } else {
+        setError(response.error || '通行密钥验证失败');
+      }
+    } catch (err: any) {
+      console.error('通行密钥错误:', err);
+      setError(err.response?.data?.error || err.response?.data?.message || '通行密钥验证失败，请重试');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // 展示恢复码
+  if (completed) {
+    return (
+      <div className="space-y-6">
+        <div className="bg-yellow-50 border border-yellow-200 text-yellow-800 px-4 py-3 rounded-lg text-sm">
+          已启用两步验证！请将以下恢复码保存在安全的地方。丢失验证器时，每个恢复码可以代替验证码使用一次，这些恢复码只显示这一次。
+        </div>
+        <pre className="bg-gray-100 p-4 rounded-lg text-sm font-mono">{recoveryCodes.join('\n')}</pre>
+        <button
+          type="button"
+          onClick={() => finishLogin(completed)}
+          className="w-full bg-indigo-600 text-white py-3 px-4 rounded-lg font-medium hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-indigo-500 focus:ring-offset-2 transition-all"
+        >
+          我已保存，继续
+        </button>
+      </div>
+    );
+  }
+
+  // 两步验证
+  if (mfaToken) {
+    return (
+      <form onSubmit={handleMFASubmit} className="space-y-6">
+        {error && (
+          <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg text-sm">
+            {error}
+          </div>
+        )}
+
+        {totpSetup ? (
+          <div className="space-y-2 text-sm text-gray-700">
+            <p>您的账户必须启用两步验证。请在验证器应用中添加以下密钥，然后输入生成的 6 位验证码</p>
+            <pre className="bg-gray-100 p-3 rounded-lg font-mono break-all whitespace-pre-wrap">{totpSetup.secret}</pre>
+            <a href={totpSetup.otpauth_uri} className="text-indigo-600 hover:underline">
+              在本设备的验证器应用中打开
+            </a>
+          </div>
+        ) : mfaMethods.includes('totp') ? (
+          <p className="text-sm text-gray-700">请输入验证器应用中的 6 位验证码，或一个恢复码</p>
+        ) : (
+          <p className="text-sm text-gray-700">请使用您注册的通行密钥完成验证</p>
+        )}
+
+        {(totpSetup || mfaMethods.includes('totp')) && (
+          <>
+            <div>
+              <label htmlFor="code" className="block text-sm font-medium text-gray-700 mb-2">
+                验证码
+              </label>
+              <input
+                type="text"
+                id="code"
+                name="code"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                value={mfaCode}
+                onChange={(e) => {
+                  setMfaCode(e.target.value);
+                  setError('');
+                }}
+                required
+                autoFocus
+                className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent transition-all"
+              />
+            </div>
+
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-indigo-600 text-white py-3 px-4 rounded-lg font-medium hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-indigo-500 focus:ring-offset-2 transition-all disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {loading ? '验证中...' : '验证'}
+            </button>
+          </>
+        )}
+
+        {mfaMethods.includes('webauthn') && passkeySupported() && (
+          <button
+            type="button"
+            onClick={handlePasskey}
+            disabled={loading}
+            className="w-full bg-gray-100 text-gray-700 py-3 px-4 rounded-lg font-medium hover:bg-gray-200 transition-all disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            使用通行密钥
+          </button>
+        )}
+      </form>
+    );
+  }
+
+  // 邮件登录验证码
+  if (emailSent) {
+    return (
+      <form onSubmit={handleEmailCodeSubmit} className="space-y-6">
+        {error && (
+          <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg text-sm">
+            {error}
+          </div>
+        )}
+
+        <p className="text-sm text-gray-700">
+          如果该邮箱已注册，登录邮件已发送到 {formData.email}。请输入邮件中的 6 位验证码（10 分钟内有效），或在本浏览器中点击邮件中的链接
+        </p>
+
+        <div>
+          <label htmlFor="email-code" className="block text-sm font-medium text-gray-700 mb-2">
+            验证码
+          </label>
+          <input
+            type="text"
+            id="email-code"
+            name="email-code"
+            inputMode="numeric"
+            autoComplete="one-time-code"
+            maxLength={6}
+            value={emailCode}
+            onChange={(e) => {
+              setEmailCode(e.target.value);
+              setError('');
+            }}
+            required
+            autoFocus
+            className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent transition-all"
+          />
+        </div>
+
+        <button
+          type="submit"
+          disabled={loading}
+          className="w-full bg-indigo-600 text-white py-3 px-4 rounded-lg font-medium hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-indigo-500 focus:ring-offset-2 transition-all disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          {loading ? '验证中...' : '登录'}
+        </button>
+
+        <button
+          type="button"
+          onClick={() => {
+            setEmailSent(false);
+            setEmailCode('');
+            setError('');
+          }}
+          className="w-full text-sm text-indigo-600 hover:underline"
+        >
+          没有收到？返回重新发送
+        </button>
+      </form>
+    );
+  }
+
   return (
     <form onSubmit={handleSubmit} className="space-y-6">
       {/* 错误提示 */}
@@ -123,6 +440,28 @@ export default function LoginForm() {
       >
         {loading ? '登录中...' : '登录'}
       </button>
+
+      {/* 通行密钥登录（无需输入邮箱和密码） */}
+      {passkeySupported() && (
+        <button
+          type="button"
+          onClick={handlePasskey}
+          disabled={loading}
+          className="w-full bg-gray-100 text-gray-700 py-3 px-4 rounded-lg font-medium hover:bg-gray-200 transition-all disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          使用通行密钥登录
+        </button>
+      )}
+
+      {/* 邮件登录（只需要填写邮箱） */}
+      <button
+        type="button"
+        onClick={handleSendEmail}
+        disabled={loading}
+        className="w-full bg-gray-100 text-gray-700 py-3 px-4 rounded-lg font-medium hover:bg-gray-200 transition-all disabled:opacity-50 disabled:cursor-not-allowed"
+      >
+        发送邮件验证码登录
+      </button>
     </form>
   );
 }
@@ -38,9 +38,9 @@ export default function RegisterForm() {
       return false;
     }
 
-    // 密码长度验证
-    if (formData.password.length < 6) {
-      setError('密码必须至少 6 个字符');
+    // 密码长度验证（与后端默认密码策略一致，其他规则由后端检查）
+    if (formData.password.length < 8) {
+      setError('密码必须至少 8 个字符');
       return false;
     }
 
@@ -136,7 +136,7 @@ export default function RegisterForm() {
           onChange={handleChange}
           required
           className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent transition-all"
-          placeholder="至少 6 个字符"
+          placeholder="至少 8 个字符"
         />
       </div>
 
@@ -9,6 +9,7 @@ const apiClient = axios.create({
   headers: {
     'Content-Type': 'application/json',
   },
+  withCredentials: true, // 允许后端写入授权服务器会话 Cookie
 });
 
 // 请求拦截器：自动添加 JWT Token
@@ -57,14 +58,29 @@ export interface User {
   id: number;
   email: string;
   name: string;
+  mfa_enabled?: boolean;
+  mfa_required?: boolean;
+  roles?: string[]; // 角色（/api/auth/me 返回，如 admin）
   created_at: string;
   updated_at: string;
 }
 
 // 登录响应类型
 export interface LoginResponse {
-  token: string;
-  user: User;
+  token?: string;
+  user?: User;
+  redirect_url?: string; // 携带 continue 登录时，需要跳转回授权端点的地址
+  mfa_required?: boolean; // 需要输入两步验证码（使用 mfa_token 调用 verifyMFA）
+  mfa_enrollment_required?: boolean; // 账户必须先设置验证器
+  mfa_token?: string;
+  mfa_methods?: string[]; // 可以使用的第二步验证方式（totp、webauthn）
+  recovery_codes?: string[]; // 首次启用两步验证时生成的恢复码
+}
+
+// 验证器设置信息
+export interface TOTPSetup {
+  secret: string;
+  otpauth_uri: string;
 }
 
 // 注册请求
@@ -78,20 +94,116 @@ export const register = async (email: string, password: string, name?: string) =
 };
 
 // 登录请求
-export const login = async (email: string, password: string) => {
+export const login = async (email: string, password: string, continuation?: string) => {
   const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/login', {
     email,
     password,
+    continue: continuation,
+  });
+  return response.data;
+};
+
+// 邮件登录：发送登录链接和 6 位验证码（后端写入浏览器绑定 Cookie，验证码只能在本浏览器中使用）
+export const sendEmailLogin = async (email: string, continuation?: string) => {
+  const response = await apiClient.post<ApiResponse<{ expires_in: number }>>('/api/auth/email-login', {
+    email,
+    continue: continuation,
+  });
+  return response.data;
+};
+
+export const verifyEmailLogin = async (code: string) => {
+  const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/email-login/verify', { code });
+  return response.data;
+};
+
+// 提升当前会话的认证级别（授权请求要求两步验证时，授权端点跳转到登录页并带上 step_up=1）
+// 响应与登录第一步相同，完成第二步验证后沿用当前会话，不返回新的 token
+export const stepUp = async (continuation?: string) => {
+  const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/step-up', {
+    continue: continuation,
+  });
+  return response.data;
+};
+
+// 登录第二步：提交两步验证码或恢复码
+export const verifyMFA = async (mfaToken: string, code: string) => {
+  const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/mfa/verify', {
+    mfa_token: mfaToken,
+    code,
+  });
+  return response.data;
+};
+
+// 获取验证器密钥（登录时要求先启用两步验证的账户使用 MFA 令牌）
+export const setupTOTP = async (mfaToken?: string) => {
+  const response = await apiClient.post<ApiResponse<TOTPSetup>>('/api/auth/mfa/totp/setup', {
+    mfa_token: mfaToken,
+  });
+  return response.data;
+};
+
+// 使用通行密钥登录（无密码）：先获取选项，由浏览器签名后提交
+export const getPasskeyLoginOptions = async () => {
+  const response = await apiClient.post<ApiResponse<any>>('/api/auth/webauthn/login/options', {});
+  return response.data;
+};
+
+export const passkeyLogin = async (credential: any, continuation?: string) => {
+  const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/webauthn/login', {
+    credential,
+    continue: continuation,
+  });
+  return response.data;
+};
+
+// 使用通行密钥完成两步验证
+export const getPasskeyMFAOptions = async (mfaToken: string) => {
+  const response = await apiClient.post<ApiResponse<any>>('/api/auth/mfa/webauthn/options', {
+    mfa_token: mfaToken,
+  });
+  return response.data;
+};
+
+export const passkeyMFA = async (mfaToken: string, credential: any) => {
+  const response = await apiClient.post<ApiResponse<LoginResponse>>('/api/auth/mfa/webauthn', {
+    mfa_token: mfaToken,
+    credential,
   });
   return response.data;
 };
 
+// 注册通行密钥（需要登录）
+export const getPasskeyRegistrationOptions = async () => {
+  const response = await apiClient.post<ApiResponse<any>>('/api/auth/webauthn/register/options', {});
+  return response.data;
+};
+
+export const registerPasskey = async (credential: any, name?: string) => {
+  const response = await apiClient.post<ApiResponse>('/api/auth/webauthn/register', { credential, name });
+  return response.data;
+};
+
 // 获取当前用户信息
 export const getCurrentUser = async () => {
   const response = await apiClient.get<ApiResponse<User>>('/api/auth/me');
   return response.data;
 };
 
+// 授权确认结果
+export interface ConsentDecisionResponse {
+  redirect_url: string;
+}
+
+// 提交授权确认（query 为授权请求的原始参数）
+export const submitConsent = async (query: string, approve: boolean) => {
+  const response = await apiClient.post<ApiResponse<ConsentDecisionResponse>>(
+    `/oauth/consent?${query}`,
+    { approve }
+  );
+  return response.data;
+};
+
 // 健康检查
 export const healthCheck = async () => {
   const response = await apiClient.get<ApiResponse>('/health');
@@ -1,4 +1,4 @@
-import { User } from './api';
+import apiClient, { User } from './api';
 
 // 存储 Token 到 localStorage
 export const setToken = (token: string) => {
@@ -58,7 +58,13 @@ export const isAuthenticated = (): boolean => {
 };
 
 // 登出
-export const logout = () => {
+export const logout = async () => {
+  // 通知后端撤销当前会话（失败时也要清除本地登录状态）
+  try {
+    await apiClient.post('/api/auth/logout');
+  } catch (e) {
+    console.error('退出登录失败:', e);
+  }
   removeToken();
   removeUser();
   if (typeof window !== 'undefined') {
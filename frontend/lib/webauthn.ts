@@ -0,0 +1,60 @@
+// 通行密钥（WebAuthn）浏览器端工具：服务端选项和凭证中的二进制字段均为 Base64URL 编码
+
+// Base64URL 解码为字节
+const decode = (value: string): Uint8Array =>
+  Uint8Array.from(atob(value.replace(/-/g, '+').replace(/_/g, '/')), (c) => c.charCodeAt(0));
+
+// 字节编码为 Base64URL（无填充）
+const encode = (buffer: ArrayBuffer): string =>
+  btoa(String.fromCharCode(...Array.from(new Uint8Array(buffer))))
+    .replace(/\+/g, '-')
+    .replace(/\//g, '_')
+    .replace(/=+$/, '');
+
+// 浏览器是否支持通行密钥
+export const passkeySupported = () =>
+  typeof window !== 'undefined' && typeof window.PublicKeyCredential !== 'undefined';
+
+// 创建通行密钥（options 为 /api/auth/webauthn/register/options 的响应）
+export const createPasskey = async (options: any) => {
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: decode(options.challenge),
+      user: { ...options.user, id: decode(options.user.id) },
+      excludeCredentials: (options.excludeCredentials || []).map((c: any) => ({ ...c, id: decode(c.id) })),
+    },
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    type: credential.type,
+    response: {
+      clientDataJSON: encode(response.clientDataJSON),
+      attestationObject: encode(response.attestationObject),
+      transports: response.getTransports ? response.getTransports() : [],
+    },
+  };
+};
+
+// 使用通行密钥签名（options 为登录或两步验证选项接口的响应）
+export const getPasskey = async (options: any) => {
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: decode(options.challenge),
+      allowCredentials: (options.allowCredentials || []).map((c: any) => ({ ...c, id: decode(c.id) })),
+    },
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    type: credential.type,
+    response: {
+      clientDataJSON: encode(response.clientDataJSON),
+      authenticatorData: encode(response.authenticatorData),
+      signature: encode(response.signature),
+      userHandle: response.userHandle ? encode(response.userHandle) : '',
+    },
+  };
+};